@@ -0,0 +1,165 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/db"
+)
+
+// BroadcastExpiry is the time for which the transactions sent by blockbook are remembered and rebroadcasted, 0 disables it
+var BroadcastExpiry = 72 * time.Hour
+
+// storeBroadcast remembers the sent transaction so that it can be rebroadcasted if it disappears from the mempool
+func (w *Worker) storeBroadcast(txid string, txHex string) {
+	if BroadcastExpiry <= 0 {
+		return
+	}
+	now := time.Now().Unix()
+	b, err := w.db.GetBroadcast(txid)
+	if err != nil {
+		glog.Error("GetBroadcast ", txid, ": ", err)
+		return
+	}
+	if b == nil {
+		b = &db.Broadcast{
+			Txid: txid,
+			Tx:   strings.TrimSpace(txHex),
+			Sent: now,
+		}
+	}
+	b.Status = db.BroadcastMempool
+	b.LastBroadcast = now
+	b.Expiry = now + int64(BroadcastExpiry/time.Second)
+	b.LastError = ""
+	if err = w.db.StoreBroadcast(b); err != nil {
+		glog.Error("StoreBroadcast ", txid, ": ", err)
+	}
+}
+
+// updateBroadcastStatus sets the status of the broadcasted transaction according to the mempool and the index
+// confirmed and conflicted transactions are final, their status is not updated
+func (w *Worker) updateBroadcastStatus(b *db.Broadcast) error {
+	if b.Status == db.BroadcastConfirmed || b.Status == db.BroadcastConflicted {
+		return nil
+	}
+	if w.mempool.GetTransactionTime(b.Txid) != 0 {
+		b.Status = db.BroadcastMempool
+		return nil
+	}
+	ta, err := w.db.GetTxAddresses(b.Txid)
+	if err != nil {
+		return errors.Annotatef(err, "GetTxAddresses %v", b.Txid)
+	}
+	if ta != nil {
+		b.Status = db.BroadcastConfirmed
+		b.Height = ta.Height
+		return nil
+	}
+	b.Status = db.BroadcastPending
+	tx, err := w.DecodeTransaction(b.Tx)
+	if err != nil {
+		// the conflicts of the transactions, which cannot be decoded locally, are not detected
+		if apiErr, ok := err.(*APIError); ok && apiErr.Public {
+			return nil
+		}
+		return err
+	}
+	for i := range tx.Problems {
+		p := &tx.Problems[i]
+		if p.Type == TxProblemSpentInput {
+			b.Status = db.BroadcastConflicted
+		} else if p.Type == TxProblemMempoolSpentInput {
+			// the mempool may know the transaction by its inputs only
+			if p.Txid == b.Txid {
+				b.Status = db.BroadcastMempool
+				return nil
+			}
+			b.Status = db.BroadcastConflicted
+			b.ConflictingTxid = p.Txid
+		}
+	}
+	return nil
+}
+
+// RebroadcastTransactions sends again the transactions broadcasted by blockbook, which are neither in mempool nor in a block
+// the expired transactions are removed
+func (w *Worker) RebroadcastTransactions() error {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil
+	}
+	broadcasts, err := w.db.GetBroadcasts()
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	rebroadcasted, removed := 0, 0
+	for _, b := range broadcasts {
+		if b.Expiry <= now {
+			if err = w.db.DeleteBroadcast(b.Txid); err != nil {
+				return err
+			}
+			removed++
+			continue
+		}
+		status := b.Status
+		if err = w.updateBroadcastStatus(b); err != nil {
+			glog.Error("RebroadcastTransactions ", b.Txid, ": ", err)
+			continue
+		}
+		if b.Status == db.BroadcastPending {
+			b.LastBroadcast = now
+			b.Rebroadcasts++
+			if _, err = w.chain.SendRawTransaction(b.Tx); err != nil {
+				b.LastError = err.Error()
+			} else {
+				b.LastError = ""
+				b.Status = db.BroadcastMempool
+			}
+			rebroadcasted++
+		} else if b.Status == status {
+			continue
+		}
+		if err = w.db.StoreBroadcast(b); err != nil {
+			return err
+		}
+	}
+	if rebroadcasted > 0 || removed > 0 {
+		glog.Info("RebroadcastTransactions: ", rebroadcasted, " rebroadcasted, ", removed, " expired of ", len(broadcasts), " transactions")
+	}
+	return nil
+}
+
+// GetBroadcast returns the status of the transaction broadcasted by blockbook
+func (w *Worker) GetBroadcast(txid string) (*BroadcastInfo, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, NewAPIError("Broadcasts are not supported for this coin", true)
+	}
+	if _, err := w.chainParser.PackTxid(txid); err != nil {
+		return nil, NewAPIError("Invalid txid", true)
+	}
+	b, err := w.db.GetBroadcast(txid)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBroadcast %v", txid)
+	}
+	if b == nil {
+		return nil, NewAPIError("Broadcast of transaction "+txid+" not found", true)
+	}
+	if err = w.updateBroadcastStatus(b); err != nil {
+		return nil, err
+	}
+	return &BroadcastInfo{
+		Txid:            b.Txid,
+		Status:          b.Status.String(),
+		Sent:            b.Sent,
+		LastBroadcast:   b.LastBroadcast,
+		Expiry:          b.Expiry,
+		Rebroadcasts:    b.Rebroadcasts,
+		BlockHeight:     b.Height,
+		ConflictingTxid: b.ConflictingTxid,
+		LastError:       b.LastError,
+	}, nil
+}
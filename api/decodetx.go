@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// types of problems found in decoded transactions
+const (
+	TxProblemKnownTransaction  = "knownTransaction"
+	TxProblemMissingInput      = "missingInput"
+	TxProblemSpentInput        = "spentInput"
+	TxProblemMempoolSpentInput = "mempoolSpentInput"
+	TxProblemDustOutput        = "dustOutput"
+	TxProblemNonStandardScript = "nonStandardScript"
+	TxProblemAbsurdFee         = "absurdFee"
+)
+
+const opReturn = 0x6a
+
+// isWitnessProgram returns true if the output script is a segwit witness program (BIP141)
+func isWitnessProgram(script []byte) bool {
+	if len(script) < 4 || len(script) > 42 {
+		return false
+	}
+	if script[0] != 0 && (script[0] < 0x51 || script[0] > 0x60) {
+		return false
+	}
+	return int(script[1]) == len(script)-2
+}
+
+// dustThreshold returns the minimal value of the output which is not considered dust
+// the same computation as in bitcoind, it is the fee for the output and for the input spending it at dustRelayFeePerKb
+// OP_RETURN outputs are unspendable and never dust
+func dustThreshold(script []byte, dustRelayFeePerKb int64) int64 {
+	if len(script) > 0 && script[0] == opReturn {
+		return 0
+	}
+	// value, script length and script
+	size := 8 + varIntSize(len(script)) + len(script)
+	if isWitnessProgram(script) {
+		// outpoint, empty script, sequence and witness discounted by the witness scale factor
+		size += 32 + 4 + 1 + 107/4 + 4
+	} else {
+		// outpoint, script with signature and public key and sequence
+		size += 32 + 4 + 1 + 107 + 4
+	}
+	return int64(size) * dustRelayFeePerKb / 1000
+}
+
+// txRelayPolicy returns the relay policy of the backend, the checks are disabled if the backend does not provide it
+func (w *Worker) txRelayPolicy() *bchain.TxRelayPolicy {
+	if g, ok := w.chain.(bchain.TxRelayPolicyGetter); ok {
+		if p := g.GetTxRelayPolicy(); p != nil {
+			return p
+		}
+	}
+	return &bchain.TxRelayPolicy{}
+}
+
+func newTxProblem(problemType string, input, output int, format string, a ...interface{}) TxProblem {
+	p := TxProblem{
+		Type:    problemType,
+		Message: fmt.Sprintf(format, a...),
+	}
+	if input >= 0 {
+		p.Input = &input
+	}
+	if output >= 0 {
+		p.Output = &output
+	}
+	return p
+}
+
+// mempoolSpendingTxid returns txid of the mempool transaction spending output vout of transaction txid
+// the output is looked up in the mempool transactions of its address, empty string is returned if it is not spent in mempool
+func (w *Worker) mempoolSpendingTxid(addrDesc bchain.AddressDescriptor, txid string, vout uint32) (string, error) {
+	if len(addrDesc) == 0 {
+		return "", nil
+	}
+	outpoints, err := w.mempool.GetAddrDescTransactions(addrDesc)
+	if err != nil {
+		return "", errors.Annotatef(err, "GetAddrDescTransactions %v", addrDesc)
+	}
+	for _, o := range outpoints {
+		// inputs are stored in mempool as negative vout
+		if o.Vout >= 0 || uint32(^o.Vout) != vout {
+			continue
+		}
+		tx, _, err := w.txCache.GetTransaction(o.Txid)
+		if err != nil {
+			if err == bchain.ErrTxNotFound {
+				continue
+			}
+			return "", errors.Annotatef(err, "txCache.GetTransaction %v", o.Txid)
+		}
+		for i := range tx.Vin {
+			if tx.Vin[i].Txid == txid && tx.Vin[i].Vout == vout {
+				return o.Txid, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// DecodeTransaction parses transaction from hex, resolves its inputs from index and mempool and checks it for problems
+func (w *Worker) DecodeTransaction(txHex string) (*DecodedTx, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, NewAPIError("Decoding of transactions is not supported for this coin", true)
+	}
+	b, err := hex.DecodeString(strings.TrimSpace(txHex))
+	if err != nil || len(b) == 0 {
+		return nil, NewAPIError("Invalid transaction hex", true)
+	}
+	bchainTx, err := w.chainParser.ParseTx(b)
+	if err != nil {
+		return nil, NewAPIError(fmt.Sprintf("Cannot parse transaction, %v", err), true)
+	}
+	tx, err := w.getTransactionFromBchainTx(bchainTx, 0, false, false, true)
+	if err != nil {
+		return nil, err
+	}
+	vsize := int64(len(b))
+	if p, ok := w.chainParser.(bchain.TxVSizeParser); ok {
+		if vsize, err = p.GetTxVSize(bchainTx); err != nil {
+			return nil, errors.Annotatef(err, "GetTxVSize %v", tx.Txid)
+		}
+	}
+	r := &DecodedTx{
+		Tx:       tx,
+		VSize:    vsize,
+		FeePerKb: feePerKb((*big.Int)(tx.FeesSat), vsize),
+	}
+	known := false
+	if w.mempool.GetTransactionTime(tx.Txid) != 0 {
+		known = true
+		r.Problems = append(r.Problems, newTxProblem(TxProblemKnownTransaction, -1, -1, "Transaction is already in mempool"))
+	} else {
+		ta, err := w.db.GetTxAddresses(tx.Txid)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetTxAddresses %v", tx.Txid)
+		}
+		if ta != nil {
+			known = true
+			r.Problems = append(r.Problems, newTxProblem(TxProblemKnownTransaction, -1, -1, "Transaction is already confirmed in block %v", ta.Height))
+		}
+	}
+	allInputsKnown := true
+	for i := range tx.Vin {
+		vin := &tx.Vin[i]
+		// coinbase input
+		if vin.Txid == "" {
+			continue
+		}
+		if vin.ValueSat == nil {
+			allInputsKnown = false
+			r.Problems = append(r.Problems, newTxProblem(TxProblemMissingInput, i, -1, "Input spends unknown output %v:%v", vin.Txid, vin.Vout))
+			continue
+		}
+		// the inputs of already known transaction are spent by the transaction itself
+		if known {
+			continue
+		}
+		ta, err := w.db.GetTxAddresses(vin.Txid)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetTxAddresses %v", vin.Txid)
+		}
+		if ta != nil && len(ta.Outputs) > int(vin.Vout) && ta.Outputs[vin.Vout].Spent {
+			r.Problems = append(r.Problems, newTxProblem(TxProblemSpentInput, i, -1, "Input spends already spent output %v:%v", vin.Txid, vin.Vout))
+			continue
+		}
+		spendingTxid, err := w.mempoolSpendingTxid(vin.AddrDesc, vin.Txid, vin.Vout)
+		if err != nil {
+			return nil, err
+		}
+		if spendingTxid != "" {
+			p := newTxProblem(TxProblemMempoolSpentInput, i, -1, "Input spends output %v:%v already spent by mempool transaction %v", vin.Txid, vin.Vout, spendingTxid)
+			p.Txid = spendingTxid
+			r.Problems = append(r.Problems, p)
+		}
+	}
+	policy := w.txRelayPolicy()
+	for i := range bchainTx.Vout {
+		script, err := hex.DecodeString(bchainTx.Vout[i].ScriptPubKey.Hex)
+		if err != nil {
+			return nil, errors.Annotatef(err, "output %v", i)
+		}
+		if !w.chainParser.IsAddrDescStandard(script) {
+			r.Problems = append(r.Problems, newTxProblem(TxProblemNonStandardScript, -1, i, "Output script is not standard"))
+		}
+		if threshold := dustThreshold(script, policy.DustRelayFeePerKb); bchainTx.Vout[i].ValueSat.Cmp(big.NewInt(threshold)) < 0 {
+			r.Problems = append(r.Problems, newTxProblem(TxProblemDustOutput, -1, i, "Output value is below the dust threshold %v", threshold))
+		}
+	}
+	if allInputsKnown && policy.MaxFeePerKb > 0 && r.FeePerKb > policy.MaxFeePerKb {
+		r.Problems = append(r.Problems, newTxProblem(TxProblemAbsurdFee, -1, -1, "Fee rate %v sat/vB is above the limit %v sat/vB", r.FeePerKb/1000, policy.MaxFeePerKb/1000))
+	}
+	return r, nil
+}
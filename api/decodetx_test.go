@@ -0,0 +1,37 @@
+//go:build unittest
+
+package api
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func Test_dustThreshold(t *testing.T) {
+	tests := []struct {
+		name              string
+		script            string
+		dustRelayFeePerKb int64
+		want              int64
+	}{
+		{name: "P2PKH", script: "76a914a2a5f3a7f0f7d2e7d7b5a1a9b2b6c5d4e3f2a1b088ac", dustRelayFeePerKb: 3000, want: 546},
+		{name: "P2SH", script: "a9146144d57c8aff48492c9dfb914e120b20bad72d6f87", dustRelayFeePerKb: 3000, want: 540},
+		{name: "P2WPKH", script: "0014a2a5f3a7f0f7d2e7d7b5a1a9b2b6c5d4e3f2a1b0", dustRelayFeePerKb: 3000, want: 294},
+		{name: "P2WSH", script: "0020a2a5f3a7f0f7d2e7d7b5a1a9b2b6c5d4e3f2a1b0a2a5f3a7f0f7d2e7d7b5a1a9", dustRelayFeePerKb: 3000, want: 330},
+		{name: "P2TR", script: "5120a2a5f3a7f0f7d2e7d7b5a1a9b2b6c5d4e3f2a1b0a2a5f3a7f0f7d2e7d7b5a1a9", dustRelayFeePerKb: 3000, want: 330},
+		{name: "OP_RETURN", script: "6a0568656c6c6f", dustRelayFeePerKb: 3000, want: 0},
+		{name: "P2PKH lower dust relay fee", script: "76a914a2a5f3a7f0f7d2e7d7b5a1a9b2b6c5d4e3f2a1b088ac", dustRelayFeePerKb: 1000, want: 182},
+		{name: "P2PKH check disabled", script: "76a914a2a5f3a7f0f7d2e7d7b5a1a9b2b6c5d4e3f2a1b088ac", dustRelayFeePerKb: 0, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := hex.DecodeString(tt.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := dustThreshold(script, tt.dustRelayFeePerKb); got != tt.want {
+				t.Errorf("dustThreshold() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// maximal number of headers returned in one request, the same as in the getheaders message of the bitcoin p2p protocol
+const maxBlockHeaders = 2000
+
+// getBlockHeaders returns the raw headers of up to count blocks starting at height from
+// the headers are read from the index only, the count is limited by maxBlockHeaders and by the best indexed block
+func (w *Worker) getBlockHeaders(from uint32, count int) ([][]byte, error) {
+	if count <= 0 {
+		return nil, NewAPIError("Parameter 'count' must be a positive number", true)
+	}
+	if count > maxBlockHeaders {
+		count = maxBlockHeaders
+	}
+	bestHeight, _, err := w.db.GetBestBlock()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestBlock")
+	}
+	if from > bestHeight {
+		return nil, NewAPIError(fmt.Sprintf("Block %v is above the best block %v", from, bestHeight), true)
+	}
+	if uint64(from)+uint64(count) > uint64(bestHeight)+1 {
+		count = int(bestHeight - from + 1)
+	}
+	headers, err := w.db.GetBlockHeaders(from, count)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockHeaders %v %v", from, count)
+	}
+	if len(headers) < count {
+		// the headers of the blocks indexed before they were stored are filled by the db migration
+		return nil, NewAPIError(fmt.Sprintf("Header of block %v is not stored in the index", from+uint32(len(headers))), true)
+	}
+	return headers, nil
+}
+
+// GetBlockHeaders returns the headers of up to count blocks starting at height from without calling the backend
+// the headers are hex encoded raw headers for Bitcoin-type coins and json objects for Ethereum-type coins
+func (w *Worker) GetBlockHeaders(from uint32, count int) (*BlockHeaders, error) {
+	headers, err := w.getBlockHeaders(from, count)
+	if err != nil {
+		return nil, err
+	}
+	r := &BlockHeaders{
+		From:    from,
+		Count:   len(headers),
+		Headers: make([]json.RawMessage, len(headers)),
+	}
+	for i := range headers {
+		if w.chainType == bchain.ChainBitcoinType {
+			r.Headers[i] = json.RawMessage(`"` + hex.EncodeToString(headers[i]) + `"`)
+		} else {
+			r.Headers[i] = headers[i]
+		}
+	}
+	return r, nil
+}
+
+// GetBlockHeadersBinary returns the concatenated raw headers of up to count blocks starting at height from, only for Bitcoin-type coins
+func (w *Worker) GetBlockHeadersBinary(from uint32, count int) ([]byte, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, NewAPIError("Binary headers are not supported for this coin", true)
+	}
+	headers, err := w.getBlockHeaders(from, count)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	for i := range headers {
+		b = append(b, headers[i]...)
+	}
+	return b, nil
+}
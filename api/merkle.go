@@ -0,0 +1,478 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+)
+
+const (
+	blockHeaderSize = 80
+	// offset of the merkle root in the serialized block header
+	blockHeaderMerkleRootOffset = 36
+	// the number of transactions in the serialized proof is limited by the minimal size of transaction in the maximal block
+	maxMerkleProofTxs = 4000000 / 60
+)
+
+type merkleHash [32]byte
+
+func doubleSha256(b []byte) merkleHash {
+	h := sha256.Sum256(b)
+	return sha256.Sum256(h[:])
+}
+
+func merkleParent(left, right merkleHash) merkleHash {
+	var b [64]byte
+	copy(b[:32], left[:])
+	copy(b[32:], right[:])
+	return doubleSha256(b[:])
+}
+
+// merkleHashFromHex converts hash in the displayed (reversed) byte order to the internal byte order
+func merkleHashFromHex(s string) (merkleHash, error) {
+	var h merkleHash
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(h) {
+		return h, errors.Errorf("Invalid hash %v", s)
+	}
+	for i := range b {
+		h[i] = b[len(b)-1-i]
+	}
+	return h, nil
+}
+
+// String returns the hash in the displayed (reversed) byte order
+func (h merkleHash) String() string {
+	var b merkleHash
+	for i := range h {
+		b[i] = h[len(h)-1-i]
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// merkleBranch returns the branch of hashes connecting the leaf at position pos to the merkle root and the root
+// the last hash of the level with odd number of hashes is paired with itself
+func merkleBranch(leaves []merkleHash, pos int) ([]merkleHash, merkleHash) {
+	level := make([]merkleHash, len(leaves))
+	copy(level, leaves)
+	var branch []merkleHash
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, level[pos^1])
+		next := make([]merkleHash, len(level)/2)
+		for i := range next {
+			next[i] = merkleParent(level[2*i], level[2*i+1])
+		}
+		level = next
+		pos /= 2
+	}
+	return branch, level[0]
+}
+
+// merkleRootFromBranch computes the merkle root from the leaf at position pos and its branch
+func merkleRootFromBranch(leaf merkleHash, branch []merkleHash, pos int) merkleHash {
+	h := leaf
+	for _, b := range branch {
+		if pos&1 == 0 {
+			h = merkleParent(h, b)
+		} else {
+			h = merkleParent(b, h)
+		}
+		pos >>= 1
+	}
+	return h
+}
+
+// partialMerkleTree is the partial merkle tree (BIP37) used in the proofs of bitcoind gettxoutproof
+type partialMerkleTree struct {
+	txs    int
+	hashes []merkleHash
+	bits   []bool
+}
+
+func partialMerkleTreeWidth(txs int, height int) int {
+	return (txs + (1 << uint(height)) - 1) >> uint(height)
+}
+
+func partialMerkleTreeHeight(txs int) int {
+	height := 0
+	for partialMerkleTreeWidth(txs, height) > 1 {
+		height++
+	}
+	return height
+}
+
+func partialMerkleTreeHash(leaves []merkleHash, height, pos int) merkleHash {
+	if height == 0 {
+		return leaves[pos]
+	}
+	left := partialMerkleTreeHash(leaves, height-1, 2*pos)
+	right := left
+	if 2*pos+1 < partialMerkleTreeWidth(len(leaves), height-1) {
+		right = partialMerkleTreeHash(leaves, height-1, 2*pos+1)
+	}
+	return merkleParent(left, right)
+}
+
+// newPartialMerkleTree builds the partial merkle tree matching the leaves at the given positions
+func newPartialMerkleTree(leaves []merkleHash, matches map[int]bool) *partialMerkleTree {
+	t := &partialMerkleTree{txs: len(leaves)}
+	var traverse func(height, pos int)
+	traverse = func(height, pos int) {
+		parentOfMatch := false
+		for p := pos << uint(height); p < (pos+1)<<uint(height) && p < len(leaves); p++ {
+			if matches[p] {
+				parentOfMatch = true
+				break
+			}
+		}
+		t.bits = append(t.bits, parentOfMatch)
+		if height == 0 || !parentOfMatch {
+			t.hashes = append(t.hashes, partialMerkleTreeHash(leaves, height, pos))
+			return
+		}
+		traverse(height-1, 2*pos)
+		if 2*pos+1 < partialMerkleTreeWidth(len(leaves), height-1) {
+			traverse(height-1, 2*pos+1)
+		}
+	}
+	traverse(partialMerkleTreeHeight(len(leaves)), 0)
+	return t
+}
+
+// extractMatches returns the merkle root of the tree and the matched leaves and their positions
+func (t *partialMerkleTree) extractMatches() (merkleHash, []merkleHash, []int, error) {
+	var root merkleHash
+	if t.txs == 0 || t.txs > maxMerkleProofTxs {
+		return root, nil, nil, errors.New("Invalid number of transactions")
+	}
+	if len(t.hashes) > t.txs {
+		return root, nil, nil, errors.New("More hashes than transactions")
+	}
+	if len(t.bits) < len(t.hashes) {
+		return root, nil, nil, errors.New("Fewer flag bits than hashes")
+	}
+	var matches []merkleHash
+	var positions []int
+	bitsUsed, hashesUsed := 0, 0
+	var traverse func(height, pos int) (merkleHash, error)
+	traverse = func(height, pos int) (merkleHash, error) {
+		if bitsUsed >= len(t.bits) {
+			return merkleHash{}, errors.New("Not enough flag bits")
+		}
+		parentOfMatch := t.bits[bitsUsed]
+		bitsUsed++
+		if height == 0 || !parentOfMatch {
+			if hashesUsed >= len(t.hashes) {
+				return merkleHash{}, errors.New("Not enough hashes")
+			}
+			h := t.hashes[hashesUsed]
+			hashesUsed++
+			if height == 0 && parentOfMatch {
+				matches = append(matches, h)
+				positions = append(positions, pos)
+			}
+			return h, nil
+		}
+		left, err := traverse(height-1, 2*pos)
+		if err != nil {
+			return left, err
+		}
+		right := left
+		if 2*pos+1 < partialMerkleTreeWidth(t.txs, height-1) {
+			if right, err = traverse(height-1, 2*pos+1); err != nil {
+				return right, err
+			}
+			// identical siblings would allow to prove a duplicated transaction (CVE-2012-2459)
+			if right == left {
+				return right, errors.New("Identical hashes of siblings")
+			}
+		}
+		return merkleParent(left, right), nil
+	}
+	root, err := traverse(partialMerkleTreeHeight(t.txs), 0)
+	if err != nil {
+		return root, nil, nil, err
+	}
+	if (bitsUsed+7)/8 != (len(t.bits)+7)/8 || hashesUsed != len(t.hashes) {
+		return root, nil, nil, errors.New("Not all hashes or flag bits consumed")
+	}
+	return root, matches, positions, nil
+}
+
+func writeCompactSize(buf *bytes.Buffer, n uint64) {
+	var b [9]byte
+	switch {
+	case n < 0xfd:
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		b[0] = 0xfd
+		binary.LittleEndian.PutUint16(b[1:], uint16(n))
+		buf.Write(b[:3])
+	case n <= 0xffffffff:
+		b[0] = 0xfe
+		binary.LittleEndian.PutUint32(b[1:], uint32(n))
+		buf.Write(b[:5])
+	default:
+		b[0] = 0xff
+		binary.LittleEndian.PutUint64(b[1:], n)
+		buf.Write(b[:9])
+	}
+}
+
+func readCompactSize(b []byte) (uint64, int, error) {
+	if len(b) < 1 {
+		return 0, 0, errors.New("Unexpected end of data")
+	}
+	var l int
+	switch b[0] {
+	case 0xfd:
+		l = 2
+	case 0xfe:
+		l = 4
+	case 0xff:
+		l = 8
+	default:
+		return uint64(b[0]), 1, nil
+	}
+	if len(b) < 1+l {
+		return 0, 0, errors.New("Unexpected end of data")
+	}
+	var n uint64
+	for i := l; i > 0; i-- {
+		n = n<<8 | uint64(b[i])
+	}
+	return n, 1 + l, nil
+}
+
+// serializeMerkleBlock serializes the block header and the partial merkle tree in the format of bitcoind gettxoutproof
+func serializeMerkleBlock(header []byte, t *partialMerkleTree) []byte {
+	var buf bytes.Buffer
+	buf.Write(header)
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(t.txs))
+	buf.Write(b[:])
+	writeCompactSize(&buf, uint64(len(t.hashes)))
+	for i := range t.hashes {
+		buf.Write(t.hashes[i][:])
+	}
+	flags := make([]byte, (len(t.bits)+7)/8)
+	for i, bit := range t.bits {
+		if bit {
+			flags[i/8] |= 1 << uint(i%8)
+		}
+	}
+	writeCompactSize(&buf, uint64(len(flags)))
+	buf.Write(flags)
+	return buf.Bytes()
+}
+
+// parseMerkleBlock parses the proof in the format of bitcoind gettxoutproof to the block header and the partial merkle tree
+func parseMerkleBlock(b []byte) ([]byte, *partialMerkleTree, error) {
+	if len(b) < blockHeaderSize+4 {
+		return nil, nil, errors.New("Unexpected end of data")
+	}
+	header := b[:blockHeaderSize]
+	t := &partialMerkleTree{txs: int(binary.LittleEndian.Uint32(b[blockHeaderSize:]))}
+	b = b[blockHeaderSize+4:]
+	n, l, err := readCompactSize(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	b = b[l:]
+	if n > uint64(len(b)/32) {
+		return nil, nil, errors.New("Unexpected end of data")
+	}
+	t.hashes = make([]merkleHash, n)
+	for i := range t.hashes {
+		copy(t.hashes[i][:], b[:32])
+		b = b[32:]
+	}
+	if n, l, err = readCompactSize(b); err != nil {
+		return nil, nil, err
+	}
+	b = b[l:]
+	if n != uint64(len(b)) {
+		return nil, nil, errors.New("Invalid length of flag bits")
+	}
+	t.bits = make([]bool, 8*len(b))
+	for i := range t.bits {
+		t.bits[i] = b[i/8]&(1<<uint(i%8)) != 0
+	}
+	return header, t, nil
+}
+
+// blockHeaderFromBlockInfo reconstructs the serialized header of the block from its info returned by the backend
+// it returns nil if the backend does not report the header fields or if the header of the coin has a different format,
+// which is detected by the mismatch of the block hash
+func blockHeaderFromBlockInfo(bi *bchain.BlockInfo) ([]byte, error) {
+	if bi.Version == "" || bi.Bits == "" {
+		return nil, nil
+	}
+	version, err := strconv.ParseInt(string(bi.Version), 10, 64)
+	if err != nil {
+		return nil, errors.Annotatef(err, "version %v", bi.Version)
+	}
+	var prev merkleHash
+	if bi.Prev != "" {
+		if prev, err = merkleHashFromHex(bi.Prev); err != nil {
+			return nil, err
+		}
+	}
+	root, err := merkleHashFromHex(bi.MerkleRoot)
+	if err != nil {
+		return nil, err
+	}
+	bits, err := strconv.ParseUint(bi.Bits, 16, 32)
+	if err != nil {
+		return nil, errors.Annotatef(err, "bits %v", bi.Bits)
+	}
+	nonce, err := strconv.ParseUint(string(bi.Nonce), 10, 32)
+	if err != nil {
+		return nil, errors.Annotatef(err, "nonce %v", bi.Nonce)
+	}
+	header := make([]byte, blockHeaderSize)
+	binary.LittleEndian.PutUint32(header, uint32(version))
+	copy(header[4:], prev[:])
+	copy(header[blockHeaderMerkleRootOffset:], root[:])
+	binary.LittleEndian.PutUint32(header[68:], uint32(bi.Time))
+	binary.LittleEndian.PutUint32(header[72:], uint32(bits))
+	binary.LittleEndian.PutUint32(header[76:], uint32(nonce))
+	if doubleSha256(header).String() != bi.Hash {
+		return nil, nil
+	}
+	return header, nil
+}
+
+// GetMerkleProof returns the proof of inclusion of the confirmed transaction in its block
+// the proof is computed from the list of transactions of the block
+func (w *Worker) GetMerkleProof(txid string) (*MerkleProof, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, NewAPIError("Merkle proofs are not supported for this coin", true)
+	}
+	leaf, err := merkleHashFromHex(txid)
+	if err != nil {
+		return nil, NewAPIError("Invalid txid", true)
+	}
+	ta, err := w.db.GetTxAddresses(txid)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetTxAddresses %v", txid)
+	}
+	if ta == nil {
+		if w.mempool.GetTransactionTime(txid) != 0 {
+			return nil, NewAPIError("Transaction "+txid+" is not confirmed", true)
+		}
+		return nil, NewAPIError("Transaction "+txid+" not found", true)
+	}
+	hash, err := w.db.GetBlockHash(ta.Height)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockHash %v", ta.Height)
+	}
+	bi, err := w.chain.GetBlockInfo(hash)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockInfo %v", hash)
+	}
+	pos := -1
+	leaves := make([]merkleHash, len(bi.Txids))
+	for i := range bi.Txids {
+		if leaves[i], err = merkleHashFromHex(bi.Txids[i]); err != nil {
+			return nil, errors.Annotatef(err, "block %v", hash)
+		}
+		if leaves[i] == leaf {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		return nil, errors.Errorf("Transaction %v not found in block %v", txid, hash)
+	}
+	branch, root := merkleBranch(leaves, pos)
+	// the merkle root is checked only if the backend reports it
+	if bi.MerkleRoot != "" && root.String() != bi.MerkleRoot {
+		return nil, errors.Errorf("Computed merkle root %v does not match the merkle root of block %v", root, hash)
+	}
+	r := &MerkleProof{
+		Txid:        txid,
+		BlockHash:   hash,
+		BlockHeight: ta.Height,
+		Pos:         pos,
+		Merkle:      make([]string, len(branch)),
+		MerkleRoot:  root.String(),
+	}
+	for i := range branch {
+		r.Merkle[i] = branch[i].String()
+	}
+	// the header stored in the index is used, the headers of the blocks indexed before they were stored are reconstructed
+	var header []byte
+	headers, err := w.db.GetBlockHeaders(ta.Height, 1)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockHeaders %v", ta.Height)
+	}
+	if len(headers) == 1 {
+		if len(headers[0]) == blockHeaderSize {
+			header = headers[0]
+		}
+	} else if header, err = blockHeaderFromBlockInfo(bi); err != nil {
+		return nil, errors.Annotatef(err, "block %v", hash)
+	}
+	if header != nil {
+		r.Hex = hex.EncodeToString(serializeMerkleBlock(header, newPartialMerkleTree(leaves, map[int]bool{pos: true})))
+	}
+	return r, nil
+}
+
+// VerifyMerkleProof checks the proof in the format of bitcoind gettxoutproof against the indexed block
+func (w *Worker) VerifyMerkleProof(proofHex string) (*MerkleProofVerification, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, NewAPIError("Merkle proofs are not supported for this coin", true)
+	}
+	b, err := hex.DecodeString(strings.TrimSpace(proofHex))
+	if err != nil {
+		return nil, NewAPIError("Invalid proof hex", true)
+	}
+	header, t, err := parseMerkleBlock(b)
+	if err != nil {
+		return nil, NewAPIError("Cannot parse proof, "+err.Error(), true)
+	}
+	root, matches, positions, err := t.extractMatches()
+	if err != nil {
+		return nil, NewAPIError("Invalid proof, "+err.Error(), true)
+	}
+	hash := doubleSha256(header).String()
+	r := &MerkleProofVerification{BlockHash: hash}
+	for i := range matches {
+		r.Txids = append(r.Txids, matches[i].String())
+		r.Positions = append(r.Positions, positions[i])
+	}
+	if !bytes.Equal(root[:], header[blockHeaderMerkleRootOffset:blockHeaderMerkleRootOffset+32]) {
+		r.Error = "Merkle root of the proof does not match the block header"
+		return r, nil
+	}
+	// the index is keyed by height, the height of the block is taken from the backend and checked against the index
+	bh, err := w.chain.GetBlockHeader(hash)
+	if err != nil {
+		if err == bchain.ErrBlockNotFound {
+			r.Error = "Block " + hash + " not found"
+			return r, nil
+		}
+		return nil, errors.Annotatef(err, "GetBlockHeader %v", hash)
+	}
+	indexedHash, err := w.db.GetBlockHash(bh.Height)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockHash %v", bh.Height)
+	}
+	if indexedHash != hash {
+		r.Error = "Block " + hash + " is not in the indexed chain"
+		return r, nil
+	}
+	r.BlockHeight = bh.Height
+	r.Valid = true
+	return r, nil
+}
@@ -0,0 +1,147 @@
+//go:build unittest
+
+package api
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
+)
+
+// bitcoin block 170 with the first transaction spending bitcoins
+var block170 = bchain.BlockInfo{
+	BlockHeader: bchain.BlockHeader{
+		Hash:   "00000000d1145790a8694403d4063f323d499e655c83426834d4ce2f8dd4a2ee",
+		Prev:   "000000002a22cfee1f2c846adbd12b3e183d4f97683f85dad08a79780a84bd55",
+		Height: 170,
+		Time:   1231731025,
+	},
+	Version:    common.JSONNumber("1"),
+	MerkleRoot: "7dac2c5666815c17a3b36427de37bb9d2e2c5ccec3f8633eb91a4205cb4c10ff",
+	Nonce:      common.JSONNumber("1889418792"),
+	Bits:       "1d00ffff",
+	Txids: []string{
+		"b1fea52486ce0c62bb442b530a3f0132b826c74e473d1f2c220bfa78111c5082",
+		"f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16",
+	},
+}
+
+const block170Proof = "0100000055bd840a78798ad0da853f68974f3d183e2bd1db6a842c1feecf222a00000000ff104ccb05421ab93e63f8c3ce5c2c2e9dbb37de2764b3a3175c8166562cac7d51b96a49ffff001d283e9e70020000000282501c1178fa0b222c1f3d474ec726b832013f0a532b44bb620cce8624a5feb1169e1e83e930853391bc6f35f605c6754cfead57cf8387639d3b4096c54f18f40105"
+
+func merkleLeaves(t *testing.T, txids []string) []merkleHash {
+	leaves := make([]merkleHash, len(txids))
+	for i := range txids {
+		var err error
+		if leaves[i], err = merkleHashFromHex(txids[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return leaves
+}
+
+func Test_merkleBranch(t *testing.T) {
+	leaves := merkleLeaves(t, block170.Txids)
+	branch, root := merkleBranch(leaves, 1)
+	if root.String() != block170.MerkleRoot {
+		t.Errorf("merkleBranch() root = %v, want %v", root, block170.MerkleRoot)
+	}
+	if len(branch) != 1 || branch[0].String() != block170.Txids[0] {
+		t.Errorf("merkleBranch() branch = %v, want [%v]", branch, block170.Txids[0])
+	}
+	// odd number of leaves, the last leaf is paired with itself
+	leaves = make([]merkleHash, 7)
+	for i := range leaves {
+		leaves[i] = doubleSha256([]byte{byte(i)})
+	}
+	_, want := merkleBranch(leaves, 0)
+	for pos := range leaves {
+		branch, root := merkleBranch(leaves, pos)
+		if root != want {
+			t.Errorf("merkleBranch(%v) root = %v, want %v", pos, root, want)
+		}
+		if len(branch) != 3 {
+			t.Errorf("merkleBranch(%v) branch length = %v, want 3", pos, len(branch))
+		}
+		if got := merkleRootFromBranch(leaves[pos], branch, pos); got != want {
+			t.Errorf("merkleRootFromBranch(%v) = %v, want %v", pos, got, want)
+		}
+	}
+}
+
+func Test_blockHeaderFromBlockInfo(t *testing.T) {
+	header, err := blockHeaderFromBlockInfo(&block170)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(header); got != block170Proof[:2*blockHeaderSize] {
+		t.Errorf("blockHeaderFromBlockInfo() = %v, want %v", got, block170Proof[:2*blockHeaderSize])
+	}
+	bi := block170
+	bi.Nonce = common.JSONNumber("1")
+	if header, err = blockHeaderFromBlockInfo(&bi); err != nil || header != nil {
+		t.Errorf("blockHeaderFromBlockInfo() = %v, %v, want nil for mismatched hash", header, err)
+	}
+}
+
+func Test_serializeMerkleBlock(t *testing.T) {
+	header, err := blockHeaderFromBlockInfo(&block170)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaves := merkleLeaves(t, block170.Txids)
+	got := hex.EncodeToString(serializeMerkleBlock(header, newPartialMerkleTree(leaves, map[int]bool{1: true})))
+	if got != block170Proof {
+		t.Errorf("serializeMerkleBlock() = %v, want %v", got, block170Proof)
+	}
+}
+
+func Test_partialMerkleTree(t *testing.T) {
+	leaves := make([]merkleHash, 11)
+	for i := range leaves {
+		leaves[i] = doubleSha256([]byte{byte(i)})
+	}
+	_, root := merkleBranch(leaves, 0)
+	header := make([]byte, blockHeaderSize)
+	for _, matches := range []map[int]bool{{0: true}, {10: true}, {3: true, 4: true, 9: true}} {
+		b := serializeMerkleBlock(header, newPartialMerkleTree(leaves, matches))
+		_, pt, err := parseMerkleBlock(b)
+		if err != nil {
+			t.Fatalf("parseMerkleBlock() error = %v", err)
+		}
+		gotRoot, gotMatches, positions, err := pt.extractMatches()
+		if err != nil {
+			t.Fatalf("extractMatches() error = %v", err)
+		}
+		if gotRoot != root {
+			t.Errorf("extractMatches() root = %v, want %v", gotRoot, root)
+		}
+		var wantMatches []merkleHash
+		var wantPositions []int
+		for i := range leaves {
+			if matches[i] {
+				wantMatches = append(wantMatches, leaves[i])
+				wantPositions = append(wantPositions, i)
+			}
+		}
+		if !reflect.DeepEqual(gotMatches, wantMatches) || !reflect.DeepEqual(positions, wantPositions) {
+			t.Errorf("extractMatches() = %v %v, want %v %v", gotMatches, positions, wantMatches, wantPositions)
+		}
+	}
+	// the proof with a truncated hash is rejected
+	b, _ := hex.DecodeString(block170Proof)
+	if _, _, err := parseMerkleBlock(b[:len(b)-10]); err == nil {
+		t.Error("parseMerkleBlock() expected error for truncated proof")
+	}
+	// duplicated sibling hashes are rejected
+	_, pt, err := parseMerkleBlock(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt.hashes[0] = pt.hashes[1]
+	if _, _, _, err = pt.extractMatches(); err == nil {
+		t.Error("extractMatches() expected error for identical siblings")
+	}
+}
@@ -0,0 +1,335 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// the transaction size estimation in weight units (BIP141), the non witness data have weight 4 per byte, the witness data 1 per byte
+const (
+	// version, the number of inputs and outputs and locktime plus the segwit marker and flag
+	txOverheadWeight = 4*(4+1+1+4) + 2
+	// outpoint and sequence
+	txInputBaseSize = 32 + 4 + 4
+	// push of DER signature with sighash type
+	signatureSize = 1 + 72
+	// push of compressed public key
+	pubKeySize = 1 + 33
+	// the dust limit of the change output is computed using this fee rate in satoshis per vbyte
+	dustRelayFeeRate = 3
+	// limit of the number of tries of the branch and bound coin selection
+	maxBnBTries = 100000
+)
+
+const (
+	coinSelectionBnB          = "branch-and-bound"
+	coinSelectionLargestFirst = "largest-first"
+)
+
+func varIntSize(n int) int {
+	if n < 0xfd {
+		return 1
+	}
+	if n <= 0xffff {
+		return 3
+	}
+	return 5
+}
+
+func pushDataSize(n int) int {
+	if n < 76 {
+		return 1 + n
+	}
+	if n <= 0xff {
+		return 2 + n
+	}
+	return 3 + n
+}
+
+func nonWitnessInputWeight(scriptSigSize int) int {
+	return 4 * (txInputBaseSize + varIntSize(scriptSigSize) + scriptSigSize)
+}
+
+// xpubInputWeight returns the estimated weight of the input spending an address derived from the descriptor
+func xpubInputWeight(xd *bchain.XpubDescriptor) (int, error) {
+	switch xd.Type {
+	case bchain.P2PKH:
+		return nonWitnessInputWeight(signatureSize + pubKeySize), nil
+	case bchain.P2SHWPKH:
+		return nonWitnessInputWeight(pushDataSize(22)) + 1 + signatureSize + pubKeySize, nil
+	case bchain.P2WPKH:
+		return nonWitnessInputWeight(0) + 1 + signatureSize + pubKeySize, nil
+	case bchain.P2SH, bchain.P2SHWSH, bchain.P2WSH:
+		keys := len(xd.ExtKeys)
+		// <threshold> <pubKey>... <number of pubKeys> OP_CHECKMULTISIG, the numbers above 16 are pushed as data
+		script := 1 + keys*pubKeySize + 1 + 1
+		if xd.Threshold > 16 {
+			script++
+		}
+		if keys > 16 {
+			script++
+		}
+		// OP_0 required by the bug in OP_CHECKMULTISIG and the signatures
+		sigs := 1 + xd.Threshold*signatureSize
+		if xd.Type == bchain.P2SH {
+			return nonWitnessInputWeight(sigs + pushDataSize(script)), nil
+		}
+		witness := varIntSize(xd.Threshold+2) + sigs + varIntSize(script) + script
+		if xd.Type == bchain.P2SHWSH {
+			return nonWitnessInputWeight(pushDataSize(34)) + witness, nil
+		}
+		return nonWitnessInputWeight(0) + witness, nil
+	}
+	return 0, NewAPIError("PSBT is not supported for this type of xpub descriptor", true)
+}
+
+func outputWeight(addrDesc bchain.AddressDescriptor) int {
+	return 4 * (8 + varIntSize(len(addrDesc)) + len(addrDesc))
+}
+
+// feeForWeight returns the fee in satoshis for the given weight and fee rate in satoshis per vbyte
+func feeForWeight(weight int, feeRate float64) int64 {
+	return int64(math.Ceil(float64(weight) * feeRate / 4))
+}
+
+type psbtCoin struct {
+	utxo           *Utxo
+	value          int64
+	effectiveValue int64 // value minus the fee for spending the coin
+}
+
+// selectCoinsBnB finds the set of coins with the effective value between target and target+costOfChange, which does not need the change output
+// the coins must be sorted by the effective value in descending order, it returns the indexes of the coins with the smallest excess or nil
+func selectCoinsBnB(coins []psbtCoin, target, costOfChange int64) []int {
+	var available int64
+	for i := range coins {
+		available += coins[i].effectiveValue
+	}
+	if available < target {
+		return nil
+	}
+	var best []int
+	bestExcess := int64(-1)
+	selected := make([]int, 0, len(coins))
+	tries := 0
+	var search func(i int, value, remaining int64)
+	search = func(i int, value, remaining int64) {
+		if tries >= maxBnBTries || bestExcess == 0 {
+			return
+		}
+		tries++
+		if value > target+costOfChange || value+remaining < target {
+			return
+		}
+		if value >= target {
+			if excess := value - target; bestExcess < 0 || excess < bestExcess {
+				best = append(best[:0], selected...)
+				bestExcess = excess
+			}
+			return
+		}
+		if i >= len(coins) {
+			return
+		}
+		remaining -= coins[i].effectiveValue
+		// try first the branch including the coin, then the branch omitting it
+		selected = append(selected, i)
+		search(i+1, value+coins[i].effectiveValue, remaining)
+		selected = selected[:len(selected)-1]
+		search(i+1, value, remaining)
+	}
+	search(0, 0, available)
+	return best
+}
+
+// selectCoinsLargestFirst selects the coins in descending order of the effective value until the target is reached
+func selectCoinsLargestFirst(coins []psbtCoin, target int64) []int {
+	var value int64
+	for i := range coins {
+		value += coins[i].effectiveValue
+		if value >= target {
+			r := make([]int, i+1)
+			for j := range r {
+				r[j] = j
+			}
+			return r
+		}
+	}
+	return nil
+}
+
+// xpubUtxoChangeIndex returns the change and the index of the address of the utxo from its derivation path
+func xpubUtxoChangeIndex(xd *bchain.XpubDescriptor, path string) (uint32, uint32, error) {
+	p := strings.Split(path, "/")
+	if len(p) >= 2 {
+		// the change part of the utxo path is the position of the change in the descriptor
+		ci, errc := strconv.Atoi(p[len(p)-2])
+		index, erri := strconv.ParseUint(p[len(p)-1], 10, 31)
+		if errc == nil && erri == nil && ci >= 0 && ci < len(xd.ChangeIndexes) {
+			return xd.ChangeIndexes[ci], uint32(index), nil
+		}
+	}
+	return 0, 0, errors.Errorf("Cannot parse xpub path %s", path)
+}
+
+// CreateXpubPsbt creates unsigned PSBT paying to the requested outputs from the utxos of xpub with the given fee rate
+// the coins are selected by the branch and bound algorithm, which avoids the change output, with largest first fallback
+// the change is sent to the next unused address of the change branch of the descriptor
+func (w *Worker) CreateXpubPsbt(xpub string, request *XpubPsbtRequest, onlyConfirmed bool, gap int) (*XpubPsbt, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, ErrUnsupportedXpub
+	}
+	start := time.Now()
+	if strings.Contains(xpub, xpubListSeparator) {
+		return nil, NewAPIError("PSBT can be created only for a single xpub descriptor", true)
+	}
+	if len(request.Outputs) == 0 {
+		return nil, NewAPIError("Missing outputs", true)
+	}
+	if request.FeeRate <= 0 {
+		return nil, NewAPIError("Invalid fee rate", true)
+	}
+	xd, err := w.chainParser.ParseXpub(xpub)
+	if err != nil {
+		return nil, err
+	}
+	inputWeight, err := xpubInputWeight(xd)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]bchain.XpubPsbtOutput, len(request.Outputs), len(request.Outputs)+1)
+	weight := txOverheadWeight
+	var outputsSat int64
+	for i, o := range request.Outputs {
+		addrDesc, err := w.chainParser.GetAddrDescFromAddress(o.Address)
+		if err != nil {
+			return nil, NewAPIError(fmt.Sprintf("Invalid output address %s", o.Address), true)
+		}
+		value := o.AmountSat.AsBigInt()
+		if value.Sign() <= 0 || !value.IsInt64() {
+			return nil, NewAPIError(fmt.Sprintf("Invalid output value %s", o.AmountSat), true)
+		}
+		outputs[i] = bchain.XpubPsbtOutput{AddrDesc: addrDesc, ValueSat: value}
+		outputsSat += value.Int64()
+		weight += outputWeight(addrDesc)
+	}
+	// the change goes to the second change branch of the descriptor, usually 1, or to the only branch
+	change := int(xd.ChangeIndexes[0])
+	if len(xd.ChangeIndexes) > 1 {
+		change = int(xd.ChangeIndexes[1])
+	}
+	changeAddress, err := w.GetXpubNextUnusedAddress(xpub, change, gap)
+	if err != nil {
+		return nil, err
+	}
+	changeAddrDesc, err := w.chainParser.GetAddrDescFromAddress(changeAddress.Address)
+	if err != nil {
+		return nil, err
+	}
+	changeWeight := outputWeight(changeAddrDesc)
+	utxos, err := w.GetXpubUtxo(xpub, onlyConfirmed, gap)
+	if err != nil {
+		return nil, err
+	}
+	inputFee := feeForWeight(inputWeight, request.FeeRate)
+	coins := make([]psbtCoin, 0, len(utxos))
+	for i := range utxos {
+		value := utxos[i].AmountSat.AsInt64()
+		// skip the coins which cost more to spend than their value
+		if value > inputFee {
+			coins = append(coins, psbtCoin{utxo: &utxos[i], value: value, effectiveValue: value - inputFee})
+		}
+	}
+	sort.SliceStable(coins, func(i, j int) bool { return coins[i].effectiveValue > coins[j].effectiveValue })
+	target := outputsSat + feeForWeight(weight, request.FeeRate)
+	costOfChange := feeForWeight(changeWeight, request.FeeRate) + inputFee
+	coinSelection := coinSelectionBnB
+	selected := selectCoinsBnB(coins, target, costOfChange)
+	if selected == nil {
+		coinSelection = coinSelectionLargestFirst
+		selected = selectCoinsLargestFirst(coins, target)
+		if selected == nil {
+			return nil, NewAPIError("Insufficient funds", true)
+		}
+	}
+	r := XpubPsbt{
+		Inputs:        make(Utxos, len(selected)),
+		CoinSelection: coinSelection,
+	}
+	inputs := make([]bchain.XpubPsbtInput, len(selected))
+	var inputsSat, effectiveSat int64
+	for i, ci := range selected {
+		c := &coins[ci]
+		inputsSat += c.value
+		effectiveSat += c.effectiveValue
+		r.Inputs[i] = *c.utxo
+		addrDesc, err := w.chainParser.GetAddrDescFromAddress(c.utxo.Address)
+		if err != nil {
+			return nil, err
+		}
+		changeIndex, index, err := xpubUtxoChangeIndex(xd, c.utxo.Path)
+		if err != nil {
+			return nil, err
+		}
+		in := bchain.XpubPsbtInput{
+			Txid:     c.utxo.Txid,
+			Vout:     uint32(c.utxo.Vout),
+			ValueSat: c.utxo.AmountSat.AsBigInt(),
+			AddrDesc: addrDesc,
+			Change:   changeIndex,
+			Index:    index,
+		}
+		// the previous transaction is required by the non segwit inputs and by some signers for all inputs
+		tx, err := w.chain.GetTransaction(c.utxo.Txid)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetTransaction %v", c.utxo.Txid)
+		}
+		if len(tx.Hex) > 0 {
+			if in.PrevTx, err = hex.DecodeString(tx.Hex); err != nil {
+				return nil, err
+			}
+		}
+		inputs[i] = in
+		weight += inputWeight
+	}
+	// the change output is added only if the change is above the dust limit, otherwise the excess goes to the fee
+	changeSat := effectiveSat - target - feeForWeight(changeWeight, request.FeeRate)
+	if coinSelection == coinSelectionLargestFirst && changeSat >= feeForWeight(changeWeight+inputWeight, dustRelayFeeRate) {
+		index, err := strconv.ParseUint(changeAddress.Path[strings.LastIndexByte(changeAddress.Path, '/')+1:], 10, 31)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, bchain.XpubPsbtOutput{
+			AddrDesc: changeAddrDesc,
+			IsChange: true,
+			Change:   uint32(change),
+			Index:    uint32(index),
+		})
+		outputs[len(outputs)-1].ValueSat.SetInt64(changeSat)
+		weight += changeWeight
+		r.Change = changeAddress
+		r.ChangeSat = (*Amount)(&outputs[len(outputs)-1].ValueSat)
+	} else {
+		changeSat = 0
+	}
+	b, err := w.chainParser.CreateXpubPsbt(xd, inputs, outputs)
+	if err != nil {
+		return nil, err
+	}
+	r.Psbt = base64.StdEncoding.EncodeToString(b)
+	r.FeeSat = (*Amount)(big.NewInt(inputsSat - outputsSat - changeSat))
+	r.Vsize = (weight + 3) / 4
+	glog.Info("CreateXpubPsbt ", xpub[:xpubLogPrefix], ", ", coinSelection, ", ", len(inputs), " inputs, ", len(outputs), " outputs, ", time.Since(start))
+	return &r, nil
+}
@@ -0,0 +1,145 @@
+//go:build unittest
+
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/trezor/blockbook/bchain"
+)
+
+func Test_xpubInputWeight(t *testing.T) {
+	tests := []struct {
+		name    string
+		xd      *bchain.XpubDescriptor
+		want    int
+		wantErr bool
+	}{
+		{name: "P2PKH", xd: &bchain.XpubDescriptor{Type: bchain.P2PKH}, want: 592},
+		{name: "P2SHWPKH", xd: &bchain.XpubDescriptor{Type: bchain.P2SHWPKH}, want: 364},
+		{name: "P2WPKH", xd: &bchain.XpubDescriptor{Type: bchain.P2WPKH}, want: 272},
+		{name: "P2SH 2 of 3", xd: &bchain.XpubDescriptor{Type: bchain.P2SH, Threshold: 2, ExtKeys: make([]interface{}, 3)}, want: 1188},
+		{name: "P2SHWSH 2 of 3", xd: &bchain.XpubDescriptor{Type: bchain.P2SHWSH, Threshold: 2, ExtKeys: make([]interface{}, 3)}, want: 558},
+		{name: "P2WSH 2 of 3", xd: &bchain.XpubDescriptor{Type: bchain.P2WSH, Threshold: 2, ExtKeys: make([]interface{}, 3)}, want: 418},
+		{name: "P2TR", xd: &bchain.XpubDescriptor{Type: bchain.P2TR}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := xpubInputWeight(tt.xd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("xpubInputWeight() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("xpubInputWeight() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func psbtCoins(values ...int64) []psbtCoin {
+	coins := make([]psbtCoin, len(values))
+	for i, v := range values {
+		coins[i] = psbtCoin{value: v + 100, effectiveValue: v}
+	}
+	return coins
+}
+
+func Test_selectCoinsBnB(t *testing.T) {
+	tests := []struct {
+		name         string
+		coins        []psbtCoin
+		target       int64
+		costOfChange int64
+		want         []int
+	}{
+		{
+			name:         "exact match",
+			coins:        psbtCoins(50000, 30000, 20000, 10000),
+			target:       40000,
+			costOfChange: 500,
+			want:         []int{1, 3},
+		},
+		{
+			name:         "smallest excess within cost of change",
+			coins:        psbtCoins(50000, 30000, 20000, 10200),
+			target:       40000,
+			costOfChange: 500,
+			want:         []int{1, 3},
+		},
+		{
+			name:         "single coin",
+			coins:        psbtCoins(50000, 30000, 20000, 10000),
+			target:       49800,
+			costOfChange: 500,
+			want:         []int{0},
+		},
+		{
+			name:         "no match without change",
+			coins:        psbtCoins(50000, 30000),
+			target:       40000,
+			costOfChange: 500,
+			want:         nil,
+		},
+		{
+			name:         "insufficient funds",
+			coins:        psbtCoins(20000, 10000),
+			target:       40000,
+			costOfChange: 500,
+			want:         nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectCoinsBnB(tt.coins, tt.target, tt.costOfChange); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectCoinsBnB() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectCoinsLargestFirst(t *testing.T) {
+	tests := []struct {
+		name   string
+		coins  []psbtCoin
+		target int64
+		want   []int
+	}{
+		{
+			name:   "one coin",
+			coins:  psbtCoins(50000, 30000, 20000),
+			target: 40000,
+			want:   []int{0},
+		},
+		{
+			name:   "more coins",
+			coins:  psbtCoins(50000, 30000, 20000),
+			target: 90000,
+			want:   []int{0, 1, 2},
+		},
+		{
+			name:   "insufficient funds",
+			coins:  psbtCoins(50000, 30000, 20000),
+			target: 100001,
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectCoinsLargestFirst(tt.coins, tt.target); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectCoinsLargestFirst() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_xpubUtxoChangeIndex(t *testing.T) {
+	xd := &bchain.XpubDescriptor{ChangeIndexes: []uint32{122, 123}}
+	change, index, err := xpubUtxoChangeIndex(xd, "m/84'/0'/0'/1/17")
+	if err != nil || change != 123 || index != 17 {
+		t.Errorf("xpubUtxoChangeIndex() = %v, %v, %v, want 123, 17", change, index, err)
+	}
+	if _, _, err = xpubUtxoChangeIndex(xd, "m/84'/0'/0'/2/17"); err == nil {
+		t.Error("xpubUtxoChangeIndex() expected error for the change not in the descriptor")
+	}
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// codes of the reasons of the rejection of a transaction
+const (
+	TxErrorInvalid       = "invalid"
+	TxErrorMissingInputs = "missingInputs"
+	TxErrorFeeTooLow     = "feeTooLow"
+	TxErrorConflict      = "conflict"
+	TxErrorNonStandard   = "nonStandard"
+	TxErrorAbsurdFee     = "absurdFee"
+	TxErrorAlreadyKnown  = "alreadyKnown"
+	TxErrorRejected      = "rejected"
+)
+
+// the reject reasons of bitcoind mapped to the codes, the reasons are matched as prefixes of the lowercase message
+var rejectReasonCodes = []struct {
+	prefix string
+	code   string
+}{
+	{"missing-inputs", TxErrorMissingInputs},
+	{"missing inputs", TxErrorMissingInputs},
+	{"bad-txns-inputs-missingorspent", TxErrorMissingInputs},
+	{"min relay fee not met", TxErrorFeeTooLow},
+	{"mempool min fee not met", TxErrorFeeTooLow},
+	{"insufficient fee", TxErrorFeeTooLow},
+	{"txn-mempool-conflict", TxErrorConflict},
+	{"txn-already-in-mempool", TxErrorAlreadyKnown},
+	{"txn-already-known", TxErrorAlreadyKnown},
+	{"transaction already in block chain", TxErrorAlreadyKnown},
+	{"max-fee-exceeded", TxErrorAbsurdFee},
+	{"absurdly-high-fee", TxErrorAbsurdFee},
+	{"fee exceeds maximum", TxErrorAbsurdFee},
+	{"dust", TxErrorNonStandard},
+	{"scriptpubkey", TxErrorNonStandard},
+	{"bare-multisig", TxErrorNonStandard},
+	{"multi-op-return", TxErrorNonStandard},
+	{"tx-size", TxErrorNonStandard},
+	{"scriptsig-size", TxErrorNonStandard},
+	{"scriptsig-not-pushonly", TxErrorNonStandard},
+	{"version", TxErrorNonStandard},
+	{"non-final", TxErrorNonStandard},
+	{"non-bip68-final", TxErrorNonStandard},
+	{"tx decode failed", TxErrorInvalid},
+	{"bad-txns-", TxErrorInvalid},
+	{"mandatory-script-verify-flag-failed", TxErrorInvalid},
+	{"non-mandatory-script-verify-flag", TxErrorNonStandard},
+}
+
+// rejectReasonCode returns the code of the reject reason reported by the backend, empty string if the reason is not known
+func rejectReasonCode(reason string) string {
+	reason = strings.ToLower(strings.TrimSpace(reason))
+	for _, r := range rejectReasonCodes {
+		if strings.HasPrefix(reason, r.prefix) {
+			return r.code
+		}
+	}
+	return ""
+}
+
+// the problems of the decoded transaction mapped to the codes, dust outputs are not standard
+// only the missing and spent inputs are definitive, the other problems depend on the relay policy of the backend
+// or may be accepted by it, for example the mempool conflict of a replacement transaction (BIP125)
+var txProblemCodes = map[string]string{
+	TxProblemKnownTransaction:  TxErrorAlreadyKnown,
+	TxProblemMissingInput:      TxErrorMissingInputs,
+	TxProblemSpentInput:        TxErrorMissingInputs,
+	TxProblemMempoolSpentInput: TxErrorConflict,
+	TxProblemDustOutput:        TxErrorNonStandard,
+	TxProblemNonStandardScript: TxErrorNonStandard,
+	TxProblemAbsurdFee:         TxErrorAbsurdFee,
+}
+
+// isTxRejectionRPCError returns true if the RPC error is a rejection of the transaction by the backend,
+// RPC_DESERIALIZATION_ERROR, RPC_VERIFY_ERROR, RPC_VERIFY_REJECTED or RPC_VERIFY_ALREADY_IN_CHAIN of bitcoind
+func isTxRejectionRPCError(err *bchain.RPCError) bool {
+	switch err.Code {
+	case -22, -25, -26, -27:
+		return true
+	}
+	return false
+}
+
+// testMempoolAccept tests the transaction by testmempoolaccept of the backend
+// nil is returned if the backend failed to test it, for example if it is not supported or the backend is warming up,
+// the transaction is then validated locally
+func (w *Worker) testMempoolAccept(txHex string) *bchain.MempoolAcceptResult {
+	res, err := w.chain.(bchain.MempoolAcceptTester).TestMempoolAccept(strings.TrimSpace(txHex))
+	if err != nil {
+		if rpcErr, ok := errors.Cause(err).(*bchain.RPCError); ok && isTxRejectionRPCError(rpcErr) {
+			// the backend rejects transactions, which it cannot decode or verify, by an error
+			return &bchain.MempoolAcceptResult{RejectReason: rpcErr.Message}
+		}
+		glog.Warning("testmempoolaccept error ", err, ", validating transaction locally")
+		return nil
+	}
+	return res
+}
+
+// validateTransaction checks if the transaction would be accepted to the mempool
+// decoded is false if the transaction could not be decoded locally
+func (w *Worker) validateTransaction(txHex string) (r *TxValidation, decoded bool, err error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, false, NewAPIError("Validation of transactions is not supported for this coin", true)
+	}
+	r = &TxValidation{}
+	tx, err := w.DecodeTransaction(txHex)
+	if err != nil {
+		if apiErr, ok := err.(*APIError); !ok || !apiErr.Public {
+			return nil, false, err
+		}
+		r.Errors = append(r.Errors, TxValidationError{Code: TxErrorInvalid, Message: err.Error()})
+	} else {
+		decoded = true
+		r.Txid = tx.Txid
+		r.VSize = tx.VSize
+		r.FeePerKb = tx.FeePerKb
+		for i := range tx.Problems {
+			if tx.Problems[i].Txid != "" {
+				r.Conflicts = append(r.Conflicts, tx.Problems[i].Txid)
+			}
+		}
+	}
+	if bchain.SupportsTestMempoolAccept(w.chain) {
+		if res := w.testMempoolAccept(txHex); res != nil {
+			r.TestedByBackend = true
+			r.Allowed = res.Allowed
+			r.Errors = nil
+			if res.Txid != "" {
+				r.Txid = res.Txid
+			}
+			if res.VSize > 0 {
+				r.VSize = res.VSize
+				if res.Allowed {
+					r.FeePerKb = feePerKb(&res.Fee, res.VSize)
+				}
+			}
+			if !res.Allowed {
+				code := rejectReasonCode(res.RejectReason)
+				if code == "" {
+					code = TxErrorRejected
+				}
+				r.Errors = append(r.Errors, TxValidationError{Code: code, Message: res.RejectReason})
+			}
+			return r, decoded, nil
+		}
+	}
+	if !decoded {
+		return r, false, nil
+	}
+	r.Errors, r.Warnings = localValidation(tx, w.txRelayPolicy())
+	r.Allowed = len(r.Errors) == 0
+	return r, true, nil
+}
+
+// localValidation checks the decoded transaction without the backend
+// the definitive problems are returned as errs, which block the broadcast, the others only as warnings
+func localValidation(tx *DecodedTx, policy *bchain.TxRelayPolicy) (errs, warnings []TxValidationError) {
+	allInputsKnown := true
+	for i := range tx.Problems {
+		p := &tx.Problems[i]
+		e := TxValidationError{Code: txProblemCodes[p.Type], Message: p.Message}
+		switch p.Type {
+		case TxProblemMissingInput:
+			allInputsKnown = false
+			errs = append(errs, e)
+		case TxProblemSpentInput:
+			errs = append(errs, e)
+		default:
+			warnings = append(warnings, e)
+		}
+	}
+	if allInputsKnown {
+		if (*big.Int)(tx.ValueInSat).Cmp((*big.Int)(tx.ValueOutSat)) < 0 {
+			errs = append(errs, TxValidationError{Code: TxErrorInvalid, Message: "Value of outputs exceeds value of inputs"})
+		} else if tx.FeePerKb < policy.MinRelayFeePerKb {
+			warnings = append(warnings, TxValidationError{Code: TxErrorFeeTooLow, Message: "Fee rate is below the minimal relay fee rate"})
+		}
+	}
+	return errs, warnings
+}
+
+// ValidateTransaction checks if the transaction would be accepted to the mempool, without broadcasting it
+// testmempoolaccept of the backend is used if it is supported, otherwise the transaction is checked locally using the index and the mempool,
+// the local checks depending on the relay policy of the backend are returned only as warnings
+func (w *Worker) ValidateTransaction(txHex string) (*TxValidation, error) {
+	r, _, err := w.validateTransaction(txHex)
+	return r, err
+}
+
+// SendTransaction validates the transaction and broadcasts it
+// a rejected transaction is returned as a public APIError with the code of the reason of the rejection
+func (w *Worker) SendTransaction(txHex string) (string, error) {
+	if w.chainType == bchain.ChainBitcoinType {
+		v, decoded, err := w.validateTransaction(txHex)
+		if err != nil {
+			return "", err
+		}
+		// the transactions which cannot be decoded locally are left to the backend to decide
+		// as well as the already known transactions, the backend may announce them again
+		if !v.Allowed && (decoded || v.TestedByBackend) && v.Errors[0].Code != TxErrorAlreadyKnown {
+			return "", &APIError{Text: v.Errors[0].Message, Public: true, Code: v.Errors[0].Code}
+		}
+	}
+	txid, err := w.chain.SendRawTransaction(txHex)
+	if err != nil {
+		apiErr := &APIError{Text: err.Error(), Public: true}
+		if rpcErr, ok := errors.Cause(err).(*bchain.RPCError); ok {
+			apiErr.Code = rejectReasonCode(rpcErr.Message)
+		}
+		return "", apiErr
+	}
+	if w.chainType == bchain.ChainBitcoinType {
+		w.storeBroadcast(txid, txHex)
+	}
+	return txid, nil
+}
@@ -0,0 +1,158 @@
+//go:build unittest
+
+package api
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+)
+
+func Test_rejectReasonCode(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   string
+	}{
+		{reason: "missing-inputs", want: TxErrorMissingInputs},
+		{reason: "bad-txns-inputs-missingorspent", want: TxErrorMissingInputs},
+		{reason: "min relay fee not met, 100 < 141", want: TxErrorFeeTooLow},
+		{reason: "mempool min fee not met, 150 < 300", want: TxErrorFeeTooLow},
+		{reason: "insufficient fee, rejecting replacement 7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25", want: TxErrorFeeTooLow},
+		{reason: "txn-mempool-conflict", want: TxErrorConflict},
+		{reason: "txn-already-in-mempool", want: TxErrorAlreadyKnown},
+		{reason: "Transaction already in block chain", want: TxErrorAlreadyKnown},
+		{reason: "max-fee-exceeded", want: TxErrorAbsurdFee},
+		{reason: "Fee exceeds maximum configured by user (e.g. -maxtxfee, maxfeerate)", want: TxErrorAbsurdFee},
+		{reason: "dust", want: TxErrorNonStandard},
+		{reason: "scriptpubkey", want: TxErrorNonStandard},
+		{reason: "TX decode failed. Make sure the tx has at least one input.", want: TxErrorInvalid},
+		{reason: "bad-txns-in-belowout, value in (0.001) < value out (0.002)", want: TxErrorInvalid},
+		{reason: "something else", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			if got := rejectReasonCode(tt.reason); got != tt.want {
+				t.Errorf("rejectReasonCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_localValidation(t *testing.T) {
+	policy := &bchain.TxRelayPolicy{DustRelayFeePerKb: 3000, MinRelayFeePerKb: 1000, MaxFeePerKb: 10000000}
+	newTx := func(in, out int64, feePerKb int64, problems ...TxProblem) *DecodedTx {
+		return &DecodedTx{
+			Tx:       &Tx{ValueInSat: (*Amount)(big.NewInt(in)), ValueOutSat: (*Amount)(big.NewInt(out))},
+			FeePerKb: feePerKb,
+			Problems: problems,
+		}
+	}
+	tests := []struct {
+		name         string
+		tx           *DecodedTx
+		policy       *bchain.TxRelayPolicy
+		wantErrs     []TxValidationError
+		wantWarnings []TxValidationError
+	}{
+		{
+			name:   "valid",
+			tx:     newTx(10000, 9000, 5000),
+			policy: policy,
+		},
+		{
+			name:     "missing input",
+			tx:       newTx(0, 9000, 0, TxProblem{Type: TxProblemMissingInput, Message: "missing"}),
+			policy:   policy,
+			wantErrs: []TxValidationError{{Code: TxErrorMissingInputs, Message: "missing"}},
+		},
+		{
+			name:     "spent input",
+			tx:       newTx(10000, 9000, 5000, TxProblem{Type: TxProblemSpentInput, Message: "spent"}),
+			policy:   policy,
+			wantErrs: []TxValidationError{{Code: TxErrorMissingInputs, Message: "spent"}},
+		},
+		{
+			name:     "outputs exceed inputs",
+			tx:       newTx(9000, 10000, 0),
+			policy:   policy,
+			wantErrs: []TxValidationError{{Code: TxErrorInvalid, Message: "Value of outputs exceeds value of inputs"}},
+		},
+		{
+			name: "mempool conflict, possible replacement",
+			tx: newTx(10000, 9000, 5000,
+				TxProblem{Type: TxProblemMempoolSpentInput, Message: "conflict", Txid: "7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25"}),
+			policy:       policy,
+			wantWarnings: []TxValidationError{{Code: TxErrorConflict, Message: "conflict"}},
+		},
+		{
+			name: "policy problems",
+			tx: newTx(10000, 9990, 500,
+				TxProblem{Type: TxProblemDustOutput, Message: "dust"},
+				TxProblem{Type: TxProblemNonStandardScript, Message: "nonstandard"}),
+			policy: policy,
+			wantWarnings: []TxValidationError{
+				{Code: TxErrorNonStandard, Message: "dust"},
+				{Code: TxErrorNonStandard, Message: "nonstandard"},
+				{Code: TxErrorFeeTooLow, Message: "Fee rate is below the minimal relay fee rate"},
+			},
+		},
+		{
+			name:   "fee check disabled",
+			tx:     newTx(10000, 9990, 500),
+			policy: &bchain.TxRelayPolicy{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, warnings := localValidation(tt.tx, tt.policy)
+			if !reflect.DeepEqual(errs, tt.wantErrs) {
+				t.Errorf("localValidation() errs = %+v, want %+v", errs, tt.wantErrs)
+			}
+			if !reflect.DeepEqual(warnings, tt.wantWarnings) {
+				t.Errorf("localValidation() warnings = %+v, want %+v", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+type testMempoolAcceptChain struct {
+	bchain.BlockChain
+	res *bchain.MempoolAcceptResult
+	err error
+}
+
+func (c *testMempoolAcceptChain) SupportsTestMempoolAccept() bool {
+	return true
+}
+
+func (c *testMempoolAcceptChain) TestMempoolAccept(tx string) (*bchain.MempoolAcceptResult, error) {
+	return c.res, c.err
+}
+
+func TestWorker_testMempoolAccept(t *testing.T) {
+	accepted := &bchain.MempoolAcceptResult{Txid: "1234", Allowed: true}
+	tests := []struct {
+		name string
+		res  *bchain.MempoolAcceptResult
+		err  error
+		want *bchain.MempoolAcceptResult
+	}{
+		{name: "accepted", res: accepted, want: accepted},
+		{name: "decode failed", err: &bchain.RPCError{Code: -22, Message: "TX decode failed"}, want: &bchain.MempoolAcceptResult{RejectReason: "TX decode failed"}},
+		{name: "verify rejected", err: errors.Annotate(&bchain.RPCError{Code: -26, Message: "min relay fee not met"}, "hash"), want: &bchain.MempoolAcceptResult{RejectReason: "min relay fee not met"}},
+		{name: "method not found", err: &bchain.RPCError{Code: -32601, Message: "Method not found"}},
+		{name: "warming up", err: &bchain.RPCError{Code: -28, Message: "Loading block index..."}},
+		{name: "connection error", err: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Worker{chain: &testMempoolAcceptChain{res: tt.res, err: tt.err}}
+			if got := w.testMempoolAccept("00"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("testMempoolAccept() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
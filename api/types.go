@@ -5,6 +5,7 @@ import (
 	"errors"
 	"math/big"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/trezor/blockbook/bchain"
@@ -39,9 +40,11 @@ const (
 var ErrUnsupportedXpub = errors.New("XPUB not supported")
 
 // APIError extends error by information if the error details should be returned to the end user
+// Code is an optional machine readable code of the error
 type APIError struct {
 	Text   string
 	Public bool
+	Code   string
 }
 
 func (e *APIError) Error() string {
@@ -72,6 +75,15 @@ func (a *Amount) MarshalJSON() (out []byte, err error) {
 	return []byte(`"` + (*big.Int)(a).String() + `"`), nil
 }
 
+// UnmarshalJSON Amount deserialization, the amount can be a string or a number in the base units
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if _, ok := (*big.Int)(a).SetString(s, 10); !ok {
+		return errors.New("Invalid amount " + string(data))
+	}
+	return nil
+}
+
 func (a *Amount) String() string {
 	if a == nil {
 		return ""
@@ -201,6 +213,34 @@ type Tx struct {
 	CoinSpecificData json.RawMessage   `json:"coinSpecificData,omitempty"`
 	TokenTransfers   []TokenTransfer   `json:"tokenTransfers,omitempty"`
 	EthereumSpecific *EthereumSpecific `json:"ethereumSpecific,omitempty"`
+	MempoolPackage   *MempoolPackage   `json:"mempoolPackage,omitempty"`
+}
+
+// MempoolPackage contains CPFP related data of an unconfirmed transaction and of its unconfirmed ancestors and descendants
+// ancestor and descendant counts, sizes and fees include the transaction itself, fee rates are in satoshi per 1000 vbytes
+type MempoolPackage struct {
+	VSize             int64    `json:"vsize"`
+	FeePerKb          int64    `json:"feePerKb"`
+	AncestorCount     int      `json:"ancestorCount"`
+	AncestorVSize     int64    `json:"ancestorVSize"`
+	AncestorFeesSat   *Amount  `json:"ancestorFees"`
+	DescendantCount   int      `json:"descendantCount"`
+	DescendantVSize   int64    `json:"descendantVSize"`
+	DescendantFeesSat *Amount  `json:"descendantFees"`
+	PackageFeePerKb   int64    `json:"packageFeePerKb"`
+	EffectiveFeePerKb int64    `json:"effectiveFeePerKb"`
+	Parents           []string `json:"parents,omitempty"`
+	Children          []string `json:"children,omitempty"`
+}
+
+// CpfpFee contains the fee a new child transaction must pay so that the package of an unconfirmed transaction reaches the target fee rate
+type CpfpFee struct {
+	Txid           string          `json:"txid"`
+	TargetFeePerKb int64           `json:"targetFeePerKb"`
+	ChildVSize     int64           `json:"childVSize"`
+	ChildFeeSat    *Amount         `json:"childFee"`
+	ChildFeePerKb  int64           `json:"childFeePerKb"`
+	MempoolPackage *MempoolPackage `json:"mempoolPackage"`
 }
 
 // FeeStats contains detailed block fee statistics
@@ -285,6 +325,115 @@ type Utxo struct {
 	Coinbase      bool    `json:"coinbase,omitempty"`
 }
 
+// XpubAddress is an address derived from xpub
+type XpubAddress struct {
+	Address string `json:"address"`
+	Path    string `json:"path"`
+	Used    bool   `json:"used"`
+}
+
+// PsbtOutput is an output of the transaction requested in PSBT
+type PsbtOutput struct {
+	Address   string  `json:"address"`
+	AmountSat *Amount `json:"value"`
+}
+
+// XpubPsbtRequest is a request to create PSBT spending the utxos of xpub
+type XpubPsbtRequest struct {
+	Outputs []PsbtOutput `json:"outputs"`
+	FeeRate float64      `json:"feeRate"` // in satoshis per vbyte
+}
+
+// XpubPsbt is an unsigned PSBT (BIP174) spending the utxos of xpub
+type XpubPsbt struct {
+	Psbt          string       `json:"psbt"` // base64 encoded
+	Inputs        Utxos        `json:"inputs"`
+	Change        *XpubAddress `json:"change,omitempty"`
+	ChangeSat     *Amount      `json:"changeValue,omitempty"`
+	FeeSat        *Amount      `json:"fee"`
+	Vsize         int          `json:"vsize"`
+	CoinSelection string       `json:"coinSelection"`
+}
+
+// TxProblem is a problem found in a decoded transaction, Input or Output is the index of the affected input or output
+type TxProblem struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Input   *int   `json:"vin,omitempty"`
+	Output  *int   `json:"vout,omitempty"`
+	Txid    string `json:"txid,omitempty"` // conflicting mempool transaction
+}
+
+// DecodedTx is a transaction decoded from hex, not yet broadcasted, with the list of found problems
+type DecodedTx struct {
+	*Tx
+	VSize    int64       `json:"vsize"`
+	FeePerKb int64       `json:"feePerKb"`
+	Problems []TxProblem `json:"problems,omitempty"`
+}
+
+// TxValidationError is a reason of the rejection of a transaction
+type TxValidationError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// TxValidation is the result of the validation of a transaction before it is broadcasted
+// TestedByBackend is set if the validation was done by testmempoolaccept of the backend, otherwise it was done locally using the index
+// Warnings are the problems found by the local validation, which do not prevent the broadcast
+type TxValidation struct {
+	Txid            string              `json:"txid,omitempty"`
+	Allowed         bool                `json:"allowed"`
+	TestedByBackend bool                `json:"testedByBackend"`
+	VSize           int64               `json:"vsize,omitempty"`
+	FeePerKb        int64               `json:"feePerKb,omitempty"`
+	Errors          []TxValidationError `json:"errors,omitempty"`
+	Warnings        []TxValidationError `json:"warnings,omitempty"`
+	Conflicts       []string            `json:"conflicts,omitempty"`
+}
+
+// BroadcastInfo is the status of a transaction broadcasted by blockbook, the times are unix timestamps
+type BroadcastInfo struct {
+	Txid            string `json:"txid"`
+	Status          string `json:"status"`
+	Sent            int64  `json:"sentTime"`
+	LastBroadcast   int64  `json:"lastBroadcastTime"`
+	Expiry          int64  `json:"expiryTime"`
+	Rebroadcasts    uint32 `json:"rebroadcasts"`
+	BlockHeight     uint32 `json:"blockHeight,omitempty"`
+	ConflictingTxid string `json:"conflictingTxid,omitempty"`
+	LastError       string `json:"lastError,omitempty"`
+}
+
+// MerkleProof is the proof of inclusion of a transaction in a block
+// Merkle is the branch of hashes from the transaction to the merkle root, Hex is the proof in the format of bitcoind gettxoutproof
+type MerkleProof struct {
+	Txid        string   `json:"txid"`
+	BlockHash   string   `json:"blockHash"`
+	BlockHeight uint32   `json:"blockHeight"`
+	Pos         int      `json:"pos"`
+	Merkle      []string `json:"merkle"`
+	MerkleRoot  string   `json:"merkleRoot"`
+	Hex         string   `json:"hex,omitempty"`
+}
+
+// MerkleProofVerification is the result of the verification of a proof in the format of bitcoind gettxoutproof
+type MerkleProofVerification struct {
+	Valid       bool     `json:"valid"`
+	BlockHash   string   `json:"blockHash"`
+	BlockHeight uint32   `json:"blockHeight,omitempty"`
+	Txids       []string `json:"txids,omitempty"`
+	Positions   []int    `json:"positions,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// BlockHeaders is a range of block headers stored in the index
+type BlockHeaders struct {
+	From    uint32            `json:"from"`
+	Count   int               `json:"count"`
+	Headers []json.RawMessage `json:"headers"`
+}
+
 // Utxos is array of Utxo
 type Utxos []Utxo
 
@@ -425,6 +574,7 @@ type BlockbookInfo struct {
 	DbSize            int64                        `json:"dbSize"`
 	DbSizeFromColumns int64                        `json:"dbSizeFromColumns,omitempty"`
 	DbColumns         []common.InternalStateColumn `json:"dbColumns,omitempty"`
+	Sync              *common.SyncProgress         `json:"sync,omitempty"`
 	About             string                       `json:"about"`
 }
 
@@ -440,6 +590,35 @@ type MempoolTxid struct {
 	Txid string `json:"txid"`
 }
 
+// MempoolTxRemoval contains information about a transaction removed from mempool
+type MempoolTxRemoval struct {
+	Txid            string   `json:"txid"`
+	Reason          string   `json:"reason"`
+	ConflictingTxid string   `json:"conflictingTxid,omitempty"`
+	Time            int64    `json:"time"`
+	Addresses       []string `json:"addresses,omitempty"`
+}
+
+// MempoolRemovals contains a list of recently removed mempool transactions with paging information
+type MempoolRemovals struct {
+	Paging
+	Removed []MempoolTxRemoval `json:"removed"`
+}
+
+// ReorgTx contains a transaction of a block disconnected in a chain reorganization and its status after the reorganization
+type ReorgTx struct {
+	Txid   string `json:"txid"`
+	Status string `json:"status"`
+}
+
+// Reorg contains information about a chain reorganization
+type Reorg struct {
+	ForkHeight         uint32    `json:"forkHeight"`
+	ForkHash           string    `json:"forkHash"`
+	DisconnectedBlocks []string  `json:"disconnectedBlocks"`
+	Txs                []ReorgTx `json:"txs"`
+}
+
 // MempoolTxids contains a list of mempool txids with paging information
 type MempoolTxids struct {
 	Paging
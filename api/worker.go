@@ -127,8 +127,51 @@ func (w *Worker) GetTransaction(txid string, spendingTxs bool, specificJSON bool
 	return w.GetTransactionFromBchainTx(bchainTx, height, spendingTxs, specificJSON)
 }
 
+// getInputTxsNotInIndex returns the transactions spent by the inputs of bchainTx, which are not in the index
+// if the backend supports batching, the transactions are fetched in one round-trip, otherwise nil is returned
+// and the transactions are fetched one by one when processing the inputs
+func (w *Worker) getInputTxsNotInIndex(bchainTx *bchain.Tx) (map[string]*bchain.Tx, error) {
+	if bchain.TransactionBatchSize(w.chain) < 2 {
+		return nil, nil
+	}
+	var txids []string
+	seen := make(map[string]struct{})
+	for i := range bchainTx.Vin {
+		txid := bchainTx.Vin[i].Txid
+		if _, found := seen[txid]; txid == "" || found {
+			continue
+		}
+		seen[txid] = struct{}{}
+		ta, err := w.db.GetTxAddresses(txid)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetTxAddresses %v", txid)
+		}
+		if ta == nil {
+			txids = append(txids, txid)
+		}
+	}
+	if len(txids) < 2 {
+		return nil, nil
+	}
+	txs, _, errs := w.txCache.GetTransactions(txids)
+	inputTxs := make(map[string]*bchain.Tx, len(txids))
+	for i, txid := range txids {
+		// the failed transactions are fetched again when processing the inputs
+		if errs[i] == nil {
+			inputTxs[txid] = txs[i]
+		}
+	}
+	return inputTxs, nil
+}
+
 // GetTransactionFromBchainTx reads transaction data from txid
 func (w *Worker) GetTransactionFromBchainTx(bchainTx *bchain.Tx, height int, spendingTxs bool, specificJSON bool) (*Tx, error) {
+	return w.getTransactionFromBchainTx(bchainTx, height, spendingTxs, specificJSON, false)
+}
+
+// getTransactionFromBchainTx converts bchain.Tx to Tx
+// decoded transactions are not known to the backend nor to the mempool, therefore the mempool related data are not loaded for them
+func (w *Worker) getTransactionFromBchainTx(bchainTx *bchain.Tx, height int, spendingTxs bool, specificJSON bool, decoded bool) (*Tx, error) {
 	var err error
 	var ta *db.TxAddresses
 	var tokens []TokenTransfer
@@ -146,6 +189,12 @@ func (w *Worker) GetTransactionFromBchainTx(bchainTx *bchain.Tx, height int, spe
 			return nil, errors.Annotatef(err, "GetBlockHash %v", height)
 		}
 	}
+	var inputTxs map[string]*bchain.Tx
+	if w.chainType == bchain.ChainBitcoinType {
+		if inputTxs, err = w.getInputTxsNotInIndex(bchainTx); err != nil {
+			return nil, err
+		}
+	}
 	var valInSat, valOutSat, feesSat big.Int
 	var pValInSat *big.Int
 	vins := make([]Vin, len(bchainTx.Vin))
@@ -173,7 +222,10 @@ func (w *Worker) GetTransactionFromBchainTx(bchainTx *bchain.Tx, height int, spe
 				}
 				if tas == nil {
 					// try to load from backend
-					otx, _, err := w.txCache.GetTransaction(bchainVin.Txid)
+					otx, found := inputTxs[bchainVin.Txid]
+					if !found {
+						otx, _, err = w.txCache.GetTransaction(bchainVin.Txid)
+					}
 					if err != nil {
 						if err == bchain.ErrTxNotFound {
 							// try to get AddrDesc using coin specific handling and continue processing the tx
@@ -281,15 +333,19 @@ func (w *Worker) GetTransactionFromBchainTx(bchainTx *bchain.Tx, height int, spe
 	// size:=len(bchainTx.Hex) / 2
 	var sj json.RawMessage
 	// return CoinSpecificData for all mempool transactions or if requested
-	if specificJSON || bchainTx.Confirmations == 0 {
+	if !decoded && (specificJSON || bchainTx.Confirmations == 0) {
 		sj, err = w.chain.GetTransactionSpecific(bchainTx)
 		if err != nil {
 			return nil, err
 		}
 	}
-	// for mempool transaction get first seen time
-	if bchainTx.Confirmations == 0 {
+	// for mempool transaction get first seen time and CPFP package info
+	var mempoolPackage *MempoolPackage
+	if !decoded && bchainTx.Confirmations == 0 {
 		bchainTx.Blocktime = int64(w.mempool.GetTransactionTime(bchainTx.Txid))
+		if w.chainType == bchain.ChainBitcoinType {
+			mempoolPackage = w.getMempoolPackage(bchainTx.Txid)
+		}
 	}
 	r := &Tx{
 		Blockhash:        blockhash,
@@ -309,10 +365,43 @@ func (w *Worker) GetTransactionFromBchainTx(bchainTx *bchain.Tx, height int, spe
 		CoinSpecificData: sj,
 		TokenTransfers:   tokens,
 		EthereumSpecific: ethSpecific,
+		MempoolPackage:   mempoolPackage,
 	}
 	return r, nil
 }
 
+// feePerKb returns fee rate in satoshi per 1000 vbytes
+func feePerKb(fee *big.Int, vsize int64) int64 {
+	if vsize <= 0 {
+		return 0
+	}
+	var r big.Int
+	r.Mul(fee, big.NewInt(1000))
+	r.Div(&r, big.NewInt(vsize))
+	return r.Int64()
+}
+
+func (w *Worker) getMempoolPackage(txid string) *MempoolPackage {
+	p := w.mempool.GetTxPackage(txid)
+	if p == nil {
+		return nil
+	}
+	return &MempoolPackage{
+		VSize:             p.VSize,
+		FeePerKb:          feePerKb(&p.Fee, p.VSize),
+		AncestorCount:     p.AncestorCount,
+		AncestorVSize:     p.AncestorVSize,
+		AncestorFeesSat:   (*Amount)(&p.AncestorFees),
+		DescendantCount:   p.DescendantCount,
+		DescendantVSize:   p.DescendantVSize,
+		DescendantFeesSat: (*Amount)(&p.DescendantFees),
+		PackageFeePerKb:   feePerKb(&p.AncestorFees, p.AncestorVSize),
+		EffectiveFeePerKb: feePerKb(&p.EffectiveFees, p.EffectiveVSize),
+		Parents:           p.Parents,
+		Children:          p.Children,
+	}
+}
+
 // GetTransactionFromMempoolTx converts bchain.MempoolTx to Tx, with limited amount of data
 // it is not doing any request to backend or to db
 func (w *Worker) GetTransactionFromMempoolTx(mempoolTx *bchain.MempoolTx) (*Tx, error) {
@@ -1802,9 +1891,12 @@ func (w *Worker) GetSystemInfo(internal bool) (*SystemInfo, error) {
 	}
 	var columnStats []common.InternalStateColumn
 	var internalDBSize int64
+	var syncProgress *common.SyncProgress
 	if internal {
 		columnStats = w.is.GetAllDBColumnStats()
 		internalDBSize = w.is.DBSizeTotal()
+		sp := w.is.GetSyncProgress()
+		syncProgress = &sp
 	}
 	blockbookInfo := &BlockbookInfo{
 		Coin:              w.is.Coin,
@@ -1824,6 +1916,7 @@ func (w *Worker) GetSystemInfo(internal bool) (*SystemInfo, error) {
 		DbSize:            w.db.DatabaseSizeOnDisk(),
 		DbSizeFromColumns: internalDBSize,
 		DbColumns:         columnStats,
+		Sync:              syncProgress,
 		About:             Text.BlockbookAbout,
 	}
 	backendInfo := &common.BackendInfo{
@@ -1840,6 +1933,7 @@ func (w *Worker) GetSystemInfo(internal bool) (*SystemInfo, error) {
 		Version:         ci.Version,
 		Warnings:        ci.Warnings,
 		Consensus:       ci.Consensus,
+		Endpoints:       ci.Endpoints,
 	}
 	w.is.SetBackendInfo(backendInfo)
 	glog.Info("GetSystemInfo, ", time.Since(start))
@@ -1869,6 +1963,101 @@ func (w *Worker) GetMempool(page int, itemsOnPage int) (*MempoolTxids, error) {
 	return r, nil
 }
 
+// default virtual size of a child transaction spending one segwit output to one output
+const defaultCpfpChildVSize = 110
+
+// GetCpfpFee computes the fee a new child transaction of the unconfirmed transaction must pay
+// so that the package of the transaction and all its unconfirmed ancestors reaches the target fee rate
+func (w *Worker) GetCpfpFee(txid string, targetFeePerKb int64, childVSize int64) (*CpfpFee, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, NewAPIError("CPFP is not supported for this coin", true)
+	}
+	if targetFeePerKb <= 0 {
+		return nil, NewAPIError("Missing or invalid parameter feePerKb", true)
+	}
+	if childVSize <= 0 {
+		childVSize = defaultCpfpChildVSize
+	}
+	mp := w.getMempoolPackage(txid)
+	if mp == nil {
+		return nil, NewAPIError(fmt.Sprintf("Transaction %v not found in mempool", txid), true)
+	}
+	target := big.NewInt(targetFeePerKb)
+	ceilFee := func(vsize int64) *big.Int {
+		var f big.Int
+		f.Mul(target, big.NewInt(vsize))
+		f.Add(&f, big.NewInt(999))
+		return f.Div(&f, big.NewInt(1000))
+	}
+	// the child must pay for the whole package, but at least the target fee rate for itself
+	childFee := ceilFee(mp.AncestorVSize + childVSize)
+	ancestorFees := (*big.Int)(mp.AncestorFeesSat)
+	childFee.Sub(childFee, ancestorFees)
+	if minFee := ceilFee(childVSize); childFee.Cmp(minFee) < 0 {
+		childFee = minFee
+	}
+	return &CpfpFee{
+		Txid:           txid,
+		TargetFeePerKb: targetFeePerKb,
+		ChildVSize:     childVSize,
+		ChildFeeSat:    (*Amount)(childFee),
+		ChildFeePerKb:  feePerKb(childFee, childVSize),
+		MempoolPackage: mp,
+	}, nil
+}
+
+// GetReorg converts the info about a chain reorganization to the api format
+func (w *Worker) GetReorg(reorg *bchain.Reorg) *Reorg {
+	r := &Reorg{
+		ForkHeight:         reorg.ForkHeight,
+		ForkHash:           reorg.ForkHash,
+		DisconnectedBlocks: reorg.DisconnectedHashes,
+		Txs:                make([]ReorgTx, len(reorg.Txs)),
+	}
+	for i := range reorg.Txs {
+		r.Txs[i] = ReorgTx{
+			Txid:   reorg.Txs[i].Txid,
+			Status: string(reorg.Txs[i].Status),
+		}
+	}
+	return r
+}
+
+// GetMempoolTxRemoval converts the info about a transaction removed from mempool to the api format
+func (w *Worker) GetMempoolTxRemoval(removal *bchain.MempoolTxRemoval) *MempoolTxRemoval {
+	r := &MempoolTxRemoval{
+		Txid:            removal.Txid,
+		Reason:          string(removal.Reason),
+		ConflictingTxid: removal.ConflictingTxid,
+		Time:            int64(removal.Time),
+	}
+	for _, addrDesc := range removal.AddrDescs {
+		a, _, err := w.chainParser.GetAddressesFromAddrDesc(addrDesc)
+		if err == nil && len(a) == 1 {
+			r.Addresses = append(r.Addresses, a[0])
+		}
+	}
+	return r
+}
+
+// GetMempoolRemovals returns a page of transactions recently removed from mempool
+func (w *Worker) GetMempoolRemovals(page int, itemsOnPage int) (*MempoolRemovals, error) {
+	page--
+	if page < 0 {
+		page = 0
+	}
+	removed := w.mempool.GetRemovedTransactions()
+	pg, from, to, _ := computePaging(len(removed), page, itemsOnPage)
+	r := &MempoolRemovals{
+		Paging:  pg,
+		Removed: make([]MempoolTxRemoval, to-from),
+	}
+	for i := from; i < to; i++ {
+		r.Removed[i-from] = *w.GetMempoolTxRemoval(&removed[i])
+	}
+	return r, nil
+}
+
 type bitcoinTypeEstimatedFee struct {
 	timestamp int64
 	fee       big.Int
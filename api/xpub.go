@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/big"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -26,6 +27,15 @@ var cachedXpubsMux sync.Mutex
 
 const xpubLogPrefix = 30
 
+// xpubListSeparator separates the xpubs (descriptors) of an account spanning several descriptors
+const xpubListSeparator = "|"
+
+// maxDerivedXpubAddresses limits the number of addresses derived by one GetXpubAddresses request
+const maxDerivedXpubAddresses = 1000
+
+// maxXpubsInList limits the number of the descriptors in one account to protect against high load of the server
+const maxXpubsInList = 16
+
 type xpubTxid struct {
 	txid        string
 	height      uint32
@@ -304,6 +314,62 @@ func setIsOwnAddresses(txs []*Tx, xpubAddresses map[string]struct{}) {
 	}
 }
 
+// parseXpubs parses an xpub (descriptor) or a list of xpubs separated by xpubListSeparator, which are treated as one account
+func (w *Worker) parseXpubs(xpub string) ([]*bchain.XpubDescriptor, error) {
+	parts := strings.Split(xpub, xpubListSeparator)
+	if len(parts) > maxXpubsInList {
+		return nil, NewAPIError(fmt.Sprintf("Too many xpubs, maximum is %d", maxXpubsInList), true)
+	}
+	xds := make([]*bchain.XpubDescriptor, 0, len(parts))
+	unique := make(map[string]struct{}, len(parts))
+	for _, p := range parts {
+		xd, err := w.chainParser.ParseXpub(strings.TrimSpace(p))
+		if err != nil {
+			return nil, err
+		}
+		// the same descriptor in different spellings derives the same addresses, it would be counted twice
+		key := xpubDescriptorKey(xd)
+		if _, found := unique[key]; found {
+			continue
+		}
+		unique[key] = struct{}{}
+		xds = append(xds, xd)
+	}
+	return xds, nil
+}
+
+// xpubDescriptorKey returns the key of the descriptor identifying the derived addresses, independent of the spelling
+// of the descriptor (checksum, key origin, hardened marker, format of the change list)
+func xpubDescriptorKey(xd *bchain.XpubDescriptor) string {
+	xpubs := []string{xd.Xpub}
+	if len(xd.Xpubs) > 0 {
+		xpubs = append([]string{}, xd.Xpubs...)
+		if xd.Sorted {
+			sort.Strings(xpubs)
+		}
+	}
+	changes := append([]uint32{}, xd.ChangeIndexes...)
+	sort.Slice(changes, func(i, j int) bool { return changes[i] < changes[j] })
+	return fmt.Sprint(xd.Type, "|", xd.Threshold, "|", xd.Sorted, "|", strings.Join(xpubs, ","), "|", changes)
+}
+
+// getXpubsData gets data of all xpubs of the account, the data of each xpub are cached separately
+func (w *Worker) getXpubsData(xds []*bchain.XpubDescriptor, page int, txsOnPage int, option AccountDetails, filter *AddressFilter, gap int) ([]*xpubData, uint32, bool, error) {
+	var bestheight uint32
+	allInCache := true
+	datas := make([]*xpubData, len(xds))
+	for i, xd := range xds {
+		data, height, inCache, err := w.getXpubData(xd, page, txsOnPage, option, filter, gap)
+		if err != nil {
+			return nil, 0, inCache, err
+		}
+		datas[i] = data
+		bestheight = height
+		allInCache = allInCache && inCache
+	}
+	return datas, bestheight, allInCache, nil
+}
+
 func (w *Worker) getXpubData(xd *bchain.XpubDescriptor, page int, txsOnPage int, option AccountDetails, filter *AddressFilter, gap int) (*xpubData, uint32, bool, error) {
 	if w.chainType != bchain.ChainBitcoinType {
 		return nil, 0, false, ErrUnsupportedXpub
@@ -386,6 +452,41 @@ func (w *Worker) getXpubData(xd *bchain.XpubDescriptor, page int, txsOnPage int,
 	return &data, bestheight, inCache, nil
 }
 
+// mergeXpubsTxids returns the txids of the addresses of all xpubs of the account passing the filter, each tx only once,
+// and the number of the unique txs regardless of the filter
+func mergeXpubsTxids(datas []*xpubData, txidFilter func(txid *xpubTxid, ad *xpubAddress) bool) (xpubTxids, int) {
+	txcMap := make(map[string]bool)
+	txc := make(xpubTxids, 0, 32)
+	for _, data := range datas {
+		for _, da := range data.addresses {
+			for i := range da {
+				ad := &da[i]
+				for _, txid := range ad.txids {
+					// add tx only once
+					if added := txcMap[txid.txid]; !added {
+						add := txidFilter == nil || txidFilter(&txid, ad)
+						txcMap[txid.txid] = add
+						if add {
+							txc = append(txc, txid)
+						}
+					}
+				}
+			}
+		}
+	}
+	return txc, len(txcMap)
+}
+
+// mergeXpubsBalances returns the sum of the balances and of the sent amounts of all xpubs of the account
+func mergeXpubsBalances(datas []*xpubData) (*big.Int, *big.Int) {
+	var balanceSat, sentSat big.Int
+	for _, data := range datas {
+		balanceSat.Add(&balanceSat, &data.balanceSat)
+		sentSat.Add(&sentSat, &data.sentSat)
+	}
+	return &balanceSat, &sentSat
+}
+
 // GetXpubAddress computes address value and gets transactions for given address
 func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option AccountDetails, filter *AddressFilter, gap int) (*Address, error) {
 	start := time.Now()
@@ -408,11 +509,16 @@ func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option Acc
 		uBalSat        big.Int
 		unconfirmedTxs int
 	)
-	xd, err := w.chainParser.ParseXpub(xpub)
+	xds, err := w.parseXpubs(xpub)
 	if err != nil {
 		return nil, err
 	}
-	data, bestheight, inCache, err := w.getXpubData(xd, page, txsOnPage, option, filter, gap)
+	dataOption := option
+	if len(xds) > 1 && dataOption < AccountDetailsTxidHistory {
+		// the txids are needed to count the txs shared by the xpubs of the account only once
+		dataOption = AccountDetailsTxidHistory
+	}
+	datas, bestheight, inCache, err := w.getXpubsData(xds, page, txsOnPage, dataOption, filter, gap)
 	if err != nil {
 		return nil, err
 	}
@@ -441,35 +547,37 @@ func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option Acc
 	if filter.ToHeight == 0 && !filter.OnlyConfirmed {
 		txmMap = make(map[string]*Tx)
 		mempoolEntries := make(bchain.MempoolTxidEntries, 0)
-		for _, da := range data.addresses {
-			for i := range da {
-				ad := &da[i]
-				newTxids, _, err := w.xpubGetAddressTxids(ad.addrDesc, true, 0, 0, maxInt)
-				if err != nil {
-					return nil, err
-				}
-				for _, txid := range newTxids {
-					// the same tx can have multiple addresses from the same xpub, get it from backend it only once
-					tx, foundTx := txmMap[txid.txid]
-					if !foundTx {
-						tx, err = w.GetTransaction(txid.txid, false, true)
-						// mempool transaction may fail
-						if err != nil || tx == nil {
-							glog.Warning("GetTransaction in mempool: ", err)
-							continue
-						}
-						txmMap[txid.txid] = tx
+		for _, data := range datas {
+			for _, da := range data.addresses {
+				for i := range da {
+					ad := &da[i]
+					newTxids, _, err := w.xpubGetAddressTxids(ad.addrDesc, true, 0, 0, maxInt)
+					if err != nil {
+						return nil, err
 					}
-					// skip already confirmed txs, mempool may be out of sync
-					if tx.Confirmations == 0 {
+					for _, txid := range newTxids {
+						// the same tx can have multiple addresses from the same xpub, get it from backend it only once
+						tx, foundTx := txmMap[txid.txid]
 						if !foundTx {
-							unconfirmedTxs++
+							tx, err = w.GetTransaction(txid.txid, false, true)
+							// mempool transaction may fail
+							if err != nil || tx == nil {
+								glog.Warning("GetTransaction in mempool: ", err)
+								continue
+							}
+							txmMap[txid.txid] = tx
 						}
-						uBalSat.Add(&uBalSat, tx.getAddrVoutValue(ad.addrDesc))
-						uBalSat.Sub(&uBalSat, tx.getAddrVinValue(ad.addrDesc))
-						// mempool txs are returned only on the first page, uniquely and filtered
-						if page == 0 && !foundTx && (txidFilter == nil || txidFilter(&txid, ad)) {
-							mempoolEntries = append(mempoolEntries, bchain.MempoolTxidEntry{Txid: txid.txid, Time: uint32(tx.Blocktime)})
+						// skip already confirmed txs, mempool may be out of sync
+						if tx.Confirmations == 0 {
+							if !foundTx {
+								unconfirmedTxs++
+							}
+							uBalSat.Add(&uBalSat, tx.getAddrVoutValue(ad.addrDesc))
+							uBalSat.Sub(&uBalSat, tx.getAddrVinValue(ad.addrDesc))
+							// mempool txs are returned only on the first page, uniquely and filtered
+							if page == 0 && !foundTx && (txidFilter == nil || txidFilter(&txid, ad)) {
+								mempoolEntries = append(mempoolEntries, bchain.MempoolTxidEntry{Txid: txid.txid, Time: uint32(tx.Blocktime)})
+							}
 						}
 					}
 				}
@@ -486,30 +594,8 @@ func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option Acc
 		}
 	}
 	if option >= AccountDetailsTxidHistory {
-		txcMap := make(map[string]bool)
-		txc = make(xpubTxids, 0, 32)
-		for _, da := range data.addresses {
-			for i := range da {
-				ad := &da[i]
-				for _, txid := range ad.txids {
-					added, foundTx := txcMap[txid.txid]
-					// count txs regardless of filter but only once
-					if !foundTx {
-						txCount++
-					}
-					// add tx only once
-					if !added {
-						add := txidFilter == nil || txidFilter(&txid, ad)
-						txcMap[txid.txid] = add
-						if add {
-							txc = append(txc, txid)
-						}
-					}
-				}
-			}
-		}
+		txc, txCount = mergeXpubsTxids(datas, txidFilter)
 		sort.Stable(txc)
-		txCount = len(txcMap)
 		totalResults := txCount
 		if filtered {
 			totalResults = -1
@@ -536,8 +622,13 @@ func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option Acc
 				txs = append(txs, tx)
 			}
 		}
+	} else if len(datas) > 1 {
+		// the txs between the xpubs of the account would be counted multiple times by the estimate
+		_, txCount = mergeXpubsTxids(datas, nil)
 	} else {
-		txCount = int(data.txCountEstimate)
+		for _, data := range datas {
+			txCount += int(data.txCountEstimate)
+		}
 	}
 	usedTokens := 0
 	var tokens []Token
@@ -546,32 +637,36 @@ func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option Acc
 		tokens = make([]Token, 0, 4)
 		xpubAddresses = make(map[string]struct{})
 	}
-	for ci, da := range data.addresses {
-		for i := range da {
-			ad := &da[i]
-			if ad.balance != nil {
-				usedTokens++
-			}
-			if option > AccountDetailsBasic {
-				token := w.tokenFromXpubAddress(data, ad, ci, i, option)
-				if filter.TokensToReturn == TokensToReturnDerived ||
-					filter.TokensToReturn == TokensToReturnUsed && ad.balance != nil ||
-					filter.TokensToReturn == TokensToReturnNonzeroBalance && ad.balance != nil && !IsZeroBigInt(&ad.balance.BalanceSat) {
-					tokens = append(tokens, token)
+	balanceSat, sentSat := mergeXpubsBalances(datas)
+	for _, data := range datas {
+		for ci, da := range data.addresses {
+			for i := range da {
+				ad := &da[i]
+				if ad.balance != nil {
+					usedTokens++
+				}
+				if option > AccountDetailsBasic {
+					token := w.tokenFromXpubAddress(data, ad, ci, i, option)
+					if filter.TokensToReturn == TokensToReturnDerived ||
+						filter.TokensToReturn == TokensToReturnUsed && ad.balance != nil ||
+						filter.TokensToReturn == TokensToReturnNonzeroBalance && ad.balance != nil && !IsZeroBigInt(&ad.balance.BalanceSat) {
+						tokens = append(tokens, token)
+					}
+					xpubAddresses[token.Name] = struct{}{}
 				}
-				xpubAddresses[token.Name] = struct{}{}
 			}
 		}
 	}
+	// the addresses of all xpubs of the account are own, the transfers between them are sent to self
 	setIsOwnAddresses(txs, xpubAddresses)
 	var totalReceived big.Int
-	totalReceived.Add(&data.balanceSat, &data.sentSat)
+	totalReceived.Add(balanceSat, sentSat)
 	addr := Address{
 		Paging:                pg,
 		AddrStr:               xpub,
-		BalanceSat:            (*Amount)(&data.balanceSat),
+		BalanceSat:            (*Amount)(balanceSat),
 		TotalReceivedSat:      (*Amount)(&totalReceived),
-		TotalSentSat:          (*Amount)(&data.sentSat),
+		TotalSentSat:          (*Amount)(sentSat),
 		Txs:                   txCount,
 		UnconfirmedBalanceSat: (*Amount)(&uBalSat),
 		UnconfirmedTxs:        unconfirmedTxs,
@@ -588,11 +683,11 @@ func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option Acc
 // GetXpubUtxo returns unspent outputs for given xpub
 func (w *Worker) GetXpubUtxo(xpub string, onlyConfirmed bool, gap int) (Utxos, error) {
 	start := time.Now()
-	xd, err := w.chainParser.ParseXpub(xpub)
+	xds, err := w.parseXpubs(xpub)
 	if err != nil {
 		return nil, err
 	}
-	data, _, inCache, err := w.getXpubData(xd, 0, 1, AccountDetailsBasic, &AddressFilter{
+	datas, _, inCache, err := w.getXpubsData(xds, 0, 1, AccountDetailsBasic, &AddressFilter{
 		Vout:          AddressFilterVoutOff,
 		OnlyConfirmed: onlyConfirmed,
 	}, gap)
@@ -600,28 +695,30 @@ func (w *Worker) GetXpubUtxo(xpub string, onlyConfirmed bool, gap int) (Utxos, e
 		return nil, err
 	}
 	r := make(Utxos, 0, 8)
-	for ci, da := range data.addresses {
-		for i := range da {
-			ad := &da[i]
-			onlyMempool := false
-			if ad.balance == nil {
-				if onlyConfirmed {
-					continue
+	for _, data := range datas {
+		for ci, da := range data.addresses {
+			for i := range da {
+				ad := &da[i]
+				onlyMempool := false
+				if ad.balance == nil {
+					if onlyConfirmed {
+						continue
+					}
+					onlyMempool = true
 				}
-				onlyMempool = true
-			}
-			utxos, err := w.getAddrDescUtxo(ad.addrDesc, ad.balance, onlyConfirmed, onlyMempool)
-			if err != nil {
-				return nil, err
-			}
-			if len(utxos) > 0 {
-				t := w.tokenFromXpubAddress(data, ad, ci, i, AccountDetailsTokens)
-				for j := range utxos {
-					a := &utxos[j]
-					a.Address = t.Name
-					a.Path = t.Path
+				utxos, err := w.getAddrDescUtxo(ad.addrDesc, ad.balance, onlyConfirmed, onlyMempool)
+				if err != nil {
+					return nil, err
+				}
+				if len(utxos) > 0 {
+					t := w.tokenFromXpubAddress(data, ad, ci, i, AccountDetailsTokens)
+					for j := range utxos {
+						a := &utxos[j]
+						a.Address = t.Name
+						a.Path = t.Path
+					}
+					r = append(r, utxos...)
 				}
-				r = append(r, utxos...)
 			}
 		}
 	}
@@ -638,11 +735,11 @@ func (w *Worker) GetXpubBalanceHistory(xpub string, fromTimestamp, toTimestamp i
 	if fromHeight >= toHeight {
 		return bhs, nil
 	}
-	xd, err := w.chainParser.ParseXpub(xpub)
+	xds, err := w.parseXpubs(xpub)
 	if err != nil {
 		return nil, err
 	}
-	data, _, inCache, err := w.getXpubData(xd, 0, 1, AccountDetailsTxidHistory, &AddressFilter{
+	datas, _, inCache, err := w.getXpubsData(xds, 0, 1, AccountDetailsTxidHistory, &AddressFilter{
 		Vout:          AddressFilterVoutOff,
 		OnlyConfirmed: true,
 		FromHeight:    fromHeight,
@@ -651,23 +748,28 @@ func (w *Worker) GetXpubBalanceHistory(xpub string, fromTimestamp, toTimestamp i
 	if err != nil {
 		return nil, err
 	}
+	// the addresses of all xpubs of the account are self addresses, the transfers between them are sent to self
 	selfAddrDesc := make(map[string]struct{})
-	for _, da := range data.addresses {
-		for i := range da {
-			selfAddrDesc[string(da[i].addrDesc)] = struct{}{}
+	for _, data := range datas {
+		for _, da := range data.addresses {
+			for i := range da {
+				selfAddrDesc[string(da[i].addrDesc)] = struct{}{}
+			}
 		}
 	}
-	for _, da := range data.addresses {
-		for i := range da {
-			ad := &da[i]
-			txids := ad.txids
-			for txi := len(txids) - 1; txi >= 0; txi-- {
-				bh, err := w.balanceHistoryForTxid(ad.addrDesc, txids[txi].txid, fromUnix, toUnix, selfAddrDesc)
-				if err != nil {
-					return nil, err
-				}
-				if bh != nil {
-					bhs = append(bhs, *bh)
+	for _, data := range datas {
+		for _, da := range data.addresses {
+			for i := range da {
+				ad := &da[i]
+				txids := ad.txids
+				for txi := len(txids) - 1; txi >= 0; txi-- {
+					bh, err := w.balanceHistoryForTxid(ad.addrDesc, txids[txi].txid, fromUnix, toUnix, selfAddrDesc)
+					if err != nil {
+						return nil, err
+					}
+					if bh != nil {
+						bhs = append(bhs, *bh)
+					}
 				}
 			}
 		}
@@ -680,3 +782,131 @@ func (w *Worker) GetXpubBalanceHistory(xpub string, fromTimestamp, toTimestamp i
 	glog.Info("GetUtxoBalanceHistory ", xpub[:xpubLogPrefix], ", cache ", inCache, ", blocks ", fromHeight, "-", toHeight, ", count ", len(bha), ",  ", time.Since(start))
 	return bha, nil
 }
+
+// xpubChangeIndex finds the change in the change indexes of the descriptor, negative change selects the first one
+func xpubChangeIndex(xd *bchain.XpubDescriptor, change int) (int, uint32, error) {
+	if change < 0 {
+		return 0, xd.ChangeIndexes[0], nil
+	}
+	for i, c := range xd.ChangeIndexes {
+		if c == uint32(change) {
+			return i, c, nil
+		}
+	}
+	return 0, 0, NewAPIError(fmt.Sprintf("Change %d is not part of the xpub descriptor", change), true)
+}
+
+func (w *Worker) xpubAddressFromAddrDesc(addrDesc bchain.AddressDescriptor, basePath string, change uint32, index uint32, used bool) XpubAddress {
+	var address string
+	if a, _, _ := w.chainParser.GetAddressesFromAddrDesc(addrDesc); len(a) > 0 {
+		address = a[0]
+	}
+	return XpubAddress{
+		Address: address,
+		Path:    fmt.Sprintf("%s/%d/%d", basePath, change, index),
+		Used:    used,
+	}
+}
+
+// xpubAddressInMempool returns true if the address has unconfirmed transactions
+func (w *Worker) xpubAddressInMempool(addrDesc bchain.AddressDescriptor) (bool, error) {
+	txs, err := w.mempool.GetAddrDescTransactions(addrDesc)
+	if err != nil {
+		return false, err
+	}
+	return len(txs) > 0, nil
+}
+
+// GetXpubAddresses derives addresses of the xpub with indexes from-to (to is exclusive), an address is used if it has a confirmed or unconfirmed transaction
+func (w *Worker) GetXpubAddresses(xpub string, change int, from, to uint32) ([]XpubAddress, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, ErrUnsupportedXpub
+	}
+	start := time.Now()
+	if to <= from {
+		return nil, NewAPIError("Parameter 'to' must be greater than 'from'", true)
+	}
+	if to-from > maxDerivedXpubAddresses {
+		return nil, NewAPIError(fmt.Sprintf("Too many addresses requested, maximum is %d", maxDerivedXpubAddresses), true)
+	}
+	xd, err := w.chainParser.ParseXpub(xpub)
+	if err != nil {
+		return nil, err
+	}
+	_, changeIndex, err := xpubChangeIndex(xd, change)
+	if err != nil {
+		return nil, err
+	}
+	basePath, err := w.chainParser.DerivationBasePath(xd)
+	if err != nil {
+		return nil, err
+	}
+	descriptors, err := w.chainParser.DeriveAddressDescriptorsFromTo(xd, changeIndex, from, to)
+	if err != nil {
+		return nil, err
+	}
+	r := make([]XpubAddress, len(descriptors))
+	for i, addrDesc := range descriptors {
+		ba, err := w.db.GetAddrDescBalance(addrDesc, db.AddressBalanceDetailNoUTXO)
+		if err != nil {
+			return nil, err
+		}
+		used := ba != nil
+		if !used {
+			if used, err = w.xpubAddressInMempool(addrDesc); err != nil {
+				return nil, err
+			}
+		}
+		r[i] = w.xpubAddressFromAddrDesc(addrDesc, basePath, changeIndex, from+uint32(i), used)
+	}
+	glog.Info("GetXpubAddresses ", xpub[:xpubLogPrefix], ", change ", changeIndex, ", ", from, "-", to, ", ", time.Since(start))
+	return r, nil
+}
+
+// GetXpubNextUnusedAddress returns the first address following the last used address of the xpub
+// the used addresses are found by the gap scanning of the xpub, the addresses with unconfirmed transactions are considered used
+func (w *Worker) GetXpubNextUnusedAddress(xpub string, change int, gap int) (*XpubAddress, error) {
+	start := time.Now()
+	xd, err := w.chainParser.ParseXpub(xpub)
+	if err != nil {
+		return nil, err
+	}
+	ci, changeIndex, err := xpubChangeIndex(xd, change)
+	if err != nil {
+		return nil, err
+	}
+	data, _, inCache, err := w.getXpubData(xd, 0, 1, AccountDetailsBasic, &AddressFilter{Vout: AddressFilterVoutOff}, gap)
+	if err != nil {
+		return nil, err
+	}
+	addresses := data.addresses[ci]
+	next := 0
+	for i := range addresses {
+		if addresses[i].balance != nil {
+			next = i + 1
+		}
+	}
+	// the addresses in the gap after the last used address may have unconfirmed transactions
+	for i := next; i < len(addresses); i++ {
+		inMempool, err := w.xpubAddressInMempool(addresses[i].addrDesc)
+		if err != nil {
+			return nil, err
+		}
+		if inMempool {
+			next = i + 1
+		}
+	}
+	var addrDesc bchain.AddressDescriptor
+	if next < len(addresses) {
+		addrDesc = addresses[next].addrDesc
+	} else {
+		descriptors, err := w.chainParser.DeriveAddressDescriptors(xd, changeIndex, []uint32{uint32(next)})
+		if err != nil {
+			return nil, err
+		}
+		addrDesc = descriptors[0]
+	}
+	a := w.xpubAddressFromAddrDesc(addrDesc, data.basePath, changeIndex, uint32(next), false)
+	glog.Info("GetXpubNextUnusedAddress ", xpub[:xpubLogPrefix], ", cache ", inCache, ", change ", changeIndex, ", index ", next, ", ", time.Since(start))
+	return &a, nil
+}
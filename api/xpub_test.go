@@ -0,0 +1,168 @@
+//go:build unittest
+
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/bchain/coins/btc"
+	"github.com/trezor/blockbook/db"
+)
+
+func TestWorker_parseXpubs(t *testing.T) {
+	w := &Worker{
+		chainParser: btc.NewBitcoinParser(btc.GetChainParams("main"), &btc.Configuration{XPubMagic: 76067358, XPubMagicSegwitP2sh: 77429938, XPubMagicSegwitNative: 78792518}),
+	}
+	const (
+		xpub = "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj"
+		ypub = "ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9azLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP"
+		tr   = "tr([5c9e228d/86'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/<0;1>/*)"
+	)
+	tests := []struct {
+		name    string
+		xpub    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "single xpub",
+			xpub: xpub,
+			want: []string{xpub},
+		},
+		{
+			name: "list of descriptors",
+			xpub: xpub + "|" + ypub + " | " + tr,
+			want: []string{xpub, ypub, tr},
+		},
+		{
+			name: "duplicates are ignored",
+			xpub: xpub + "|" + tr + "|" + xpub,
+			want: []string{xpub, tr},
+		},
+		{
+			name: "different spellings of the same descriptor are ignored",
+			xpub: tr + "|tr([5c9e228d/86h/0h/0h]xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/{1,0}/*)#578wy4j8|" +
+				xpub + "|pkh(" + xpub + ")",
+			want: []string{tr, xpub},
+		},
+		{
+			name: "different change indexes are not duplicates",
+			xpub: tr + "|tr([5c9e228d/86'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/2/*)",
+			want: []string{tr, "tr([5c9e228d/86'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/2/*)"},
+		},
+		{
+			name:    "invalid descriptor in list",
+			xpub:    xpub + "|xxx",
+			wantErr: true,
+		},
+		{
+			name:    "too many descriptors",
+			xpub:    strings.Repeat(xpub+"|", maxXpubsInList) + ypub,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := w.parseXpubs(tt.xpub)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseXpubs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var descriptors []string
+			for _, xd := range got {
+				descriptors = append(descriptors, xd.XpubDescriptor)
+			}
+			if !reflect.DeepEqual(descriptors, tt.want) {
+				t.Errorf("parseXpubs() = %v, want %v", descriptors, tt.want)
+			}
+		})
+	}
+}
+
+func Test_xpubChangeIndex(t *testing.T) {
+	xd := &bchain.XpubDescriptor{ChangeIndexes: []uint32{122, 123, 4431}}
+	tests := []struct {
+		name       string
+		change     int
+		wantIndex  int
+		wantChange uint32
+		wantErr    bool
+	}{
+		{name: "default", change: -1, wantIndex: 0, wantChange: 122},
+		{name: "listed", change: 4431, wantIndex: 2, wantChange: 4431},
+		{name: "not listed", change: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, change, err := xpubChangeIndex(xd, tt.change)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("xpubChangeIndex() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if index != tt.wantIndex || change != tt.wantChange {
+				t.Errorf("xpubChangeIndex() = %v, %v, want %v, %v", index, change, tt.wantIndex, tt.wantChange)
+			}
+		})
+	}
+}
+
+func Test_mergeXpubsData(t *testing.T) {
+	balance := func(txs uint32, balanceSat, sentSat int64) *db.AddrBalance {
+		b := &db.AddrBalance{Txs: txs}
+		b.BalanceSat.SetInt64(balanceSat)
+		b.SentSat.SetInt64(sentSat)
+		return b
+	}
+	newData := func(addresses ...xpubAddress) *xpubData {
+		d := &xpubData{addresses: [][]xpubAddress{addresses}}
+		for i := range addresses {
+			if b := addresses[i].balance; b != nil {
+				d.txCountEstimate += b.Txs
+				d.balanceSat.Add(&d.balanceSat, &b.BalanceSat)
+				d.sentSat.Add(&d.sentSat, &b.SentSat)
+			}
+		}
+		return d
+	}
+	// tx2 is sent to self from the address of the first descriptor to the address of the second descriptor
+	datas := []*xpubData{
+		newData(
+			xpubAddress{balance: balance(2, 0, 100), txids: xpubTxids{
+				{txid: "tx2", height: 20, inputOutput: txInput},
+				{txid: "tx1", height: 10, inputOutput: txOutput},
+			}},
+			xpubAddress{},
+		),
+		newData(
+			xpubAddress{balance: balance(1, 90, 0), txids: xpubTxids{
+				{txid: "tx2", height: 20, inputOutput: txOutput},
+			}},
+		),
+	}
+	balanceSat, sentSat := mergeXpubsBalances(datas)
+	if balanceSat.Int64() != 90 || sentSat.Int64() != 100 {
+		t.Errorf("mergeXpubsBalances() = %v, %v, want 90, 100", balanceSat, sentSat)
+	}
+	if estimate := datas[0].txCountEstimate + datas[1].txCountEstimate; estimate != 3 {
+		t.Errorf("txCountEstimate = %d, want 3", estimate)
+	}
+	txc, txCount := mergeXpubsTxids(datas, nil)
+	if txCount != 2 {
+		t.Errorf("mergeXpubsTxids() txCount = %d, want 2", txCount)
+	}
+	if len(txc) != 2 || txc[0].txid != "tx2" || txc[1].txid != "tx1" {
+		t.Errorf("mergeXpubsTxids() = %+v", txc)
+	}
+	// the txs are counted regardless of the filter
+	txc, txCount = mergeXpubsTxids(datas, func(txid *xpubTxid, ad *xpubAddress) bool {
+		return txid.inputOutput&txOutput != 0
+	})
+	if txCount != 2 {
+		t.Errorf("mergeXpubsTxids() filtered txCount = %d, want 2", txCount)
+	}
+	// tx2 is filtered out as an input of the first descriptor but passes as an output of the second one
+	if len(txc) != 2 || txc[0].txid != "tx1" || txc[1].txid != "tx2" || txc[1].inputOutput != txOutput {
+		t.Errorf("mergeXpubsTxids() filtered = %+v", txc)
+	}
+}
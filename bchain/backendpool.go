@@ -0,0 +1,255 @@
+package bchain
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/trezor/blockbook/common"
+)
+
+const (
+	// BackendCheckPeriod is the period of the health check of the backend endpoints
+	BackendCheckPeriod = 10 * time.Second
+	// the active endpoint is switched to another one only if it lags behind the best endpoint by more blocks
+	maxBackendHeightLag = 2
+)
+
+// BackendCheckFunc returns the best height of the backend endpoint with given index
+type BackendCheckFunc func(index int) (uint32, error)
+
+// OnBackendSwitchFunc is called when the active backend endpoint is changed
+type OnBackendSwitchFunc func(index int)
+
+type backendEndpoint struct {
+	url        string
+	healthy    bool
+	bestHeight uint32
+	latency    time.Duration
+	err        string
+}
+
+// BackendPool keeps the health state of multiple backend endpoints and selects the active one
+// The endpoints are checked periodically by their best height and latency. The active endpoint is kept
+// as long as it is healthy and synchronized, otherwise the healthy endpoint with the best height and lowest latency is selected.
+type BackendPool struct {
+	mux       sync.Mutex
+	endpoints []backendEndpoint
+	active    int
+	check     BackendCheckFunc
+	onSwitch  OnBackendSwitchFunc
+	done      chan struct{}
+}
+
+// NewBackendPool creates the pool of the endpoints with given urls, the first url is the initially active one
+func NewBackendPool(urls []string, check BackendCheckFunc, onSwitch OnBackendSwitchFunc) *BackendPool {
+	p := &BackendPool{
+		endpoints: make([]backendEndpoint, len(urls)),
+		check:     check,
+		onSwitch:  onSwitch,
+		done:      make(chan struct{}),
+	}
+	for i := range urls {
+		p.endpoints[i] = backendEndpoint{url: urls[i], healthy: true}
+	}
+	return p
+}
+
+// BackendURLs returns the list of unique backend urls from the primary url and the list of additional urls
+func BackendURLs(primary string, others []string) []string {
+	var urls []string
+	seen := make(map[string]struct{})
+	for _, u := range append([]string{primary}, others...) {
+		if _, found := seen[u]; u == "" || found {
+			continue
+		}
+		seen[u] = struct{}{}
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// Start checks all endpoints and starts the periodic health check
+func (p *BackendPool) Start(period time.Duration) {
+	p.Check()
+	go func() {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.Check()
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic health check
+func (p *BackendPool) Stop() {
+	close(p.done)
+}
+
+// Check checks the state of all endpoints and selects the active one
+func (p *BackendPool) Check() {
+	var wg sync.WaitGroup
+	results := make([]backendEndpoint, len(p.endpoints))
+	for i := range p.endpoints {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			start := time.Now()
+			height, err := p.check(i)
+			r := &results[i]
+			r.latency = time.Since(start)
+			if err != nil {
+				r.err = safeBackendError(err, p.endpoints[i].url)
+			} else {
+				r.healthy = true
+				r.bestHeight = height
+			}
+		}(i)
+	}
+	wg.Wait()
+	p.mux.Lock()
+	for i := range p.endpoints {
+		e := &p.endpoints[i]
+		if e.healthy && !results[i].healthy {
+			glog.Warning("backend ", safeBackendURL(e.url), " is unhealthy: ", results[i].err)
+		} else if !e.healthy && results[i].healthy {
+			glog.Info("backend ", safeBackendURL(e.url), " is healthy")
+		}
+		e.healthy = results[i].healthy
+		e.err = results[i].err
+		e.latency = results[i].latency
+		if e.healthy {
+			e.bestHeight = results[i].bestHeight
+		}
+	}
+	switched := p.selectActive()
+	p.mux.Unlock()
+	p.notifySwitch(switched)
+}
+
+// selectActive selects the active endpoint, returns -1 if the active endpoint did not change; must be called with the lock held
+func (p *BackendPool) selectActive() int {
+	best := -1
+	for i := range p.endpoints {
+		e := &p.endpoints[i]
+		if !e.healthy {
+			continue
+		}
+		if best < 0 || e.bestHeight > p.endpoints[best].bestHeight ||
+			(e.bestHeight == p.endpoints[best].bestHeight && e.latency < p.endpoints[best].latency) {
+			best = i
+		}
+	}
+	if best < 0 || best == p.active {
+		return -1
+	}
+	a := &p.endpoints[p.active]
+	if a.healthy && a.bestHeight+maxBackendHeightLag >= p.endpoints[best].bestHeight {
+		return -1
+	}
+	glog.Warning("backend switched from ", safeBackendURL(a.url), " to ", safeBackendURL(p.endpoints[best].url))
+	p.active = best
+	return best
+}
+
+func (p *BackendPool) notifySwitch(index int) {
+	if index >= 0 && p.onSwitch != nil {
+		p.onSwitch(index)
+	}
+}
+
+// Active returns the index and url of the active endpoint
+func (p *BackendPool) Active() (int, string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.active, p.endpoints[p.active].url
+}
+
+// URL returns the url of the endpoint with given index
+func (p *BackendPool) URL(index int) string {
+	return p.endpoints[index].url
+}
+
+// ReportError marks the endpoint unhealthy after a failed call and fails over to another healthy endpoint
+// returns the index and url of the active endpoint after the failover
+func (p *BackendPool) ReportError(index int, err error) (int, string) {
+	p.mux.Lock()
+	e := &p.endpoints[index]
+	if e.healthy {
+		glog.Warning("backend ", safeBackendURL(e.url), " is unhealthy: ", err)
+	}
+	e.healthy = false
+	e.err = safeBackendError(err, e.url)
+	switched := p.selectActive()
+	active, url := p.active, p.endpoints[p.active].url
+	p.mux.Unlock()
+	p.notifySwitch(switched)
+	return active, url
+}
+
+// Endpoints returns the state of the endpoints
+func (p *BackendPool) Endpoints() []common.BackendEndpoint {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	r := make([]common.BackendEndpoint, len(p.endpoints))
+	for i := range p.endpoints {
+		e := &p.endpoints[i]
+		r[i] = common.BackendEndpoint{
+			URL:        safeBackendURL(e.url),
+			Active:     i == p.active,
+			Healthy:    e.healthy,
+			BestHeight: e.bestHeight,
+			LatencyMs:  float64(e.latency) / float64(time.Millisecond),
+			Error:      e.err,
+		}
+	}
+	return r
+}
+
+// safeBackendURL returns the url without credentials, path and query, which may contain api keys
+func safeBackendURL(u string) string {
+	pu, err := url.Parse(u)
+	if err != nil || pu.Host == "" {
+		return "backend"
+	}
+	return pu.Scheme + "://" + pu.Host
+}
+
+var backendErrorURLRegex = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+
+// safeBackendError returns the text of the error with the urls reduced to scheme and host
+// and without the credentials, path and query of the endpoint url, the error is published in the status API
+func safeBackendError(err error, u string) string {
+	s := backendErrorURLRegex.ReplaceAllStringFunc(err.Error(), safeBackendURL)
+	pu, perr := url.Parse(u)
+	if perr != nil {
+		return s
+	}
+	var secrets []string
+	if pu.User != nil {
+		secrets = append(secrets, pu.User.String())
+		if password, set := pu.User.Password(); set {
+			secrets = append(secrets, password)
+		}
+	}
+	if pu.RawQuery != "" {
+		secrets = append(secrets, pu.RawQuery)
+	}
+	if p := strings.Trim(pu.EscapedPath(), "/"); p != "" {
+		secrets = append(secrets, p)
+	}
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, "***")
+		}
+	}
+	return s
+}
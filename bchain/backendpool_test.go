@@ -0,0 +1,159 @@
+//go:build unittest
+
+package bchain
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testBackends struct {
+	mux      sync.Mutex
+	heights  []uint32
+	errs     []error
+	delays   []time.Duration
+	switched []int
+}
+
+func (b *testBackends) check(index int) (uint32, error) {
+	b.mux.Lock()
+	height, err, delay := b.heights[index], b.errs[index], b.delays[index]
+	b.mux.Unlock()
+	time.Sleep(delay)
+	return height, err
+}
+
+func (b *testBackends) onSwitch(index int) {
+	b.mux.Lock()
+	b.switched = append(b.switched, index)
+	b.mux.Unlock()
+}
+
+func (b *testBackends) set(index int, height uint32, err error) {
+	b.mux.Lock()
+	b.heights[index] = height
+	b.errs[index] = err
+	b.mux.Unlock()
+}
+
+// testEndpointState is common.BackendEndpoint without the measured latency
+type testEndpointState struct {
+	URL        string
+	Active     bool
+	Healthy    bool
+	BestHeight uint32
+	Error      string
+}
+
+func TestBackendURLs(t *testing.T) {
+	got := BackendURLs("http://a:8030", []string{"http://b:8030", "", "http://a:8030", "http://c:8030", "http://b:8030"})
+	want := []string{"http://a:8030", "http://b:8030", "http://c:8030"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BackendURLs() = %v, want %v", got, want)
+	}
+}
+
+func TestBackendPool(t *testing.T) {
+	b := &testBackends{
+		heights: []uint32{100, 101, 101},
+		errs:    make([]error, 3),
+		delays:  []time.Duration{0, 50 * time.Millisecond, 0},
+	}
+	p := NewBackendPool([]string{"http://user:pass@a:8030", "https://b/api/key", "http://c:8030"}, b.check, b.onSwitch)
+	active := func(want int) {
+		t.Helper()
+		if i, _ := p.Active(); i != want {
+			t.Errorf("active = %d, want %d", i, want)
+		}
+	}
+
+	// the first endpoint lags only by one block, it is kept active
+	p.Check()
+	active(0)
+
+	// the first endpoint lags too much, the endpoint with the best height and lower latency is selected
+	b.set(1, 103, nil)
+	b.set(2, 103, nil)
+	p.Check()
+	active(2)
+
+	// the active endpoint is kept even if another one has lower latency
+	b.mux.Lock()
+	b.delays[1], b.delays[2] = 0, 50*time.Millisecond
+	b.mux.Unlock()
+	p.Check()
+	active(2)
+
+	// failed call fails over immediately
+	if i, url := p.ReportError(2, errors.New("connection refused")); i != 1 || url != "https://b/api/key" {
+		t.Errorf("ReportError() = %d %v, want 1 https://b/api/key", i, url)
+	}
+
+	// unhealthy endpoint is not selected
+	b.set(0, 110, errors.New("timeout"))
+	p.Check()
+	active(1)
+
+	want := []testEndpointState{
+		{URL: "http://a:8030", Healthy: false, BestHeight: 100, Error: "timeout"},
+		{URL: "https://b", Active: true, Healthy: true, BestHeight: 103},
+		{URL: "http://c:8030", Healthy: true, BestHeight: 103},
+	}
+	got := p.Endpoints()
+	if len(got) != len(want) {
+		t.Fatalf("Endpoints() = %+v, want %+v", got, want)
+	}
+	for i := range got {
+		g := testEndpointState{got[i].URL, got[i].Active, got[i].Healthy, got[i].BestHeight, got[i].Error}
+		if g != want[i] {
+			t.Errorf("Endpoints()[%d] = %+v, want %+v", i, g, want[i])
+		}
+	}
+	if !reflect.DeepEqual(b.switched, []int{2, 1}) {
+		t.Errorf("switched = %v, want %v", b.switched, []int{2, 1})
+	}
+}
+
+func Test_safeBackendError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		url  string
+		want string
+	}{
+		{
+			name: "url in the error",
+			err:  errors.New(`Post "https://eth.example.com/v3/0123456789abcdef": dial tcp: lookup eth.example.com: no such host`),
+			url:  "https://eth.example.com/v3/0123456789abcdef",
+			want: `Post "https://eth.example.com": dial tcp: lookup eth.example.com: no such host`,
+		},
+		{
+			name: "credentials and query",
+			err:  errors.New("http://user:***@b:8030?apikey=secret: 401 Unauthorized, user:secret-password apikey=secret"),
+			url:  "http://user:secret-password@b:8030?apikey=secret",
+			want: "http://b:8030 401 Unauthorized, *** ***",
+		},
+		{
+			name: "api key in the path",
+			err:  errors.New("invalid api key 0123456789abcdef"),
+			url:  "https://eth.example.com/0123456789abcdef",
+			want: "invalid api key ***",
+		},
+		{
+			name: "no secrets",
+			err:  errors.New("context deadline exceeded"),
+			url:  "http://a:8030",
+			want: "context deadline exceeded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := safeBackendError(tt.err, tt.url); got != tt.want {
+				t.Errorf("safeBackendError() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
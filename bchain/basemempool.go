@@ -6,6 +6,21 @@ import (
 	"time"
 )
 
+// maximum number of recently removed transactions kept by the mempool
+const maxRemovedTxs = 1000
+
+// rough estimates of the memory used by the mempool structs, in bytes, including the overhead of strings, slices and maps
+const (
+	txidSize       = 64 + 16
+	mapEntrySize   = 32
+	txEntrySize    = txidSize + 48 + mapEntrySize
+	addrIndexSize  = 24
+	addrDescSize   = 16 + 24 + mapEntrySize
+	outpointSize   = 24 + 64
+	relationsSize  = 80
+	lightEntrySize = txidSize + 16 + mapEntrySize
+)
+
 type addrIndex struct {
 	addrDesc string
 	n        int32
@@ -14,11 +29,13 @@ type addrIndex struct {
 type txEntry struct {
 	addrIndexes []addrIndex
 	time        uint32
+	relations   *txRelations
 }
 
 type txidio struct {
-	txid string
-	io   []addrIndex
+	txid      string
+	io        []addrIndex
+	relations *txRelations
 }
 
 // BaseMempool is mempool base handle
@@ -27,8 +44,10 @@ type BaseMempool struct {
 	mux          sync.Mutex
 	txEntries    map[string]txEntry
 	addrDescToTx map[string][]Outpoint
+	removedTxs   []MempoolTxRemoval
 	OnNewTxAddr  OnNewTxAddrFunc
 	OnNewTx      OnNewTxFunc
+	OnTxRemoved  OnTxRemovedFunc
 }
 
 // GetTransactions returns slice of mempool transactions for given address
@@ -88,6 +107,50 @@ func (m *BaseMempool) removeEntryFromMempool(txid string, entry txEntry) {
 	}
 }
 
+// newTxRemoval creates the removal info of the entry and stores it in the list of recently removed transactions.
+// The caller is responsible for locking!
+func (m *BaseMempool) newTxRemoval(txid string, entry txEntry, reason MempoolRemovalReason, conflictingTxid string) MempoolTxRemoval {
+	r := MempoolTxRemoval{
+		Txid:            txid,
+		Reason:          reason,
+		ConflictingTxid: conflictingTxid,
+		Time:            uint32(time.Now().Unix()),
+	}
+	seen := make(map[string]struct{}, len(entry.addrIndexes))
+	for _, si := range entry.addrIndexes {
+		if _, found := seen[si.addrDesc]; !found {
+			seen[si.addrDesc] = struct{}{}
+			r.AddrDescs = append(r.AddrDescs, AddressDescriptor(si.addrDesc))
+		}
+	}
+	if len(m.removedTxs) >= maxRemovedTxs {
+		m.removedTxs = m.removedTxs[1:]
+	}
+	m.removedTxs = append(m.removedTxs, r)
+	return r
+}
+
+// notifyTxRemovals sends notifications about removed transactions, it must be called without holding the lock
+func (m *BaseMempool) notifyTxRemovals(removals []MempoolTxRemoval) {
+	if m.OnTxRemoved != nil {
+		for i := range removals {
+			m.OnTxRemoved(&removals[i])
+		}
+	}
+}
+
+// GetRemovedTransactions returns recently removed transactions, the most recent first
+func (m *BaseMempool) GetRemovedTransactions() []MempoolTxRemoval {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	rv := make([]MempoolTxRemoval, len(m.removedTxs))
+	for i, j := len(m.removedTxs)-1, 0; i >= 0; i-- {
+		rv[j] = m.removedTxs[i]
+		j++
+	}
+	return rv
+}
+
 // GetAllEntries returns all mempool entries sorted by fist seen time in descending order
 func (m *BaseMempool) GetAllEntries() MempoolTxidEntries {
 	i := 0
@@ -105,6 +168,29 @@ func (m *BaseMempool) GetAllEntries() MempoolTxidEntries {
 	return entries
 }
 
+// GetTxPackage returns package (ancestors and descendants) data of a mempool transaction
+// the base implementation does not track the relations between transactions and returns nil
+func (m *BaseMempool) GetTxPackage(txid string) *MempoolTxPackage {
+	return nil
+}
+
+// GetStats returns the number of tracked transactions and the estimate of the memory used by them
+func (m *BaseMempool) GetStats() MempoolStats {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	stats := MempoolStats{
+		Txs:       len(m.txEntries),
+		AddrDescs: len(m.addrDescToTx),
+	}
+	for _, entry := range m.txEntries {
+		stats.MemoryBytes += txEntrySize + int64(len(entry.addrIndexes))*addrIndexSize
+	}
+	for addrDesc, outpoints := range m.addrDescToTx {
+		stats.MemoryBytes += addrDescSize + int64(len(addrDesc)) + int64(len(outpoints))*24
+	}
+	return stats
+}
+
 // GetTransactionTime returns first seen time of a transaction
 func (m *BaseMempool) GetTransactionTime(txid string) uint32 {
 	m.mux.Lock()
@@ -280,6 +280,12 @@ func (p *BaseParser) IsAddrDescIndexable(addrDesc AddressDescriptor) bool {
 	return true
 }
 
+// IsAddrDescStandard returns true if the output script is standard
+// by default all AddressDescriptors are standard
+func (p *BaseParser) IsAddrDescStandard(addrDesc AddressDescriptor) bool {
+	return true
+}
+
 // ParseXpub is unsupported
 func (p *BaseParser) ParseXpub(xpub string) (*XpubDescriptor, error) {
 	return nil, errors.New("Not supported")
@@ -300,6 +306,11 @@ func (p *BaseParser) DeriveAddressDescriptorsFromTo(descriptor *XpubDescriptor,
 	return nil, errors.New("Not supported")
 }
 
+// CreateXpubPsbt is unsupported
+func (p *BaseParser) CreateXpubPsbt(descriptor *XpubDescriptor, inputs []XpubPsbtInput, outputs []XpubPsbtOutput) ([]byte, error) {
+	return nil, errors.New("Not supported")
+}
+
 // EthereumTypeGetErc20FromTx is unsupported
 func (p *BaseParser) EthereumTypeGetErc20FromTx(tx *Tx) ([]Erc20Transfer, error) {
 	return nil, errors.New("Not supported")
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"math/big"
 	"reflect"
+	"strconv"
 	"time"
 
 	"github.com/juju/errors"
@@ -197,8 +198,8 @@ func (c *blockChainWithMetrics) CreateMempool(chain bchain.BlockChain) (bchain.M
 	return c.b.CreateMempool(chain)
 }
 
-func (c *blockChainWithMetrics) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOutpointFunc, onNewTxAddr bchain.OnNewTxAddrFunc, onNewTx bchain.OnNewTxFunc) error {
-	return c.b.InitializeMempool(addrDescForOutpoint, onNewTxAddr, onNewTx)
+func (c *blockChainWithMetrics) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOutpointFunc, onNewTxAddr bchain.OnNewTxAddrFunc, onNewTx bchain.OnNewTxFunc, onTxRemoved bchain.OnTxRemovedFunc) error {
+	return c.b.InitializeMempool(addrDescForOutpoint, onNewTxAddr, onNewTx, onTxRemoved)
 }
 
 func (c *blockChainWithMetrics) Shutdown(ctx context.Context) error {
@@ -223,7 +224,21 @@ func (c *blockChainWithMetrics) GetSubversion() string {
 
 func (c *blockChainWithMetrics) GetChainInfo() (v *bchain.ChainInfo, err error) {
 	defer func(s time.Time) { c.observeRPCLatency("GetChainInfo", s, err) }(time.Now())
-	return c.b.GetChainInfo()
+	v, err = c.b.GetChainInfo()
+	if err == nil && v != nil {
+		// the endpoints are labeled by their index, the urls without path are not unique
+		for i, e := range v.Endpoints {
+			var healthy float64
+			if e.Healthy {
+				healthy = 1
+			}
+			label := common.Labels{"endpoint": strconv.Itoa(i)}
+			c.m.BackendEndpointHealthy.With(label).Set(healthy)
+			c.m.BackendEndpointHeight.With(label).Set(float64(e.BestHeight))
+			c.m.BackendEndpointLatency.With(label).Set(e.LatencyMs)
+		}
+	}
+	return v, err
 }
 
 func (c *blockChainWithMetrics) GetBestBlockHash() (v string, err error) {
@@ -246,6 +261,15 @@ func (c *blockChainWithMetrics) GetBlockHeader(hash string) (v *bchain.BlockHead
 	return c.b.GetBlockHeader(hash)
 }
 
+func (c *blockChainWithMetrics) GetBlockHeaderRaw(hash string) (v []byte, err error) {
+	g, ok := c.b.(bchain.BlockHeaderRawGetter)
+	if !ok {
+		return nil, errors.New("Not supported")
+	}
+	defer func(s time.Time) { c.observeRPCLatency("GetBlockHeaderRaw", s, err) }(time.Now())
+	return g.GetBlockHeaderRaw(hash)
+}
+
 func (c *blockChainWithMetrics) GetBlock(hash string, height uint32) (v *bchain.Block, err error) {
 	defer func(s time.Time) { c.observeRPCLatency("GetBlock", s, err) }(time.Now())
 	return c.b.GetBlock(hash, height)
@@ -281,6 +305,86 @@ func (c *blockChainWithMetrics) GetTransactionForMempool(txid string) (v *bchain
 	return c.b.GetTransactionForMempool(txid)
 }
 
+func (c *blockChainWithMetrics) TransactionBatchSize() int {
+	return bchain.TransactionBatchSize(c.b)
+}
+
+func (c *blockChainWithMetrics) SupportsGetMempoolEntries() bool {
+	g, ok := c.b.(bchain.MempoolEntriesGetter)
+	return ok && g.SupportsGetMempoolEntries()
+}
+
+func (c *blockChainWithMetrics) GetMempoolEntries() (v map[string]*bchain.MempoolEntry, err error) {
+	g, ok := c.b.(bchain.MempoolEntriesGetter)
+	if !ok {
+		return nil, errors.New("Not supported")
+	}
+	defer func(s time.Time) { c.observeRPCLatency("GetMempoolEntries", s, err) }(time.Now())
+	return g.GetMempoolEntries()
+}
+
+func (c *blockChainWithMetrics) SupportsTestMempoolAccept() bool {
+	return bchain.SupportsTestMempoolAccept(c.b)
+}
+
+func (c *blockChainWithMetrics) TestMempoolAccept(tx string) (v *bchain.MempoolAcceptResult, err error) {
+	t, ok := c.b.(bchain.MempoolAcceptTester)
+	if !ok {
+		return nil, errors.New("Not supported")
+	}
+	defer func(s time.Time) { c.observeRPCLatency("TestMempoolAccept", s, err) }(time.Now())
+	return t.TestMempoolAccept(tx)
+}
+
+func (c *blockChainWithMetrics) GetTxRelayPolicy() *bchain.TxRelayPolicy {
+	if g, ok := c.b.(bchain.TxRelayPolicyGetter); ok {
+		return g.GetTxRelayPolicy()
+	}
+	return nil
+}
+
+func (c *blockChainWithMetrics) GetTransactionsForMempool(txids []string) (v []*bchain.Tx, errs []error) {
+	tb, ok := c.b.(bchain.TransactionBatcher)
+	if !ok || tb.TransactionBatchSize() < 2 {
+		return c.getTransactions(txids, c.GetTransactionForMempool)
+	}
+	defer func(s time.Time) { c.observeRPCBatchLatency("GetTransactionsForMempool", s, errs) }(time.Now())
+	return tb.GetTransactionsForMempool(txids)
+}
+
+func (c *blockChainWithMetrics) GetTransactions(txids []string) (v []*bchain.Tx, errs []error) {
+	tb, ok := c.b.(bchain.TransactionBatcher)
+	if !ok || tb.TransactionBatchSize() < 2 {
+		return c.getTransactions(txids, c.GetTransaction)
+	}
+	defer func(s time.Time) { c.observeRPCBatchLatency("GetTransactions", s, errs) }(time.Now())
+	return tb.GetTransactions(txids)
+}
+
+// getTransactions gets the transactions one by one if the backend does not support batching
+// the coin specific GetTransaction and GetTransactionForMempool are used in that case
+func (c *blockChainWithMetrics) getTransactions(txids []string, getTx func(txid string) (*bchain.Tx, error)) ([]*bchain.Tx, []error) {
+	txs := make([]*bchain.Tx, len(txids))
+	errs := make([]error, len(txids))
+	for i, txid := range txids {
+		txs[i], errs[i] = getTx(txid)
+	}
+	return txs, errs
+}
+
+// observeRPCBatchLatency observes the latency of the whole batch, the batch is counted as failed if any of its items failed
+// other than by a missing transaction
+func (c *blockChainWithMetrics) observeRPCBatchLatency(method string, start time.Time, errs []error) {
+	var err error
+	for _, e := range errs {
+		if e != nil && e != bchain.ErrTxNotFound {
+			err = e
+			break
+		}
+	}
+	c.observeRPCLatency(method, start, err)
+}
+
 func (c *blockChainWithMetrics) EstimateSmartFee(blocks int, conservative bool) (v big.Int, err error) {
 	defer func(s time.Time) { c.observeRPCLatency("EstimateSmartFee", s, err) }(time.Now())
 	return c.b.EstimateSmartFee(blocks, conservative)
@@ -348,6 +452,10 @@ func (c *mempoolWithMetrics) Resync() (count int, err error) {
 	count, err = c.mempool.Resync()
 	if err == nil {
 		c.m.MempoolSize.Set(float64(count))
+		stats := c.mempool.GetStats()
+		c.m.MempoolLightSize.Set(float64(stats.LightTxs))
+		c.m.MempoolAddresses.Set(float64(stats.AddrDescs))
+		c.m.MempoolMemory.Set(float64(stats.MemoryBytes))
 	}
 	return count, err
 }
@@ -370,3 +478,15 @@ func (c *mempoolWithMetrics) GetAllEntries() (v bchain.MempoolTxidEntries) {
 func (c *mempoolWithMetrics) GetTransactionTime(txid string) uint32 {
 	return c.mempool.GetTransactionTime(txid)
 }
+
+func (c *mempoolWithMetrics) GetTxPackage(txid string) *bchain.MempoolTxPackage {
+	return c.mempool.GetTxPackage(txid)
+}
+
+func (c *mempoolWithMetrics) GetRemovedTransactions() []bchain.MempoolTxRemoval {
+	return c.mempool.GetRemovedTransactions()
+}
+
+func (c *mempoolWithMetrics) GetStats() bchain.MempoolStats {
+	return c.mempool.GetStats()
+}
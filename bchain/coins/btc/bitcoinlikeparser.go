@@ -6,7 +6,9 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"math/big"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode/utf8"
@@ -15,10 +17,12 @@ import (
 	"github.com/juju/errors"
 	"github.com/martinboehm/btcd/blockchain"
 	"github.com/martinboehm/btcd/btcec"
+	"github.com/martinboehm/btcd/chaincfg/chainhash"
 	"github.com/martinboehm/btcd/wire"
 	"github.com/martinboehm/btcutil"
 	"github.com/martinboehm/btcutil/chaincfg"
 	"github.com/martinboehm/btcutil/hdkeychain"
+	"github.com/martinboehm/btcutil/psbt"
 	"github.com/martinboehm/btcutil/txscript"
 	"github.com/trezor/blockbook/bchain"
 )
@@ -91,6 +95,26 @@ func (p *BitcoinLikeParser) IsAddrDescIndexable(addrDesc bchain.AddressDescripto
 	return true
 }
 
+// maxStandardNullDataSize is the maximum size of the standard OP_RETURN script, including the opcodes
+const maxStandardNullDataSize = 83
+
+// IsAddrDescStandard returns true if the output script is standard, i.e. it is relayed by the default bitcoind policy
+// bare multisig scripts are standard only with at most 3 public keys
+func (p *BitcoinLikeParser) IsAddrDescStandard(addrDesc bchain.AddressDescriptor) bool {
+	switch txscript.GetScriptClass(addrDesc) {
+	case txscript.PubKeyTy, txscript.PubKeyHashTy, txscript.ScriptHashTy,
+		txscript.WitnessV0PubKeyHashTy, txscript.WitnessV0ScriptHashTy,
+		txscript.WitnessV1TaprootTy, txscript.WitnessUnknownTy:
+		return true
+	case txscript.MultiSigTy:
+		keys, required, err := txscript.CalcMultiSigStats(addrDesc)
+		return err == nil && keys >= 1 && keys <= 3 && required >= 1 && required <= keys
+	case txscript.NullDataTy:
+		return len(addrDesc) <= maxStandardNullDataSize
+	}
+	return false
+}
+
 // addressToOutputScript converts bitcoin address to ScriptPubKey
 func (p *BitcoinLikeParser) addressToOutputScript(address string) ([]byte, error) {
 	da, err := btcutil.DecodeAddress(address, p.Params)
@@ -269,6 +293,20 @@ func (p *BitcoinLikeParser) ParseTx(b []byte) (*bchain.Tx, error) {
 	return &tx, nil
 }
 
+// GetTxVSize returns virtual size of the transaction, computed from its weight as defined by BIP141
+func (p *BitcoinLikeParser) GetTxVSize(tx *bchain.Tx) (int64, error) {
+	b, err := hex.DecodeString(tx.Hex)
+	if err != nil {
+		return 0, err
+	}
+	t := wire.MsgTx{}
+	if err := t.Deserialize(bytes.NewReader(b)); err != nil {
+		return 0, err
+	}
+	weight := int64(t.SerializeSizeStripped())*3 + int64(len(b))
+	return (weight + 3) / 4, nil
+}
+
 // ParseBlock parses raw block to our Block struct
 func (p *BitcoinLikeParser) ParseBlock(b []byte) (*bchain.Block, error) {
 	w := wire.MsgBlock{}
@@ -288,7 +326,8 @@ func (p *BitcoinLikeParser) ParseBlock(b []byte) (*bchain.Block, error) {
 			Size: len(b),
 			Time: w.Header.Timestamp.Unix(),
 		},
-		Txs: txs,
+		Txs:       txs,
+		RawHeader: append([]byte(nil), b[:wire.MaxBlockHeaderPayload]...),
 	}, nil
 }
 
@@ -415,17 +454,32 @@ func (p *BitcoinLikeParser) xpubDescriptorFromXpub(xpub string) (*bchain.XpubDes
 var (
 	xpubDesriptorRegex     *regexp.Regexp
 	typeSubexpIndex        int
-	bipSubexpIndex         int
 	xpubSubexpIndex        int
+	fingerprintSubexpIndex int
+	originSubexpIndex      int
 	changeSubexpIndex      int
 	changeList1SubexpIndex int
 	changeList2SubexpIndex int
+
+	multisigDescriptorRegex *regexp.Regexp
+	multisigTypeSubexpIndex int
+	multiSubexpIndex        int
+	thresholdSubexpIndex    int
+	keysSubexpIndex         int
+	multisigKeyRegex        *regexp.Regexp
+	keyFingerprintSubexpIdx int
+	keyOriginSubexpIndex    int
+	keyXpubSubexpIndex      int
+	keyChangeSubexpIndex    int
+	keyChangeList1SubexpIdx int
+	keyChangeList2SubexpIdx int
 )
 
 func init() {
-	xpubDesriptorRegex, _ = regexp.Compile(`^(?P<type>(sh\(wpkh|wpkh|pk|pkh|wpkh|wsh|tr))\((\[\w+/(?P<bip>\d+)'/\d+'?/\d+'?\])?(?P<xpub>\w+)(/(({(?P<changelist1>\d+(,\d+)*)})|(<(?P<changelist2>\d+(;\d+)*)>)|(?P<change>\d+))/\*)?\)+`)
+	xpubDesriptorRegex, _ = regexp.Compile(`^(?P<type>(sh\(wpkh|wpkh|pk|pkh|wpkh|wsh|tr))\((\[(?P<fingerprint>[0-9a-fA-F]{8})(?P<origin>(/\d+['h]?)*)\])?(?P<xpub>\w+)(/(({(?P<changelist1>\d+(,\d+)*)})|(<(?P<changelist2>\d+(;\d+)*)>)|(?P<change>\d+))/\*)?\)+`)
 	typeSubexpIndex = xpubDesriptorRegex.SubexpIndex("type")
-	bipSubexpIndex = xpubDesriptorRegex.SubexpIndex("bip")
+	fingerprintSubexpIndex = xpubDesriptorRegex.SubexpIndex("fingerprint")
+	originSubexpIndex = xpubDesriptorRegex.SubexpIndex("origin")
 	xpubSubexpIndex = xpubDesriptorRegex.SubexpIndex("xpub")
 	changeList1SubexpIndex = xpubDesriptorRegex.SubexpIndex("changelist1")
 	changeList2SubexpIndex = xpubDesriptorRegex.SubexpIndex("changelist2")
@@ -433,10 +487,280 @@ func init() {
 	if changeSubexpIndex < 0 {
 		panic("Invalid bitcoinparser xpubDesriptorRegex")
 	}
+	multisigDescriptorRegex, _ = regexp.Compile(`^(?P<type>sh\(wsh|sh|wsh)\((?P<multi>sortedmulti|multi)\((?P<threshold>\d+),(?P<keys>[^()]+)\)\)+`)
+	multisigTypeSubexpIndex = multisigDescriptorRegex.SubexpIndex("type")
+	multiSubexpIndex = multisigDescriptorRegex.SubexpIndex("multi")
+	thresholdSubexpIndex = multisigDescriptorRegex.SubexpIndex("threshold")
+	keysSubexpIndex = multisigDescriptorRegex.SubexpIndex("keys")
+	if keysSubexpIndex < 0 {
+		panic("Invalid bitcoinparser multisigDescriptorRegex")
+	}
+	multisigKeyRegex, _ = regexp.Compile(`^(\[(?P<fingerprint>[0-9a-fA-F]{8})(?P<origin>(/\d+['h]?)*)\])?(?P<xpub>\w+)(/(({(?P<changelist1>\d+(,\d+)*)})|(<(?P<changelist2>\d+(;\d+)*)>)|(?P<change>\d+))/\*)?$`)
+	keyFingerprintSubexpIdx = multisigKeyRegex.SubexpIndex("fingerprint")
+	keyOriginSubexpIndex = multisigKeyRegex.SubexpIndex("origin")
+	keyXpubSubexpIndex = multisigKeyRegex.SubexpIndex("xpub")
+	keyChangeList1SubexpIdx = multisigKeyRegex.SubexpIndex("changelist1")
+	keyChangeList2SubexpIdx = multisigKeyRegex.SubexpIndex("changelist2")
+	keyChangeSubexpIndex = multisigKeyRegex.SubexpIndex("change")
+	if keyChangeSubexpIndex < 0 {
+		panic("Invalid bitcoinparser multisigKeyRegex")
+	}
+}
+
+// parseChangeIndexes parses the change part of the xpub descriptor, either a single index or a list of indexes
+func parseChangeIndexes(change, changeList1, changeList2 string) ([]uint32, error) {
+	if len(change) > 0 {
+		c, err := strconv.ParseUint(change, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		return []uint32{uint32(c)}, nil
+	}
+	if len(changeList1) > 0 || len(changeList2) > 0 {
+		var changes []string
+		if len(changeList1) > 0 {
+			changes = strings.Split(changeList1, ",")
+		} else {
+			changes = strings.Split(changeList2, ";")
+		}
+		if len(changes) == 0 {
+			return nil, errors.New("Invalid xpub descriptor, cannot parse change")
+		}
+		changeIndexes := make([]uint32, len(changes))
+		for i, ch := range changes {
+			c, err := strconv.ParseUint(ch, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			changeIndexes[i] = uint32(c)
+		}
+		return changeIndexes, nil
+	}
+	// default to {0,1}
+	return []uint32{0, 1}, nil
+}
+
+// splitMultisigKeys splits the keys of the multi(...) expression, the commas inside the change list {a,b} do not split
+func splitMultisigKeys(keys string) []string {
+	var r []string
+	depth := 0
+	start := 0
+	for i, c := range keys {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				r = append(r, keys[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(r, keys[start:])
+}
+
+func (p *BitcoinLikeParser) parseMultisigXpub(xpub string, match []string) (*bchain.XpubDescriptor, error) {
+	var descriptor bchain.XpubDescriptor
+	descriptor.XpubDescriptor = xpub
+	// BIP48 is the derivation scheme of the multisig wallets
+	descriptor.Bip = "48"
+	descriptor.Sorted = match[multiSubexpIndex] == "sortedmulti"
+	// the standard limits of the number of the keys, the P2SH redeem script is limited to 520 bytes
+	maxKeys := 20
+	switch match[multisigTypeSubexpIndex] {
+	case "sh":
+		descriptor.Type = bchain.P2SH
+		maxKeys = 15
+	case "sh(wsh":
+		descriptor.Type = bchain.P2SHWSH
+	case "wsh":
+		descriptor.Type = bchain.P2WSH
+	}
+	keys := splitMultisigKeys(match[keysSubexpIndex])
+	if len(keys) > maxKeys {
+		return nil, errors.Errorf("Xpub descriptor has %d keys, maximum is %d", len(keys), maxKeys)
+	}
+	threshold, err := strconv.Atoi(match[thresholdSubexpIndex])
+	if err != nil {
+		return nil, err
+	}
+	if threshold < 1 || threshold > len(keys) {
+		return nil, errors.Errorf("Invalid xpub descriptor threshold %d of %d keys", threshold, len(keys))
+	}
+	descriptor.Threshold = threshold
+	descriptor.Xpubs = make([]string, len(keys))
+	descriptor.ExtKeys = make([]interface{}, len(keys))
+	descriptor.Fingerprints = make([]string, len(keys))
+	descriptor.OriginPaths = make([]string, len(keys))
+	for i, key := range keys {
+		km := multisigKeyRegex.FindStringSubmatch(key)
+		if len(km) <= keyChangeSubexpIndex {
+			return nil, errors.Errorf("Invalid xpub descriptor key %s", key)
+		}
+		changeIndexes, err := parseChangeIndexes(km[keyChangeSubexpIndex], km[keyChangeList1SubexpIdx], km[keyChangeList2SubexpIdx])
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			descriptor.ChangeIndexes = changeIndexes
+			setKeyOrigin(&descriptor, km[keyFingerprintSubexpIdx], km[keyOriginSubexpIndex])
+		} else if !reflect.DeepEqual(changeIndexes, descriptor.ChangeIndexes) {
+			return nil, errors.New("Invalid xpub descriptor, all keys must have the same change indexes")
+		}
+		extKey, err := hdkeychain.NewKeyFromString(km[keyXpubSubexpIndex], p.Params.Base58CksumHasher)
+		if err != nil {
+			return nil, err
+		}
+		descriptor.Xpubs[i] = km[keyXpubSubexpIndex]
+		descriptor.ExtKeys[i] = extKey
+		descriptor.Fingerprints[i], descriptor.OriginPaths[i] = keyOrigin(km[keyFingerprintSubexpIdx], km[keyOriginSubexpIndex])
+	}
+	descriptor.Xpub = descriptor.Xpubs[0]
+	descriptor.ExtKey = descriptor.ExtKeys[0]
+	return &descriptor, nil
+}
+
+// setKeyOrigin stores the key origin [fingerprint/path] to the descriptor, the purpose of the path overrides the default Bip
+func setKeyOrigin(descriptor *bchain.XpubDescriptor, fingerprint, origin string) {
+	if len(fingerprint) == 0 {
+		return
+	}
+	descriptor.Fingerprint, descriptor.OriginPath = keyOrigin(fingerprint, origin)
+	if path := strings.Split(origin, "/"); len(path) > 1 {
+		descriptor.Bip = strings.TrimRight(path[1], "'h")
+	}
+}
+
+// keyOrigin normalizes the key origin [fingerprint/path] to the lowercase fingerprint and the path in the m/84'/0'/0' form
+func keyOrigin(fingerprint, origin string) (string, string) {
+	if len(fingerprint) == 0 {
+		return "", ""
+	}
+	return strings.ToLower(fingerprint), "m" + strings.ReplaceAll(origin, "h", "'")
+}
+
+// descriptor checksum as defined in BIP380
+const (
+	descriptorInputCharset    = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	descriptorChecksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+)
+
+func descriptorPolymod(c uint64, val int) uint64 {
+	c0 := c >> 35
+	c = ((c & 0x7ffffffff) << 5) ^ uint64(val)
+	if c0&1 != 0 {
+		c ^= 0xf5dee51989
+	}
+	if c0&2 != 0 {
+		c ^= 0xa9fdca3312
+	}
+	if c0&4 != 0 {
+		c ^= 0x1bab10e32d
+	}
+	if c0&8 != 0 {
+		c ^= 0x3706b1677a
+	}
+	if c0&16 != 0 {
+		c ^= 0x644d626ffd
+	}
+	return c
+}
+
+// descriptorChecksum computes the checksum of the descriptor (without the #checksum part)
+func descriptorChecksum(desc string) (string, error) {
+	c := uint64(1)
+	cls := 0
+	clsCount := 0
+	for _, ch := range desc {
+		pos := strings.IndexRune(descriptorInputCharset, ch)
+		if pos < 0 {
+			return "", errors.Errorf("Invalid character %q in xpub descriptor", ch)
+		}
+		// the symbol position within the group of 32 characters
+		c = descriptorPolymod(c, pos&31)
+		// the group of the character, 3 groups are combined into one symbol
+		cls = cls*3 + (pos >> 5)
+		clsCount++
+		if clsCount == 3 {
+			c = descriptorPolymod(c, cls)
+			cls = 0
+			clsCount = 0
+		}
+	}
+	if clsCount > 0 {
+		c = descriptorPolymod(c, cls)
+	}
+	for i := 0; i < 8; i++ {
+		c = descriptorPolymod(c, 0)
+	}
+	c ^= 1
+	checksum := make([]byte, 8)
+	for i := range checksum {
+		checksum[i] = descriptorChecksumCharset[(c>>(5*(7-i)))&31]
+	}
+	return string(checksum), nil
+}
+
+// descriptorChangeRegex matches the change part of the keys of the descriptor, a single index or a list of indexes
+var descriptorChangeRegex = regexp.MustCompile(`/(\{\d+(,\d+)*\}|<\d+(;\d+)*>|\d+)/\*`)
+
+// descriptorBranches returns the receive branch and all change indexes used in the descriptor
+func descriptorBranches(desc string) []string {
+	branches := []string{"0"}
+	for _, m := range descriptorChangeRegex.FindAllStringSubmatch(desc, -1) {
+		for _, b := range strings.FieldsFunc(m[1], func(r rune) bool {
+			return r == '{' || r == '}' || r == '<' || r == '>' || r == ',' || r == ';'
+		}) {
+			found := false
+			for _, e := range branches {
+				if e == b {
+					found = true
+					break
+				}
+			}
+			if !found {
+				branches = append(branches, b)
+			}
+		}
+	}
+	return branches
+}
+
+// checkDescriptorChecksum validates the #checksum suffix of the descriptor, if present
+// the clients compute the checksum of the descriptor of a single branch (typically the receive branch /0/*)
+// and substitute the change part afterwards, therefore also the checksums of the single branch descriptors are accepted
+func checkDescriptorChecksum(xpub string) error {
+	i := strings.LastIndexByte(xpub, '#')
+	if i < 0 {
+		return nil
+	}
+	desc, checksum := xpub[:i], xpub[i+1:]
+	expected, err := descriptorChecksum(desc)
+	if err != nil {
+		return err
+	}
+	if checksum == expected {
+		return nil
+	}
+	for _, b := range descriptorBranches(desc) {
+		c, err := descriptorChecksum(descriptorChangeRegex.ReplaceAllLiteralString(desc, "/"+b+"/*"))
+		if err == nil && c == checksum {
+			return nil
+		}
+	}
+	return errors.Errorf("Invalid xpub descriptor checksum %s, expected %s", checksum, expected)
 }
 
 // ParseXpub parses xpub (or xpub descriptor) and returns XpubDescriptor
 func (p *BitcoinLikeParser) ParseXpub(xpub string) (*bchain.XpubDescriptor, error) {
+	if err := checkDescriptorChecksum(xpub); err != nil {
+		return nil, err
+	}
+	if match := multisigDescriptorRegex.FindStringSubmatch(xpub); len(match) > keysSubexpIndex {
+		return p.parseMultisigXpub(xpub, match)
+	}
 	match := xpubDesriptorRegex.FindStringSubmatch(xpub)
 	if len(match) > changeSubexpIndex {
 		var descriptor bchain.XpubDescriptor
@@ -458,46 +782,16 @@ func (p *BitcoinLikeParser) ParseXpub(xpub string) (*bchain.XpubDescriptor, erro
 		default:
 			return nil, errors.Errorf("Xpub descriptor %s is not supported", m)
 		}
-		if len(match[bipSubexpIndex]) > 0 {
-			descriptor.Bip = match[bipSubexpIndex]
-		}
+		setKeyOrigin(&descriptor, match[fingerprintSubexpIndex], match[originSubexpIndex])
 		descriptor.Xpub = match[xpubSubexpIndex]
 		extKey, err := hdkeychain.NewKeyFromString(descriptor.Xpub, p.Params.Base58CksumHasher)
 		if err != nil {
 			return nil, err
 		}
 		descriptor.ExtKey = extKey
-		if len(match[changeSubexpIndex]) > 0 {
-			change, err := strconv.ParseUint(match[changeSubexpIndex], 10, 32)
-			if err != nil {
-				return nil, err
-			}
-			descriptor.ChangeIndexes = []uint32{uint32(change)}
-		} else {
-			if len(match[changeList1SubexpIndex]) > 0 || len(match[changeList2SubexpIndex]) > 0 {
-				var changes []string
-				if len(match[changeList1SubexpIndex]) > 0 {
-					changes = strings.Split(match[changeList1SubexpIndex], ",")
-				} else {
-					changes = strings.Split(match[changeList2SubexpIndex], ";")
-				}
-				if len(changes) == 0 {
-					return nil, errors.New("Invalid xpub descriptor, cannot parse change")
-				}
-				descriptor.ChangeIndexes = make([]uint32, len(changes))
-				for i, ch := range changes {
-					change, err := strconv.ParseUint(ch, 10, 32)
-					if err != nil {
-						return nil, err
-					}
-					descriptor.ChangeIndexes[i] = uint32(change)
-
-				}
-			} else {
-				// default to {0,1}
-				descriptor.ChangeIndexes = []uint32{0, 1}
-			}
-
+		descriptor.ChangeIndexes, err = parseChangeIndexes(match[changeSubexpIndex], match[changeList1SubexpIndex], match[changeList2SubexpIndex])
+		if err != nil {
+			return nil, err
 		}
 		return &descriptor, nil
 	}
@@ -505,19 +799,96 @@ func (p *BitcoinLikeParser) ParseXpub(xpub string) (*bchain.XpubDescriptor, erro
 
 }
 
+// changeExtKeys derives the extended keys of the change branch for all keys of the descriptor
+func changeExtKeys(descriptor *bchain.XpubDescriptor, change uint32) ([]*hdkeychain.ExtendedKey, error) {
+	extKeys := descriptor.ExtKeys
+	if len(extKeys) == 0 {
+		extKeys = []interface{}{descriptor.ExtKey}
+	}
+	changeKeys := make([]*hdkeychain.ExtendedKey, len(extKeys))
+	for i, k := range extKeys {
+		var err error
+		changeKeys[i], err = k.(*hdkeychain.ExtendedKey).Derive(change)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changeKeys, nil
+}
+
+func (p *BitcoinLikeParser) addrDescFromChangeKeys(changeKeys []*hdkeychain.ExtendedKey, index uint32, descriptor *bchain.XpubDescriptor) (bchain.AddressDescriptor, error) {
+	if descriptor.Threshold == 0 {
+		indexExtKey, err := changeKeys[0].Derive(index)
+		if err != nil {
+			return nil, err
+		}
+		return p.addrDescFromExtKey(indexExtKey, descriptor)
+	}
+	pubKeys := make([][]byte, len(changeKeys))
+	for i, k := range changeKeys {
+		indexExtKey, err := k.Derive(index)
+		if err != nil {
+			return nil, err
+		}
+		pubKeys[i] = indexExtKey.PubKeyBytes()
+	}
+	return p.multisigAddrDesc(pubKeys, descriptor)
+}
+
+// multisigScript builds the script <threshold> <pubKey>... <number of pubKeys> OP_CHECKMULTISIG
+func multisigScript(pubKeys [][]byte, descriptor *bchain.XpubDescriptor) ([]byte, error) {
+	if descriptor.Sorted {
+		sort.Slice(pubKeys, func(i, j int) bool { return bytes.Compare(pubKeys[i], pubKeys[j]) < 0 })
+	}
+	builder := txscript.NewScriptBuilder().AddInt64(int64(descriptor.Threshold))
+	for _, pk := range pubKeys {
+		builder.AddData(pk)
+	}
+	return builder.AddInt64(int64(len(pubKeys))).AddOp(txscript.OP_CHECKMULTISIG).Script()
+}
+
+// witnessProgramScript builds the script <witness version: OP_0><len hash><hash>, used as the redeem script of the P2SH wrapped segwit outputs
+func witnessProgramScript(hash []byte) []byte {
+	script := make([]byte, len(hash)+2)
+	script[0] = txscript.OP_0
+	script[1] = byte(len(hash))
+	copy(script[2:], hash)
+	return script
+}
+
+func (p *BitcoinLikeParser) multisigAddrDesc(pubKeys [][]byte, descriptor *bchain.XpubDescriptor) (bchain.AddressDescriptor, error) {
+	script, err := multisigScript(pubKeys, descriptor)
+	if err != nil {
+		return nil, err
+	}
+	var a btcutil.Address
+	switch descriptor.Type {
+	case bchain.P2SH:
+		a, err = btcutil.NewAddressScriptHash(script, p.Params)
+	case bchain.P2SHWSH:
+		scriptHash := sha256.Sum256(script)
+		a, err = btcutil.NewAddressScriptHash(witnessProgramScript(scriptHash[:]), p.Params)
+	case bchain.P2WSH:
+		scriptHash := sha256.Sum256(script)
+		a, err = btcutil.NewAddressWitnessScriptHash(scriptHash[:], p.Params)
+	default:
+		return nil, errors.New("Unsupported multisig xpub descriptor type")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return txscript.PayToAddrScript(a)
+}
+
 // DeriveAddressDescriptors derives address descriptors from given xpub for listed indexes
 func (p *BitcoinLikeParser) DeriveAddressDescriptors(descriptor *bchain.XpubDescriptor, change uint32, indexes []uint32) ([]bchain.AddressDescriptor, error) {
 	ad := make([]bchain.AddressDescriptor, len(indexes))
-	changeExtKey, err := descriptor.ExtKey.(*hdkeychain.ExtendedKey).Derive(change)
+	changeKeys, err := changeExtKeys(descriptor, change)
 	if err != nil {
 		return nil, err
 	}
 	for i, index := range indexes {
-		indexExtKey, err := changeExtKey.Derive(index)
-		if err != nil {
-			return nil, err
-		}
-		ad[i], err = p.addrDescFromExtKey(indexExtKey, descriptor)
+		ad[i], err = p.addrDescFromChangeKeys(changeKeys, index, descriptor)
 		if err != nil {
 			return nil, err
 		}
@@ -530,17 +901,13 @@ func (p *BitcoinLikeParser) DeriveAddressDescriptorsFromTo(descriptor *bchain.Xp
 	if toIndex <= fromIndex {
 		return nil, errors.New("toIndex<=fromIndex")
 	}
-	changeExtKey, err := descriptor.ExtKey.(*hdkeychain.ExtendedKey).Derive(change)
+	changeKeys, err := changeExtKeys(descriptor, change)
 	if err != nil {
 		return nil, err
 	}
 	ad := make([]bchain.AddressDescriptor, toIndex-fromIndex)
 	for index := fromIndex; index < toIndex; index++ {
-		indexExtKey, err := changeExtKey.Derive(index)
-		if err != nil {
-			return nil, err
-		}
-		ad[index-fromIndex], err = p.addrDescFromExtKey(indexExtKey, descriptor)
+		ad[index-fromIndex], err = p.addrDescFromChangeKeys(changeKeys, index, descriptor)
 		if err != nil {
 			return nil, err
 		}
@@ -550,6 +917,10 @@ func (p *BitcoinLikeParser) DeriveAddressDescriptorsFromTo(descriptor *bchain.Xp
 
 // DerivationBasePath returns base path of xpub
 func (p *BitcoinLikeParser) DerivationBasePath(descriptor *bchain.XpubDescriptor) (string, error) {
+	// the key origin is the path as known to the wallet, even for non-standard account layouts
+	if len(descriptor.OriginPath) > 1 {
+		return descriptor.OriginPath, nil
+	}
 	var c string
 	extKey := descriptor.ExtKey.(*hdkeychain.ExtendedKey)
 	cn := extKey.ChildNum()
@@ -563,3 +934,163 @@ func (p *BitcoinLikeParser) DerivationBasePath(descriptor *bchain.XpubDescriptor
 	}
 	return "m/" + descriptor.Bip + "'/" + strconv.Itoa(int(p.Slip44)) + "'/" + c, nil
 }
+
+// keyOriginDerivation returns the master key fingerprint and the derivation path of the key derived from extKey by change/index
+// the key without the key origin is described relative to the xpub, with the fingerprint of the xpub itself
+func keyOriginDerivation(extKey *hdkeychain.ExtendedKey, fingerprint, originPath string, change, index uint32) (uint32, []uint32, error) {
+	var fp []byte
+	var path []uint32
+	if len(fingerprint) > 0 {
+		var err error
+		if fp, err = hex.DecodeString(fingerprint); err != nil {
+			return 0, nil, err
+		}
+		for _, e := range strings.Split(originPath, "/")[1:] {
+			n, err := strconv.ParseUint(strings.TrimSuffix(e, "'"), 10, 31)
+			if err != nil {
+				return 0, nil, errors.Errorf("Invalid key origin path %s", originPath)
+			}
+			if strings.HasSuffix(e, "'") {
+				n += hdkeychain.HardenedKeyStart
+			}
+			path = append(path, uint32(n))
+		}
+	} else {
+		fp = btcutil.Hash160(extKey.PubKeyBytes())[:4]
+	}
+	// the fingerprint is serialized in the PSBT as little endian uint32, keep the byte order
+	return binary.LittleEndian.Uint32(fp), append(path, change, index), nil
+}
+
+// xpubAddressDerivations returns the BIP32 derivations of the keys of the address derived from the descriptor by change/index
+// and the redeem and witness scripts of the address
+func (p *BitcoinLikeParser) xpubAddressDerivations(descriptor *bchain.XpubDescriptor, change, index uint32) ([]*psbt.Bip32Derivation, []byte, []byte, error) {
+	changeKeys, err := changeExtKeys(descriptor, change)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	extKeys := []interface{}{descriptor.ExtKey}
+	fingerprints := []string{descriptor.Fingerprint}
+	originPaths := []string{descriptor.OriginPath}
+	if len(descriptor.ExtKeys) > 0 {
+		extKeys = descriptor.ExtKeys
+		fingerprints = descriptor.Fingerprints
+		originPaths = descriptor.OriginPaths
+	}
+	derivations := make([]*psbt.Bip32Derivation, len(changeKeys))
+	pubKeys := make([][]byte, len(changeKeys))
+	for i, k := range changeKeys {
+		indexExtKey, err := k.Derive(index)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		var fingerprint, originPath string
+		if i < len(fingerprints) && i < len(originPaths) {
+			fingerprint, originPath = fingerprints[i], originPaths[i]
+		}
+		fp, path, err := keyOriginDerivation(extKeys[i].(*hdkeychain.ExtendedKey), fingerprint, originPath, change, index)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		pubKeys[i] = indexExtKey.PubKeyBytes()
+		derivations[i] = &psbt.Bip32Derivation{PubKey: pubKeys[i], MasterKeyFingerprint: fp, Bip32Path: path}
+	}
+	var redeemScript, witnessScript []byte
+	switch descriptor.Type {
+	case bchain.P2PKH, bchain.P2WPKH:
+	case bchain.P2SHWPKH:
+		redeemScript = witnessProgramScript(btcutil.Hash160(pubKeys[0]))
+	case bchain.P2SH, bchain.P2SHWSH, bchain.P2WSH:
+		// the multisig script sorts the keys in place, pass a copy
+		script, err := multisigScript(append([][]byte{}, pubKeys...), descriptor)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if descriptor.Type == bchain.P2SH {
+			redeemScript = script
+		} else {
+			witnessScript = script
+			if descriptor.Type == bchain.P2SHWSH {
+				scriptHash := sha256.Sum256(script)
+				redeemScript = witnessProgramScript(scriptHash[:])
+			}
+		}
+	default:
+		return nil, nil, nil, errors.New("Xpub descriptor type is not supported in PSBT")
+	}
+	return derivations, redeemScript, witnessScript, nil
+}
+
+// CreateXpubPsbt creates unsigned PSBT (BIP174) spending the inputs of the addresses derived from xpub
+// the inputs contain the BIP32 derivations of the keys and the scripts necessary for signing, the change outputs the BIP32 derivations
+func (p *BitcoinLikeParser) CreateXpubPsbt(descriptor *bchain.XpubDescriptor, inputs []bchain.XpubPsbtInput, outputs []bchain.XpubPsbtOutput) ([]byte, error) {
+	segwit := descriptor.Type == bchain.P2SHWPKH || descriptor.Type == bchain.P2WPKH || descriptor.Type == bchain.P2SHWSH || descriptor.Type == bchain.P2WSH
+	tx := wire.NewMsgTx(2)
+	for i := range inputs {
+		in := &inputs[i]
+		hash, err := chainhash.NewHashFromStr(in.Txid)
+		if err != nil {
+			return nil, err
+		}
+		txIn := wire.NewTxIn(wire.NewOutPoint(hash, in.Vout), nil, nil)
+		// signal replace by fee (BIP125)
+		txIn.Sequence = wire.MaxTxInSequenceNum - 2
+		tx.AddTxIn(txIn)
+	}
+	for i := range outputs {
+		tx.AddTxOut(wire.NewTxOut(outputs[i].ValueSat.Int64(), outputs[i].AddrDesc))
+	}
+	packet, err := psbt.NewFromUnsignedTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range inputs {
+		in := &inputs[i]
+		addrDescs, err := p.DeriveAddressDescriptors(descriptor, in.Change, []uint32{in.Index})
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(addrDescs[0], in.AddrDesc) {
+			return nil, errors.Errorf("Input %s:%d is not derived from xpub by path %d/%d", in.Txid, in.Vout, in.Change, in.Index)
+		}
+		pi := &packet.Inputs[i]
+		pi.Bip32Derivation, pi.RedeemScript, pi.WitnessScript, err = p.xpubAddressDerivations(descriptor, in.Change, in.Index)
+		if err != nil {
+			return nil, err
+		}
+		if len(in.PrevTx) > 0 {
+			var prevTx wire.MsgTx
+			if err := prevTx.Deserialize(bytes.NewReader(in.PrevTx)); err != nil {
+				return nil, err
+			}
+			if prevTx.TxHash() != tx.TxIn[i].PreviousOutPoint.Hash {
+				return nil, errors.Errorf("Previous transaction of input %s:%d does not match", in.Txid, in.Vout)
+			}
+			pi.NonWitnessUtxo = &prevTx
+		} else if !segwit {
+			return nil, errors.Errorf("Missing previous transaction of input %s:%d", in.Txid, in.Vout)
+		}
+		if segwit {
+			pi.WitnessUtxo = wire.NewTxOut(in.ValueSat.Int64(), in.AddrDesc)
+		}
+	}
+	for i := range outputs {
+		out := &outputs[i]
+		if !out.IsChange {
+			continue
+		}
+		po := &packet.Outputs[i]
+		po.Bip32Derivation, po.RedeemScript, po.WitnessScript, err = p.xpubAddressDerivations(descriptor, out.Change, out.Index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := packet.SanityCheck(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := packet.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -3,13 +3,19 @@
 package btc
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"math/big"
 	"os"
 	"reflect"
 	"testing"
 
+	"github.com/martinboehm/btcutil"
 	"github.com/martinboehm/btcutil/chaincfg"
+	"github.com/martinboehm/btcutil/hdkeychain"
+	"github.com/martinboehm/btcutil/psbt"
 	"github.com/trezor/blockbook/bchain"
 )
 
@@ -760,6 +766,8 @@ func TestParseXpubDescriptors(t *testing.T) {
 				Xpub:           "tpubDC88gkaZi5HvJGxGDNLADkvtdpni3mLmx6vr2KnXmWMG8zfkBRggsxHVBkUpgcwPe2KKpkyvTJCdXHb1UHEWE64vczyyPQfHr1skBcsRedN",
 				Type:           bchain.P2TR,
 				Bip:            "86",
+				Fingerprint:    "5c9e228d",
+				OriginPath:     "m/86'/1'/0'",
 				ChangeIndexes:  []uint32{0, 1, 2},
 			},
 		},
@@ -772,6 +780,8 @@ func TestParseXpubDescriptors(t *testing.T) {
 				Xpub:           "tpubDC88gkaZi5HvJGxGDNLADkvtdpni3mLmx6vr2KnXmWMG8zfkBRggsxHVBkUpgcwPe2KKpkyvTJCdXHb1UHEWE64vczyyPQfHr1skBcsRedN",
 				Type:           bchain.P2TR,
 				Bip:            "86",
+				Fingerprint:    "5c9e228d",
+				OriginPath:     "m/86'/1'/0'",
 				ChangeIndexes:  []uint32{0, 1, 2},
 			},
 		},
@@ -784,6 +794,8 @@ func TestParseXpubDescriptors(t *testing.T) {
 				Xpub:           "tpubDC88gkaZi5HvJGxGDNLADkvtdpni3mLmx6vr2KnXmWMG8zfkBRggsxHVBkUpgcwPe2KKpkyvTJCdXHb1UHEWE64vczyyPQfHr1skBcsRedN",
 				Type:           bchain.P2TR,
 				Bip:            "86",
+				Fingerprint:    "5c9e228d",
+				OriginPath:     "m/86'/1'/0'",
 				ChangeIndexes:  []uint32{3},
 			},
 		},
@@ -832,6 +844,8 @@ func TestParseXpubDescriptors(t *testing.T) {
 				Xpub:           "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ",
 				Type:           bchain.P2SHWPKH,
 				Bip:            "99",
+				Fingerprint:    "5c9e228d",
+				OriginPath:     "m/99'/0'/0'",
 				ChangeIndexes:  []uint32{122, 123, 4431},
 			},
 		},
@@ -844,6 +858,8 @@ func TestParseXpubDescriptors(t *testing.T) {
 				Xpub:           "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ",
 				Type:           bchain.P2SHWPKH,
 				Bip:            "99",
+				Fingerprint:    "5c9e228d",
+				OriginPath:     "m/99'/0'/0'",
 				ChangeIndexes:  []uint32{122, 123, 4431},
 			},
 		},
@@ -883,6 +899,104 @@ func TestParseXpubDescriptors(t *testing.T) {
 				ChangeIndexes:  []uint32{0, 1},
 			},
 		},
+		{
+			name:   "wsh(sortedmulti(2,xpub,xpub,xpub))",
+			xpub:   "wsh(sortedmulti(2,[5c9e228d/48'/0'/0'/2']xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj/<0;1>/*,[7c9e228d/48'/0'/0'/2']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/<0;1>/*,xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB/<0;1>/*))",
+			parser: btcMainParser,
+			want: &bchain.XpubDescriptor{
+				XpubDescriptor: "wsh(sortedmulti(2,[5c9e228d/48'/0'/0'/2']xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj/<0;1>/*,[7c9e228d/48'/0'/0'/2']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/<0;1>/*,xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB/<0;1>/*))",
+				Xpub:           "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj",
+				Type:           bchain.P2WSH,
+				Bip:            "48",
+				Fingerprint:    "5c9e228d",
+				OriginPath:     "m/48'/0'/0'/2'",
+				ChangeIndexes:  []uint32{0, 1},
+				Xpubs:          []string{"xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj", "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ", "xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB"},
+				Fingerprints:   []string{"5c9e228d", "7c9e228d", ""},
+				OriginPaths:    []string{"m/48'/0'/0'/2'", "m/48'/0'/0'/2'", ""},
+				Threshold:      2,
+				Sorted:         true,
+			},
+		},
+		{
+			name:   "sh(wsh(multi(2,xpub,xpub,xpub)))",
+			xpub:   "sh(wsh(multi(2,xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ,xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB)))",
+			parser: btcMainParser,
+			want: &bchain.XpubDescriptor{
+				XpubDescriptor: "sh(wsh(multi(2,xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ,xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB)))",
+				Xpub:           "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj",
+				Type:           bchain.P2SHWSH,
+				Bip:            "48",
+				ChangeIndexes:  []uint32{0, 1},
+				Xpubs:          []string{"xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj", "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ", "xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB"},
+				Fingerprints:   []string{"", "", ""},
+				OriginPaths:    []string{"", "", ""},
+				Threshold:      2,
+			},
+		},
+		{
+			name:   "sh(sortedmulti(1,[5c9e228d/45']xpub/3/*,xpub/3/*))",
+			xpub:   "sh(sortedmulti(1,[5c9e228d/45']xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj/3/*,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/3/*))",
+			parser: btcMainParser,
+			want: &bchain.XpubDescriptor{
+				XpubDescriptor: "sh(sortedmulti(1,[5c9e228d/45']xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj/3/*,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/3/*))",
+				Xpub:           "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj",
+				Type:           bchain.P2SH,
+				Bip:            "45",
+				Fingerprint:    "5c9e228d",
+				OriginPath:     "m/45'",
+				ChangeIndexes:  []uint32{3},
+				Xpubs:          []string{"xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj", "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ"},
+				Fingerprints:   []string{"5c9e228d", ""},
+				OriginPaths:    []string{"m/45'", ""},
+				Threshold:      1,
+				Sorted:         true,
+			},
+		},
+		{
+			name:    "wsh(multi(3,xpub,xpub)) error - threshold higher than number of keys",
+			xpub:    "wsh(multi(3,xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ))",
+			parser:  btcMainParser,
+			wantErr: true,
+		},
+		{
+			name:    "wsh(multi(2,xpub/0/*,xpub/1/*)) error - different change indexes",
+			xpub:    "wsh(multi(2,xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj/0/*,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/1/*))",
+			parser:  btcMainParser,
+			wantErr: true,
+		},
+		{
+			name:    "wsh(multi(1,xpub,xxx)) error - invalid key",
+			xpub:    "wsh(multi(1,xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj,xxx))",
+			parser:  btcMainParser,
+			wantErr: true,
+		},
+		{
+			name:   "wpkh([D34DB33F/84h/0h/5h/7]xpub/0/*)#n3vtrlxq - non-standard account path",
+			xpub:   "wpkh([D34DB33F/84h/0h/5h/7]xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*)#n3vtrlxq",
+			parser: btcMainParser,
+			want: &bchain.XpubDescriptor{
+				XpubDescriptor: "wpkh([D34DB33F/84h/0h/5h/7]xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*)#n3vtrlxq",
+				Xpub:           "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ",
+				Type:           bchain.P2WPKH,
+				Bip:            "84",
+				Fingerprint:    "d34db33f",
+				OriginPath:     "m/84'/0'/5'/7",
+				ChangeIndexes:  []uint32{0},
+			},
+		},
+		{
+			name:    "tr([5c9e228d/86'/1'/0']tpubD/3/*)#4rqwxvek error - invalid checksum",
+			xpub:    "tr([5c9e228d/86'/1'/0']tpubDC88gkaZi5HvJGxGDNLADkvtdpni3mLmx6vr2KnXmWMG8zfkBRggsxHVBkUpgcwPe2KKpkyvTJCdXHb1UHEWE64vczyyPQfHr1skBcsRedN/3/*)#4rqwxvek",
+			parser:  btcTestnetParser,
+			wantErr: true,
+		},
+		{
+			name:    "wpkh([5c9e2/84'/0'/0']xpub) error - invalid fingerprint",
+			xpub:    "wpkh([5c9e2/84'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ)",
+			parser:  btcMainParser,
+			wantErr: true,
+		},
 		{
 			name:    "xxx(xpub) error - unknown output script",
 			xpub:    "xxx(xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ)",
@@ -915,6 +1029,11 @@ func TestParseXpubDescriptors(t *testing.T) {
 					return
 				}
 				got.ExtKey = nil
+				if len(got.ExtKeys) != len(got.Xpubs) {
+					t.Errorf("ParseXpub() got %d ExtKeys, want %d", len(got.ExtKeys), len(got.Xpubs))
+					return
+				}
+				got.ExtKeys = nil
 				if !reflect.DeepEqual(got, tt.want) {
 					t.Errorf("ParseXpub() = %+v, want %+v", got, tt.want)
 				}
@@ -923,6 +1042,70 @@ func TestParseXpubDescriptors(t *testing.T) {
 	}
 }
 
+func Test_checkDescriptorChecksum(t *testing.T) {
+	desc := "tr([5c9e228d/86'/1'/0']tpubDC88gkaZi5HvJGxGDNLADkvtdpni3mLmx6vr2KnXmWMG8zfkBRggsxHVBkUpgcwPe2KKpkyvTJCdXHb1UHEWE64vczyyPQfHr1skBcsRedN"
+	tests := []struct {
+		name    string
+		xpub    string
+		wantErr bool
+	}{
+		{
+			name: "no checksum",
+			xpub: desc + "/{0,1}/*)",
+		},
+		{
+			name: "checksum of the descriptor {0,1,2}",
+			xpub: desc + "/{0,1,2}/*)#dzq5m3rf",
+		},
+		{
+			name: "checksum of the descriptor <0;1;2>",
+			xpub: desc + "/<0;1;2>/*)#xum0es6f",
+		},
+		{
+			name: "checksum of the descriptor /3/*",
+			xpub: desc + "/3/*)#0k0dg6qn",
+		},
+		{
+			name: "checksum of the receive branch /0/* for {0,1}",
+			xpub: desc + "/{0,1}/*)#4rqwxvej",
+		},
+		{
+			name: "checksum of the receive branch /0/* for <0;1>",
+			xpub: desc + "/<0;1>/*)#4rqwxvej",
+		},
+		{
+			name: "checksum of the change branch /1/* for {0,1}",
+			xpub: desc + "/{0,1}/*)#yh90mef2",
+		},
+		{
+			name: "checksum of the receive branch /0/* for /3/*",
+			xpub: desc + "/3/*)#4rqwxvej",
+		},
+		{
+			name:    "checksum of the branch /1/* not in /3/*",
+			xpub:    desc + "/3/*)#yh90mef2",
+			wantErr: true,
+		},
+		{
+			name:    "invalid checksum",
+			xpub:    desc + "/{0,1}/*)#4rqwxvek",
+			wantErr: true,
+		},
+		{
+			name:    "invalid character",
+			xpub:    desc + "/{0,1}/*)è#4rqwxvej",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkDescriptorChecksum(tt.xpub); (err != nil) != tt.wantErr {
+				t.Errorf("checkDescriptorChecksum() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestDeriveAddressDescriptors(t *testing.T) {
 	btcMainParser := NewBitcoinParser(GetChainParams("main"), &Configuration{XPubMagic: 76067358, XPubMagicSegwitP2sh: 77429938, XPubMagicSegwitNative: 78792518})
 	btcTestnetParser := NewBitcoinParser(GetChainParams("test"), &Configuration{XPubMagic: 70617039, XPubMagicSegwitP2sh: 71979618, XPubMagicSegwitNative: 73342198})
@@ -951,7 +1134,7 @@ func TestDeriveAddressDescriptors(t *testing.T) {
 		{
 			name: "m/86'/0'/0'",
 			args: args{
-				xpub:    "tr([5c9e228d/86'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*)#d8jj22qr",
+				xpub:    "tr([5c9e228d/86'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*)#80c3709y",
 				change:  0,
 				indexes: []uint32{0, 1},
 				parser:  btcMainParser,
@@ -961,7 +1144,7 @@ func TestDeriveAddressDescriptors(t *testing.T) {
 		{
 			name: "m/86'/0'/0'/1",
 			args: args{
-				xpub:    "tr([5c9e228d/86'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*)#d8jj22qr",
+				xpub:    "tr([5c9e228d/86'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*)#80c3709y",
 				change:  1,
 				indexes: []uint32{0},
 				parser:  btcMainParser,
@@ -998,6 +1181,26 @@ func TestDeriveAddressDescriptors(t *testing.T) {
 			},
 			want: []string{"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "bc1q4nm6g46ujzyjaeusralaz2nfv2rf04jjfyamkw"},
 		},
+		{
+			name: "m/48'/0'/0'/2' wsh(sortedmulti)",
+			args: args{
+				xpub:    "wsh(sortedmulti(2,[5c9e228d/48'/0'/0'/2']xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj/<0;1>/*,[7c9e228d/48'/0'/0'/2']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/<0;1>/*,xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB/<0;1>/*))",
+				change:  1,
+				indexes: []uint32{0, 2},
+				parser:  btcMainParser,
+			},
+			want: []string{"bc1q6684e086c20jjdmm54k56thlnuqlhdtyvw6v0wr9trtqmhfhayxsmf3u43", "bc1qk4hnzhcda9qs0d70dp0jyed8gt0m0kljpmgdf9nd7y9el7ukyjhsdavh09"},
+		},
+		{
+			name: "sh(sortedmulti)",
+			args: args{
+				xpub:    "sh(sortedmulti(1,xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj/{0,1}/*,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/{0,1}/*))",
+				change:  0,
+				indexes: []uint32{0, 1},
+				parser:  btcMainParser,
+			},
+			want: []string{"3AEVe4VgqAjDM5g59ApWLHrPgmJkX83Ah1", "3F1zXBBrrMeYJmDCNWjXh9Mp4anMysk3f5"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1079,7 +1282,7 @@ func TestDeriveAddressDescriptorsFromTo(t *testing.T) {
 		{
 			name: "m/86'/0'/0'",
 			args: args{
-				xpub:      "tr([5c9e228d/86'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*)#d8jj22qr",
+				xpub:      "tr([5c9e228d/86'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*)#80c3709y",
 				change:    0,
 				fromIndex: 0,
 				toIndex:   1,
@@ -1098,6 +1301,28 @@ func TestDeriveAddressDescriptorsFromTo(t *testing.T) {
 			},
 			want: []string{"2N4Q5FhU2497BryFfUgbqkAJE87aKHUhXMp", "2Mt7P2BAfE922zmfXrdcYTLyR7GUvbwSEns", "2N6aUMgQk8y1zvoq6FeWFyotyj75WY9BGsu", "2NA7tbZWM9BcRwBuebKSQe2xbhhF1paJwBM", "2N8RZMzvrUUnpLmvACX9ysmJ2MX3GK5jcQM", "2MvUUSiQZDSqyeSdofKX9KrSCio1nANPDTe", "2NBXaWu1HazjoUVgrXgcKNoBLhtkkD9Gmet", "2N791Ttf89tMVw2maj86E1Y3VgxD9Mc7PU7", "2NCJmwEq8GJm8t8GWWyBXAfpw7F2qZEVP5Y", "2NEgW71hWKer2XCSA8ZCC2VnWpB77L6bk68"},
 		},
+		{
+			name: "m/48'/0'/0'/2' wsh(sortedmulti)",
+			args: args{
+				xpub:      "wsh(sortedmulti(2,[5c9e228d/48'/0'/0'/2']xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj/<0;1>/*,[7c9e228d/48'/0'/0'/2']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/<0;1>/*,xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB/<0;1>/*))",
+				change:    0,
+				fromIndex: 0,
+				toIndex:   3,
+				parser:    btcMainParser,
+			},
+			want: []string{"bc1qva8w0tq9mc9h8n4vx5y3xpke4nnvt3rwddsa7wkj7tgtzfck9w0qp2dhze", "bc1qk5g8ykt309wknn8kcdftv8249h524vr5qv6am8h64hg42wct392qtdfl9d", "bc1q5gh0cpj3f6u9lcvar0tag64jvnnfuw2tclhjhp6py044mduzzv7ql45zva"},
+		},
+		{
+			name: "m/48'/0'/0'/1' sh(wsh(multi))",
+			args: args{
+				xpub:      "sh(wsh(multi(2,xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj,xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ,xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB)))",
+				change:    0,
+				fromIndex: 1,
+				toIndex:   3,
+				parser:    btcMainParser,
+			},
+			want: []string{"3GQ3Mo87n37mCPKvfQX17uFEs75NEhtSh4", "3AKoEjHHaHLVP86Lg89h1thghBHVeb6j2K"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1176,7 +1401,7 @@ func TestBitcoinParser_DerivationBasePath(t *testing.T) {
 		{
 			name: "m/86'/0'/0'",
 			args: args{
-				xpub:   "tr([5c9e228d/86'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*)#d8jj22qr",
+				xpub:   "tr([5c9e228d/86'/0'/0']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*)#80c3709y",
 				parser: btcMainParser,
 			},
 			want: "m/86'/0'/0'",
@@ -1221,6 +1446,22 @@ func TestBitcoinParser_DerivationBasePath(t *testing.T) {
 			},
 			want: "m/44'/133'/12'",
 		},
+		{
+			name: "m/84'/0'/5'/7 - non-standard path from key origin",
+			args: args{
+				xpub:   "wpkh([D34DB33F/84h/0h/5h/7]xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/0/*)#n3vtrlxq",
+				parser: btcMainParser,
+			},
+			want: "m/84'/0'/5'/7",
+		},
+		{
+			name: "m/48'/0'/0'/2' - multisig",
+			args: args{
+				xpub:   "wsh(sortedmulti(2,[5c9e228d/48'/0'/0'/2']xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj/<0;1>/*,[7c9e228d/48'/0'/0'/2']xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ/<0;1>/*))",
+				parser: btcMainParser,
+			},
+			want: "m/48'/0'/0'/2'",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1240,3 +1481,233 @@ func TestBitcoinParser_DerivationBasePath(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateXpubPsbt(t *testing.T) {
+	parser := NewBitcoinParser(GetChainParams("main"), &Configuration{XPubMagic: 76067358, XPubMagicSegwitP2sh: 77429938, XPubMagicSegwitNative: 78792518})
+	const (
+		xpub1 = "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj"
+		xpub2 = "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ"
+		txid  = "fdd824a780cbb718eeb766eb05d83fdefc793a27082cd5e67f856d69798cf7db"
+	)
+	h := uint32(hdkeychain.HardenedKeyStart)
+	outputAddrDesc, _ := parser.GetAddrDescFromAddress("bc1qa9tj4cvz2x4lctd0nl54eqqu5cawknnqd7lrfq")
+	otherTx, _ := hex.DecodeString(testTx1.Hex)
+	tests := []struct {
+		name          string
+		xpub          string
+		input         [2]uint32 // change and index of the input address
+		change        [2]uint32 // change and index of the change address
+		prevTx        []byte
+		wantPath      [][]uint32
+		wantOwnFp     []bool // the fingerprint of the key is the fingerprint of xpub, the key has no origin
+		wantRedeem    bool
+		wantWitness   bool
+		wantErr       bool
+		wrongAddrDesc bool
+	}{
+		{
+			name:     "wpkh with key origin",
+			xpub:     "wpkh([d34db33f/84'/0'/0']" + xpub1 + "/<0;1>/*)",
+			input:    [2]uint32{0, 3},
+			change:   [2]uint32{1, 2},
+			wantPath: [][]uint32{{84 + h, h, h, 0, 3}},
+		},
+		{
+			name:       "sh(wpkh) without key origin",
+			xpub:       "sh(wpkh(" + xpub1 + "/{0,1}/*))",
+			input:      [2]uint32{1, 7},
+			change:     [2]uint32{1, 8},
+			wantPath:   [][]uint32{{1, 7}},
+			wantOwnFp:  []bool{true},
+			wantRedeem: true,
+		},
+		{
+			name:        "wsh(sortedmulti) with partial key origins",
+			xpub:        "wsh(sortedmulti(2,[d34db33f/48'/0'/0'/2']" + xpub1 + "/<0;1>/*," + xpub2 + "/<0;1>/*))",
+			input:       [2]uint32{0, 5},
+			change:      [2]uint32{1, 0},
+			wantPath:    [][]uint32{{48 + h, h, h, 2 + h, 0, 5}, {0, 5}},
+			wantOwnFp:   []bool{false, true},
+			wantWitness: true,
+		},
+		{
+			name:    "pkh without previous transaction",
+			xpub:    "pkh(" + xpub1 + "/<0;1>/*)",
+			input:   [2]uint32{0, 1},
+			change:  [2]uint32{1, 1},
+			wantErr: true,
+		},
+		{
+			name:    "pkh with not matching previous transaction",
+			xpub:    "pkh(" + xpub1 + "/<0;1>/*)",
+			input:   [2]uint32{0, 1},
+			change:  [2]uint32{1, 1},
+			prevTx:  otherTx,
+			wantErr: true,
+		},
+		{
+			name:          "input not derived from xpub",
+			xpub:          "wpkh(" + xpub1 + "/<0;1>/*)",
+			input:         [2]uint32{0, 1},
+			change:        [2]uint32{1, 1},
+			wrongAddrDesc: true,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			descriptor, err := parser.ParseXpub(tt.xpub)
+			if err != nil {
+				t.Fatalf("ParseXpub() error = %v", err)
+			}
+			inputAddrDesc, err := parser.DeriveAddressDescriptors(descriptor, tt.input[0], []uint32{tt.input[1]})
+			if err != nil {
+				t.Fatalf("DeriveAddressDescriptors() error = %v", err)
+			}
+			changeAddrDesc, err := parser.DeriveAddressDescriptors(descriptor, tt.change[0], []uint32{tt.change[1]})
+			if err != nil {
+				t.Fatalf("DeriveAddressDescriptors() error = %v", err)
+			}
+			if tt.wrongAddrDesc {
+				inputAddrDesc = changeAddrDesc
+			}
+			inputs := []bchain.XpubPsbtInput{{Txid: txid, Vout: 1, ValueSat: *big.NewInt(100000), AddrDesc: inputAddrDesc[0], Change: tt.input[0], Index: tt.input[1], PrevTx: tt.prevTx}}
+			outputs := []bchain.XpubPsbtOutput{
+				{AddrDesc: outputAddrDesc, ValueSat: *big.NewInt(60000)},
+				{AddrDesc: changeAddrDesc[0], ValueSat: *big.NewInt(39000), IsChange: true, Change: tt.change[0], Index: tt.change[1]},
+			}
+			b, err := parser.CreateXpubPsbt(descriptor, inputs, outputs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateXpubPsbt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			packet, err := psbt.NewFromRawBytes(bytes.NewReader(b), false)
+			if err != nil {
+				t.Fatalf("NewFromRawBytes() error = %v", err)
+			}
+			if len(packet.UnsignedTx.TxIn) != 1 || len(packet.UnsignedTx.TxOut) != 2 {
+				t.Fatalf("unexpected number of inputs %d and outputs %d", len(packet.UnsignedTx.TxIn), len(packet.UnsignedTx.TxOut))
+			}
+			in := packet.UnsignedTx.TxIn[0]
+			if in.PreviousOutPoint.Hash.String() != txid || in.PreviousOutPoint.Index != 1 || in.Sequence != 0xfffffffd {
+				t.Errorf("unexpected input %v, sequence %x", in.PreviousOutPoint, in.Sequence)
+			}
+			pi := packet.Inputs[0]
+			if pi.WitnessUtxo == nil || pi.WitnessUtxo.Value != 100000 || !bytes.Equal(pi.WitnessUtxo.PkScript, inputAddrDesc[0]) {
+				t.Errorf("unexpected witness utxo %v", pi.WitnessUtxo)
+			}
+			if len(pi.Bip32Derivation) != len(tt.wantPath) {
+				t.Fatalf("unexpected number of derivations %d, want %d", len(pi.Bip32Derivation), len(tt.wantPath))
+			}
+			pubKeys := make([][]byte, len(pi.Bip32Derivation))
+			for i, d := range pi.Bip32Derivation {
+				// the derivations are sorted by the public keys, find the derivation by its path
+				var j int
+				for j = range tt.wantPath {
+					if reflect.DeepEqual(d.Bip32Path, tt.wantPath[j]) {
+						break
+					}
+				}
+				if !reflect.DeepEqual(d.Bip32Path, tt.wantPath[j]) {
+					t.Errorf("unexpected derivation path %v, want one of %v", d.Bip32Path, tt.wantPath)
+				}
+				wantFp := "d34db33f"
+				if j < len(tt.wantOwnFp) && tt.wantOwnFp[j] {
+					extKey := descriptor.ExtKey
+					if len(descriptor.ExtKeys) > j {
+						extKey = descriptor.ExtKeys[j]
+					}
+					wantFp = hex.EncodeToString(btcutil.Hash160(extKey.(*hdkeychain.ExtendedKey).PubKeyBytes())[:4])
+				}
+				fp := make([]byte, 4)
+				binary.LittleEndian.PutUint32(fp, d.MasterKeyFingerprint)
+				if hex.EncodeToString(fp) != wantFp {
+					t.Errorf("unexpected fingerprint %x, want %s", fp, wantFp)
+				}
+				pubKeys[i] = d.PubKey
+			}
+			switch {
+			case tt.wantWitness:
+				scriptHash := sha256.Sum256(pi.WitnessScript)
+				if !bytes.Equal(inputAddrDesc[0][2:], scriptHash[:]) {
+					t.Errorf("witness script %x does not match the input address", pi.WitnessScript)
+				}
+			case tt.wantRedeem:
+				if !bytes.Equal(inputAddrDesc[0][2:22], btcutil.Hash160(pi.RedeemScript)) || !bytes.Equal(pi.RedeemScript[2:], btcutil.Hash160(pubKeys[0])) {
+					t.Errorf("redeem script %x does not match the input address", pi.RedeemScript)
+				}
+			default:
+				if !bytes.Equal(inputAddrDesc[0][2:], btcutil.Hash160(pubKeys[0])) {
+					t.Errorf("public key %x does not match the input address", pubKeys[0])
+				}
+			}
+			if len(packet.Outputs[0].Bip32Derivation) != 0 {
+				t.Errorf("unexpected derivation of the not change output")
+			}
+			if len(packet.Outputs[1].Bip32Derivation) != len(tt.wantPath) {
+				t.Errorf("unexpected number of derivations of the change output %d", len(packet.Outputs[1].Bip32Derivation))
+			}
+			for _, d := range packet.Outputs[1].Bip32Derivation {
+				if d.Bip32Path[len(d.Bip32Path)-2] != tt.change[0] || d.Bip32Path[len(d.Bip32Path)-1] != tt.change[1] {
+					t.Errorf("unexpected derivation path of the change output %v", d.Bip32Path)
+				}
+			}
+		})
+	}
+}
+
+func TestGetTxVSize(t *testing.T) {
+	parser := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	tests := []struct {
+		name string
+		tx   *bchain.Tx
+		want int64
+	}{
+		{name: "legacy", tx: &testTx1, want: 189},
+		{name: "segwit", tx: &testTx2, want: 166},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parser.GetTxVSize(tt.tx)
+			if err != nil {
+				t.Fatalf("GetTxVSize() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetTxVSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsAddrDescStandard(t *testing.T) {
+	parser := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	tests := []struct {
+		name   string
+		script string
+		want   bool
+	}{
+		{name: "P2PKH", script: "76a914be027bf3eac907bd4ac8cb9c5293b6f37662722088ac", want: true},
+		{name: "P2PK compressed", script: "21020e46e79a2a8d12b9b5d12c7a91adb4e454edfae43c0a0cb805427d2ac7613fd9ac", want: true},
+		{name: "P2SH", script: "a9146144d57c8aff48492c9dfb914e120b20bad72d6f87", want: true},
+		{name: "P2WPKH", script: "00145e5d7b5c6a1ba4e2e5b5a1e26a6d2a0a0ebe40a2", want: true},
+		{name: "P2TR", script: "51205e5d7b5c6a1ba4e2e5b5a1e26a6d2a0a0ebe40a25e5d7b5c6a1ba4e2e5b5a1e2", want: true},
+		{name: "multisig 1 of 3", script: "5121020e46e79a2a8d12b9b5d12c7a91adb4e454edfae43c0a0cb805427d2ac7613fd921020e46e79a2a8d12b9b5d12c7a91adb4e454edfae43c0a0cb805427d2ac7613fd921020e46e79a2a8d12b9b5d12c7a91adb4e454edfae43c0a0cb805427d2ac7613fd953ae", want: true},
+		{name: "multisig 1 of 4", script: "5121020e46e79a2a8d12b9b5d12c7a91adb4e454edfae43c0a0cb805427d2ac7613fd921020e46e79a2a8d12b9b5d12c7a91adb4e454edfae43c0a0cb805427d2ac7613fd921020e46e79a2a8d12b9b5d12c7a91adb4e454edfae43c0a0cb805427d2ac7613fd921020e46e79a2a8d12b9b5d12c7a91adb4e454edfae43c0a0cb805427d2ac7613fd954ae", want: false},
+		{name: "OP_RETURN", script: "6a0568656c6c6f", want: true},
+		{name: "OP_RETURN too big", script: "6a4c54000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000", want: false},
+		{name: "nonstandard", script: "51", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := hex.DecodeString(tt.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := parser.IsAddrDescStandard(script); got != tt.want {
+				t.Errorf("IsAddrDescStandard() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
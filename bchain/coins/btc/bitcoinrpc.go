@@ -11,6 +11,7 @@ import (
 	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"time"
 
 	"github.com/golang/glog"
@@ -25,40 +26,54 @@ type BitcoinRPC struct {
 	*bchain.BaseChain
 	client       http.Client
 	rpcURL       string
+	backends     *bchain.BackendPool
 	user         string
 	password     string
 	Mempool      *bchain.MempoolBitcoinType
 	ParseBlocks  bool
 	pushHandler  func(bchain.NotificationType)
 	mq           *bchain.MQ
+	p2p          *P2PClient
 	ChainConfig  *Configuration
 	RPCMarshaler RPCMarshaler
 }
 
 // Configuration represents json config file
 type Configuration struct {
-	CoinName                     string `json:"coin_name"`
-	CoinShortcut                 string `json:"coin_shortcut"`
-	RPCURL                       string `json:"rpc_url"`
-	RPCUser                      string `json:"rpc_user"`
-	RPCPass                      string `json:"rpc_pass"`
-	RPCTimeout                   int    `json:"rpc_timeout"`
-	Parse                        bool   `json:"parse"`
-	MessageQueueBinding          string `json:"message_queue_binding"`
-	Subversion                   string `json:"subversion"`
-	BlockAddressesToKeep         int    `json:"block_addresses_to_keep"`
-	MempoolWorkers               int    `json:"mempool_workers"`
-	MempoolSubWorkers            int    `json:"mempool_sub_workers"`
-	AddressFormat                string `json:"address_format"`
-	SupportsEstimateFee          bool   `json:"supports_estimate_fee"`
-	SupportsEstimateSmartFee     bool   `json:"supports_estimate_smart_fee"`
-	XPubMagic                    uint32 `json:"xpub_magic,omitempty"`
-	XPubMagicSegwitP2sh          uint32 `json:"xpub_magic_segwit_p2sh,omitempty"`
-	XPubMagicSegwitNative        uint32 `json:"xpub_magic_segwit_native,omitempty"`
-	Slip44                       uint32 `json:"slip44,omitempty"`
-	AlternativeEstimateFee       string `json:"alternative_estimate_fee,omitempty"`
-	AlternativeEstimateFeeParams string `json:"alternative_estimate_fee_params,omitempty"`
-	MinimumCoinbaseConfirmations int    `json:"minimumCoinbaseConfirmations,omitempty"`
+	CoinName                     string   `json:"coin_name"`
+	CoinShortcut                 string   `json:"coin_shortcut"`
+	RPCURL                       string   `json:"rpc_url"`
+	RPCURLs                      []string `json:"rpc_urls,omitempty"`
+	RPCUser                      string   `json:"rpc_user"`
+	RPCPass                      string   `json:"rpc_pass"`
+	RPCTimeout                   int      `json:"rpc_timeout"`
+	RPCBatchSize                 int      `json:"rpc_batch_size,omitempty"`
+	Parse                        bool     `json:"parse"`
+	MessageQueueBinding          string   `json:"message_queue_binding"`
+	MessageQueueRawTx            bool     `json:"message_queue_raw_tx,omitempty"`
+	P2PAddress                   string   `json:"p2p_address,omitempty"`
+	Subversion                   string   `json:"subversion"`
+	BlockAddressesToKeep         int      `json:"block_addresses_to_keep"`
+	MempoolWorkers               int      `json:"mempool_workers"`
+	MempoolSubWorkers            int      `json:"mempool_sub_workers"`
+	MempoolMaxTrackedTxs         int      `json:"mempool_max_tracked_txs,omitempty"`
+	AddressFormat                string   `json:"address_format"`
+	SupportsEstimateFee          bool     `json:"supports_estimate_fee"`
+	SupportsEstimateSmartFee     bool     `json:"supports_estimate_smart_fee"`
+	XPubMagic                    uint32   `json:"xpub_magic,omitempty"`
+	XPubMagicSegwitP2sh          uint32   `json:"xpub_magic_segwit_p2sh,omitempty"`
+	XPubMagicSegwitNative        uint32   `json:"xpub_magic_segwit_native,omitempty"`
+	Slip44                       uint32   `json:"slip44,omitempty"`
+	AlternativeEstimateFee       string   `json:"alternative_estimate_fee,omitempty"`
+	AlternativeEstimateFeeParams string   `json:"alternative_estimate_fee_params,omitempty"`
+	MinimumCoinbaseConfirmations int      `json:"minimumCoinbaseConfirmations,omitempty"`
+	TestMempoolAccept            bool     `json:"test_mempool_accept,omitempty"`
+	DustRelayFeePerKb            int64    `json:"dust_relay_fee_per_kb,omitempty"`
+	MinRelayFeePerKb             int64    `json:"min_relay_fee_per_kb,omitempty"`
+	MaxFeePerKb                  int64    `json:"max_fee_per_kb,omitempty"`
+	SupportsGetMempoolEntries    bool     `json:"supports_get_mempool_entries"`
+	SupportsP2P                  bool     `json:"-"`
+	SupportsTransactionBatch     bool     `json:"-"`
 }
 
 // NewBitcoinRPC returns new BitcoinRPC instance.
@@ -87,6 +102,7 @@ func NewBitcoinRPC(config json.RawMessage, pushHandler func(bchain.NotificationT
 	// btc supports both calls, other coins overriding BitcoinRPC can change this
 	c.SupportsEstimateFee = true
 	c.SupportsEstimateSmartFee = true
+	c.SupportsGetMempoolEntries = true
 
 	transport := &http.Transport{
 		Dial:                (&net.Dialer{KeepAlive: 600 * time.Second}).Dial,
@@ -106,9 +122,31 @@ func NewBitcoinRPC(config json.RawMessage, pushHandler func(bchain.NotificationT
 		RPCMarshaler: JSONMarshalerV2{},
 	}
 
+	if urls := bchain.BackendURLs(c.RPCURL, c.RPCURLs); len(urls) > 1 {
+		s.backends = bchain.NewBackendPool(urls, s.checkBackend, nil)
+		s.backends.Start(bchain.BackendCheckPeriod)
+	}
+
 	return s, nil
 }
 
+// checkBackend returns the best height of the backend endpoint with given index
+func (b *BitcoinRPC) checkBackend(index int) (uint32, error) {
+	res := ResGetBlockCount{}
+	req := CmdGetBlockCount{Method: "getblockcount"}
+	httpData, err := b.RPCMarshaler.Marshal(&req)
+	if err != nil {
+		return 0, err
+	}
+	if err = b.call(b.backends.URL(index), httpData, &res); err != nil {
+		return 0, err
+	}
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return res.Result, nil
+}
+
 // Initialize initializes BitcoinRPC instance.
 func (b *BitcoinRPC) Initialize() error {
 	b.ChainConfig.SupportsEstimateFee = false
@@ -135,6 +173,13 @@ func (b *BitcoinRPC) Initialize() error {
 
 	glog.Info("rpc: block chain ", params.Name)
 
+	// bitcoin uses the transaction format of the P2P client, other coins must enable P2P explicitly
+	b.ChainConfig.SupportsP2P = true
+	// the batches are fetched and parsed the same way as GetTransaction and GetTransactionForMempool,
+	// other coins must enable batching explicitly and only if they do not override these methods
+	b.ChainConfig.SupportsTransactionBatch = true
+	b.InitializeP2P(params.Net)
+
 	if b.ChainConfig.AlternativeEstimateFee == "whatthefee" {
 		if err = InitWhatTheFee(b, b.ChainConfig.AlternativeEstimateFeeParams); err != nil {
 			glog.Error("InitWhatTheFee error ", err, " Reverting to default estimateFee functionality")
@@ -146,24 +191,79 @@ func (b *BitcoinRPC) Initialize() error {
 	return nil
 }
 
+// InitializeP2P starts the P2P client if the p2p address is configured and the coin supports P2P
+// The blocks and mempool transactions are then downloaded over the P2P protocol, the RPC is used as a fallback.
+// If the message queue binding is not configured, the announcements of the peer are used instead of ZeroMQ notifications.
+func (b *BitcoinRPC) InitializeP2P(net wire.BitcoinNet) {
+	if b.ChainConfig.P2PAddress == "" || b.p2p != nil {
+		return
+	}
+	if !b.ChainConfig.SupportsP2P {
+		glog.Warning("p2p: not supported by ", b.ChainConfig.CoinName, ", p2p_address ignored")
+		return
+	}
+	timeout := time.Duration(b.ChainConfig.RPCTimeout) * time.Second
+	if timeout == 0 {
+		timeout = 25 * time.Second
+	}
+	var onBlockInv func(string)
+	var onTx func([]byte)
+	if b.ChainConfig.MessageQueueBinding == "" {
+		onBlockInv = b.onP2PBlockInv
+		onTx = b.onP2PTx
+	}
+	b.p2p = NewP2PClient(b.ChainConfig.P2PAddress, net, timeout, onBlockInv, onTx)
+	b.p2p.Start()
+	glog.Info("p2p: using peer ", b.ChainConfig.P2PAddress)
+}
+
+// onP2PBlockInv notifies about a new block announced by the P2P peer
+func (b *BitcoinRPC) onP2PBlockInv(hash string) {
+	b.pushHandler(bchain.NotificationNewBlock)
+}
+
+// onP2PTx passes the transaction announced by the P2P peer to the mempool
+func (b *BitcoinRPC) onP2PTx(rawTx []byte) {
+	if b.Mempool == nil {
+		return
+	}
+	tx, err := b.Parser.ParseTx(rawTx)
+	if err != nil {
+		glog.Error("p2p: tx ", err)
+		b.pushHandler(bchain.NotificationNewTx)
+		return
+	}
+	// the peer announces only transactions accepted to its mempool
+	if !b.Mempool.AddRawTx(tx) || !b.Mempool.UpdateFromSequence(tx.Txid, bchain.MQSequenceMempoolAdd) {
+		b.pushHandler(bchain.NotificationNewTx)
+	}
+}
+
 // CreateMempool creates mempool if not already created, however does not initialize it
 func (b *BitcoinRPC) CreateMempool(chain bchain.BlockChain) (bchain.Mempool, error) {
 	if b.Mempool == nil {
-		b.Mempool = bchain.NewMempoolBitcoinType(chain, b.ChainConfig.MempoolWorkers, b.ChainConfig.MempoolSubWorkers)
+		b.Mempool = bchain.NewMempoolBitcoinType(chain, b.ChainConfig.MempoolWorkers, b.ChainConfig.MempoolSubWorkers, b.ChainConfig.MempoolMaxTrackedTxs)
 	}
 	return b.Mempool, nil
 }
 
 // InitializeMempool creates ZeroMQ subscription and sets AddrDescForOutpointFunc to the Mempool
-func (b *BitcoinRPC) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOutpointFunc, onNewTxAddr bchain.OnNewTxAddrFunc, onNewTx bchain.OnNewTxFunc) error {
+func (b *BitcoinRPC) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOutpointFunc, onNewTxAddr bchain.OnNewTxAddrFunc, onNewTx bchain.OnNewTxFunc, onTxRemoved bchain.OnTxRemovedFunc) error {
 	if b.Mempool == nil {
 		return errors.New("Mempool not created")
 	}
 	b.Mempool.AddrDescForOutpoint = addrDescForOutpoint
 	b.Mempool.OnNewTxAddr = onNewTxAddr
 	b.Mempool.OnNewTx = onNewTx
-	if b.mq == nil {
-		mq, err := bchain.NewMQ(b.ChainConfig.MessageQueueBinding, b.pushHandler)
+	b.Mempool.OnTxRemoved = onTxRemoved
+	if b.mq == nil && (b.p2p == nil || b.ChainConfig.MessageQueueBinding != "") {
+		var mq *bchain.MQ
+		var err error
+		if b.ChainConfig.MessageQueueRawTx {
+			mq, err = bchain.NewMQWithRawTx(b.ChainConfig.MessageQueueBinding, b.pushHandler, b.onMQRawTx, b.onMQSequence)
+		} else {
+			mq, err = bchain.NewMQ(b.ChainConfig.MessageQueueBinding, b.pushHandler)
+		}
 		if err != nil {
 			glog.Error("mq: ", err)
 			return err
@@ -173,8 +273,34 @@ func (b *BitcoinRPC) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOut
 	return nil
 }
 
+// onMQRawTx parses transaction from the rawtx topic and passes it to the mempool
+func (b *BitcoinRPC) onMQRawTx(rawTx []byte) {
+	tx, err := b.Parser.ParseTx(rawTx)
+	if err != nil {
+		glog.Error("mq: rawtx ", err)
+		b.pushHandler(bchain.NotificationNewTx)
+		return
+	}
+	if !b.Mempool.AddRawTx(tx) {
+		b.pushHandler(bchain.NotificationNewTx)
+	}
+}
+
+// onMQSequence passes the mempool and block messages of the sequence topic to the mempool
+func (b *BitcoinRPC) onMQSequence(hash string, label byte) {
+	if !b.Mempool.UpdateFromSequence(hash, label) || label == bchain.MQSequenceBlockDisconnected {
+		b.pushHandler(bchain.NotificationNewTx)
+	}
+}
+
 // Shutdown ZeroMQ and other resources
 func (b *BitcoinRPC) Shutdown(ctx context.Context) error {
+	if b.p2p != nil {
+		b.p2p.Stop()
+	}
+	if b.backends != nil {
+		b.backends.Stop()
+	}
 	if b.mq != nil {
 		if err := b.mq.Shutdown(ctx); err != nil {
 			glog.Error("MQ.Shutdown error: ", err)
@@ -277,6 +403,18 @@ type ResGetMempool struct {
 	Result []string         `json:"result"`
 }
 
+// getrawmempool verbose
+
+type CmdGetMempoolVerbose struct {
+	Method string `json:"method"`
+	Params []bool `json:"params"`
+}
+
+type ResGetMempoolVerbose struct {
+	Error  *bchain.RPCError                `json:"error"`
+	Result map[string]*bchain.MempoolEntry `json:"result"`
+}
+
 // getblockheader
 
 type CmdGetBlockHeader struct {
@@ -391,6 +529,26 @@ type ResSendRawTransaction struct {
 	Result string           `json:"result"`
 }
 
+// testmempoolaccept
+
+type CmdTestMempoolAccept struct {
+	Method string     `json:"method"`
+	Params [][]string `json:"params"`
+}
+
+type ResTestMempoolAccept struct {
+	Error  *bchain.RPCError `json:"error"`
+	Result []struct {
+		Txid    string `json:"txid"`
+		Allowed bool   `json:"allowed"`
+		VSize   int64  `json:"vsize"`
+		Fees    struct {
+			Base common.JSONNumber `json:"base"`
+		} `json:"fees"`
+		RejectReason string `json:"reject-reason"`
+	} `json:"result"`
+}
+
 // getmempoolentry
 
 type CmdGetMempoolEntry struct {
@@ -479,9 +637,18 @@ func (b *BitcoinRPC) GetChainInfo() (*bchain.ChainInfo, error) {
 	if resCi.Result.Warnings != resNi.Result.Warnings {
 		rv.Warnings += resNi.Result.Warnings
 	}
+	rv.Endpoints = b.GetBackendEndpoints()
 	return rv, nil
 }
 
+// GetBackendEndpoints returns the state of the backend endpoints if multiple endpoints are configured
+func (b *BitcoinRPC) GetBackendEndpoints() []common.BackendEndpoint {
+	if b.backends == nil {
+		return nil
+	}
+	return b.backends.Endpoints()
+}
+
 // IsErrBlockNotFound returns true if error means block was not found
 func IsErrBlockNotFound(err *bchain.RPCError) bool {
 	return err.Message == "Block not found" ||
@@ -531,6 +698,32 @@ func (b *BitcoinRPC) GetBlockHeader(hash string) (*bchain.BlockHeader, error) {
 	return &res.Result, nil
 }
 
+// GetBlockHeaderRaw returns the serialized header of block with given hash
+func (b *BitcoinRPC) GetBlockHeaderRaw(hash string) ([]byte, error) {
+	glog.V(1).Info("rpc: getblockheader (verbose=false) ", hash)
+
+	res := ResGetBlockRaw{}
+	req := CmdGetBlockHeader{Method: "getblockheader"}
+	req.Params.BlockHash = hash
+	req.Params.Verbose = false
+	err := b.Call(&req, &res)
+
+	if err != nil {
+		return nil, errors.Annotatef(err, "hash %v", hash)
+	}
+	if res.Error != nil {
+		if IsErrBlockNotFound(res.Error) {
+			return nil, bchain.ErrBlockNotFound
+		}
+		return nil, errors.Annotatef(res.Error, "hash %v", hash)
+	}
+	header, err := hex.DecodeString(res.Result)
+	if err != nil {
+		return nil, errors.Annotatef(err, "hash %v", hash)
+	}
+	return header, nil
+}
+
 // GetBlock returns block with given hash.
 func (b *BitcoinRPC) GetBlock(hash string, height uint32) (*bchain.Block, error) {
 	var err error
@@ -625,6 +818,13 @@ func (b *BitcoinRPC) GetBlockRaw(hash string) (string, error) {
 
 // GetBlockBytes returns block with given hash as bytes
 func (b *BitcoinRPC) GetBlockBytes(hash string) ([]byte, error) {
+	if b.p2p != nil {
+		data, err := b.p2p.GetBlockBytes(hash)
+		if err == nil {
+			return data, nil
+		}
+		glog.V(1).Info("p2p: block ", hash, " error ", err, ", using rpc")
+	}
 	block, err := b.GetBlockRaw(hash)
 	if err != nil {
 		return nil, err
@@ -693,7 +893,20 @@ func IsMissingTx(err *bchain.RPCError) bool {
 
 // GetTransactionForMempool returns a transaction by the transaction ID
 // It could be optimized for mempool, i.e. without block time and confirmations
+// The transaction is downloaded over P2P only if it was announced by the peer, otherwise it is not likely
+// in the peer's mempool and the request would only add the round-trip of the notfound response.
 func (b *BitcoinRPC) GetTransactionForMempool(txid string) (*bchain.Tx, error) {
+	if b.p2p != nil && b.p2p.HasTx(txid) {
+		data, err := b.p2p.GetTxBytes(txid)
+		if err == nil {
+			tx, err := b.Parser.ParseTx(data)
+			if err != nil {
+				return nil, errors.Annotatef(err, "txid %v", txid)
+			}
+			return tx, nil
+		}
+		glog.V(1).Info("p2p: tx ", txid, " error ", err, ", using rpc")
+	}
 	glog.V(1).Info("rpc: getrawtransaction nonverbose ", txid)
 
 	res := ResGetRawTransactionNonverbose{}
@@ -704,6 +917,10 @@ func (b *BitcoinRPC) GetTransactionForMempool(txid string) (*bchain.Tx, error) {
 	if err != nil {
 		return nil, errors.Annotatef(err, "txid %v", txid)
 	}
+	return b.parseRawTransactionNonverbose(txid, &res)
+}
+
+func (b *BitcoinRPC) parseRawTransactionNonverbose(txid string, res *ResGetRawTransactionNonverbose) (*bchain.Tx, error) {
 	if res.Error != nil {
 		if IsMissingTx(res.Error) {
 			return nil, bchain.ErrTxNotFound
@@ -721,12 +938,99 @@ func (b *BitcoinRPC) GetTransactionForMempool(txid string) (*bchain.Tx, error) {
 	return tx, nil
 }
 
+// TransactionBatchSize returns the maximum number of transactions fetched in one JSON-RPC batch,
+// 0 if the coin does not support fetching of transactions in batches
+func (b *BitcoinRPC) TransactionBatchSize() int {
+	if !b.ChainConfig.SupportsTransactionBatch {
+		return 0
+	}
+	return b.ChainConfig.RPCBatchSize
+}
+
+// GetTransactionsForMempool returns transactions with given txids, fetched over P2P in one getdata message
+// and the transactions not provided by the peer in JSON-RPC batches
+// The transactions are returned in the order of txids, errs contains the error of each transaction
+func (b *BitcoinRPC) GetTransactionsForMempool(txids []string) ([]*bchain.Tx, []error) {
+	txs := make([]*bchain.Tx, len(txids))
+	errs := make([]error, len(txids))
+	reqs := make([]interface{}, 0, len(txids))
+	res := make([]interface{}, 0, len(txids))
+	indexes := make([]int, 0, len(txids))
+	var p2pData [][]byte
+	var p2pErrs []error
+	if b.p2p != nil && b.p2p.IsConnected() {
+		p2pData, p2pErrs = b.p2p.GetTxsBytes(txids)
+	}
+	for i, txid := range txids {
+		if p2pErrs != nil && p2pErrs[i] == nil {
+			if txs[i], errs[i] = b.Parser.ParseTx(p2pData[i]); errs[i] != nil {
+				errs[i] = errors.Annotatef(errs[i], "txid %v", txid)
+			}
+			continue
+		}
+		req := &CmdGetRawTransaction{Method: "getrawtransaction"}
+		req.Params.Txid = txid
+		req.Params.Verbose = false
+		reqs = append(reqs, req)
+		res = append(res, &ResGetRawTransactionNonverbose{})
+		indexes = append(indexes, i)
+	}
+	if len(reqs) == 0 {
+		return txs, errs
+	}
+	glog.V(1).Info("rpc: getrawtransaction nonverbose batch of ", len(reqs), " txs")
+	callErrs := b.batchCalls(reqs, res)
+	for j, i := range indexes {
+		if callErrs[j] != nil {
+			errs[i] = errors.Annotatef(callErrs[j], "txid %v", txids[i])
+			continue
+		}
+		txs[i], errs[i] = b.parseRawTransactionNonverbose(txids[i], res[j].(*ResGetRawTransactionNonverbose))
+	}
+	return txs, errs
+}
+
+// GetTransactions returns transactions with given txids, fetched in JSON-RPC batches
+// The transactions are returned in the order of txids, errs contains the error of each transaction
+func (b *BitcoinRPC) GetTransactions(txids []string) ([]*bchain.Tx, []error) {
+	txs := make([]*bchain.Tx, len(txids))
+	errs := make([]error, len(txids))
+	reqs := make([]interface{}, len(txids))
+	res := make([]interface{}, len(txids))
+	for i, txid := range txids {
+		req := &CmdGetRawTransaction{Method: "getrawtransaction"}
+		req.Params.Txid = txid
+		req.Params.Verbose = true
+		reqs[i] = req
+		res[i] = &ResGetRawTransaction{}
+	}
+	glog.V(1).Info("rpc: getrawtransaction batch of ", len(reqs), " txs")
+	callErrs := b.batchCalls(reqs, res)
+	for i, txid := range txids {
+		if callErrs[i] != nil {
+			errs[i] = errors.Annotatef(callErrs[i], "txid %v", txid)
+			continue
+		}
+		r, err := parseRawTransaction(txid, res[i].(*ResGetRawTransaction))
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		txs[i], errs[i] = b.parseTransactionFromJSON(txid, r)
+	}
+	return txs, errs
+}
+
 // GetTransaction returns a transaction by the transaction ID
 func (b *BitcoinRPC) GetTransaction(txid string) (*bchain.Tx, error) {
 	r, err := b.getRawTransaction(txid)
 	if err != nil {
 		return nil, err
 	}
+	return b.parseTransactionFromJSON(txid, r)
+}
+
+func (b *BitcoinRPC) parseTransactionFromJSON(txid string, r json.RawMessage) (*bchain.Tx, error) {
 	tx, err := b.Parser.ParseTxFromJson(r)
 	if err != nil {
 		return nil, errors.Annotatef(err, "txid %v", txid)
@@ -756,6 +1060,10 @@ func (b *BitcoinRPC) getRawTransaction(txid string) (json.RawMessage, error) {
 	if err != nil {
 		return nil, errors.Annotatef(err, "txid %v", txid)
 	}
+	return parseRawTransaction(txid, &res)
+}
+
+func parseRawTransaction(txid string, res *ResGetRawTransaction) (json.RawMessage, error) {
 	if res.Error != nil {
 		if IsMissingTx(res.Error) {
 			return nil, bchain.ErrTxNotFound
@@ -844,6 +1152,53 @@ func (b *BitcoinRPC) SendRawTransaction(tx string) (string, error) {
 	return res.Result, nil
 }
 
+// GetTxRelayPolicy returns the relay policy of the backend set in the configuration
+func (b *BitcoinRPC) GetTxRelayPolicy() *bchain.TxRelayPolicy {
+	return &bchain.TxRelayPolicy{
+		DustRelayFeePerKb: b.ChainConfig.DustRelayFeePerKb,
+		MinRelayFeePerKb:  b.ChainConfig.MinRelayFeePerKb,
+		MaxFeePerKb:       b.ChainConfig.MaxFeePerKb,
+	}
+}
+
+// SupportsTestMempoolAccept returns true if the backend is configured to support testmempoolaccept
+func (b *BitcoinRPC) SupportsTestMempoolAccept() bool {
+	return b.ChainConfig.TestMempoolAccept
+}
+
+// TestMempoolAccept tests if the raw transaction would be accepted to the mempool of the backend, without broadcasting it
+func (b *BitcoinRPC) TestMempoolAccept(tx string) (*bchain.MempoolAcceptResult, error) {
+	glog.V(1).Info("rpc: testmempoolaccept")
+
+	res := ResTestMempoolAccept{}
+	req := CmdTestMempoolAccept{Method: "testmempoolaccept"}
+	req.Params = [][]string{{tx}}
+	err := b.Call(&req, &res)
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if len(res.Result) != 1 {
+		return nil, errors.Errorf("testmempoolaccept: unexpected number of results %d", len(res.Result))
+	}
+	rr := &res.Result[0]
+	r := &bchain.MempoolAcceptResult{
+		Txid:         rr.Txid,
+		Allowed:      rr.Allowed,
+		RejectReason: rr.RejectReason,
+		VSize:        rr.VSize,
+	}
+	// fees are returned only for the allowed transactions
+	if rr.Fees.Base != "" {
+		if r.Fee, err = b.Parser.AmountToBigInt(rr.Fees.Base); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
 // GetMempoolEntry returns mempool data for given transaction
 func (b *BitcoinRPC) GetMempoolEntry(txid string) (*bchain.MempoolEntry, error) {
 	glog.V(1).Info("rpc: getmempoolentry")
@@ -860,14 +1215,48 @@ func (b *BitcoinRPC) GetMempoolEntry(txid string) (*bchain.MempoolEntry, error)
 	if res.Error != nil {
 		return nil, res.Error
 	}
-	res.Result.FeeSat, err = b.Parser.AmountToBigInt(res.Result.Fee)
-	if err != nil {
+	if err = b.parseMempoolEntryFees(res.Result); err != nil {
 		return nil, err
 	}
-	res.Result.ModifiedFeeSat, err = b.Parser.AmountToBigInt(res.Result.ModifiedFee)
+	return res.Result, nil
+}
+
+func (b *BitcoinRPC) parseMempoolEntryFees(e *bchain.MempoolEntry) error {
+	var err error
+	e.FeeSat, err = b.Parser.AmountToBigInt(e.Fee)
+	if err != nil {
+		return err
+	}
+	e.ModifiedFeeSat, err = b.Parser.AmountToBigInt(e.ModifiedFee)
+	return err
+}
+
+// SupportsGetMempoolEntries returns true if the backend returns the mempool entries by verbose getrawmempool
+func (b *BitcoinRPC) SupportsGetMempoolEntries() bool {
+	return b.ChainConfig.SupportsGetMempoolEntries
+}
+
+// GetMempoolEntries returns mempool data of all mempool transactions indexed by txid
+func (b *BitcoinRPC) GetMempoolEntries() (map[string]*bchain.MempoolEntry, error) {
+	glog.V(1).Info("rpc: getrawmempool verbose")
+
+	res := ResGetMempoolVerbose{}
+	req := CmdGetMempoolVerbose{
+		Method: "getrawmempool",
+		Params: []bool{true},
+	}
+	err := b.Call(&req, &res)
 	if err != nil {
 		return nil, err
 	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	for _, e := range res.Result {
+		if err = b.parseMempoolEntryFees(e); err != nil {
+			return nil, err
+		}
+	}
 	return res.Result, nil
 }
 
@@ -892,12 +1281,113 @@ func safeDecodeResponse(body io.ReadCloser, res interface{}) (err error) {
 }
 
 // Call calls Backend RPC interface, using RPCMarshaler interface to marshall the request
+// If there are multiple backend endpoints, the call is made to the active one and in case of failure repeated on the next healthy endpoint
 func (b *BitcoinRPC) Call(req interface{}, res interface{}) error {
 	httpData, err := b.RPCMarshaler.Marshal(req)
 	if err != nil {
 		return err
 	}
-	httpReq, err := http.NewRequest("POST", b.rpcURL, bytes.NewBuffer(httpData))
+	return b.callActive(httpData, res)
+}
+
+// batchCalls calls Backend RPC interface with the requests sent in JSON-RPC batches of at most RPCBatchSize requests
+// If RPCBatchSize is less than 2, the requests are sent one by one.
+// The responses are unmarshalled to res in the order of reqs, errs contains the error of the call of each request
+func (b *BitcoinRPC) batchCalls(reqs []interface{}, res []interface{}) []error {
+	errs := make([]error, len(reqs))
+	size := b.ChainConfig.RPCBatchSize
+	if size < 2 {
+		for i := range reqs {
+			errs[i] = b.Call(reqs[i], res[i])
+		}
+		return errs
+	}
+	for from := 0; from < len(reqs); from += size {
+		to := from + size
+		if to > len(reqs) {
+			to = len(reqs)
+		}
+		if err := b.BatchCall(reqs[from:to], res[from:to]); err != nil {
+			for i := from; i < to; i++ {
+				errs[i] = err
+			}
+		}
+	}
+	return errs
+}
+
+// BatchCall calls Backend RPC interface with the requests sent in one JSON-RPC batch
+// The responses are unmarshalled to res in the order of reqs, the errors of the individual requests are returned
+// in the responses as in Call
+func (b *BitcoinRPC) BatchCall(reqs []interface{}, res []interface{}) error {
+	if len(reqs) != len(res) {
+		return errors.New("BatchCall: number of requests and responses differs")
+	}
+	batch := make([]json.RawMessage, len(reqs))
+	for i := range reqs {
+		d, err := b.RPCMarshaler.Marshal(reqs[i])
+		if err != nil {
+			return err
+		}
+		// the responses in the batch can be in any order, they are matched to the requests by id
+		var m map[string]json.RawMessage
+		if err = json.Unmarshal(d, &m); err != nil {
+			return err
+		}
+		m["id"] = json.RawMessage(strconv.Itoa(i))
+		if batch[i], err = json.Marshal(m); err != nil {
+			return err
+		}
+	}
+	httpData, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	var responses []json.RawMessage
+	if err = b.callActive(httpData, &responses); err != nil {
+		return err
+	}
+	received := make([]bool, len(reqs))
+	for _, r := range responses {
+		var id struct {
+			ID *int `json:"id"`
+		}
+		if err = json.Unmarshal(r, &id); err != nil {
+			return err
+		}
+		if id.ID == nil || *id.ID < 0 || *id.ID >= len(reqs) {
+			return errors.Errorf("BatchCall: unexpected response %s", r)
+		}
+		if err = json.Unmarshal(r, res[*id.ID]); err != nil {
+			return err
+		}
+		received[*id.ID] = true
+	}
+	for i := range received {
+		if !received[i] {
+			return errors.Errorf("BatchCall: missing response to request %d", i)
+		}
+	}
+	return nil
+}
+
+// callActive sends the marshalled request to the active backend endpoint
+func (b *BitcoinRPC) callActive(httpData []byte, res interface{}) error {
+	if b.backends == nil {
+		return b.call(b.rpcURL, httpData, res)
+	}
+	index, url := b.backends.Active()
+	err := b.call(url, httpData, res)
+	if err != nil {
+		if next, url := b.backends.ReportError(index, err); next != index {
+			return b.call(url, httpData, res)
+		}
+	}
+	return err
+}
+
+func (b *BitcoinRPC) call(url string, httpData []byte, res interface{}) error {
+	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(httpData))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,148 @@
+//go:build unittest
+
+package btc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/martinboehm/btcd/wire"
+	"github.com/trezor/blockbook/bchain"
+)
+
+func TestGetTransactionsForMempool_Batch(t *testing.T) {
+	_, rawBlocks := createTestBlocks(t, 3)
+	rawTxs := make(map[string]string)
+	var txids []string
+	for _, rb := range rawBlocks[:2] {
+		var b wire.MsgBlock
+		if err := b.Deserialize(bytes.NewReader(rb)); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := b.Transactions[0].Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		txid := b.Transactions[0].TxHash().String()
+		rawTxs[txid] = hex.EncodeToString(buf.Bytes())
+		txids = append(txids, txid)
+	}
+	txids = append(txids, "0000000000000000000000000000000000000000000000000000000000000001")
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		var batch []struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Txid string `json:"txid"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Errorf("request is not a batch: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		responses := make([]map[string]interface{}, 0, len(batch))
+		// respond in the reverse order, the responses must be matched by id
+		for i := len(batch) - 1; i >= 0; i-- {
+			req := batch[i]
+			if req.Method != "getrawtransaction" {
+				t.Errorf("unexpected method %v", req.Method)
+			}
+			if raw, found := rawTxs[req.Params.Txid]; found {
+				responses = append(responses, map[string]interface{}{"id": req.ID, "result": raw, "error": nil})
+			} else {
+				responses = append(responses, map[string]interface{}{"id": req.ID, "result": nil,
+					"error": map[string]interface{}{"code": -5, "message": "No such mempool or blockchain transaction"}})
+			}
+		}
+		json.NewEncoder(w).Encode(responses)
+	}))
+	defer server.Close()
+
+	config, _ := json.Marshal(map[string]interface{}{"rpc_url": server.URL, "rpc_timeout": 5, "rpc_batch_size": 2})
+	chain, err := NewBitcoinRPC(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := chain.(*BitcoinRPC)
+	b.Parser = NewBitcoinParser(GetChainParams("main"), b.ChainConfig)
+	// batching is enabled by the coin
+	if size := b.TransactionBatchSize(); size != 0 {
+		t.Errorf("TransactionBatchSize() = %d, want 0", size)
+	}
+	b.ChainConfig.SupportsTransactionBatch = true
+	if size := b.TransactionBatchSize(); size != 2 {
+		t.Errorf("TransactionBatchSize() = %d, want 2", size)
+	}
+
+	txs, errs := b.GetTransactionsForMempool(txids)
+	if requests := atomic.LoadInt32(&requests); requests != 2 {
+		t.Errorf("requests = %d, want 2", requests)
+	}
+	for i := 0; i < 2; i++ {
+		if errs[i] != nil {
+			t.Fatalf("errs[%d] = %v", i, errs[i])
+		}
+		if txs[i].Txid != txids[i] {
+			t.Errorf("txs[%d].Txid = %v, want %v", i, txs[i].Txid, txids[i])
+		}
+	}
+	if txs[2] != nil || errs[2] != bchain.ErrTxNotFound {
+		t.Errorf("txs[2], errs[2] = %v, %v, want nil, %v", txs[2], errs[2], bchain.ErrTxNotFound)
+	}
+}
+
+func TestGetBlockHeaderRaw(t *testing.T) {
+	const hash = "0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997"
+	const header = "00000020c2d1b5638f2e9a0a6e5b4a8cbdd07f0c2a2a6a2abd146f8f0e00000000000000790677d9812841c00755c399c5ddf0894e52cc40707b8a4a366dbd532d8d9b4b127ab05affff001d812c9f7d"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				BlockHash string `json:"blockhash"`
+				Verbose   bool   `json:"verbose"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			return
+		}
+		if req.Method != "getblockheader" || req.Params.Verbose {
+			t.Errorf("unexpected request %+v", req)
+		}
+		res := map[string]interface{}{"id": req.ID, "result": nil, "error": nil}
+		if req.Params.BlockHash == hash {
+			res["result"] = header
+		} else {
+			res["error"] = map[string]interface{}{"code": -5, "message": "Block not found"}
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer server.Close()
+
+	config, _ := json.Marshal(map[string]interface{}{"rpc_url": server.URL, "rpc_timeout": 5})
+	chain, err := NewBitcoinRPC(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := chain.(*BitcoinRPC)
+	got, err := b.GetBlockHeaderRaw(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(got) != header {
+		t.Errorf("GetBlockHeaderRaw() = %x, want %v", got, header)
+	}
+	if _, err = b.GetBlockHeaderRaw("0000000000000000000000000000000000000000000000000000000000000001"); err != bchain.ErrBlockNotFound {
+		t.Errorf("GetBlockHeaderRaw() error = %v, want %v", err, bchain.ErrBlockNotFound)
+	}
+}
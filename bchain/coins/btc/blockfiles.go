@@ -0,0 +1,191 @@
+package btc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/martinboehm/btcd/chaincfg/chainhash"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// block files
+// bitcoind stores the blocks in blocks/blk?????.dat files, each block is stored as a record
+// <4 bytes network magic><4 bytes little endian block size><serialized block>
+// the files are preallocated, the unused space at the end of the file is zeroed
+// since bitcoind 28, the files can be obfuscated by xor with the 8 byte key stored in blocks/xor.dat
+// the blocks are stored in the order in which they were downloaded, not by height
+// the positions of the blocks are read from the block index (LevelDB database in blocks/index),
+// if it is not available, the block files are scanned and the blocks are indexed by hash
+// the sync gets the blocks in the order of height using the block hashes from the backend
+
+const blockFileRecordHeaderSize = 8
+const blockHeaderSize = 80
+
+// blockFileLocation is the position of the block data in the block file, size is 0 if it is not known yet
+type blockFileLocation struct {
+	file   int
+	offset uint32
+	size   uint32
+}
+
+// BlockFiles is the source of blocks read directly from the backend's blk*.dat files
+type BlockFiles struct {
+	parser bchain.BlockChainParser
+	dir    string
+	xorKey []byte
+	magic  uint32
+	blocks map[chainhash.Hash]blockFileLocation
+}
+
+// NewBlockFiles locates the blocks in the blk*.dat files in the directory dir using the block index in dir/index
+// or, if the index cannot be read, by scanning the files
+func NewBlockFiles(dir string, parser bchain.BlockChainParser) (*BlockFiles, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "blk*.dat"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("No blk*.dat files in %s", dir)
+	}
+	bf := &BlockFiles{
+		parser: parser,
+		dir:    dir,
+	}
+	key, err := ioutil.ReadFile(filepath.Join(dir, "xor.dat"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, k := range key {
+		if k != 0 {
+			bf.xorKey = key
+			break
+		}
+	}
+	start := time.Now()
+	if bf.blocks, err = readBlockIndex(filepath.Join(dir, "index")); err == nil {
+		glog.Info("blockfiles: read positions of ", len(bf.blocks), " blocks from block index, done in ", time.Since(start))
+		return bf, nil
+	}
+	glog.Warning("blockfiles: cannot read block index: ", err, ", scanning block files")
+	bf.blocks = make(map[chainhash.Hash]blockFileLocation)
+	for _, name := range files {
+		n, ok := blockFileNumber(name)
+		if !ok {
+			continue
+		}
+		if err := bf.indexFile(n); err != nil {
+			return nil, errors.Annotatef(err, "%s", name)
+		}
+	}
+	glog.Info("blockfiles: indexed ", len(bf.blocks), " blocks in ", len(files), " files, done in ", time.Since(start))
+	return bf, nil
+}
+
+func (bf *BlockFiles) fileName(n int) string {
+	return filepath.Join(bf.dir, fmt.Sprintf("blk%05d.dat", n))
+}
+
+// readAt reads len(buf) bytes from the file at the offset and removes the xor obfuscation
+func (bf *BlockFiles) readAt(f *os.File, buf []byte, offset int64) error {
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		return err
+	}
+	if len(bf.xorKey) > 0 {
+		l := int64(len(bf.xorKey))
+		for i := range buf {
+			buf[i] ^= bf.xorKey[(offset+int64(i))%l]
+		}
+	}
+	return nil
+}
+
+func (bf *BlockFiles) indexFile(n int) error {
+	f, err := os.Open(bf.fileName(n))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	buf := make([]byte, blockFileRecordHeaderSize+blockHeaderSize)
+	for offset := int64(0); offset+int64(len(buf)) <= size; {
+		if err := bf.readAt(f, buf, offset); err != nil {
+			return err
+		}
+		magic := binary.LittleEndian.Uint32(buf)
+		// zeroed preallocated space
+		if magic == 0 {
+			break
+		}
+		if bf.magic == 0 {
+			bf.magic = magic
+		} else if magic != bf.magic {
+			return errors.Errorf("Unexpected magic %x at offset %d", magic, offset)
+		}
+		blockSize := binary.LittleEndian.Uint32(buf[4:])
+		if offset+blockFileRecordHeaderSize+int64(blockSize) > size {
+			glog.Warning("blockfiles: ", bf.fileName(n), " truncated block at offset ", offset)
+			break
+		}
+		bf.blocks[chainhash.DoubleHashH(buf[blockFileRecordHeaderSize:])] = blockFileLocation{
+			file:   n,
+			offset: uint32(offset + blockFileRecordHeaderSize),
+			size:   blockSize,
+		}
+		offset += blockFileRecordHeaderSize + int64(blockSize)
+	}
+	return nil
+}
+
+// GetBlock returns the block with given hash from the block files or bchain.ErrBlockNotFound if it is not in the files
+func (bf *BlockFiles) GetBlock(hash string, height uint32) (*bchain.Block, error) {
+	h, err := chainhash.NewHashFromStr(hash)
+	if err != nil {
+		return nil, err
+	}
+	l, found := bf.blocks[*h]
+	if !found {
+		return nil, bchain.ErrBlockNotFound
+	}
+	f, err := os.Open(bf.fileName(l.file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	size := l.size
+	if size == 0 {
+		// the position from the block index points to the block data, the size precedes it
+		if l.offset < 4 {
+			return nil, errors.Errorf("Invalid position %v of block %v %v", l.offset, height, hash)
+		}
+		buf := make([]byte, 4)
+		if err := bf.readAt(f, buf, int64(l.offset)-4); err != nil {
+			return nil, errors.Annotatef(err, "%v %v", height, hash)
+		}
+		size = binary.LittleEndian.Uint32(buf)
+	}
+	data := make([]byte, size)
+	if err := bf.readAt(f, data, int64(l.offset)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, errors.Annotatef(err, "%v %v", height, hash)
+	}
+	block, err := bf.parser.ParseBlock(data)
+	if err != nil {
+		return nil, errors.Annotatef(err, "%v %v", height, hash)
+	}
+	block.BlockHeader.Hash = hash
+	block.BlockHeader.Height = height
+	return block, nil
+}
@@ -0,0 +1,334 @@
+//go:build unittest
+
+package btc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/martinboehm/btcd/chaincfg/chainhash"
+	"github.com/martinboehm/btcd/wire"
+	"github.com/trezor/blockbook/bchain"
+)
+
+const testBlockFilesMagic = 0xd9b4bef9
+
+func createTestBlocks(t *testing.T, n int) ([]string, [][]byte) {
+	var hashes []string
+	var blocks [][]byte
+	prev := chainhash.Hash{}
+	for i := 0; i < n; i++ {
+		b := wire.NewMsgBlock(&wire.BlockHeader{
+			Version:   1,
+			PrevBlock: prev,
+			Timestamp: time.Unix(int64(1600000000+i*600), 0),
+			Bits:      0x1d00ffff,
+			Nonce:     uint32(i),
+		})
+		tx := wire.NewMsgTx(1)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 0xffffffff}, []byte{byte(i), 0x51}, nil))
+		script, _ := hex.DecodeString("76a914be027bf3eac907bd4ac8cb9c5293b6f37662722088ac")
+		tx.AddTxOut(wire.NewTxOut(5000000000, script))
+		if err := b.AddTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := b.Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		prev = b.BlockHash()
+		hashes = append(hashes, prev.String())
+		blocks = append(blocks, buf.Bytes())
+	}
+	return hashes, blocks
+}
+
+func writeTestBlockFile(t *testing.T, name string, blocks [][]byte, xorKey []byte) {
+	var buf bytes.Buffer
+	for _, b := range blocks {
+		binary.Write(&buf, binary.LittleEndian, uint32(testBlockFilesMagic))
+		binary.Write(&buf, binary.LittleEndian, uint32(len(b)))
+		buf.Write(b)
+	}
+	// preallocated space
+	buf.Write(make([]byte, 256))
+	data := buf.Bytes()
+	if len(xorKey) > 0 {
+		for i := range data {
+			data[i] ^= xorKey[i%len(xorKey)]
+		}
+	}
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockFiles(t *testing.T) {
+	parser := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	hashes, blocks := createTestBlocks(t, 5)
+	tests := []struct {
+		name   string
+		xorKey []byte
+	}{
+		{
+			name: "plain",
+		},
+		{
+			name:   "xor",
+			xorKey: []byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "blockfiles")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			if tt.xorKey != nil {
+				if err := ioutil.WriteFile(filepath.Join(dir, "xor.dat"), tt.xorKey, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// the blocks are not stored in the order of height
+			writeTestBlockFile(t, filepath.Join(dir, "blk00000.dat"), [][]byte{blocks[0], blocks[2], blocks[1]}, tt.xorKey)
+			writeTestBlockFile(t, filepath.Join(dir, "blk00001.dat"), [][]byte{blocks[4], blocks[3]}, tt.xorKey)
+			bf, err := NewBlockFiles(dir, parser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bf.blocks) != len(blocks) {
+				t.Fatalf("indexed %d blocks, want %d", len(bf.blocks), len(blocks))
+			}
+			for i := range hashes {
+				b, err := bf.GetBlock(hashes[i], uint32(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if b.Hash != hashes[i] || b.Height != uint32(i) || b.Size != len(blocks[i]) || b.Time != int64(1600000000+i*600) {
+					t.Errorf("GetBlock(%d) = %+v", i, b.BlockHeader)
+				}
+				if len(b.Txs) != 1 || len(b.Txs[0].Vout) != 1 || b.Txs[0].Vout[0].ValueSat.Int64() != 5000000000 {
+					t.Errorf("GetBlock(%d) unexpected txs %+v", i, b.Txs)
+				}
+			}
+			_, err = bf.GetBlock("000000000000000000000000000000000000000000000000000000000000abcd", 5)
+			if err != bchain.ErrBlockNotFound {
+				t.Errorf("GetBlock() error = %v, want %v", err, bchain.ErrBlockNotFound)
+			}
+		})
+	}
+}
+
+// bitcoinVarintBytes encodes n in the VARINT format of bitcoind's serialization of the disk structures
+func bitcoinVarintBytes(n uint64) []byte {
+	var tmp []byte
+	for {
+		b := byte(n & 0x7f)
+		if len(tmp) > 0 {
+			b |= 0x80
+		}
+		tmp = append(tmp, b)
+		if n <= 0x7f {
+			break
+		}
+		n = (n >> 7) - 1
+	}
+	r := make([]byte, len(tmp))
+	for i := range tmp {
+		r[i] = tmp[len(tmp)-1-i]
+	}
+	return r
+}
+
+type testBlockIndexEntry struct {
+	hash   string
+	height int
+	status uint64
+	file   int
+	pos    int
+}
+
+func (e *testBlockIndexEntry) key(t *testing.T) []byte {
+	h, err := chainhash.NewHashFromStr(e.hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte{blockIndexPrefix}, h[:]...)
+}
+
+func (e *testBlockIndexEntry) value() []byte {
+	var v []byte
+	v = append(v, bitcoinVarintBytes(259900)...)
+	v = append(v, bitcoinVarintBytes(uint64(e.height))...)
+	v = append(v, bitcoinVarintBytes(e.status)...)
+	v = append(v, bitcoinVarintBytes(1)...)
+	if e.status&(blockHaveData|blockHaveUndo) != 0 {
+		v = append(v, bitcoinVarintBytes(uint64(e.file))...)
+	}
+	if e.status&blockHaveData != 0 {
+		v = append(v, bitcoinVarintBytes(uint64(e.pos))...)
+	}
+	if e.status&blockHaveUndo != 0 {
+		v = append(v, bitcoinVarintBytes(uint64(e.pos))...)
+	}
+	// block header
+	return append(v, make([]byte, blockHeaderSize)...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	return append(buf, b[:binary.PutUvarint(b, v)]...)
+}
+
+// levelDBTableBlock creates uncompressed table block with the entries, the keys are not prefix compressed
+func levelDBTableBlock(keys, values [][]byte) []byte {
+	var b []byte
+	for i := range keys {
+		b = appendUvarint(b, 0)
+		b = appendUvarint(b, uint64(len(keys[i])))
+		b = appendUvarint(b, uint64(len(values[i])))
+		b = append(b, keys[i]...)
+		b = append(b, values[i]...)
+	}
+	// single restart point at offset 0
+	b = append(b, 0, 0, 0, 0, 1, 0, 0, 0)
+	return b
+}
+
+func writeTestLevelDBTable(t *testing.T, name string, seq uint64, entries []testBlockIndexEntry) {
+	var keys, values [][]byte
+	for i := range entries {
+		k := make([]byte, 8)
+		binary.LittleEndian.PutUint64(k, (seq+uint64(i))<<8|levelDBTypeValue)
+		keys = append(keys, append(entries[i].key(t), k...))
+		values = append(values, entries[i].value())
+	}
+	var file []byte
+	writeBlock := func(b []byte) []byte {
+		var handle []byte
+		handle = appendUvarint(handle, uint64(len(file)))
+		handle = appendUvarint(handle, uint64(len(b)))
+		file = append(file, b...)
+		// compression type and checksum, which is not verified
+		file = append(file, 0, 0, 0, 0, 0)
+		return handle
+	}
+	dataHandle := writeBlock(levelDBTableBlock(keys, values))
+	metaHandle := writeBlock(levelDBTableBlock(nil, nil))
+	indexHandle := writeBlock(levelDBTableBlock([][]byte{keys[len(keys)-1]}, [][]byte{dataHandle}))
+	footer := append(append([]byte{}, metaHandle...), indexHandle...)
+	footer = append(footer, make([]byte, levelDBTableFooterSize-8-len(footer))...)
+	magic := make([]byte, 8)
+	binary.LittleEndian.PutUint64(magic, levelDBTableMagic)
+	file = append(append(file, footer...), magic...)
+	if err := ioutil.WriteFile(name, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestLevelDBLog(t *testing.T, name string, seq uint64, entries []testBlockIndexEntry) {
+	batch := make([]byte, 12)
+	binary.LittleEndian.PutUint64(batch, seq)
+	binary.LittleEndian.PutUint32(batch[8:], uint32(len(entries)))
+	for i := range entries {
+		k, v := entries[i].key(t), entries[i].value()
+		batch = append(batch, levelDBTypeValue)
+		batch = appendUvarint(batch, uint64(len(k)))
+		batch = append(batch, k...)
+		batch = appendUvarint(batch, uint64(len(v)))
+		batch = append(batch, v...)
+	}
+	// checksum, which is not verified, length and type of the record
+	header := []byte{0, 0, 0, 0, 0, 0, levelDBLogFull}
+	binary.LittleEndian.PutUint16(header[4:], uint16(len(batch)))
+	data := append(header, batch...)
+	// zeroed preallocated space
+	data = append(data, make([]byte, 64)...)
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockFiles_blockIndex(t *testing.T) {
+	parser := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	hashes, blocks := createTestBlocks(t, 5)
+	xorKey := []byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+	dir, err := ioutil.TempDir("", "blockfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "xor.dat"), xorKey, 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeTestBlockFile(t, filepath.Join(dir, "blk00000.dat"), [][]byte{blocks[0], blocks[2], blocks[1]}, xorKey)
+	writeTestBlockFile(t, filepath.Join(dir, "blk00001.dat"), [][]byte{blocks[4], blocks[3]}, xorKey)
+	pos := func(blocks ...[]byte) int {
+		p := blockFileRecordHeaderSize
+		for _, b := range blocks {
+			p += blockFileRecordHeaderSize + len(b)
+		}
+		return p
+	}
+	if err := os.Mkdir(filepath.Join(dir, "index"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestLevelDBTable(t, filepath.Join(dir, "index", "000005.ldb"), 1, []testBlockIndexEntry{
+		{hash: hashes[0], height: 0, status: blockHaveData | blockHaveUndo, file: 0, pos: pos()},
+		{hash: hashes[1], height: 1, status: blockHaveData | blockHaveUndo, file: 0, pos: pos(blocks[0], blocks[2])},
+		{hash: hashes[2], height: 2, status: blockHaveData | blockHaveUndo, file: 0, pos: pos(blocks[0])},
+		// only header, the position is updated in the log
+		{hash: hashes[3], height: 3, status: 0},
+	})
+	writeTestLevelDBLog(t, filepath.Join(dir, "index", "000006.log"), 10, []testBlockIndexEntry{
+		{hash: hashes[3], height: 3, status: blockHaveData, file: 1, pos: pos(blocks[4])},
+		{hash: hashes[4], height: 4, status: blockHaveData, file: 1, pos: pos()},
+		// block without data is not located
+		{hash: "000000000000000000000000000000000000000000000000000000000000abcd", height: 5, status: 0},
+	})
+	bf, err := NewBlockFiles(dir, parser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bf.blocks) != len(blocks) {
+		t.Fatalf("located %d blocks, want %d", len(bf.blocks), len(blocks))
+	}
+	for _, l := range bf.blocks {
+		if l.size != 0 {
+			t.Fatalf("block location %+v not from block index", l)
+		}
+	}
+	for i := range hashes {
+		b, err := bf.GetBlock(hashes[i], uint32(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Hash != hashes[i] || b.Height != uint32(i) || b.Size != len(blocks[i]) || b.Time != int64(1600000000+i*600) {
+			t.Errorf("GetBlock(%d) = %+v", i, b.BlockHeader)
+		}
+	}
+	_, err = bf.GetBlock("000000000000000000000000000000000000000000000000000000000000abcd", 5)
+	if err != bchain.ErrBlockNotFound {
+		t.Errorf("GetBlock() error = %v, want %v", err, bchain.ErrBlockNotFound)
+	}
+}
+
+func Test_bitcoinVarint(t *testing.T) {
+	for _, n := range []uint64{0, 1, 127, 128, 255, 256, 16383, 16384, 16511, 65535, 1 << 32, 1<<63 - 1} {
+		b := bitcoinVarintBytes(n)
+		got, rest, err := bitcoinVarint(append(b, 0xff))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != n || len(rest) != 1 {
+			t.Errorf("bitcoinVarint(%x) = %v, %x, want %v", b, got, rest, n)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package btc
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/martinboehm/btcd/chaincfg/chainhash"
+)
+
+// block index
+// bitcoind stores the positions of the blocks in the LevelDB database in blocks/index
+// the database is read without a LevelDB library, only the subset of the format used by bitcoind is supported:
+// the table files (*.ldb, *.sst) without compression and the log files (*.log) with the recent writes
+// the files are read in any order, the version of a key with the highest sequence number wins
+
+const (
+	levelDBTableMagic      = 0xdb4775248b80fb57
+	levelDBTableFooterSize = 48
+	levelDBBlockTrailer    = 5
+	levelDBLogBlockSize    = 32768
+	levelDBLogHeaderSize   = 7
+	levelDBTypeDeletion    = 0
+	levelDBTypeValue       = 1
+	levelDBLogFull         = 1
+	levelDBLogFirst        = 2
+	levelDBLogMiddle       = 3
+	levelDBLogLast         = 4
+)
+
+// the block index record key is 'b' followed by the block hash
+const blockIndexPrefix = 'b'
+
+// status flags of the block index record
+const (
+	blockHaveData = 8
+	blockHaveUndo = 16
+)
+
+type levelDBValue struct {
+	seq     uint64
+	deleted bool
+	value   []byte
+}
+
+// levelDBReader collects the latest versions of the keys with given prefix
+type levelDBReader struct {
+	prefix []byte
+	values map[string]levelDBValue
+}
+
+func (r *levelDBReader) add(key []byte, seq uint64, deleted bool, value []byte) {
+	if len(key) < len(r.prefix) || string(key[:len(r.prefix)]) != string(r.prefix) {
+		return
+	}
+	if v, found := r.values[string(key)]; found && v.seq > seq {
+		return
+	}
+	r.values[string(key)] = levelDBValue{seq: seq, deleted: deleted, value: append([]byte(nil), value...)}
+}
+
+func uvarint(buf []byte) (uint64, []byte, error) {
+	v, l := binary.Uvarint(buf)
+	if l <= 0 {
+		return 0, nil, errors.New("Invalid varint")
+	}
+	return v, buf[l:], nil
+}
+
+func lengthPrefixed(buf []byte) ([]byte, []byte, error) {
+	l, buf, err := uvarint(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	if uint64(len(buf)) < l {
+		return nil, nil, errors.New("Invalid length")
+	}
+	return buf[:l], buf[l:], nil
+}
+
+// tableBlock returns the contents of the block of the table file referenced by the handle
+func tableBlock(data, handle []byte) ([]byte, error) {
+	offset, handle, err := uvarint(handle)
+	if err != nil {
+		return nil, err
+	}
+	size, _, err := uvarint(handle)
+	if err != nil {
+		return nil, err
+	}
+	if offset+size+levelDBBlockTrailer > uint64(len(data)) {
+		return nil, errors.New("Block out of bounds")
+	}
+	if data[offset+size] != 0 {
+		return nil, errors.Errorf("Compressed block (type %d) not supported", data[offset+size])
+	}
+	return data[offset : offset+size], nil
+}
+
+// tableBlockEntries calls f for all key-value pairs of the block
+func tableBlockEntries(block []byte, f func(key, value []byte) error) error {
+	if len(block) < 4 {
+		return errors.New("Invalid block")
+	}
+	restarts := binary.LittleEndian.Uint32(block[len(block)-4:])
+	end := len(block) - 4 - 4*int(restarts)
+	if end < 0 {
+		return errors.New("Invalid block restarts")
+	}
+	buf := block[:end]
+	var key []byte
+	for len(buf) > 0 {
+		var shared, nonShared, valueLen uint64
+		var err error
+		if shared, buf, err = uvarint(buf); err != nil {
+			return err
+		}
+		if nonShared, buf, err = uvarint(buf); err != nil {
+			return err
+		}
+		if valueLen, buf, err = uvarint(buf); err != nil {
+			return err
+		}
+		if shared > uint64(len(key)) || nonShared+valueLen > uint64(len(buf)) {
+			return errors.New("Invalid block entry")
+		}
+		key = append(key[:shared], buf[:nonShared]...)
+		if err = f(key, buf[nonShared:nonShared+valueLen]); err != nil {
+			return err
+		}
+		buf = buf[nonShared+valueLen:]
+	}
+	return nil
+}
+
+func (r *levelDBReader) readTable(data []byte) error {
+	if len(data) < levelDBTableFooterSize {
+		return errors.New("Invalid table file")
+	}
+	footer := data[len(data)-levelDBTableFooterSize:]
+	if binary.LittleEndian.Uint64(footer[levelDBTableFooterSize-8:]) != levelDBTableMagic {
+		return errors.New("Invalid table magic")
+	}
+	// skip the metaindex handle, the index handle follows it
+	_, h, err := uvarint(footer)
+	if err != nil {
+		return err
+	}
+	if _, h, err = uvarint(h); err != nil {
+		return err
+	}
+	index, err := tableBlock(data, h)
+	if err != nil {
+		return err
+	}
+	return tableBlockEntries(index, func(_, handle []byte) error {
+		block, err := tableBlock(data, handle)
+		if err != nil {
+			return err
+		}
+		return tableBlockEntries(block, func(key, value []byte) error {
+			// internal key is user key followed by sequence number and type
+			if len(key) < 8 {
+				return errors.New("Invalid internal key")
+			}
+			t := binary.LittleEndian.Uint64(key[len(key)-8:])
+			r.add(key[:len(key)-8], t>>8, t&0xff == levelDBTypeDeletion, value)
+			return nil
+		})
+	})
+}
+
+// readLog reads the write batches from the log file, the incomplete record at the end of the log is ignored
+func (r *levelDBReader) readLog(data []byte) error {
+	var record []byte
+	for block := 0; block < len(data); block += levelDBLogBlockSize {
+		end := block + levelDBLogBlockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		buf := data[block:end]
+		for len(buf) >= levelDBLogHeaderSize {
+			l := int(binary.LittleEndian.Uint16(buf[4:]))
+			t := buf[6]
+			if t == 0 || levelDBLogHeaderSize+l > len(buf) {
+				// zeroed preallocated space or a partially written record
+				break
+			}
+			fragment := buf[levelDBLogHeaderSize : levelDBLogHeaderSize+l]
+			buf = buf[levelDBLogHeaderSize+l:]
+			switch t {
+			case levelDBLogFull:
+				record = append(record[:0], fragment...)
+			case levelDBLogFirst:
+				record = append(record[:0], fragment...)
+				continue
+			case levelDBLogMiddle:
+				record = append(record, fragment...)
+				continue
+			case levelDBLogLast:
+				record = append(record, fragment...)
+			default:
+				return errors.Errorf("Invalid log record type %d", t)
+			}
+			if err := r.readWriteBatch(record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *levelDBReader) readWriteBatch(batch []byte) error {
+	if len(batch) < 12 {
+		return errors.New("Invalid write batch")
+	}
+	seq := binary.LittleEndian.Uint64(batch)
+	count := binary.LittleEndian.Uint32(batch[8:])
+	buf := batch[12:]
+	for i := uint32(0); i < count; i++ {
+		if len(buf) == 0 {
+			return errors.New("Truncated write batch")
+		}
+		t := buf[0]
+		var key, value []byte
+		var err error
+		if key, buf, err = lengthPrefixed(buf[1:]); err != nil {
+			return err
+		}
+		if t == levelDBTypeValue {
+			if value, buf, err = lengthPrefixed(buf); err != nil {
+				return err
+			}
+		}
+		r.add(key, seq+uint64(i), t == levelDBTypeDeletion, value)
+	}
+	return nil
+}
+
+// readLevelDB returns the latest values of the keys with given prefix from the LevelDB database in the directory dir
+func readLevelDB(dir string, prefix []byte) (map[string][]byte, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	r := levelDBReader{prefix: prefix, values: make(map[string]levelDBValue)}
+	tables := 0
+	for _, fi := range files {
+		name := fi.Name()
+		ext := filepath.Ext(name)
+		if ext != ".ldb" && ext != ".sst" && ext != ".log" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if ext == ".log" {
+			err = r.readLog(data)
+		} else {
+			err = r.readTable(data)
+			tables++
+		}
+		if err != nil {
+			return nil, errors.Annotatef(err, "%s", name)
+		}
+	}
+	if tables == 0 && len(r.values) == 0 {
+		return nil, errors.Errorf("No LevelDB files in %s", dir)
+	}
+	values := make(map[string][]byte, len(r.values))
+	for k, v := range r.values {
+		if !v.deleted {
+			values[k] = v.value
+		}
+	}
+	return values, nil
+}
+
+// bitcoinVarint decodes the VARINT format of bitcoind's serialization of the disk structures
+func bitcoinVarint(buf []byte) (uint64, []byte, error) {
+	var n uint64
+	for i, b := range buf {
+		if i >= 10 {
+			break
+		}
+		n = n<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			return n, buf[i+1:], nil
+		}
+		n++
+	}
+	return 0, nil, errors.New("Invalid varint")
+}
+
+// blockIndexRecord is the part of the CDiskBlockIndex record needed to locate the block
+type blockIndexRecord struct {
+	height int32
+	status uint64
+	file   int
+	pos    uint32
+}
+
+func parseBlockIndexRecord(buf []byte) (*blockIndexRecord, error) {
+	var r blockIndexRecord
+	var v uint64
+	var err error
+	// client version
+	if _, buf, err = bitcoinVarint(buf); err != nil {
+		return nil, err
+	}
+	if v, buf, err = bitcoinVarint(buf); err != nil {
+		return nil, err
+	}
+	r.height = int32(v)
+	if r.status, buf, err = bitcoinVarint(buf); err != nil {
+		return nil, err
+	}
+	// number of transactions
+	if _, buf, err = bitcoinVarint(buf); err != nil {
+		return nil, err
+	}
+	if r.status&(blockHaveData|blockHaveUndo) != 0 {
+		if v, buf, err = bitcoinVarint(buf); err != nil {
+			return nil, err
+		}
+		r.file = int(v)
+	}
+	if r.status&blockHaveData != 0 {
+		if v, _, err = bitcoinVarint(buf); err != nil {
+			return nil, err
+		}
+		r.pos = uint32(v)
+	}
+	return &r, nil
+}
+
+// readBlockIndex returns the positions of the blocks stored in the block files from the block index in the directory dir
+func readBlockIndex(dir string) (map[chainhash.Hash]blockFileLocation, error) {
+	values, err := readLevelDB(dir, []byte{blockIndexPrefix})
+	if err != nil {
+		return nil, err
+	}
+	blocks := make(map[chainhash.Hash]blockFileLocation, len(values))
+	for k, v := range values {
+		if len(k) != 1+chainhash.HashSize {
+			continue
+		}
+		r, err := parseBlockIndexRecord(v)
+		if err != nil {
+			return nil, errors.Annotatef(err, "block index record %x", k)
+		}
+		if r.status&blockHaveData == 0 {
+			continue
+		}
+		var h chainhash.Hash
+		copy(h[:], k[1:])
+		// the size of the block is read from the block file record header when the block is read
+		blocks[h] = blockFileLocation{file: r.file, offset: r.pos}
+	}
+	return blocks, nil
+}
+
+// blockFileNumber returns the number of the block file from its name blkNNNNN.dat
+func blockFileNumber(name string) (int, bool) {
+	name = filepath.Base(name)
+	if !strings.HasPrefix(name, "blk") || !strings.HasSuffix(name, ".dat") {
+		return 0, false
+	}
+	n := 0
+	for _, c := range name[3 : len(name)-4] {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
@@ -0,0 +1,479 @@
+package btc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/martinboehm/btcd/chaincfg/chainhash"
+	"github.com/martinboehm/btcd/wire"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// P2P client
+// downloads blocks and mempool transactions from the backend over the bitcoin P2P protocol using getdata messages
+// and receives the inv announcements of new blocks and transactions
+// the messages are read in raw form, so that the blocks and transactions can be parsed by the coin specific parser,
+// however the transactions are matched to the requests by their hash computed from the bitcoin wire format,
+// therefore the client can be used only by the coins with the bitcoin transaction format (see Configuration.SupportsP2P)
+
+const (
+	p2pMessageHeaderSize = 24
+	p2pCommandSize       = 12
+	// the peer sends ping every 2 minutes, connection without any message for a longer time is considered dead
+	p2pIdleTimeout     = 5 * time.Minute
+	p2pReconnectDelay  = 10 * time.Second
+	maxP2PAnnouncedTxs = 50000
+	maxP2PKnownTxs     = 300000
+)
+
+// ErrP2PNotConnected is returned when a request is made while the P2P client is not connected to the peer
+var ErrP2PNotConnected = errors.New("P2P not connected")
+
+type p2pResult struct {
+	data []byte
+	err  error
+}
+
+// P2PClient is a client of the bitcoin P2P protocol connected to a single peer
+type P2PClient struct {
+	address    string
+	net        wire.BitcoinNet
+	pver       uint32
+	timeout    time.Duration
+	onBlockInv func(hash string)
+	onTx       func(rawTx []byte)
+	mux        sync.Mutex
+	writeMux   sync.Mutex
+	conn       net.Conn
+	witness    bool
+	pending    map[wire.InvVect][]chan p2pResult
+	announced  map[chainhash.Hash]struct{}
+	known      map[chainhash.Hash]struct{}
+	done       chan struct{}
+}
+
+// NewP2PClient creates the P2P client of the peer at address, the client must be started by Start
+// onBlockInv is called when the peer announces a new block, onTx is called with the announced transactions
+func NewP2PClient(address string, net wire.BitcoinNet, timeout time.Duration, onBlockInv func(hash string), onTx func(rawTx []byte)) *P2PClient {
+	return &P2PClient{
+		address:    address,
+		net:        net,
+		pver:       wire.ProtocolVersion,
+		timeout:    timeout,
+		onBlockInv: onBlockInv,
+		onTx:       onTx,
+		pending:    make(map[wire.InvVect][]chan p2pResult),
+		announced:  make(map[chainhash.Hash]struct{}),
+		known:      make(map[chainhash.Hash]struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start connects to the peer and keeps the connection open until Stop is called
+func (p *P2PClient) Start() {
+	go p.run()
+}
+
+// Stop closes the connection to the peer
+func (p *P2PClient) Stop() {
+	close(p.done)
+	p.mux.Lock()
+	conn := p.conn
+	p.mux.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// IsConnected returns true if the handshake with the peer was completed and the connection is open
+func (p *P2PClient) IsConnected() bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.conn != nil
+}
+
+func (p *P2PClient) stopped() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *P2PClient) run() {
+	for {
+		conn, err := p.connect()
+		if err != nil {
+			glog.Error("p2p: connect to ", p.address, " error ", err)
+		} else {
+			glog.Info("p2p: connected to ", p.address)
+			err = p.readLoop(conn)
+			p.disconnect(conn)
+			if !p.stopped() {
+				glog.Error("p2p: disconnected from ", p.address, ", error ", err)
+			}
+		}
+		select {
+		case <-p.done:
+			glog.Info("p2p: stopped")
+			return
+		case <-time.After(p2pReconnectDelay):
+		}
+	}
+}
+
+func (p *P2PClient) connect() (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", p.address, p.timeout)
+	if err != nil {
+		return nil, err
+	}
+	host, portStr, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	port, _ := strconv.Atoi(portStr)
+	me := wire.NewNetAddressIPPort(net.IPv4zero, 0, 0)
+	you := wire.NewNetAddressIPPort(net.ParseIP(host), uint16(port), 0)
+	version := wire.NewMsgVersion(me, you, rand.Uint64(), 0)
+	version.ProtocolVersion = int32(p.pver)
+	if err := version.AddUserAgent("blockbook", ""); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := p.writeMessage(conn, version); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// wait for the version and verack of the peer, ignore other messages sent during the handshake
+	conn.SetReadDeadline(time.Now().Add(p.timeout))
+	var gotVersion, gotVerAck, witness bool
+	for !gotVersion || !gotVerAck {
+		command, payload, err := readP2PMessage(conn, p.net)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		switch command {
+		case wire.CmdVersion:
+			var v wire.MsgVersion
+			// MsgVersion decoding requires bytes.Buffer
+			if err := v.BtcDecode(bytes.NewBuffer(payload), p.pver, wire.BaseEncoding); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			witness = v.HasService(wire.SFNodeWitness)
+			gotVersion = true
+			if err := p.writeMessage(conn, wire.NewMsgVerAck()); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		case wire.CmdVerAck:
+			gotVerAck = true
+		}
+	}
+	p.mux.Lock()
+	p.conn = conn
+	p.witness = witness
+	p.mux.Unlock()
+	return conn, nil
+}
+
+func (p *P2PClient) disconnect(conn net.Conn) {
+	conn.Close()
+	p.mux.Lock()
+	p.conn = nil
+	pending := p.pending
+	p.pending = make(map[wire.InvVect][]chan p2pResult)
+	p.announced = make(map[chainhash.Hash]struct{})
+	p.known = make(map[chainhash.Hash]struct{})
+	p.mux.Unlock()
+	for _, cs := range pending {
+		for _, c := range cs {
+			c <- p2pResult{err: ErrP2PNotConnected}
+		}
+	}
+}
+
+func (p *P2PClient) readLoop(conn net.Conn) error {
+	for {
+		conn.SetReadDeadline(time.Now().Add(p2pIdleTimeout))
+		command, payload, err := readP2PMessage(conn, p.net)
+		if err != nil {
+			return err
+		}
+		if err = p.handleMessage(conn, command, payload); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *P2PClient) handleMessage(conn net.Conn, command string, payload []byte) error {
+	switch command {
+	case wire.CmdPing:
+		var ping wire.MsgPing
+		if err := ping.BtcDecode(bytes.NewReader(payload), p.pver, wire.BaseEncoding); err != nil {
+			return err
+		}
+		return p.writeMessage(conn, wire.NewMsgPong(ping.Nonce))
+	case wire.CmdInv:
+		var inv wire.MsgInv
+		if err := inv.BtcDecode(bytes.NewReader(payload), p.pver, wire.BaseEncoding); err != nil {
+			return err
+		}
+		return p.handleInv(conn, &inv)
+	case wire.CmdNotFound:
+		var nf wire.MsgNotFound
+		if err := nf.BtcDecode(bytes.NewReader(payload), p.pver, wire.BaseEncoding); err != nil {
+			return err
+		}
+		for _, iv := range nf.InvList {
+			err := bchain.ErrTxNotFound
+			if iv.Type&^wire.InvWitnessFlag == wire.InvTypeBlock {
+				err = bchain.ErrBlockNotFound
+			} else {
+				p.mux.Lock()
+				delete(p.announced, iv.Hash)
+				delete(p.known, iv.Hash)
+				p.mux.Unlock()
+			}
+			p.deliver(iv.Type, &iv.Hash, p2pResult{err: err})
+		}
+	case wire.CmdBlock:
+		if len(payload) < blockHeaderSize {
+			return errors.New("Invalid block message")
+		}
+		hash := chainhash.DoubleHashH(payload[:blockHeaderSize])
+		p.deliver(wire.InvTypeBlock, &hash, p2pResult{data: payload})
+	case wire.CmdTx:
+		var tx wire.MsgTx
+		if err := tx.BtcDecode(bytes.NewReader(payload), p.pver, wire.WitnessEncoding); err != nil {
+			glog.Error("p2p: tx decode error ", err)
+			return nil
+		}
+		hash := tx.TxHash()
+		p.deliver(wire.InvTypeTx, &hash, p2pResult{data: payload})
+		p.mux.Lock()
+		_, announced := p.announced[hash]
+		delete(p.announced, hash)
+		p.mux.Unlock()
+		if announced && p.onTx != nil {
+			p.onTx(payload)
+		}
+	}
+	return nil
+}
+
+func (p *P2PClient) handleInv(conn net.Conn, inv *wire.MsgInv) error {
+	getData := wire.NewMsgGetData()
+	for _, iv := range inv.InvList {
+		switch iv.Type {
+		case wire.InvTypeBlock:
+			if p.onBlockInv != nil {
+				p.onBlockInv(iv.Hash.String())
+			}
+		case wire.InvTypeTx:
+			p.mux.Lock()
+			if len(p.known) >= maxP2PKnownTxs {
+				p.known = make(map[chainhash.Hash]struct{})
+			}
+			p.known[iv.Hash] = struct{}{}
+			if p.onTx == nil {
+				p.mux.Unlock()
+				continue
+			}
+			if len(p.announced) >= maxP2PAnnouncedTxs {
+				glog.Warning("p2p: too many announced transactions without response, resetting")
+				p.announced = make(map[chainhash.Hash]struct{})
+			}
+			_, requested := p.announced[iv.Hash]
+			p.announced[iv.Hash] = struct{}{}
+			witness := p.witness
+			p.mux.Unlock()
+			if !requested {
+				getData.AddInvVect(wire.NewInvVect(invType(wire.InvTypeTx, witness), &iv.Hash))
+			}
+		}
+	}
+	if len(getData.InvList) > 0 {
+		return p.writeMessage(conn, getData)
+	}
+	return nil
+}
+
+// invType returns the inventory type to be requested, the witness data are requested from the peers supporting them
+func invType(t wire.InvType, witness bool) wire.InvType {
+	if witness {
+		return t | wire.InvWitnessFlag
+	}
+	return t
+}
+
+func (p *P2PClient) deliver(t wire.InvType, hash *chainhash.Hash, r p2pResult) {
+	key := wire.InvVect{Type: t &^ wire.InvWitnessFlag, Hash: *hash}
+	p.mux.Lock()
+	cs := p.pending[key]
+	delete(p.pending, key)
+	p.mux.Unlock()
+	for _, c := range cs {
+		c <- r
+	}
+}
+
+func (p *P2PClient) removePending(key wire.InvVect, c chan p2pResult) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	cs := p.pending[key]
+	for i := range cs {
+		if cs[i] == c {
+			cs = append(cs[:i], cs[i+1:]...)
+			break
+		}
+	}
+	if len(cs) == 0 {
+		delete(p.pending, key)
+	} else {
+		p.pending[key] = cs
+	}
+}
+
+// getData requests the objects with given hashes in one getdata message and waits for all of them
+// the data and errors are returned in the order of hashes
+func (p *P2PClient) getData(t wire.InvType, hashes []string) ([][]byte, []error) {
+	data := make([][]byte, len(hashes))
+	errs := make([]error, len(hashes))
+	keys := make([]wire.InvVect, len(hashes))
+	cs := make([]chan p2pResult, len(hashes))
+	p.mux.Lock()
+	conn := p.conn
+	if conn == nil {
+		p.mux.Unlock()
+		for i := range errs {
+			errs[i] = ErrP2PNotConnected
+		}
+		return data, errs
+	}
+	getData := wire.NewMsgGetData()
+	for i, hash := range hashes {
+		h, err := chainhash.NewHashFromStr(hash)
+		if err == nil {
+			err = getData.AddInvVect(wire.NewInvVect(invType(t, p.witness), h))
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		keys[i] = wire.InvVect{Type: t, Hash: *h}
+		cs[i] = make(chan p2pResult, 1)
+		p.pending[keys[i]] = append(p.pending[keys[i]], cs[i])
+	}
+	p.mux.Unlock()
+	if len(getData.InvList) == 0 {
+		return data, errs
+	}
+	if err := p.writeMessage(conn, getData); err != nil {
+		for i := range cs {
+			if cs[i] != nil {
+				p.removePending(keys[i], cs[i])
+				errs[i] = err
+			}
+		}
+		return data, errs
+	}
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	timedOut := false
+	for i := range cs {
+		if cs[i] == nil {
+			continue
+		}
+		if !timedOut {
+			select {
+			case r := <-cs[i]:
+				data[i], errs[i] = r.data, r.err
+				continue
+			case <-timer.C:
+				timedOut = true
+			}
+		}
+		select {
+		case r := <-cs[i]:
+			data[i], errs[i] = r.data, r.err
+		default:
+			p.removePending(keys[i], cs[i])
+			errs[i] = errors.Errorf("P2P getdata %v timeout", hashes[i])
+		}
+	}
+	return data, errs
+}
+
+// GetBlockBytes downloads the block with given hash from the peer
+func (p *P2PClient) GetBlockBytes(hash string) ([]byte, error) {
+	data, errs := p.getData(wire.InvTypeBlock, []string{hash})
+	return data[0], errs[0]
+}
+
+// GetTxBytes downloads the transaction with given txid from the peer, the peer provides only mempool transactions
+func (p *P2PClient) GetTxBytes(txid string) ([]byte, error) {
+	data, errs := p.getData(wire.InvTypeTx, []string{txid})
+	return data[0], errs[0]
+}
+
+// GetTxsBytes downloads the transactions with given txids from the peer in one getdata message
+// the data and errors are returned in the order of txids
+func (p *P2PClient) GetTxsBytes(txids []string) ([][]byte, []error) {
+	return p.getData(wire.InvTypeTx, txids)
+}
+
+// HasTx returns true if the transaction was announced by the peer, i.e. it can be downloaded from the peer's mempool
+func (p *P2PClient) HasTx(txid string) bool {
+	h, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return false
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	_, found := p.known[*h]
+	return found
+}
+
+func (p *P2PClient) writeMessage(conn net.Conn, msg wire.Message) error {
+	p.writeMux.Lock()
+	defer p.writeMux.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(p.timeout))
+	return wire.WriteMessage(conn, msg, p.pver, p.net)
+}
+
+// readP2PMessage reads the message from the peer and returns its command and raw payload
+func readP2PMessage(r io.Reader, net wire.BitcoinNet) (string, []byte, error) {
+	var header [p2pMessageHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", nil, err
+	}
+	if magic := wire.BitcoinNet(binary.LittleEndian.Uint32(header[:4])); magic != net {
+		return "", nil, errors.Errorf("Unexpected network magic %x", uint32(magic))
+	}
+	command := string(bytes.TrimRight(header[4:4+p2pCommandSize], "\x00"))
+	length := binary.LittleEndian.Uint32(header[4+p2pCommandSize:])
+	if length > wire.MaxMessagePayload {
+		return "", nil, errors.Errorf("Message %v payload too large %d", command, length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", nil, err
+	}
+	checksum := chainhash.DoubleHashB(payload)[:4]
+	if !bytes.Equal(checksum, header[4+p2pCommandSize+4:]) {
+		return "", nil, errors.Errorf("Message %v checksum mismatch", command)
+	}
+	return command, payload, nil
+}
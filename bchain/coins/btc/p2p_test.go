@@ -0,0 +1,242 @@
+//go:build unittest
+
+package btc
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/martinboehm/btcd/chaincfg/chainhash"
+	"github.com/martinboehm/btcd/wire"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// testP2PPeer is an in-process stand-in of the backend P2P interface
+type testP2PPeer struct {
+	t      *testing.T
+	ln     net.Listener
+	blocks map[chainhash.Hash]*wire.MsgBlock
+	txs    map[chainhash.Hash]*wire.MsgTx
+	conn   chan net.Conn
+	pong   chan uint64
+	// getData counts the received getdata messages
+	getData int32
+}
+
+func newTestP2PPeer(t *testing.T, blocks []*wire.MsgBlock, txs []*wire.MsgTx) *testP2PPeer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testP2PPeer{
+		t:      t,
+		ln:     ln,
+		blocks: make(map[chainhash.Hash]*wire.MsgBlock),
+		txs:    make(map[chainhash.Hash]*wire.MsgTx),
+		conn:   make(chan net.Conn, 1),
+		pong:   make(chan uint64, 1),
+	}
+	for _, b := range blocks {
+		p.blocks[b.BlockHash()] = b
+	}
+	for _, tx := range txs {
+		p.txs[tx.TxHash()] = tx
+	}
+	go p.serve()
+	return p
+}
+
+func (p *testP2PPeer) serve() {
+	conn, err := p.ln.Accept()
+	if err != nil {
+		return
+	}
+	p.conn <- conn
+	for {
+		msg, _, err := wire.ReadMessage(conn, wire.ProtocolVersion, wire.MainNet)
+		if err != nil {
+			return
+		}
+		switch m := msg.(type) {
+		case *wire.MsgVersion:
+			me := wire.NewNetAddressIPPort(net.IPv4zero, 0, 0)
+			v := wire.NewMsgVersion(me, me, 1, 100)
+			v.Services = wire.SFNodeNetwork | wire.SFNodeWitness
+			p.write(conn, v)
+			p.write(conn, wire.NewMsgVerAck())
+		case *wire.MsgGetData:
+			atomic.AddInt32(&p.getData, 1)
+			nf := wire.NewMsgNotFound()
+			for _, iv := range m.InvList {
+				if iv.Type != wire.InvTypeWitnessBlock && iv.Type != wire.InvTypeWitnessTx {
+					p.t.Errorf("unexpected inv type %v", iv.Type)
+				}
+				if b, found := p.blocks[iv.Hash]; found {
+					p.write(conn, b)
+				} else if tx, found := p.txs[iv.Hash]; found {
+					p.write(conn, tx)
+				} else {
+					nf.AddInvVect(iv)
+				}
+			}
+			if len(nf.InvList) > 0 {
+				p.write(conn, nf)
+			}
+		case *wire.MsgPong:
+			p.pong <- m.Nonce
+		}
+	}
+}
+
+func (p *testP2PPeer) getDataCount() int32 {
+	return atomic.LoadInt32(&p.getData)
+}
+
+func (p *testP2PPeer) write(conn net.Conn, msg wire.Message) {
+	if err := wire.WriteMessage(conn, msg, wire.ProtocolVersion, wire.MainNet); err != nil {
+		p.t.Error(err)
+	}
+}
+
+func TestP2PClient(t *testing.T) {
+	_, rawBlocks := createTestBlocks(t, 3)
+	var blocks []*wire.MsgBlock
+	var txs []*wire.MsgTx
+	for _, rb := range rawBlocks {
+		var b wire.MsgBlock
+		if err := b.Deserialize(bytes.NewReader(rb)); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, &b)
+		txs = append(txs, b.Transactions[0])
+	}
+	// the last block and tx are not known to the peer yet
+	peer := newTestP2PPeer(t, blocks[:2], txs[:2])
+	defer peer.ln.Close()
+
+	blockInvs := make(chan string, 1)
+	announcedTxs := make(chan []byte, 1)
+	c := NewP2PClient(peer.ln.Addr().String(), wire.MainNet, 5*time.Second, func(hash string) {
+		blockInvs <- hash
+	}, func(rawTx []byte) {
+		announcedTxs <- rawTx
+	})
+	if _, err := c.GetBlockBytes(blocks[0].BlockHash().String()); err != ErrP2PNotConnected {
+		t.Errorf("GetBlockBytes() before connect error = %v, want %v", err, ErrP2PNotConnected)
+	}
+	c.Start()
+	defer c.Stop()
+	var conn net.Conn
+	select {
+	case conn = <-peer.conn:
+	case <-time.After(5 * time.Second):
+		t.Fatal("P2P client did not connect")
+	}
+	for i := 0; !c.IsConnected(); i++ {
+		if i > 100 {
+			t.Fatal("P2P handshake not finished")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	for i := 0; i < 2; i++ {
+		data, err := c.GetBlockBytes(blocks[i].BlockHash().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, rawBlocks[i]) {
+			t.Errorf("GetBlockBytes(%d) = %x, want %x", i, data, rawBlocks[i])
+		}
+		var buf bytes.Buffer
+		if err := txs[i].Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		data, err = c.GetTxBytes(txs[i].TxHash().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, buf.Bytes()) {
+			t.Errorf("GetTxBytes(%d) = %x, want %x", i, data, buf.Bytes())
+		}
+	}
+	if _, err := c.GetBlockBytes(blocks[2].BlockHash().String()); err != bchain.ErrBlockNotFound {
+		t.Errorf("GetBlockBytes() error = %v, want %v", err, bchain.ErrBlockNotFound)
+	}
+	if _, err := c.GetTxBytes(txs[2].TxHash().String()); err != bchain.ErrTxNotFound {
+		t.Errorf("GetTxBytes() error = %v, want %v", err, bchain.ErrTxNotFound)
+	}
+
+	// all transactions are requested in one getdata message
+	txids := []string{txs[1].TxHash().String(), txs[2].TxHash().String(), "invalid", txs[0].TxHash().String()}
+	getDataCount := peer.getDataCount()
+	data, errs := c.GetTxsBytes(txids)
+	if n := peer.getDataCount() - getDataCount; n != 1 {
+		t.Errorf("GetTxsBytes() sent %d getdata messages, want 1", n)
+	}
+	for i, j := range []int{1, -1, -1, 0} {
+		if j < 0 {
+			if errs[i] == nil {
+				t.Errorf("GetTxsBytes()[%d] expected error", i)
+			}
+			continue
+		}
+		var buf bytes.Buffer
+		if err := txs[j].Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if errs[i] != nil || !bytes.Equal(data[i], buf.Bytes()) {
+			t.Errorf("GetTxsBytes()[%d] = %x, %v, want %x", i, data[i], errs[i], buf.Bytes())
+		}
+	}
+	if errs[1] != bchain.ErrTxNotFound {
+		t.Errorf("GetTxsBytes()[1] error = %v, want %v", errs[1], bchain.ErrTxNotFound)
+	}
+
+	// announce a new block and transaction
+	blockHash := blocks[1].BlockHash()
+	txHash := txs[1].TxHash()
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &blockHash))
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &txHash))
+	peer.write(conn, inv)
+	select {
+	case h := <-blockInvs:
+		if h != blockHash.String() {
+			t.Errorf("onBlockInv hash = %v, want %v", h, blockHash.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onBlockInv not called")
+	}
+	select {
+	case rawTx := <-announcedTxs:
+		var tx wire.MsgTx
+		if err := tx.Deserialize(bytes.NewReader(rawTx)); err != nil {
+			t.Fatal(err)
+		}
+		if tx.TxHash() != txHash {
+			t.Errorf("onTx txid = %v, want %v", tx.TxHash(), txHash)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onTx not called")
+	}
+	if !c.HasTx(txHash.String()) {
+		t.Errorf("HasTx(%v) = false, want true", txHash)
+	}
+	if c.HasTx(txs[0].TxHash().String()) {
+		t.Errorf("HasTx(%v) = true, want false", txs[0].TxHash())
+	}
+
+	// ping must be answered by pong
+	peer.write(conn, wire.NewMsgPing(12345))
+	select {
+	case nonce := <-peer.pong:
+		if nonce != 12345 {
+			t.Errorf("pong nonce = %v, want %v", nonce, 12345)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pong not received")
+	}
+}
@@ -67,6 +67,7 @@ func NewDecredRPC(config json.RawMessage, pushHandler func(bchain.NotificationTy
 
 	d.BitcoinRPC.RPCMarshaler = btc.JSONMarshalerV1{}
 	d.BitcoinRPC.ChainConfig.SupportsEstimateSmartFee = false
+	d.BitcoinRPC.ChainConfig.SupportsGetMempoolEntries = false
 
 	return d, nil
 }
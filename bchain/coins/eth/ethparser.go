@@ -2,6 +2,7 @@ package eth
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"math/big"
 	"strconv"
 
@@ -76,6 +77,11 @@ type rpcReceipt struct {
 	Logs    []*rpcLog `json:"logs"`
 }
 
+type rpcReceiptWithTxHash struct {
+	rpcReceipt
+	Hash string `json:"transactionHash"`
+}
+
 type completeTransaction struct {
 	Tx      *rpcTransaction `json:"tx"`
 	Receipt *rpcReceipt     `json:"receipt,omitempty"`
@@ -89,6 +95,39 @@ type rpcBlockTxids struct {
 	Transactions []string `json:"transactions"`
 }
 
+// rpcBlockHeaderFields are the fields of the block header as returned by the backend, the other fields of the block are not stored
+type rpcBlockHeaderFields struct {
+	Hash             json.RawMessage `json:"hash,omitempty"`
+	ParentHash       json.RawMessage `json:"parentHash,omitempty"`
+	Sha3Uncles       json.RawMessage `json:"sha3Uncles,omitempty"`
+	Miner            json.RawMessage `json:"miner,omitempty"`
+	StateRoot        json.RawMessage `json:"stateRoot,omitempty"`
+	TransactionsRoot json.RawMessage `json:"transactionsRoot,omitempty"`
+	ReceiptsRoot     json.RawMessage `json:"receiptsRoot,omitempty"`
+	LogsBloom        json.RawMessage `json:"logsBloom,omitempty"`
+	Difficulty       json.RawMessage `json:"difficulty,omitempty"`
+	Number           json.RawMessage `json:"number,omitempty"`
+	GasLimit         json.RawMessage `json:"gasLimit,omitempty"`
+	GasUsed          json.RawMessage `json:"gasUsed,omitempty"`
+	Time             json.RawMessage `json:"timestamp,omitempty"`
+	ExtraData        json.RawMessage `json:"extraData,omitempty"`
+	MixHash          json.RawMessage `json:"mixHash,omitempty"`
+	Nonce            json.RawMessage `json:"nonce,omitempty"`
+	BaseFee          json.RawMessage `json:"baseFeePerGas,omitempty"`
+}
+
+// ethBlockHeaderJSON returns the header fields of the block returned by the backend, compacted
+func ethBlockHeaderJSON(raw json.RawMessage) ([]byte, error) {
+	var h rpcBlockHeaderFields
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return nil, err
+	}
+	if len(h.Hash) == 0 || len(h.Number) == 0 {
+		return nil, errors.New("Missing block hash or number")
+	}
+	return json.Marshal(&h)
+}
+
 func ethNumber(n string) (int64, error) {
 	if len(n) > 2 {
 		return strconv.ParseInt(n[2:], 16, 64)
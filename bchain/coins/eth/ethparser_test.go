@@ -400,3 +400,21 @@ func TestEthereumParser_GetEthereumTxData(t *testing.T) {
 		})
 	}
 }
+
+func Test_ethBlockHeaderJSON(t *testing.T) {
+	raw := []byte(`{"number": "0x2a", "hash": "0x1234", "transactions": [{"hash": "0x5678"}], "parentHash": "0x9abc", "totalDifficulty": "0x10", "size": "0x220", "uncles": [], "baseFeePerGas": "0x7"}`)
+	got, err := ethBlockHeaderJSON(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"hash":"0x1234","parentHash":"0x9abc","number":"0x2a","baseFeePerGas":"0x7"}`
+	if string(got) != want {
+		t.Errorf("ethBlockHeaderJSON() = %v, want %v", string(got), want)
+	}
+	if _, err = ethBlockHeaderJSON([]byte(`[]`)); err == nil {
+		t.Error("ethBlockHeaderJSON() expected error")
+	}
+	if _, err = ethBlockHeaderJSON([]byte(`{"parentHash": "0x9abc"}`)); err == nil {
+		t.Error("ethBlockHeaderJSON() expected error for missing hash")
+	}
+}
@@ -35,20 +35,30 @@ const (
 
 // Configuration represents json config file
 type Configuration struct {
-	CoinName                    string `json:"coin_name"`
-	CoinShortcut                string `json:"coin_shortcut"`
-	RPCURL                      string `json:"rpc_url"`
-	RPCTimeout                  int    `json:"rpc_timeout"`
-	BlockAddressesToKeep        int    `json:"block_addresses_to_keep"`
-	MempoolTxTimeoutHours       int    `json:"mempoolTxTimeoutHours"`
-	QueryBackendOnMempoolResync bool   `json:"queryBackendOnMempoolResync"`
+	CoinName                    string   `json:"coin_name"`
+	CoinShortcut                string   `json:"coin_shortcut"`
+	RPCURL                      string   `json:"rpc_url"`
+	RPCURLs                     []string `json:"rpc_urls,omitempty"`
+	RPCTimeout                  int      `json:"rpc_timeout"`
+	BlockAddressesToKeep        int      `json:"block_addresses_to_keep"`
+	MempoolTxTimeoutHours       int      `json:"mempoolTxTimeoutHours"`
+	QueryBackendOnMempoolResync bool     `json:"queryBackendOnMempoolResync"`
+	BlockReceipts               bool     `json:"block_receipts,omitempty"`
+	ReceiptsBatchSize           int      `json:"receipts_batch_size,omitempty"`
 }
 
 // EthereumRPC is an interface to JSON-RPC eth service.
 type EthereumRPC struct {
 	*bchain.BaseChain
+	rpcLock              sync.RWMutex
 	client               *ethclient.Client
 	rpc                  *rpc.Client
+	rpcURL               string
+	rpcIndex             int
+	reconnectLock        sync.Mutex
+	backends             *bchain.BackendPool
+	checkClientsLock     sync.Mutex
+	checkClients         []*rpc.Client
 	timeout              time.Duration
 	Parser               *EthereumParser
 	Mempool              *bchain.MempoolEthereumType
@@ -76,7 +86,20 @@ func NewEthereumRPC(config json.RawMessage, pushHandler func(bchain.Notification
 		c.BlockAddressesToKeep = 100
 	}
 
-	rc, ec, err := openRPC(c.RPCURL)
+	// connect to the first available endpoint, the backend pool then selects the best one
+	urls := bchain.BackendURLs(c.RPCURL, c.RPCURLs)
+	if len(urls) == 0 {
+		return nil, errors.New("Missing rpc_url")
+	}
+	var rc *rpc.Client
+	var ec *ethclient.Client
+	index := 0
+	for ; index < len(urls); index++ {
+		if rc, ec, err = openRPC(urls[index]); err == nil {
+			break
+		}
+		glog.Error("rpc: connect to backend endpoint ", index, " error ", err)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +108,8 @@ func NewEthereumRPC(config json.RawMessage, pushHandler func(bchain.Notification
 		BaseChain:   &bchain.BaseChain{},
 		client:      ec,
 		rpc:         rc,
+		rpcURL:      urls[index],
+		rpcIndex:    index,
 		ChainConfig: &c,
 	}
 
@@ -92,6 +117,12 @@ func NewEthereumRPC(config json.RawMessage, pushHandler func(bchain.Notification
 	s.Parser = NewEthereumParser(c.BlockAddressesToKeep)
 	s.timeout = time.Duration(c.RPCTimeout) * time.Second
 
+	if len(urls) > 1 {
+		s.checkClients = make([]*rpc.Client, len(urls))
+		s.backends = bchain.NewBackendPool(urls, s.checkBackend, s.switchBackend)
+		s.backends.Start(bchain.BackendCheckPeriod)
+	}
+
 	// new blocks notifications handling
 	// the subscription is done in Initialize
 	s.chanNewBlock = make(chan *ethtypes.Header)
@@ -142,12 +173,77 @@ func openRPC(url string) (*rpc.Client, *ethclient.Client, error) {
 	return rc, ec, nil
 }
 
+// getRPC returns the clients of the active backend endpoint and the index of the endpoint in the backend pool
+func (b *EthereumRPC) getRPC() (*rpc.Client, *ethclient.Client, int) {
+	b.rpcLock.RLock()
+	defer b.rpcLock.RUnlock()
+	return b.rpc, b.client, b.rpcIndex
+}
+
+// isBackendError returns false for the errors returned by the backend in the response to the request, e.g. a rejected transaction,
+// other errors like a connection failure or a timeout are caused by the backend endpoint
+func isBackendError(err error) bool {
+	if err == ethereum.NotFound {
+		return false
+	}
+	if _, ok := err.(rpc.Error); ok {
+		return false
+	}
+	return true
+}
+
+// call calls f with the clients of the active backend endpoint
+// If the call fails because of the endpoint, the error is reported to the backend pool and the call is repeated
+// on the endpoint selected by the failover, until there is no other healthy endpoint or the context expires.
+func (b *EthereumRPC) call(ctx context.Context, f func(rc *rpc.Client, ec *ethclient.Client) error) error {
+	rc, ec, index := b.getRPC()
+	err := f(rc, ec)
+	for i := 1; err != nil && b.backends != nil && isBackendError(err); i++ {
+		// the call could fail because the connection was closed by a concurrent switch, then it is only repeated
+		if current, _, _ := b.getRPC(); current == rc {
+			if next, _ := b.backends.ReportError(index, err); next == index {
+				break
+			}
+		}
+		if i >= len(b.checkClients) || ctx.Err() != nil {
+			break
+		}
+		rc, ec, index = b.getRPC()
+		err = f(rc, ec)
+	}
+	return err
+}
+
+// callContext calls the JSON-RPC method on the active backend endpoint with failover
+func (b *EthereumRPC) callContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return b.call(ctx, func(rc *rpc.Client, _ *ethclient.Client) error {
+		return rc.CallContext(ctx, result, method, args...)
+	})
+}
+
+// batchCallContext sends the batch of JSON-RPC calls to the active backend endpoint with failover
+func (b *EthereumRPC) batchCallContext(ctx context.Context, batch []rpc.BatchElem) error {
+	return b.call(ctx, func(rc *rpc.Client, _ *ethclient.Client) error {
+		return rc.BatchCallContext(ctx, batch)
+	})
+}
+
+func (b *EthereumRPC) networkID(ctx context.Context) (*big.Int, error) {
+	var id *big.Int
+	err := b.call(ctx, func(_ *rpc.Client, ec *ethclient.Client) (err error) {
+		id, err = ec.NetworkID(ctx)
+		return err
+	})
+	return id, err
+}
+
 // Initialize initializes ethereum rpc interface
 func (b *EthereumRPC) Initialize() error {
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
 
-	id, err := b.client.NetworkID(ctx)
+	// the alternative endpoints are tried if the active one fails
+	id, err := b.networkID(ctx)
 	if err != nil {
 		return err
 	}
@@ -183,7 +279,7 @@ func (b *EthereumRPC) CreateMempool(chain bchain.BlockChain) (bchain.Mempool, er
 }
 
 // InitializeMempool creates subscriptions to newHeads and newPendingTransactions
-func (b *EthereumRPC) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOutpointFunc, onNewTxAddr bchain.OnNewTxAddrFunc, onNewTx bchain.OnNewTxFunc) error {
+func (b *EthereumRPC) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOutpointFunc, onNewTxAddr bchain.OnNewTxAddrFunc, onNewTx bchain.OnNewTxFunc, onTxRemoved bchain.OnTxRemovedFunc) error {
 	if b.Mempool == nil {
 		return errors.New("Mempool not created")
 	}
@@ -199,6 +295,7 @@ func (b *EthereumRPC) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOu
 
 	b.Mempool.OnNewTxAddr = onNewTxAddr
 	b.Mempool.OnNewTx = onNewTx
+	b.Mempool.OnTxRemoved = onTxRemoved
 
 	if err = b.subscribeEvents(); err != nil {
 		return err
@@ -216,7 +313,8 @@ func (b *EthereumRPC) subscribeEvents() error {
 		b.newBlockSubscription = nil
 		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 		defer cancel()
-		sub, err := b.rpc.EthSubscribe(ctx, b.chanNewBlock, "newHeads")
+		rc, _, _ := b.getRPC()
+		sub, err := rc.EthSubscribe(ctx, b.chanNewBlock, "newHeads")
 		if err != nil {
 			return nil, errors.Annotatef(err, "EthSubscribe newHeads")
 		}
@@ -232,7 +330,8 @@ func (b *EthereumRPC) subscribeEvents() error {
 		b.newTxSubscription = nil
 		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 		defer cancel()
-		sub, err := b.rpc.EthSubscribe(ctx, b.chanNewTx, "newPendingTransactions")
+		rc, _, _ := b.getRPC()
+		sub, err := rc.EthSubscribe(ctx, b.chanNewTx, "newPendingTransactions")
 		if err != nil {
 			return nil, errors.Annotatef(err, "EthSubscribe newPendingTransactions")
 		}
@@ -293,25 +392,79 @@ func (b *EthereumRPC) closeRPC() {
 	if b.newTxSubscription != nil {
 		b.newTxSubscription.Unsubscribe()
 	}
-	if b.rpc != nil {
-		b.rpc.Close()
+	if rc, _, _ := b.getRPC(); rc != nil {
+		rc.Close()
 	}
 }
 
-func (b *EthereumRPC) reconnectRPC() error {
-	glog.Info("Reconnecting RPC")
-	b.closeRPC()
-	rc, ec, err := openRPC(b.ChainConfig.RPCURL)
+// connectRPC replaces the connection by a new one to the backend endpoint with given url and index in the backend pool
+func (b *EthereumRPC) connectRPC(url string, index int) error {
+	b.reconnectLock.Lock()
+	defer b.reconnectLock.Unlock()
+	rc, ec, err := openRPC(url)
 	if err != nil {
 		return err
 	}
-	b.rpc = rc
-	b.client = ec
+	b.closeRPC()
+	b.rpcLock.Lock()
+	b.rpc, b.client, b.rpcURL, b.rpcIndex = rc, ec, url, index
+	b.rpcLock.Unlock()
+	// the subscriptions are created when the mempool is initialized
+	if !b.mempoolInitialized {
+		return nil
+	}
 	return b.subscribeEvents()
 }
 
+func (b *EthereumRPC) reconnectRPC() error {
+	glog.Info("Reconnecting RPC")
+	b.rpcLock.RLock()
+	url, index := b.rpcURL, b.rpcIndex
+	b.rpcLock.RUnlock()
+	return b.connectRPC(url, index)
+}
+
+// checkBackend returns the best height of the backend endpoint with given index
+func (b *EthereumRPC) checkBackend(index int) (uint32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	b.checkClientsLock.Lock()
+	rc := b.checkClients[index]
+	b.checkClientsLock.Unlock()
+	if rc == nil {
+		var err error
+		if rc, err = rpc.DialContext(ctx, b.backends.URL(index)); err != nil {
+			return 0, err
+		}
+		b.checkClientsLock.Lock()
+		b.checkClients[index] = rc
+		b.checkClientsLock.Unlock()
+	}
+	var height hexutil.Uint64
+	if err := rc.CallContext(ctx, &height, "eth_blockNumber"); err != nil {
+		// reconnect in the next check
+		rc.Close()
+		b.checkClientsLock.Lock()
+		b.checkClients[index] = nil
+		b.checkClientsLock.Unlock()
+		return 0, err
+	}
+	return uint32(height), nil
+}
+
+// switchBackend connects to the backend endpoint selected by the backend pool
+func (b *EthereumRPC) switchBackend(index int) {
+	glog.Info("Switching RPC to backend endpoint ", index)
+	if err := b.connectRPC(b.backends.URL(index), index); err != nil {
+		glog.Error("rpc: switch backend error ", err)
+	}
+}
+
 // Shutdown cleans up rpc interface to ethereum
 func (b *EthereumRPC) Shutdown(ctx context.Context) error {
+	if b.backends != nil {
+		b.backends.Stop()
+	}
 	b.closeRPC()
 	close(b.chanNewBlock)
 	glog.Info("rpc: shutdown")
@@ -336,12 +489,12 @@ func (b *EthereumRPC) GetChainInfo() (*bchain.ChainInfo, error) {
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
-	id, err := b.client.NetworkID(ctx)
+	id, err := b.networkID(ctx)
 	if err != nil {
 		return nil, err
 	}
 	var ver string
-	if err := b.rpc.CallContext(ctx, &ver, "web3_clientVersion"); err != nil {
+	if err := b.callContext(ctx, &ver, "web3_clientVersion"); err != nil {
 		return nil, err
 	}
 	rv := &bchain.ChainInfo{
@@ -356,9 +509,21 @@ func (b *EthereumRPC) GetChainInfo() (*bchain.ChainInfo, error) {
 	} else {
 		rv.Chain = "testnet " + strconv.Itoa(idi)
 	}
+	if b.backends != nil {
+		rv.Endpoints = b.backends.Endpoints()
+	}
 	return rv, nil
 }
 
+func (b *EthereumRPC) headerByNumber(ctx context.Context, n *big.Int) (*ethtypes.Header, error) {
+	var h *ethtypes.Header
+	err := b.call(ctx, func(_ *rpc.Client, ec *ethclient.Client) (err error) {
+		h, err = ec.HeaderByNumber(ctx, n)
+		return err
+	})
+	return h, err
+}
+
 func (b *EthereumRPC) getBestHeader() (*ethtypes.Header, error) {
 	b.bestHeaderLock.Lock()
 	defer b.bestHeaderLock.Unlock()
@@ -375,7 +540,7 @@ func (b *EthereumRPC) getBestHeader() (*ethtypes.Header, error) {
 		var err error
 		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 		defer cancel()
-		b.bestHeader, err = b.client.HeaderByNumber(ctx, nil)
+		b.bestHeader, err = b.headerByNumber(ctx, nil)
 		if err != nil {
 			b.bestHeader = nil
 			return nil, err
@@ -409,7 +574,7 @@ func (b *EthereumRPC) GetBlockHash(height uint32) (string, error) {
 	n.SetUint64(uint64(height))
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
-	h, err := b.client.HeaderByNumber(ctx, &n)
+	h, err := b.headerByNumber(ctx, &n)
 	if err != nil {
 		if err == ethereum.NotFound {
 			return "", bchain.ErrBlockNotFound
@@ -459,6 +624,19 @@ func (b *EthereumRPC) GetBlockHeader(hash string) (*bchain.BlockHeader, error) {
 	return b.ethHeaderToBlockHeader(&h)
 }
 
+// GetBlockHeaderRaw returns the header fields of block with given hash as json
+func (b *EthereumRPC) GetBlockHeaderRaw(hash string) ([]byte, error) {
+	raw, err := b.getBlockRaw(hash, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	header, err := ethBlockHeaderJSON(raw)
+	if err != nil {
+		return nil, errors.Annotatef(err, "hash %v", hash)
+	}
+	return header, nil
+}
+
 func (b *EthereumRPC) computeConfirmations(n uint64) (uint32, error) {
 	bh, err := b.getBestHeader()
 	if err != nil {
@@ -476,12 +654,12 @@ func (b *EthereumRPC) getBlockRaw(hash string, height uint32, fullTxs bool) (jso
 	var err error
 	if hash != "" {
 		if hash == "pending" {
-			err = b.rpc.CallContext(ctx, &raw, "eth_getBlockByNumber", hash, fullTxs)
+			err = b.callContext(ctx, &raw, "eth_getBlockByNumber", hash, fullTxs)
 		} else {
-			err = b.rpc.CallContext(ctx, &raw, "eth_getBlockByHash", ethcommon.HexToHash(hash), fullTxs)
+			err = b.callContext(ctx, &raw, "eth_getBlockByHash", ethcommon.HexToHash(hash), fullTxs)
 		}
 	} else {
-		err = b.rpc.CallContext(ctx, &raw, "eth_getBlockByNumber", fmt.Sprintf("%#x", height), fullTxs)
+		err = b.callContext(ctx, &raw, "eth_getBlockByNumber", fmt.Sprintf("%#x", height), fullTxs)
 	}
 	if err != nil {
 		return nil, errors.Annotatef(err, "hash %v, height %v", hash, height)
@@ -495,7 +673,7 @@ func (b *EthereumRPC) getERC20EventsForBlock(blockNumber string) (map[string][]*
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
 	var logs []rpcLogWithTxHash
-	err := b.rpc.CallContext(ctx, &logs, "eth_getLogs", map[string]interface{}{
+	err := b.callContext(ctx, &logs, "eth_getLogs", map[string]interface{}{
 		"fromBlock": blockNumber,
 		"toBlock":   blockNumber,
 		"topics":    []string{erc20TransferEventSignature},
@@ -511,8 +689,78 @@ func (b *EthereumRPC) getERC20EventsForBlock(blockNumber string) (map[string][]*
 	return r, nil
 }
 
+// getBlockReceipts returns the receipts of all transactions of the block using one eth_getBlockReceipts call
+// blockID is the block hash or the block number in hex
+func (b *EthereumRPC) getBlockReceipts(blockID string) (map[string]*rpcReceipt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	var receipts []rpcReceiptWithTxHash
+	err := b.callContext(ctx, &receipts, "eth_getBlockReceipts", blockID)
+	if err != nil {
+		return nil, errors.Annotatef(err, "block %v", blockID)
+	}
+	r := make(map[string]*rpcReceipt, len(receipts))
+	for i := range receipts {
+		r[receipts[i].Hash] = &receipts[i].rpcReceipt
+	}
+	return r, nil
+}
+
+// getTransactionReceipts returns the receipts of the transactions using batches of eth_getTransactionReceipt calls
+// at most ReceiptsBatchSize receipts are requested in one batch to keep the size of the responses bounded
+func (b *EthereumRPC) getTransactionReceipts(txs []rpcTransaction) (map[string]*rpcReceipt, error) {
+	batchSize := b.ChainConfig.ReceiptsBatchSize
+	r := make(map[string]*rpcReceipt, len(txs))
+	for lower := 0; lower < len(txs); lower += batchSize {
+		higher := lower + batchSize
+		if higher > len(txs) {
+			higher = len(txs)
+		}
+		batch := make([]rpc.BatchElem, higher-lower)
+		for i := range batch {
+			batch[i] = rpc.BatchElem{
+				Method: "eth_getTransactionReceipt",
+				Args:   []interface{}{txs[lower+i].Hash},
+				Result: new(*rpcReceipt),
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+		err := b.batchCallContext(ctx, batch)
+		cancel()
+		if err != nil {
+			return nil, errors.Annotatef(err, "txs %v-%v", lower, higher)
+		}
+		for i := range batch {
+			txid := txs[lower+i].Hash
+			if batch[i].Error != nil {
+				return nil, errors.Annotatef(batch[i].Error, "txid %v", txid)
+			}
+			receipt := *batch[i].Result.(**rpcReceipt)
+			if receipt == nil {
+				return nil, errors.Errorf("Receipt of txid %v not found", txid)
+			}
+			r[txid] = receipt
+		}
+	}
+	return r, nil
+}
+
 // GetBlock returns block with given hash or height, hash has precedence if both passed
 func (b *EthereumRPC) GetBlock(hash string, height uint32) (*bchain.Block, error) {
+	// eth_getBlockReceipts does not need the transactions of the block, the receipts of a block requested by hash
+	// are fetched in parallel with the block; a block requested by height may be replaced by a reorg between the calls,
+	// its receipts are fetched by the hash of the fetched block
+	var receiptsDone chan struct{}
+	var receipts map[string]*rpcReceipt
+	var receiptsErr error
+	getBlockReceipts := func(blockHash string) {
+		defer close(receiptsDone)
+		receipts, receiptsErr = b.getBlockReceipts(blockHash)
+	}
+	if b.ChainConfig.BlockReceipts && hash != "" {
+		receiptsDone = make(chan struct{})
+		go getBlockReceipts(hash)
+	}
 	raw, err := b.getBlockRaw(hash, height, true)
 	if err != nil {
 		return nil, err
@@ -529,15 +777,39 @@ func (b *EthereumRPC) GetBlock(hash string, height uint32) (*bchain.Block, error
 	if err != nil {
 		return nil, errors.Annotatef(err, "hash %v, height %v", hash, height)
 	}
-	// get ERC20 events
-	logs, err := b.getERC20EventsForBlock(head.Number)
-	if err != nil {
+	// get the receipts of the transactions, or only ERC20 events if the receipts are not configured
+	var logs map[string][]*rpcLog
+	if b.ChainConfig.BlockReceipts && receiptsDone == nil {
+		receiptsDone = make(chan struct{})
+		getBlockReceipts(head.Hash)
+	}
+	if receiptsDone != nil {
+		<-receiptsDone
+		if receiptsErr != nil {
+			return nil, receiptsErr
+		}
+		if len(receipts) != len(body.Transactions) {
+			return nil, errors.Errorf("hash %v, height %v: %v receipts for %v transactions", hash, height, len(receipts), len(body.Transactions))
+		}
+	} else if b.ChainConfig.ReceiptsBatchSize > 0 {
+		if receipts, err = b.getTransactionReceipts(body.Transactions); err != nil {
+			return nil, errors.Annotatef(err, "hash %v, height %v", hash, height)
+		}
+	} else if logs, err = b.getERC20EventsForBlock(head.Number); err != nil {
 		return nil, err
 	}
 	btxs := make([]bchain.Tx, len(body.Transactions))
 	for i := range body.Transactions {
 		tx := &body.Transactions[i]
-		btx, err := b.Parser.ethTxToTx(tx, &rpcReceipt{Logs: logs[tx.Hash]}, bbh.Time, uint32(bbh.Confirmations), true)
+		receipt := receipts[tx.Hash]
+		if receipt == nil {
+			// the transaction without its receipt would be indexed without status, gas used and logs
+			if b.ChainConfig.BlockReceipts || b.ChainConfig.ReceiptsBatchSize > 0 {
+				return nil, errors.Errorf("hash %v, height %v: receipt of txid %v not found", hash, height, tx.Hash)
+			}
+			receipt = &rpcReceipt{Logs: logs[tx.Hash]}
+		}
+		btx, err := b.Parser.ethTxToTx(tx, receipt, bbh.Time, uint32(bbh.Confirmations), true)
 		if err != nil {
 			return nil, errors.Annotatef(err, "hash %v, height %v, txid %v", hash, height, tx.Hash)
 		}
@@ -546,9 +818,14 @@ func (b *EthereumRPC) GetBlock(hash string, height uint32) (*bchain.Block, error
 			b.Mempool.RemoveTransactionFromMempool(tx.Hash)
 		}
 	}
+	rawHeader, err := ethBlockHeaderJSON(raw)
+	if err != nil {
+		return nil, errors.Annotatef(err, "hash %v, height %v", hash, height)
+	}
 	bbk := bchain.Block{
 		BlockHeader: *bbh,
 		Txs:         btxs,
+		RawHeader:   rawHeader,
 	}
 	return &bbk, nil
 }
@@ -591,7 +868,7 @@ func (b *EthereumRPC) GetTransaction(txid string) (*bchain.Tx, error) {
 	defer cancel()
 	var tx *rpcTransaction
 	hash := ethcommon.HexToHash(txid)
-	err := b.rpc.CallContext(ctx, &tx, "eth_getTransactionByHash", hash)
+	err := b.callContext(ctx, &tx, "eth_getTransactionByHash", hash)
 	if err != nil {
 		return nil, err
 	} else if tx == nil {
@@ -624,7 +901,7 @@ func (b *EthereumRPC) GetTransaction(txid string) (*bchain.Tx, error) {
 			return nil, errors.Annotatef(err, "txid %v", txid)
 		}
 		var receipt rpcReceipt
-		err = b.rpc.CallContext(ctx, &receipt, "eth_getTransactionReceipt", hash)
+		err = b.callContext(ctx, &receipt, "eth_getTransactionReceipt", hash)
 		if err != nil {
 			return nil, errors.Annotatef(err, "txid %v", txid)
 		}
@@ -690,7 +967,11 @@ func (b *EthereumRPC) EstimateSmartFee(blocks int, conservative bool) (big.Int,
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
 	var r big.Int
-	gp, err := b.client.SuggestGasPrice(ctx)
+	var gp *big.Int
+	err := b.call(ctx, func(_ *rpc.Client, ec *ethclient.Client) (err error) {
+		gp, err = ec.SuggestGasPrice(ctx)
+		return err
+	})
 	if err == nil && b != nil {
 		r = *gp
 	}
@@ -736,7 +1017,12 @@ func (b *EthereumRPC) EthereumTypeEstimateGas(params map[string]interface{}) (ui
 	if ok && len(s) > 0 {
 		msg.GasPrice, _ = hexutil.DecodeBig(s)
 	}
-	return b.client.EstimateGas(ctx, msg)
+	var gas uint64
+	err := b.call(ctx, func(_ *rpc.Client, ec *ethclient.Client) (err error) {
+		gas, err = ec.EstimateGas(ctx, msg)
+		return err
+	})
+	return gas, err
 }
 
 // SendRawTransaction sends raw transaction
@@ -744,7 +1030,7 @@ func (b *EthereumRPC) SendRawTransaction(hex string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
 	var raw json.RawMessage
-	err := b.rpc.CallContext(ctx, &raw, "eth_sendRawTransaction", hex)
+	err := b.callContext(ctx, &raw, "eth_sendRawTransaction", hex)
 	if err != nil {
 		return "", err
 	} else if len(raw) == 0 {
@@ -764,14 +1050,24 @@ func (b *EthereumRPC) SendRawTransaction(hex string) (string, error) {
 func (b *EthereumRPC) EthereumTypeGetBalance(addrDesc bchain.AddressDescriptor) (*big.Int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
-	return b.client.BalanceAt(ctx, ethcommon.BytesToAddress(addrDesc), nil)
+	var balance *big.Int
+	err := b.call(ctx, func(_ *rpc.Client, ec *ethclient.Client) (err error) {
+		balance, err = ec.BalanceAt(ctx, ethcommon.BytesToAddress(addrDesc), nil)
+		return err
+	})
+	return balance, err
 }
 
 // EthereumTypeGetNonce returns current balance of an address
 func (b *EthereumRPC) EthereumTypeGetNonce(addrDesc bchain.AddressDescriptor) (uint64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
-	return b.client.NonceAt(ctx, ethcommon.BytesToAddress(addrDesc), nil)
+	var nonce uint64
+	err := b.call(ctx, func(_ *rpc.Client, ec *ethclient.Client) (err error) {
+		nonce, err = ec.NonceAt(ctx, ethcommon.BytesToAddress(addrDesc), nil)
+		return err
+	})
+	return nonce, err
 }
 
 // GetChainParser returns ethereum BlockChainParser
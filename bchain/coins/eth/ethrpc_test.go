@@ -0,0 +1,384 @@
+//go:build unittest
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/trezor/blockbook/bchain"
+)
+
+type testRPCRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type testRPCResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+}
+
+func testReceipt(txid string) map[string]interface{} {
+	return map[string]interface{}{
+		"transactionHash": txid,
+		"gasUsed":         "0x5208",
+		"status":          "0x1",
+		"logs": []map[string]interface{}{{
+			"address": "0x4af4114f73d1c1c903ac9e0361b379d1291808a2",
+			"topics":  []string{erc20TransferEventSignature},
+			"data":    "0x01",
+		}},
+	}
+}
+
+const testReceiptsBlockHash = "0x0000000000000000000000000000000000000000000000000000000000000010"
+
+func testReceiptsBlock(number string, txids []string) map[string]interface{} {
+	txs := make([]map[string]interface{}, len(txids))
+	for i, txid := range txids {
+		txs[i] = map[string]interface{}{
+			"hash":             txid,
+			"nonce":            "0x1",
+			"gasPrice":         "0x1",
+			"gas":              "0x5208",
+			"to":               "0x4af4114f73d1c1c903ac9e0361b379d1291808a2",
+			"value":            "0x1",
+			"input":            "0x",
+			"blockNumber":      number,
+			"blockHash":        testReceiptsBlockHash,
+			"from":             "0x9f4981531fda132e83c44680787dfa7ee31e4f8d",
+			"transactionIndex": "0x0",
+		}
+	}
+	return map[string]interface{}{
+		"hash":         testReceiptsBlockHash,
+		"number":       number,
+		"parentHash":   "0x000000000000000000000000000000000000000000000000000000000000000f",
+		"timestamp":    "0x5e4ad4c6",
+		"size":         "0x21c",
+		"transactions": txs,
+		"uncles":       []string{},
+	}
+}
+
+func newTestReceiptsServer(t *testing.T, requests *int32) *httptest.Server {
+	respond := func(req *testRPCRequest) testRPCResponse {
+		r := testRPCResponse{Version: "2.0", ID: req.ID}
+		var param string
+		if len(req.Params) > 0 {
+			json.Unmarshal(req.Params[0], &param)
+		}
+		switch req.Method {
+		case "eth_getTransactionReceipt":
+			if param != "0xunknown" {
+				r.Result = testReceipt(param)
+			}
+		case "eth_getBlockReceipts":
+			// the receipts must be requested by the block hash
+			if param != testReceiptsBlockHash {
+				t.Errorf("unexpected eth_getBlockReceipts block %v", param)
+			}
+			r.Result = []map[string]interface{}{testReceipt("0x01"), testReceipt("0x02")}
+		case "eth_getBlockByNumber":
+			// block 0x10 contains the transactions of the receipts, block 0x11 a transaction without receipt
+			txids := []string{"0x01", "0x02"}
+			if param == "0x11" {
+				txids[1] = "0x03"
+			}
+			r.Result = testReceiptsBlock(param, txids)
+		default:
+			t.Errorf("unexpected method %v", req.Method)
+		}
+		return r
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		var raw json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if len(raw) > 0 && raw[0] == '[' {
+			var batch []testRPCRequest
+			if err := json.Unmarshal(raw, &batch); err != nil {
+				t.Error(err)
+				return
+			}
+			res := make([]testRPCResponse, len(batch))
+			for i := range batch {
+				res[i] = respond(&batch[i])
+			}
+			json.NewEncoder(w).Encode(res)
+			return
+		}
+		var req testRPCRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			t.Error(err)
+			return
+		}
+		json.NewEncoder(w).Encode(respond(&req))
+	}))
+}
+
+func newTestReceiptsRPC(t *testing.T, url string, c *Configuration) *EthereumRPC {
+	rc, err := rpc.Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &EthereumRPC{
+		rpc:         rc,
+		timeout:     5 * time.Second,
+		ChainConfig: c,
+		Parser:      NewEthereumParser(1),
+		bestHeader:  &ethtypes.Header{Number: big.NewInt(0x11)},
+	}
+}
+
+func TestEthereumRPC_getTransactionReceipts(t *testing.T) {
+	var requests int32
+	server := newTestReceiptsServer(t, &requests)
+	defer server.Close()
+	b := newTestReceiptsRPC(t, server.URL, &Configuration{ReceiptsBatchSize: 2})
+
+	txs := []rpcTransaction{{Hash: "0x01"}, {Hash: "0x02"}, {Hash: "0x03"}}
+	receipts, err := b.getTransactionReceipts(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := atomic.LoadInt32(&requests); r != 2 {
+		t.Errorf("requests = %d, want 2", r)
+	}
+	if len(receipts) != 3 {
+		t.Fatalf("got %d receipts, want 3", len(receipts))
+	}
+	for _, tx := range txs {
+		r := receipts[tx.Hash]
+		if r == nil || r.Status != "0x1" || r.GasUsed != "0x5208" || len(r.Logs) != 1 {
+			t.Errorf("receipt of %v = %+v", tx.Hash, r)
+		}
+	}
+
+	if _, err := b.getTransactionReceipts([]rpcTransaction{{Hash: "0x01"}, {Hash: "0xunknown"}}); err == nil {
+		t.Error("getTransactionReceipts() of unknown tx, expected error")
+	}
+}
+
+func TestEthereumRPC_getBlockReceipts(t *testing.T) {
+	var requests int32
+	server := newTestReceiptsServer(t, &requests)
+	defer server.Close()
+	b := newTestReceiptsRPC(t, server.URL, &Configuration{BlockReceipts: true})
+
+	receipts, err := b.getBlockReceipts(testReceiptsBlockHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 2 || receipts["0x01"] == nil || receipts["0x02"] == nil {
+		t.Fatalf("getBlockReceipts() = %+v", receipts)
+	}
+	if receipts["0x02"].Status != "0x1" || len(receipts["0x02"].Logs) != 1 {
+		t.Errorf("receipt of 0x02 = %+v", receipts["0x02"])
+	}
+}
+
+func TestEthereumRPC_GetBlockReceipts(t *testing.T) {
+	var requests int32
+	server := newTestReceiptsServer(t, &requests)
+	defer server.Close()
+	for _, c := range []*Configuration{{BlockReceipts: true}, {ReceiptsBatchSize: 10}} {
+		b := newTestReceiptsRPC(t, server.URL, c)
+		block, err := b.GetBlock("", 0x10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(block.Txs) != 2 || block.Hash != testReceiptsBlockHash {
+			t.Fatalf("GetBlock() = %+v", block)
+		}
+		for i := range block.Txs {
+			csd, ok := block.Txs[i].CoinSpecificData.(completeTransaction)
+			if !ok || csd.Receipt == nil || csd.Receipt.Status != "0x1" || len(csd.Receipt.Logs) != 1 {
+				t.Errorf("%+v: receipt of %v = %+v", c, block.Txs[i].Txid, block.Txs[i].CoinSpecificData)
+			}
+		}
+	}
+	// the transaction without receipt is not indexed without its status and logs
+	b := newTestReceiptsRPC(t, server.URL, &Configuration{BlockReceipts: true})
+	if _, err := b.GetBlock("", 0x11); err == nil {
+		t.Error("GetBlock() of block with missing receipt, expected error")
+	}
+}
+
+// testBackend is a backend endpoint returning its balance for all addresses, it can be switched down
+type testBackend struct {
+	*httptest.Server
+	down int32
+}
+
+func newTestBackend(t *testing.T, balance string) *testBackend {
+	b := &testBackend{}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&b.down) != 0 {
+			http.Error(w, "backend down", http.StatusBadGateway)
+			return
+		}
+		var req testRPCRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		res := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "net_version":
+			res["result"] = "1"
+		case "eth_blockNumber":
+			res["result"] = "0x10"
+		case "eth_getBalance":
+			res["result"] = balance
+		case "eth_sendRawTransaction":
+			res["error"] = map[string]interface{}{"code": -32000, "message": "nonce too low"}
+		case "eth_getBlockByHash":
+			if string(req.Params[0]) == `"0x0000000000000000000000000000000000000000000000000000000000000010"` {
+				res["result"] = json.RawMessage(testBlockJSON)
+			} else {
+				res["result"] = nil
+			}
+		default:
+			t.Errorf("unexpected method %v", req.Method)
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+	return b
+}
+
+const testBlockJSON = `{"hash":"0x0000000000000000000000000000000000000000000000000000000000000010","number":"0x10","parentHash":"0x000000000000000000000000000000000000000000000000000000000000000f","timestamp":"0x5e4ad4c6","size":"0x21c","totalDifficulty":"0x20000","transactions":[],"uncles":[]}`
+
+func newTestFailoverRPC(t *testing.T, backends ...*testBackend) *EthereumRPC {
+	var urls []string
+	for _, b := range backends[1:] {
+		urls = append(urls, b.URL)
+	}
+	config, _ := json.Marshal(map[string]interface{}{"rpc_url": backends[0].URL, "rpc_urls": urls, "rpc_timeout": 5})
+	chain, err := NewEthereumRPC(config, func(bchain.NotificationType) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain.(*EthereumRPC)
+}
+
+func checkTestBalance(t *testing.T, b *EthereumRPC, want int64) {
+	t.Helper()
+	balance, err := b.EthereumTypeGetBalance(bchain.AddressDescriptor{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Int64() != want {
+		t.Errorf("EthereumTypeGetBalance() = %v, want %v", balance, want)
+	}
+}
+
+func TestEthereumRPC_failover(t *testing.T) {
+	primary := newTestBackend(t, "0x1")
+	defer primary.Close()
+	secondary := newTestBackend(t, "0x2")
+	defer secondary.Close()
+	b := newTestFailoverRPC(t, primary, secondary)
+	defer b.Shutdown(context.Background())
+
+	if err := b.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	checkTestBalance(t, b, 1)
+
+	// the error response of the backend does not cause failover
+	if _, err := b.SendRawTransaction("0x01"); err == nil {
+		t.Error("SendRawTransaction() expected error")
+	}
+	if index, _ := b.backends.Active(); index != 0 {
+		t.Errorf("active backend %d after error response, want 0", index)
+	}
+
+	// the call fails over to the secondary endpoint
+	atomic.StoreInt32(&primary.down, 1)
+	checkTestBalance(t, b, 2)
+	if index, _ := b.backends.Active(); index != 1 {
+		t.Errorf("active backend %d after failover, want 1", index)
+	}
+}
+
+func TestEthereumRPC_failoverAtStartup(t *testing.T) {
+	primary := newTestBackend(t, "0x1")
+	defer primary.Close()
+	atomic.StoreInt32(&primary.down, 1)
+	secondary := newTestBackend(t, "0x2")
+	defer secondary.Close()
+	b := newTestFailoverRPC(t, primary, secondary)
+	defer b.Shutdown(context.Background())
+
+	if err := b.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	checkTestBalance(t, b, 2)
+}
+
+func TestEthereumRPC_switchBackendConcurrent(t *testing.T) {
+	primary := newTestBackend(t, "0x1")
+	defer primary.Close()
+	secondary := newTestBackend(t, "0x2")
+	defer secondary.Close()
+	b := newTestFailoverRPC(t, primary, secondary)
+	defer b.Shutdown(context.Background())
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					b.EthereumTypeGetBalance(bchain.AddressDescriptor{1})
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		b.switchBackend(i % 2)
+	}
+	close(done)
+	wg.Wait()
+	checkTestBalance(t, b, 2)
+}
+
+func TestEthereumRPC_GetBlockHeaderRaw(t *testing.T) {
+	backend := newTestBackend(t, "0x1")
+	defer backend.Close()
+	b := newTestFailoverRPC(t, backend)
+	got, err := b.GetBlockHeaderRaw("0x0000000000000000000000000000000000000000000000000000000000000010")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"hash":"0x0000000000000000000000000000000000000000000000000000000000000010","parentHash":"0x000000000000000000000000000000000000000000000000000000000000000f","number":"0x10","timestamp":"0x5e4ad4c6"}`
+	if string(got) != want {
+		t.Errorf("GetBlockHeaderRaw() = %v, want %v", string(got), want)
+	}
+	if _, err = b.GetBlockHeaderRaw("0x0000000000000000000000000000000000000000000000000000000000000011"); err != bchain.ErrBlockNotFound {
+		t.Errorf("GetBlockHeaderRaw() error = %v, want %v", err, bchain.ErrBlockNotFound)
+	}
+}
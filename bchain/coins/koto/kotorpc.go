@@ -25,6 +25,7 @@ func NewKotoRPC(config json.RawMessage, pushHandler func(bchain.NotificationType
 	}
 	z.RPCMarshaler = btc.JSONMarshalerV1{}
 	z.ChainConfig.SupportsEstimateSmartFee = false
+	z.ChainConfig.SupportsGetMempoolEntries = false
 	return z, nil
 }
 
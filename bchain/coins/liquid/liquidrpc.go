@@ -25,6 +25,7 @@ func NewLiquidRPC(config json.RawMessage, pushHandler func(bchain.NotificationTy
 		b.(*btc.BitcoinRPC),
 	}
 	s.RPCMarshaler = btc.JSONMarshalerV2{}
+	s.ChainConfig.SupportsGetMempoolEntries = false
 
 	return s, nil
 }
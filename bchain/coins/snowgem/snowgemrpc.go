@@ -26,6 +26,7 @@ func NewSnowGemRPC(config json.RawMessage, pushHandler func(bchain.NotificationT
 	}
 	z.RPCMarshaler = btc.JSONMarshalerV1{}
 	z.ChainConfig.SupportsEstimateSmartFee = false
+	z.ChainConfig.SupportsGetMempoolEntries = false
 	return z, nil
 }
 
@@ -26,6 +26,7 @@ func NewTrezarcoinRPC(config json.RawMessage, pushHandler func(bchain.Notificati
 	}
 	s.RPCMarshaler = btc.JSONMarshalerV1{}
 	s.ChainConfig.SupportsEstimateFee = false
+	s.ChainConfig.SupportsGetMempoolEntries = false
 
 	return s, nil
 }
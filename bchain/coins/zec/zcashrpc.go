@@ -44,6 +44,7 @@ func NewZCashRPC(config json.RawMessage, pushHandler func(bchain.NotificationTyp
 	}
 	z.RPCMarshaler = btc.JSONMarshalerV1{}
 	z.ChainConfig.SupportsEstimateSmartFee = false
+	z.ChainConfig.SupportsGetMempoolEntries = false
 	return z, nil
 }
 
@@ -106,6 +107,7 @@ func (z *ZCashRPC) GetChainInfo() (*bchain.ChainInfo, error) {
 		Timeoffset:      networkInfo.Result.Timeoffset,
 		Consensus:       chainInfo.Result.Consensus,
 		Warnings:        networkInfo.Result.Warnings,
+		Endpoints:       z.GetBackendEndpoints(),
 	}, nil
 }
 
@@ -134,10 +136,11 @@ func (z *ZCashRPC) GetBlock(hash string, height uint32) (*bchain.Block, error) {
 		return nil, errors.Annotatef(res.Error, "hash %v", hash)
 	}
 
+	// the transactions are fetched in JSON-RPC batches if rpc_batch_size is configured
+	btxs, errs := z.GetTransactions(res.Result.Txids)
 	txs := make([]bchain.Tx, 0, len(res.Result.Txids))
-	for _, txid := range res.Result.Txids {
-		tx, err := z.GetTransaction(txid)
-		if err != nil {
+	for i, tx := range btxs {
+		if err := errs[i]; err != nil {
 			if err == bchain.ErrTxNotFound {
 				glog.Errorf("rpc: getblock: skipping transanction in block %s due error: %s", hash, err)
 				continue
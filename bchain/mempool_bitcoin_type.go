@@ -2,35 +2,106 @@ package bchain
 
 import (
 	"math/big"
+	"sort"
 	"time"
 
 	"github.com/golang/glog"
 )
 
+// maximum number of queued incremental mempool updates
+const mempoolUpdatesQueueSize = 10000
+
+// maximum number of transactions from the rawtx topic waiting for the mempool add or block connected message
+const maxPendingRawTxs = 50000
+
+// maximum number of transactions visited when computing package of a transaction
+const maxPackageTxs = 1000
+
+// percentage of the limit of the tracked transactions freed by the eviction, the space is filled by the incoming transactions
+const trackedTxsEvictionSlackPercent = 10
+
+// time after which a removed transaction, which is neither confirmed nor conflicted, is considered evicted
+// the index may not contain the block with the transaction at the moment of the removal
+const removalResolvePeriod = 2 * time.Minute
+
 type chanInputPayload struct {
-	tx    *MempoolTx
-	index int
+	tx          *MempoolTx
+	index       int
+	unconfirmed []bool
+}
+
+// txRelations contains fee, virtual size, spent outpoints and unconfirmed parents of a mempool transaction
+type txRelations struct {
+	fee     big.Int
+	vsize   int64
+	inputs  []Outpoint
+	parents []string
+}
+
+// lightTxEntry is a mempool transaction tracked only by its txid, its inputs and outputs are not resolved
+// relations are resolved lazily, when the package of the transaction is requested
+type lightTxEntry struct {
+	time      uint32
+	feeRate   int64
+	relations *txRelations
+}
+
+// removedTx is a transaction removed from mempool, for which the reason of the removal is being resolved
+type removedTx struct {
+	txid      string
+	entry     txEntry
+	confirmed bool
+	time      time.Time
+}
+
+// txPayload is a transaction to be processed by the sync workers, tx is nil if the worker has to get it from the backend
+type txPayload struct {
+	txid string
+	tx   *Tx
+}
+
+// mempoolUpdate is an incremental update of the mempool received from the message queue
+// tx is set for transactions from the rawtx topic, label for the messages of the sequence topic
+type mempoolUpdate struct {
+	tx    *Tx
+	txid  string
+	label byte
 }
 
 // MempoolBitcoinType is mempool handle.
 type MempoolBitcoinType struct {
 	BaseMempool
-	chanTxid            chan string
+	chanTxid            chan txPayload
 	chanAddrIndex       chan txidio
+	chanUpdate          chan mempoolUpdate
+	pendingRawTxs       []*Tx
+	children            map[string][]string
+	spentOutpoints      map[Outpoint]string
+	unresolvedRemovals  []removedTx
+	lightEntries        map[string]lightTxEntry
+	maxTrackedTxs       int
+	minTrackedFeeRate   int64
 	AddrDescForOutpoint AddrDescForOutpointFunc
 }
 
 // NewMempoolBitcoinType creates new mempool handler.
+// If maxTrackedTxs is greater than zero, at most maxTrackedTxs transactions with the highest fee rate are fully tracked,
+// the others are tracked only by txid and are not returned by the address queries.
 // For now there is no cleanup of sync routines, the expectation is that the mempool is created only once per process
-func NewMempoolBitcoinType(chain BlockChain, workers int, subworkers int) *MempoolBitcoinType {
+func NewMempoolBitcoinType(chain BlockChain, workers int, subworkers int, maxTrackedTxs int) *MempoolBitcoinType {
 	m := &MempoolBitcoinType{
 		BaseMempool: BaseMempool{
 			chain:        chain,
 			txEntries:    make(map[string]txEntry),
 			addrDescToTx: make(map[string][]Outpoint),
 		},
-		chanTxid:      make(chan string, 1),
-		chanAddrIndex: make(chan txidio, 1),
+		chanTxid:       make(chan txPayload, 1),
+		chanAddrIndex:  make(chan txidio, 1),
+		chanUpdate:     make(chan mempoolUpdate, mempoolUpdatesQueueSize),
+		children:       make(map[string][]string),
+		spentOutpoints: make(map[Outpoint]string),
+		lightEntries:   make(map[string]lightTxEntry),
+		maxTrackedTxs:  maxTrackedTxs,
 	}
 	for i := 0; i < workers; i++ {
 		go func(i int) {
@@ -44,15 +115,37 @@ func NewMempoolBitcoinType(chain BlockChain, workers int, subworkers int) *Mempo
 					}
 				}(j)
 			}
-			for txid := range m.chanTxid {
-				io, ok := m.getTxAddrs(txid, chanInput, chanResult)
+			for p := range m.chanTxid {
+				var io []addrIndex
+				var relations *txRelations
+				ok := true
+				if p.tx != nil {
+					io, relations = m.getAddrIndexes(p.tx, chanInput, chanResult)
+				} else {
+					io, relations, ok = m.getTxAddrs(p.txid, chanInput, chanResult)
+				}
 				if !ok {
 					io = []addrIndex{}
 				}
-				m.chanAddrIndex <- txidio{txid, io}
+				m.chanAddrIndex <- txidio{p.txid, io, relations}
 			}
 		}(i)
 	}
+	go func() {
+		chanInput := make(chan chanInputPayload, 1)
+		chanResult := make(chan *addrIndex, 1)
+		for j := 0; j < subworkers; j++ {
+			go func() {
+				for payload := range chanInput {
+					ai := m.getInputAddress(&payload)
+					chanResult <- ai
+				}
+			}()
+		}
+		for u := range m.chanUpdate {
+			m.processUpdate(&u, chanInput, chanResult)
+		}
+	}()
 	glog.Info("mempool: starting with ", workers, "*", subworkers, " sync workers")
 	return m
 }
@@ -65,6 +158,8 @@ func (m *MempoolBitcoinType) getInputAddress(payload *chanInputPayload) *addrInd
 		addrDesc, value = m.AddrDescForOutpoint(Outpoint{vin.Txid, int32(vin.Vout)})
 	}
 	if addrDesc == nil {
+		// the output is not in the index, the input spends an unconfirmed transaction
+		payload.unconfirmed[payload.index] = true
 		itx, err := m.chain.GetTransactionForMempool(vin.Txid)
 		if err != nil {
 			glog.Error("cannot get transaction ", vin.Txid, ": ", err)
@@ -87,12 +182,18 @@ func (m *MempoolBitcoinType) getInputAddress(payload *chanInputPayload) *addrInd
 
 }
 
-func (m *MempoolBitcoinType) getTxAddrs(txid string, chanInput chan chanInputPayload, chanResult chan *addrIndex) ([]addrIndex, bool) {
+func (m *MempoolBitcoinType) getTxAddrs(txid string, chanInput chan chanInputPayload, chanResult chan *addrIndex) ([]addrIndex, *txRelations, bool) {
 	tx, err := m.chain.GetTransactionForMempool(txid)
 	if err != nil {
 		glog.Error("cannot get transaction ", txid, ": ", err)
-		return nil, false
+		return nil, nil, false
 	}
+	io, relations := m.getAddrIndexes(tx, chanInput, chanResult)
+	return io, relations, true
+}
+
+func (m *MempoolBitcoinType) getAddrIndexes(tx *Tx, chanInput chan chanInputPayload, chanResult chan *addrIndex) ([]addrIndex, *txRelations) {
+	txid := tx.Txid
 	glog.V(2).Info("mempool: gettxaddrs ", txid, ", ", len(tx.Vin), " inputs")
 	mtx := m.txToMempoolTx(tx)
 	io := make([]addrIndex, 0, len(tx.Vout)+len(tx.Vin))
@@ -110,12 +211,13 @@ func (m *MempoolBitcoinType) getTxAddrs(txid string, chanInput chan chanInputPay
 		}
 	}
 	dispatched := 0
+	unconfirmed := make([]bool, len(tx.Vin))
 	for i := range tx.Vin {
 		input := &tx.Vin[i]
 		if input.Coinbase != "" {
 			continue
 		}
-		payload := chanInputPayload{mtx, i}
+		payload := chanInputPayload{mtx, i, unconfirmed}
 	loop:
 		for {
 			select {
@@ -141,7 +243,634 @@ func (m *MempoolBitcoinType) getTxAddrs(txid string, chanInput chan chanInputPay
 	if m.OnNewTx != nil {
 		m.OnNewTx(mtx)
 	}
-	return io, true
+	return io, m.getTxRelations(tx, mtx, unconfirmed)
+}
+
+func (m *MempoolBitcoinType) getTxRelations(tx *Tx, mtx *MempoolTx, unconfirmed []bool) *txRelations {
+	r := txRelations{}
+	for i := range mtx.Vin {
+		vin := &mtx.Vin[i]
+		r.fee.Add(&r.fee, &vin.ValueSat)
+		if vin.Txid != "" {
+			r.inputs = append(r.inputs, Outpoint{vin.Txid, int32(vin.Vout)})
+		}
+		if unconfirmed[i] {
+			found := false
+			for _, p := range r.parents {
+				if p == vin.Txid {
+					found = true
+					break
+				}
+			}
+			if !found {
+				r.parents = append(r.parents, vin.Txid)
+			}
+		}
+	}
+	for i := range tx.Vout {
+		r.fee.Sub(&r.fee, &tx.Vout[i].ValueSat)
+	}
+	if r.fee.Sign() < 0 {
+		r.fee.SetInt64(0)
+	}
+	r.vsize = m.txVSize(tx)
+	return &r
+}
+
+// txVSize returns virtual size of the transaction, if the parser cannot compute it, the size of the transaction
+func (m *MempoolBitcoinType) txVSize(tx *Tx) int64 {
+	if p, ok := m.chain.GetChainParser().(TxVSizeParser); ok {
+		if vsize, err := p.GetTxVSize(tx); err == nil {
+			return vsize
+		}
+	}
+	return int64(len(tx.Hex) / 2)
+}
+
+// addEntry adds the entry to the mempool structs if it is not there yet
+func (m *MempoolBitcoinType) addEntry(txid string, entry txEntry) {
+	if len(entry.addrIndexes) > 0 {
+		m.mux.Lock()
+		if _, exists := m.txEntries[txid]; !exists {
+			m.txEntries[txid] = entry
+			for _, si := range entry.addrIndexes {
+				m.addrDescToTx[si.addrDesc] = append(m.addrDescToTx[si.addrDesc], Outpoint{txid, si.n})
+			}
+			if entry.relations != nil {
+				for _, p := range entry.relations.parents {
+					m.children[p] = append(m.children[p], txid)
+				}
+				for _, o := range entry.relations.inputs {
+					m.spentOutpoints[o] = txid
+				}
+			}
+		}
+		m.mux.Unlock()
+	}
+}
+
+// removeEntryFromMempool removes entry from mempool structs including its links to parents and spent outpoints. The caller is responsible for locking!
+func (m *MempoolBitcoinType) removeEntryFromMempool(txid string, entry txEntry) {
+	m.BaseMempool.removeEntryFromMempool(txid, entry)
+	if entry.relations != nil {
+		for _, o := range entry.relations.inputs {
+			if m.spentOutpoints[o] == txid {
+				delete(m.spentOutpoints, o)
+			}
+		}
+		for _, p := range entry.relations.parents {
+			children := m.children[p]
+			for i := range children {
+				if children[i] == txid {
+					children = append(children[:i], children[i+1:]...)
+					break
+				}
+			}
+			if len(children) > 0 {
+				m.children[p] = children
+			} else {
+				delete(m.children, p)
+			}
+		}
+	}
+}
+
+// getRelations returns relations of a fully tracked transaction or of a resolved lightweight one, nil if they are not known
+// The caller is responsible for locking!
+func (m *MempoolBitcoinType) getRelations(txid string) *txRelations {
+	if entry, found := m.txEntries[txid]; found {
+		return entry.relations
+	}
+	return m.lightEntries[txid].relations
+}
+
+// walkPackage calls f for the transaction and all its in-mempool ancestors (or descendants) exactly once
+// The caller is responsible for locking!
+func (m *MempoolBitcoinType) walkPackage(txid string, descendants bool, f func(txid string, r *txRelations)) {
+	visited := map[string]struct{}{txid: {}}
+	queue := []string{txid}
+	for len(queue) > 0 && len(visited) <= maxPackageTxs {
+		t := queue[0]
+		queue = queue[1:]
+		relations := m.getRelations(t)
+		if relations == nil {
+			continue
+		}
+		f(t, relations)
+		next := relations.parents
+		if descendants {
+			next = m.children[t]
+		}
+		for _, n := range next {
+			if _, v := visited[n]; !v {
+				visited[n] = struct{}{}
+				queue = append(queue, n)
+			}
+		}
+	}
+}
+
+// resolveLight resolves the relations of a transaction tracked only by txid, if they are not resolved yet
+// The transaction stays in the lightweight form, it is still not returned by the address queries.
+func (m *MempoolBitcoinType) resolveLight(txid string) {
+	m.mux.Lock()
+	light, found := m.lightEntries[txid]
+	m.mux.Unlock()
+	if !found || light.relations != nil {
+		return
+	}
+	tx, err := m.chain.GetTransactionForMempool(txid)
+	if err != nil {
+		glog.Error("cannot get transaction ", txid, ": ", err)
+		return
+	}
+	mtx := m.txToMempoolTx(tx)
+	unconfirmed := make([]bool, len(mtx.Vin))
+	for i := range mtx.Vin {
+		if mtx.Vin[i].Coinbase == "" {
+			m.getInputAddress(&chanInputPayload{mtx, i, unconfirmed})
+		}
+	}
+	relations := m.getTxRelations(tx, mtx, unconfirmed)
+	m.mux.Lock()
+	if light, found = m.lightEntries[txid]; found {
+		light.relations = relations
+		m.lightEntries[txid] = light
+	}
+	m.mux.Unlock()
+}
+
+// GetTxPackage returns package (ancestors and descendants) data of a mempool transaction or nil if the transaction is not in mempool
+// The relations of a transaction tracked only by txid are resolved on demand.
+func (m *MempoolBitcoinType) GetTxPackage(txid string) *MempoolTxPackage {
+	m.resolveLight(txid)
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	relations := m.getRelations(txid)
+	if relations == nil {
+		return nil
+	}
+	p := MempoolTxPackage{
+		VSize:   relations.vsize,
+		Parents: relations.parents,
+	}
+	p.Fee.Set(&relations.fee)
+	m.walkPackage(txid, false, func(t string, r *txRelations) {
+		p.AncestorCount++
+		p.AncestorVSize += r.vsize
+		p.AncestorFees.Add(&p.AncestorFees, &r.fee)
+	})
+	p.EffectiveVSize = p.AncestorVSize
+	p.EffectiveFees.Set(&p.AncestorFees)
+	var a, b big.Int
+	m.walkPackage(txid, true, func(t string, r *txRelations) {
+		p.DescendantCount++
+		p.DescendantVSize += r.vsize
+		p.DescendantFees.Add(&p.DescendantFees, &r.fee)
+		if t == txid {
+			return
+		}
+		// the transaction can be mined in the ancestor package of a descendant, if it has higher fee rate
+		var vsize int64
+		var fees big.Int
+		m.walkPackage(t, false, func(_ string, r *txRelations) {
+			vsize += r.vsize
+			fees.Add(&fees, &r.fee)
+		})
+		a.Mul(&fees, big.NewInt(p.EffectiveVSize))
+		b.Mul(&p.EffectiveFees, big.NewInt(vsize))
+		if a.Cmp(&b) > 0 {
+			p.EffectiveVSize = vsize
+			p.EffectiveFees.Set(&fees)
+		}
+	})
+	p.Children = append([]string{}, m.children[txid]...)
+	return &p
+}
+
+// removeEntry removes transaction from the mempool structs if it is there, returns the entry if the transaction was fully tracked
+func (m *MempoolBitcoinType) removeEntry(txid string) (txEntry, bool) {
+	m.mux.Lock()
+	entry, exists := m.txEntries[txid]
+	if exists {
+		m.removeEntryFromMempool(txid, entry)
+	}
+	delete(m.lightEntries, txid)
+	m.mux.Unlock()
+	return entry, exists
+}
+
+// feeRate returns fee rate of the entry in satoshi per 1000 vbytes
+func (e *txEntry) feeRate() int64 {
+	if e.relations == nil || e.relations.vsize <= 0 {
+		return 0
+	}
+	var r big.Int
+	r.Mul(&e.relations.fee, big.NewInt(1000))
+	return r.Div(&r, big.NewInt(e.relations.vsize)).Int64()
+}
+
+// mempoolEntryFeeRate returns fee rate of the mempool entry returned by the backend in satoshi per 1000 vbytes
+func mempoolEntryFeeRate(me *MempoolEntry) (int64, bool) {
+	if me == nil || me.Size == 0 {
+		return 0, false
+	}
+	var r big.Int
+	r.Mul(&me.FeeSat, big.NewInt(1000))
+	return r.Div(&r, big.NewInt(int64(me.Size))).Int64(), true
+}
+
+// txFeeRate computes fee rate of the transaction from the values of its inputs found in the index, without calls to the backend
+// The fee rate is not known if the transaction spends an output which is not in the index yet.
+func (m *MempoolBitcoinType) txFeeRate(tx *Tx) (int64, bool) {
+	if m.AddrDescForOutpoint == nil {
+		return 0, false
+	}
+	var fee big.Int
+	for i := range tx.Vin {
+		vin := &tx.Vin[i]
+		if vin.Coinbase != "" {
+			continue
+		}
+		addrDesc, value := m.AddrDescForOutpoint(Outpoint{vin.Txid, int32(vin.Vout)})
+		if addrDesc == nil || value == nil {
+			return 0, false
+		}
+		fee.Add(&fee, value)
+	}
+	for i := range tx.Vout {
+		fee.Sub(&fee, &tx.Vout[i].ValueSat)
+	}
+	vsize := m.txVSize(tx)
+	if fee.Sign() < 0 || vsize <= 0 {
+		return 0, false
+	}
+	fee.Mul(&fee, big.NewInt(1000))
+	return fee.Div(&fee, big.NewInt(vsize)).Int64(), true
+}
+
+// evictionSlack returns the number of the transactions under the limit, to which the tracked transactions are evicted
+func (m *MempoolBitcoinType) evictionSlack() int {
+	return m.maxTrackedTxs * trackedTxsEvictionSlackPercent / 100
+}
+
+// trackLight adds the transaction in the lightweight form, if the limit of the tracked transactions is reached
+// and the fee rate of the transaction is lower than the fee rate of the tracked transactions.
+// If force is set, the threshold was computed from the mempool entries of the whole mempool
+// and is applied even if the limit is not reached yet.
+func (m *MempoolBitcoinType) trackLight(txid string, txTime uint32, feeRate int64, force bool) bool {
+	if m.maxTrackedTxs <= 0 {
+		return false
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if !force && len(m.txEntries) < m.maxTrackedTxs-m.evictionSlack() {
+		return false
+	}
+	if feeRate >= m.minTrackedFeeRate {
+		return false
+	}
+	m.lightEntries[txid] = lightTxEntry{time: txTime, feeRate: feeRate}
+	return true
+}
+
+type txidFeeRate struct {
+	txid    string
+	feeRate int64
+}
+
+// evictTrackedTxs converts the tracked transactions with the lowest fee rate to the lightweight form, down to the limit
+// minus the eviction slack, so that the transactions are not sorted again on every add over the limit.
+// The fee rates are sorted without holding the lock, the transactions removed in the meantime are skipped.
+func (m *MempoolBitcoinType) evictTrackedTxs() {
+	m.mux.Lock()
+	if len(m.txEntries) <= m.maxTrackedTxs {
+		m.mux.Unlock()
+		return
+	}
+	feeRates := make([]txidFeeRate, 0, len(m.txEntries))
+	for txid, entry := range m.txEntries {
+		feeRates = append(feeRates, txidFeeRate{txid, entry.feeRate()})
+	}
+	m.mux.Unlock()
+	sort.Slice(feeRates, func(i, j int) bool { return feeRates[i].feeRate < feeRates[j].feeRate })
+	over := len(feeRates) - m.maxTrackedTxs + m.evictionSlack()
+	m.mux.Lock()
+	evicted := 0
+	for _, f := range feeRates[:over] {
+		if entry, found := m.txEntries[f.txid]; found {
+			m.removeEntryFromMempool(f.txid, entry)
+			m.lightEntries[f.txid] = lightTxEntry{time: entry.time, feeRate: f.feeRate}
+			evicted++
+		}
+	}
+	m.minTrackedFeeRate = feeRates[over].feeRate
+	m.mux.Unlock()
+	glog.V(1).Info("mempool: limit of tracked transactions reached, ", evicted, " transactions with fee rate under ", feeRates[over].feeRate, " tracked only by txid")
+}
+
+// limitTrackedTxs converts the tracked transactions with the lowest fee rate over the limit to the lightweight form
+// or, if there is space under the limit minus the eviction slack, returns the lightweight transactions with the highest fee rate to be resolved
+func (m *MempoolBitcoinType) limitTrackedTxs() []string {
+	if m.maxTrackedTxs <= 0 {
+		return nil
+	}
+	m.mux.Lock()
+	if len(m.txEntries) > m.maxTrackedTxs {
+		m.mux.Unlock()
+		m.evictTrackedTxs()
+		return nil
+	}
+	defer m.mux.Unlock()
+	free := m.maxTrackedTxs - m.evictionSlack() - len(m.txEntries)
+	if free <= 0 || len(m.lightEntries) == 0 {
+		return nil
+	}
+	txids := make([]string, 0, len(m.lightEntries))
+	for txid := range m.lightEntries {
+		txids = append(txids, txid)
+	}
+	sort.Slice(txids, func(i, j int) bool { return m.lightEntries[txids[i]].feeRate > m.lightEntries[txids[j]].feeRate })
+	if len(txids) > free {
+		txids = txids[:free]
+		m.minTrackedFeeRate = m.lightEntries[txids[free-1]].feeRate
+	} else {
+		m.minTrackedFeeRate = 0
+	}
+	return txids
+}
+
+// GetAllEntries returns all mempool entries including the lightweight ones sorted by fist seen time in descending order
+func (m *MempoolBitcoinType) GetAllEntries() MempoolTxidEntries {
+	m.mux.Lock()
+	entries := make(MempoolTxidEntries, 0, len(m.txEntries)+len(m.lightEntries))
+	for txid, entry := range m.txEntries {
+		entries = append(entries, MempoolTxidEntry{Txid: txid, Time: entry.time})
+	}
+	for txid, entry := range m.lightEntries {
+		entries = append(entries, MempoolTxidEntry{Txid: txid, Time: entry.time})
+	}
+	m.mux.Unlock()
+	sort.Sort(entries)
+	return entries
+}
+
+// GetTransactionTime returns first seen time of a transaction
+func (m *MempoolBitcoinType) GetTransactionTime(txid string) uint32 {
+	if t := m.BaseMempool.GetTransactionTime(txid); t != 0 {
+		return t
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.lightEntries[txid].time
+}
+
+// GetStats returns the number of tracked transactions and the estimate of the memory used by them
+func (m *MempoolBitcoinType) GetStats() MempoolStats {
+	stats := m.BaseMempool.GetStats()
+	m.mux.Lock()
+	stats.LightTxs = len(m.lightEntries)
+	stats.MemoryBytes += int64(stats.LightTxs) * lightEntrySize
+	for _, entry := range m.lightEntries {
+		if entry.relations != nil {
+			stats.MemoryBytes += relationsSize + int64(len(entry.relations.inputs))*outpointSize + int64(len(entry.relations.parents))*txidSize
+		}
+	}
+	for _, entry := range m.txEntries {
+		if entry.relations != nil {
+			stats.MemoryBytes += relationsSize + int64(len(entry.relations.inputs))*outpointSize + int64(len(entry.relations.parents))*txidSize
+		}
+	}
+	stats.MemoryBytes += int64(len(m.spentOutpoints)) * (outpointSize + txidSize)
+	m.mux.Unlock()
+	return stats
+}
+
+// isConfirmed checks if the transaction is already in the index
+func (m *MempoolBitcoinType) isConfirmed(txid string) bool {
+	if m.AddrDescForOutpoint == nil {
+		return false
+	}
+	_, value := m.AddrDescForOutpoint(Outpoint{txid, 0})
+	return value != nil
+}
+
+// resolveRemovals infers the reasons of removal of the removed transactions and of the previously unresolved ones
+// and notifies about the resolved removals. The outpoints spent by the transactions of a newly connected block,
+// if they are known, are passed in blockSpent.
+// A transaction is conflicted if another transaction in mempool or in the connected block spends the same outpoint
+// or if its parent is conflicted. If it is neither confirmed nor conflicted for removalResolvePeriod, it is evicted.
+func (m *MempoolBitcoinType) resolveRemovals(removed []removedTx, blockSpent map[Outpoint]string) {
+	m.mux.Lock()
+	removed = append(m.unresolvedRemovals, removed...)
+	m.unresolvedRemovals = nil
+	m.mux.Unlock()
+	if len(removed) == 0 {
+		return
+	}
+	now := time.Now()
+	reasons := make([]MempoolRemovalReason, len(removed))
+	conflicting := make([]string, len(removed))
+	// conflicted transactions and the transactions conflicting with them
+	conflicted := make(map[string]string)
+	for i := range removed {
+		r := &removed[i]
+		if r.confirmed || m.isConfirmed(r.txid) {
+			reasons[i] = MempoolRemovalConfirmed
+			if r.entry.relations != nil {
+				if blockSpent == nil {
+					blockSpent = make(map[Outpoint]string)
+				}
+				for _, o := range r.entry.relations.inputs {
+					blockSpent[o] = r.txid
+				}
+			}
+		}
+	}
+	m.mux.Lock()
+	// repeat until there is no change, descendants of conflicted transactions are conflicted too
+	for changed := true; changed; {
+		changed = false
+		for i := range removed {
+			r := &removed[i]
+			if reasons[i] != "" || r.entry.relations == nil {
+				continue
+			}
+			for _, o := range r.entry.relations.inputs {
+				c, found := m.spentOutpoints[o]
+				if !found || c == r.txid {
+					c, found = blockSpent[o]
+				}
+				if !found || c == r.txid {
+					c, found = conflicted[o.Txid]
+				}
+				if found {
+					reasons[i] = MempoolRemovalConflicted
+					conflicting[i] = c
+					conflicted[r.txid] = c
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	var removals []MempoolTxRemoval
+	for i := range removed {
+		r := &removed[i]
+		if reasons[i] == "" {
+			if now.Sub(r.time) < removalResolvePeriod {
+				m.unresolvedRemovals = append(m.unresolvedRemovals, *r)
+				continue
+			}
+			reasons[i] = MempoolRemovalEvicted
+		}
+		removals = append(removals, m.newTxRemoval(r.txid, r.entry, reasons[i], conflicting[i]))
+	}
+	m.mux.Unlock()
+	m.notifyTxRemovals(removals)
+	glog.V(1).Info("mempool: resolved ", len(removals), " removals, ", len(removed)-len(removals), " unresolved")
+}
+
+// AddRawTx queues a transaction received from the rawtx topic of the message queue
+// The transaction is added to the mempool when the mempool add message for it arrives,
+// if a block connected message arrives first, the transaction was confirmed.
+// Returns false if the queue is full, in which case full resync is necessary.
+func (m *MempoolBitcoinType) AddRawTx(tx *Tx) bool {
+	return m.queueUpdate(mempoolUpdate{tx: tx, txid: tx.Txid})
+}
+
+// UpdateFromSequence queues a message of the sequence topic of the message queue
+// Returns false if the queue is full, in which case full resync is necessary.
+func (m *MempoolBitcoinType) UpdateFromSequence(hash string, label byte) bool {
+	return m.queueUpdate(mempoolUpdate{txid: hash, label: label})
+}
+
+func (m *MempoolBitcoinType) queueUpdate(u mempoolUpdate) bool {
+	select {
+	case m.chanUpdate <- u:
+		return true
+	default:
+		glog.Warning("mempool: updates queue full, dropping update of ", u.txid)
+		return false
+	}
+}
+
+func (m *MempoolBitcoinType) takePendingRawTx(txid string) *Tx {
+	for i := len(m.pendingRawTxs) - 1; i >= 0; i-- {
+		if tx := m.pendingRawTxs[i]; tx.Txid == txid {
+			m.pendingRawTxs = append(m.pendingRawTxs[:i], m.pendingRawTxs[i+1:]...)
+			return tx
+		}
+	}
+	return nil
+}
+
+func (m *MempoolBitcoinType) processUpdate(u *mempoolUpdate, chanInput chan chanInputPayload, chanResult chan *addrIndex) {
+	if u.tx != nil {
+		if len(m.pendingRawTxs) >= maxPendingRawTxs {
+			m.pendingRawTxs = m.pendingRawTxs[1:]
+		}
+		m.pendingRawTxs = append(m.pendingRawTxs, u.tx)
+		return
+	}
+	switch u.label {
+	case MQSequenceMempoolAdd:
+		tx := m.takePendingRawTx(u.txid)
+		m.mux.Lock()
+		_, exists := m.txEntries[u.txid]
+		_, light := m.lightEntries[u.txid]
+		m.mux.Unlock()
+		if exists || light {
+			return
+		}
+		if tx == nil {
+			var err error
+			tx, err = m.chain.GetTransactionForMempool(u.txid)
+			if err != nil {
+				glog.Error("cannot get transaction ", u.txid, ": ", err)
+				return
+			}
+		}
+		// the fee rate is computed from the indexed outputs, the transactions spending unconfirmed outputs are tracked
+		// and converted to the lightweight form by the eviction, if they have low fee rate
+		if feeRate, ok := m.txFeeRate(tx); ok && m.trackLight(u.txid, uint32(time.Now().Unix()), feeRate, false) {
+			return
+		}
+		io, relations := m.getAddrIndexes(tx, chanInput, chanResult)
+		m.addEntry(u.txid, txEntry{io, uint32(time.Now().Unix()), relations})
+		glog.V(2).Info("mempool: added ", u.txid)
+		// the transactions with the lowest fee rate over the limit are converted to the lightweight form
+		// the space freed by the removals is filled by the next resync
+		m.mux.Lock()
+		over := m.maxTrackedTxs > 0 && len(m.txEntries) > m.maxTrackedTxs
+		m.mux.Unlock()
+		if over {
+			m.evictTrackedTxs()
+		}
+		// the added transaction may be the replacement of a previously removed one
+		m.resolveRemovals(nil, nil)
+	case MQSequenceMempoolRemove:
+		m.takePendingRawTx(u.txid)
+		// the reason is resolved later, the replacing transaction is announced after the removal
+		if entry, exists := m.removeEntry(u.txid); exists {
+			m.mux.Lock()
+			m.unresolvedRemovals = append(m.unresolvedRemovals, removedTx{txid: u.txid, entry: entry, time: time.Now()})
+			m.mux.Unlock()
+		}
+		glog.V(2).Info("mempool: removed ", u.txid)
+	case MQSequenceBlockConnected:
+		// raw transactions not announced as added to mempool belong to the connected block
+		var removed []removedTx
+		blockSpent := make(map[Outpoint]string)
+		for _, tx := range m.pendingRawTxs {
+			if entry, exists := m.removeEntry(tx.Txid); exists {
+				removed = append(removed, removedTx{txid: tx.Txid, entry: entry, confirmed: true, time: time.Now()})
+			}
+			for i := range tx.Vin {
+				if tx.Vin[i].Txid != "" {
+					blockSpent[Outpoint{tx.Vin[i].Txid, int32(tx.Vin[i].Vout)}] = tx.Txid
+				}
+			}
+		}
+		m.resolveRemovals(removed, blockSpent)
+		glog.V(2).Info("mempool: block ", u.txid, " connected, removed ", len(removed), " confirmed transactions")
+		m.pendingRawTxs = m.pendingRawTxs[:0]
+	case MQSequenceBlockDisconnected:
+		// transactions of the disconnected block are returned to the mempool by the resync
+		m.pendingRawTxs = m.pendingRawTxs[:0]
+	}
+}
+
+// getMempoolTransactions returns txids of the mempool transactions. If the limit of the tracked transactions is set
+// and the backend returns the mempool entries in bulk, the entries are returned too and the minimal tracked fee rate
+// is set so that only the transactions with the highest fee rate up to the limit are resolved.
+func (m *MempoolBitcoinType) getMempoolTransactions() ([]string, map[string]*MempoolEntry, error) {
+	getter, ok := m.chain.(MempoolEntriesGetter)
+	if m.maxTrackedTxs <= 0 || !ok || !getter.SupportsGetMempoolEntries() {
+		txs, err := m.chain.GetMempoolTransactions()
+		return txs, nil, err
+	}
+	entries, err := getter.GetMempoolEntries()
+	if err != nil {
+		return nil, nil, err
+	}
+	txs := make([]string, 0, len(entries))
+	feeRates := make([]int64, 0, len(entries))
+	for txid, me := range entries {
+		txs = append(txs, txid)
+		if feeRate, ok := mempoolEntryFeeRate(me); ok {
+			feeRates = append(feeRates, feeRate)
+		}
+	}
+	var threshold int64
+	if len(feeRates) > m.maxTrackedTxs {
+		sort.Slice(feeRates, func(i, j int) bool { return feeRates[i] > feeRates[j] })
+		threshold = feeRates[m.maxTrackedTxs-1]
+	}
+	m.mux.Lock()
+	m.minTrackedFeeRate = threshold
+	m.mux.Unlock()
+	return txs, entries, nil
 }
 
 // Resync gets mempool transactions and maps outputs to transactions.
@@ -150,56 +879,119 @@ func (m *MempoolBitcoinType) getTxAddrs(txid string, chanInput chan chanInputPay
 func (m *MempoolBitcoinType) Resync() (int, error) {
 	start := time.Now()
 	glog.V(1).Info("mempool: resync")
-	txs, err := m.chain.GetMempoolTransactions()
+	// transactions added incrementally after this moment may be missing in the list returned by the backend
+	txTime := uint32(start.Unix())
+	txs, entries, err := m.getMempoolTransactions()
 	if err != nil {
 		return 0, err
 	}
 	glog.V(2).Info("mempool: resync ", len(txs), " txs")
-	onNewEntry := func(txid string, entry txEntry) {
-		if len(entry.addrIndexes) > 0 {
-			m.mux.Lock()
-			m.txEntries[txid] = entry
-			for _, si := range entry.addrIndexes {
-				m.addrDescToTx[si.addrDesc] = append(m.addrDescToTx[si.addrDesc], Outpoint{txid, si.n})
-			}
-			m.mux.Unlock()
+	onNewEntry := func(tio txidio) {
+		t := txTime
+		// resolved lightweight transaction keeps its first seen time
+		m.mux.Lock()
+		if light, found := m.lightEntries[tio.txid]; found {
+			t = light.time
+			delete(m.lightEntries, tio.txid)
 		}
+		m.mux.Unlock()
+		m.addEntry(tio.txid, txEntry{tio.io, t, tio.relations})
 	}
-	txsMap := make(map[string]struct{}, len(txs))
 	dispatched := 0
-	txTime := uint32(time.Now().Unix())
 	// get transaction in parallel using goroutines created in NewUTXOMempool
+	dispatchPayload := func(p txPayload) {
+		for {
+			select {
+			// store as many processed transactions as possible
+			case tio := <-m.chanAddrIndex:
+				onNewEntry(tio)
+				dispatched--
+			// send transaction to be processed
+			case m.chanTxid <- p:
+				dispatched++
+				return
+			}
+		}
+	}
+	// if the backend supports batching, the transactions are fetched in batches and passed to the workers
+	// the transactions which failed in the batch are fetched again individually by the workers
+	batchSize := TransactionBatchSize(m.chain)
+	var batch []string
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		btxs, errs := m.chain.(TransactionBatcher).GetTransactionsForMempool(batch)
+		for i, txid := range batch {
+			if errs[i] != nil && errs[i] != ErrTxNotFound {
+				glog.Warning("mempool: batch get transaction ", txid, ": ", errs[i])
+			}
+			dispatchPayload(txPayload{txid: txid, tx: btxs[i]})
+		}
+		batch = batch[:0]
+	}
+	dispatch := func(txid string) {
+		if batchSize < 2 {
+			dispatchPayload(txPayload{txid: txid})
+			return
+		}
+		batch = append(batch, txid)
+		if len(batch) >= batchSize {
+			flush()
+		}
+	}
+	txsMap := make(map[string]struct{}, len(txs))
 	for _, txid := range txs {
 		txsMap[txid] = struct{}{}
+		m.mux.Lock()
 		_, exists := m.txEntries[txid]
-		if !exists {
-		loop:
-			for {
-				select {
-				// store as many processed transactions as possible
-				case tio := <-m.chanAddrIndex:
-					onNewEntry(tio.txid, txEntry{tio.io, txTime})
-					dispatched--
-				// send transaction to be processed
-				case m.chanTxid <- txid:
-					dispatched++
-					break loop
-				}
-			}
+		_, light := m.lightEntries[txid]
+		m.mux.Unlock()
+		if exists || light {
+			continue
+		}
+		// without the mempool entries the fee rate is not known before the transaction is fetched,
+		// the transactions over the limit are converted to the lightweight form after the resync
+		if feeRate, ok := mempoolEntryFeeRate(entries[txid]); !ok || !m.trackLight(txid, txTime, feeRate, true) {
+			dispatch(txid)
 		}
 	}
-	for i := 0; i < dispatched; i++ {
-		tio := <-m.chanAddrIndex
-		onNewEntry(tio.txid, txEntry{tio.io, txTime})
+	flush()
+	for ; dispatched > 0; dispatched-- {
+		onNewEntry(<-m.chanAddrIndex)
 	}
 
+	var removed []removedTx
+	m.mux.Lock()
 	for txid, entry := range m.txEntries {
-		if _, exists := txsMap[txid]; !exists {
-			m.mux.Lock()
+		if _, exists := txsMap[txid]; !exists && entry.time < txTime {
 			m.removeEntryFromMempool(txid, entry)
-			m.mux.Unlock()
+			removed = append(removed, removedTx{txid: txid, entry: entry, time: start})
+		}
+	}
+	// the lightweight transactions were not announced, they are removed without notification
+	for txid, entry := range m.lightEntries {
+		if _, exists := txsMap[txid]; !exists && entry.time < txTime {
+			delete(m.lightEntries, txid)
+		}
+	}
+	m.mux.Unlock()
+	m.resolveRemovals(removed, nil)
+
+	// resolve the lightweight transactions if there is space under the limit of tracked transactions
+	if promote := m.limitTrackedTxs(); len(promote) > 0 {
+		for _, txid := range promote {
+			dispatch(txid)
+		}
+		flush()
+		for ; dispatched > 0; dispatched-- {
+			onNewEntry(<-m.chanAddrIndex)
 		}
+		glog.Info("mempool: resolved ", len(promote), " transactions tracked only by txid")
 	}
-	glog.Info("mempool: resync finished in ", time.Since(start), ", ", len(m.txEntries), " transactions in mempool")
-	return len(m.txEntries), nil
+	m.mux.Lock()
+	count := len(m.txEntries) + len(m.lightEntries)
+	m.mux.Unlock()
+	glog.Info("mempool: resync finished in ", time.Since(start), ", ", count, " transactions in mempool")
+	return count, nil
 }
@@ -0,0 +1,493 @@
+//go:build unittest
+
+package bchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testMempoolParser struct {
+	BlockChainParser
+}
+
+func (p *testMempoolParser) GetAddrDescFromVout(output *Vout) (AddressDescriptor, error) {
+	return hex.DecodeString(output.ScriptPubKey.Hex)
+}
+
+type testMempoolChain struct {
+	BlockChain
+	parser  *testMempoolParser
+	txs     map[string]*Tx
+	mempool []string
+}
+
+func (c *testMempoolChain) GetChainParser() BlockChainParser {
+	return c.parser
+}
+
+func (c *testMempoolChain) GetTransactionForMempool(txid string) (*Tx, error) {
+	tx, found := c.txs[txid]
+	if !found {
+		return nil, ErrTxNotFound
+	}
+	return tx, nil
+}
+
+func (c *testMempoolChain) GetMempoolTransactions() ([]string, error) {
+	return c.mempool, nil
+}
+
+func (c *testMempoolChain) GetMempoolEntry(txid string) (*MempoolEntry, error) {
+	return nil, errors.New("getmempoolentry must not be called")
+}
+
+func newTestMempoolEntry(tx *Tx) *MempoolEntry {
+	// all test inputs have value 5000
+	e := &MempoolEntry{Size: uint32(len(tx.Hex) / 2)}
+	e.FeeSat.SetInt64(5000)
+	for i := range tx.Vout {
+		e.FeeSat.Sub(&e.FeeSat, &tx.Vout[i].ValueSat)
+	}
+	return e
+}
+
+func newTestMempoolTx(txid string, spent Outpoint, scripts ...string) *Tx {
+	tx := &Tx{
+		Txid: txid,
+		Vin:  []Vin{{Txid: spent.Txid, Vout: uint32(spent.Vout)}},
+	}
+	for i, s := range scripts {
+		tx.Vout = append(tx.Vout, Vout{N: uint32(i), ValueSat: *big.NewInt(1000), ScriptPubKey: ScriptPubKey{Hex: s}})
+	}
+	return tx
+}
+
+func TestMempoolBitcoinType_processUpdate(t *testing.T) {
+	tx1 := newTestMempoolTx("01", Outpoint{"f1", 0}, "a1", "a2")
+	tx2 := newTestMempoolTx("02", Outpoint{"01", 1}, "a3")
+	tx3 := newTestMempoolTx("03", Outpoint{"f3", 0}, "a1")
+	chain := &testMempoolChain{parser: &testMempoolParser{}, txs: map[string]*Tx{"01": tx1, "02": tx2}}
+	m := &MempoolBitcoinType{
+		BaseMempool: BaseMempool{
+			chain:        chain,
+			txEntries:    make(map[string]txEntry),
+			addrDescToTx: make(map[string][]Outpoint),
+		},
+		children:       make(map[string][]string),
+		spentOutpoints: make(map[Outpoint]string),
+	}
+	m.AddrDescForOutpoint = func(outpoint Outpoint) (AddressDescriptor, *big.Int) {
+		return AddressDescriptor{0xf0, byte(outpoint.Vout)}, big.NewInt(5000)
+	}
+	chanInput := make(chan chanInputPayload, 1)
+	chanResult := make(chan *addrIndex, 1)
+	go func() {
+		for payload := range chanInput {
+			chanResult <- m.getInputAddress(&payload)
+		}
+	}()
+	defer close(chanInput)
+
+	addrTxs := func(addrDesc string) []Outpoint {
+		o, _ := m.GetAddrDescTransactions(AddressDescriptor(addrDesc))
+		return o
+	}
+
+	// tx1 arrives raw with mempool add message, tx2 only as mempool add message, it must be fetched from the chain
+	m.processUpdate(&mempoolUpdate{tx: tx1, txid: tx1.Txid}, chanInput, chanResult)
+	m.processUpdate(&mempoolUpdate{txid: tx1.Txid, label: MQSequenceMempoolAdd}, chanInput, chanResult)
+	m.processUpdate(&mempoolUpdate{txid: tx2.Txid, label: MQSequenceMempoolAdd}, chanInput, chanResult)
+	if len(m.txEntries) != 2 || len(m.pendingRawTxs) != 0 {
+		t.Fatalf("got %d entries and %d pending txs, want 2 and 0", len(m.txEntries), len(m.pendingRawTxs))
+	}
+	if got, want := addrTxs("\xa1"), []Outpoint{{"01", 0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("a1 outpoints = %+v, want %+v", got, want)
+	}
+	if got, want := addrTxs("\xf0\x01"), []Outpoint{{"02", ^int32(1)}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("f001 outpoints = %+v, want %+v", got, want)
+	}
+
+	// tx2 removed from mempool, tx1 and tx3 confirmed in a block
+	m.processUpdate(&mempoolUpdate{txid: tx2.Txid, label: MQSequenceMempoolRemove}, chanInput, chanResult)
+	if _, found := m.txEntries[tx2.Txid]; found || len(addrTxs("\xa3")) != 0 {
+		t.Errorf("tx 02 not removed from mempool")
+	}
+	m.processUpdate(&mempoolUpdate{tx: tx1, txid: tx1.Txid}, chanInput, chanResult)
+	m.processUpdate(&mempoolUpdate{tx: tx3, txid: tx3.Txid}, chanInput, chanResult)
+	m.processUpdate(&mempoolUpdate{txid: "b1", label: MQSequenceBlockConnected}, chanInput, chanResult)
+	if len(m.txEntries) != 0 || len(m.addrDescToTx) != 0 || len(m.pendingRawTxs) != 0 {
+		t.Errorf("mempool not empty after block connected: %+v, %+v, %d pending txs", m.txEntries, m.addrDescToTx, len(m.pendingRawTxs))
+	}
+}
+
+func TestParseMQSequence(t *testing.T) {
+	hash := "00000000000000000001c7d1b0dd6b4b1e1bf6a8e1f4ab7f7b9e4a1c2d3e4f50"
+	b, _ := hex.DecodeString(hash)
+	body := append(append(b, 'A'), 7, 0, 0, 0, 0, 0, 0, 0)
+	gotHash, label, seq, err := ParseMQSequence(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotHash != hash || label != MQSequenceMempoolAdd || seq != 7 {
+		t.Errorf("ParseMQSequence() = %v, %c, %v", gotHash, label, seq)
+	}
+	if _, label, _, err = ParseMQSequence(append(b, 'C')); err != nil || label != MQSequenceBlockConnected {
+		t.Errorf("ParseMQSequence() = %c, %v", label, err)
+	}
+	if _, _, _, err = ParseMQSequence(b); err == nil {
+		t.Error("ParseMQSequence() expected error for invalid length")
+	}
+}
+
+func TestMempoolBitcoinType_GetTxPackage(t *testing.T) {
+	m := &MempoolBitcoinType{
+		BaseMempool: BaseMempool{
+			txEntries:    make(map[string]txEntry),
+			addrDescToTx: make(map[string][]Outpoint),
+		},
+		children:       make(map[string][]string),
+		spentOutpoints: make(map[Outpoint]string),
+	}
+	relations := func(fee, vsize int64, parents ...string) *txRelations {
+		r := &txRelations{vsize: vsize, parents: parents}
+		r.fee.SetInt64(fee)
+		return r
+	}
+	entry := func(r *txRelations) txEntry {
+		return txEntry{addrIndexes: []addrIndex{{addrDesc: "\xa1"}}, relations: r}
+	}
+	// child 03 is added before its parent 02, 04 pays for 02 and 01
+	m.addEntry("01", entry(relations(100, 100)))
+	m.addEntry("03", entry(relations(50, 100, "02")))
+	m.addEntry("02", entry(relations(100, 100, "01")))
+	m.addEntry("04", entry(relations(5000, 100, "02")))
+	p := m.GetTxPackage("02")
+	if p == nil {
+		t.Fatal("GetTxPackage() returned nil")
+	}
+	if p.AncestorCount != 2 || p.AncestorVSize != 200 || p.AncestorFees.Int64() != 200 {
+		t.Errorf("ancestors = %d, %d, %v", p.AncestorCount, p.AncestorVSize, p.AncestorFees.String())
+	}
+	if p.DescendantCount != 3 || p.DescendantVSize != 300 || p.DescendantFees.Int64() != 5150 {
+		t.Errorf("descendants = %d, %d, %v", p.DescendantCount, p.DescendantVSize, p.DescendantFees.String())
+	}
+	if p.EffectiveVSize != 300 || p.EffectiveFees.Int64() != 5200 {
+		t.Errorf("effective package = %d, %v", p.EffectiveVSize, p.EffectiveFees.String())
+	}
+	if !reflect.DeepEqual(p.Parents, []string{"01"}) || !reflect.DeepEqual(p.Children, []string{"03", "04"}) {
+		t.Errorf("parents %v, children %v", p.Parents, p.Children)
+	}
+	m.removeEntry("04")
+	if p = m.GetTxPackage("02"); p.DescendantCount != 2 || p.EffectiveFees.Int64() != 200 {
+		t.Errorf("after remove descendants = %d, effective fees %v", p.DescendantCount, p.EffectiveFees.String())
+	}
+	if m.GetTxPackage("05") != nil {
+		t.Error("GetTxPackage() of unknown tx is not nil")
+	}
+}
+
+func TestMempoolBitcoinType_resolveRemovals(t *testing.T) {
+	tx1 := newTestMempoolTx("01", Outpoint{"f1", 0}, "a1")
+	tx2 := newTestMempoolTx("02", Outpoint{"01", 0}, "a2")
+	tx3 := newTestMempoolTx("03", Outpoint{"f3", 0}, "a3")
+	tx4 := newTestMempoolTx("04", Outpoint{"f4", 0}, "a4")
+	tx5 := newTestMempoolTx("05", Outpoint{"f1", 0}, "a5")
+	tx6 := newTestMempoolTx("06", Outpoint{"f6", 0}, "a6")
+	tx7 := newTestMempoolTx("07", Outpoint{"f6", 0}, "a7")
+	chain := &testMempoolChain{parser: &testMempoolParser{}, txs: map[string]*Tx{"01": tx1, "02": tx2, "03": tx3, "04": tx4, "06": tx6}}
+	m := &MempoolBitcoinType{
+		BaseMempool: BaseMempool{
+			chain:        chain,
+			txEntries:    make(map[string]txEntry),
+			addrDescToTx: make(map[string][]Outpoint),
+		},
+		children:       make(map[string][]string),
+		spentOutpoints: make(map[Outpoint]string),
+	}
+	var notified []string
+	m.OnTxRemoved = func(r *MempoolTxRemoval) {
+		notified = append(notified, r.Txid)
+	}
+	// only the outputs of the "f" transactions are confirmed
+	m.AddrDescForOutpoint = func(outpoint Outpoint) (AddressDescriptor, *big.Int) {
+		if outpoint.Txid[0] != 'f' {
+			return nil, nil
+		}
+		return AddressDescriptor{0xf0}, big.NewInt(5000)
+	}
+	chanInput := make(chan chanInputPayload, 1)
+	chanResult := make(chan *addrIndex, 1)
+	go func() {
+		for payload := range chanInput {
+			chanResult <- m.getInputAddress(&payload)
+		}
+	}()
+	defer close(chanInput)
+	update := func(u mempoolUpdate) {
+		m.processUpdate(&u, chanInput, chanResult)
+	}
+	for _, txid := range []string{"01", "02", "03", "04", "06"} {
+		update(mempoolUpdate{txid: txid, label: MQSequenceMempoolAdd})
+	}
+
+	// 01 is replaced by 05, its child 02 is removed with it
+	update(mempoolUpdate{txid: "01", label: MQSequenceMempoolRemove})
+	update(mempoolUpdate{txid: "02", label: MQSequenceMempoolRemove})
+	if len(notified) != 0 {
+		t.Fatalf("notified %v before the replacement arrived", notified)
+	}
+	update(mempoolUpdate{tx: tx5, txid: "05"})
+	update(mempoolUpdate{txid: "05", label: MQSequenceMempoolAdd})
+	// 04 is evicted, 06 conflicts with 07 from the block, in which 03 is confirmed
+	update(mempoolUpdate{txid: "04", label: MQSequenceMempoolRemove})
+	update(mempoolUpdate{txid: "06", label: MQSequenceMempoolRemove})
+	update(mempoolUpdate{tx: tx3, txid: "03"})
+	update(mempoolUpdate{tx: tx7, txid: "07"})
+	update(mempoolUpdate{txid: "b1", label: MQSequenceBlockConnected})
+	if len(m.unresolvedRemovals) != 1 || m.unresolvedRemovals[0].txid != "04" {
+		t.Fatalf("unresolved removals %+v, want 04", m.unresolvedRemovals)
+	}
+	m.unresolvedRemovals[0].time = m.unresolvedRemovals[0].time.Add(-removalResolvePeriod)
+	m.resolveRemovals(nil, nil)
+
+	type removal struct {
+		txid, conflicting string
+		reason            MempoolRemovalReason
+	}
+	var got []removal
+	for _, r := range m.GetRemovedTransactions() {
+		got = append(got, removal{r.Txid, r.ConflictingTxid, r.Reason})
+	}
+	want := []removal{
+		{"04", "", MempoolRemovalEvicted},
+		{"03", "", MempoolRemovalConfirmed},
+		{"06", "07", MempoolRemovalConflicted},
+		{"02", "05", MempoolRemovalConflicted},
+		{"01", "05", MempoolRemovalConflicted},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetRemovedTransactions() = %+v, want %+v", got, want)
+	}
+	if len(notified) != len(want) {
+		t.Errorf("notified %v", notified)
+	}
+	if len(m.txEntries) != 1 || len(m.spentOutpoints) != 1 || m.spentOutpoints[Outpoint{"f1", 0}] != "05" {
+		t.Errorf("mempool contains %+v, spent outpoints %+v", m.txEntries, m.spentOutpoints)
+	}
+}
+
+// newTestFeeRateTxs returns transactions 01 to 04 with fee rates 40000, 30000, 20000 and 10000 sat/kvB
+func newTestFeeRateTxs() map[string]*Tx {
+	txs := make(map[string]*Tx)
+	for i, fee := range []int64{4000, 3000, 2000, 1000} {
+		txid := string([]byte{'0', byte('1' + i)})
+		tx := newTestMempoolTx(txid, Outpoint{"f" + txid, 0}, "a"+txid[1:])
+		tx.Vout[0].ValueSat.SetInt64(5000 - fee)
+		tx.Hex = strings.Repeat("00", 100)
+		txs[txid] = tx
+	}
+	return txs
+}
+
+func newTestLimitedMempool(chain BlockChain, maxTrackedTxs int) *MempoolBitcoinType {
+	m := NewMempoolBitcoinType(chain, 1, 1, maxTrackedTxs)
+	m.AddrDescForOutpoint = func(outpoint Outpoint) (AddressDescriptor, *big.Int) {
+		return AddressDescriptor{0xf0}, big.NewInt(5000)
+	}
+	return m
+}
+
+func trackedTxs(m *MempoolBitcoinType) (full []string, light []string) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for txid := range m.txEntries {
+		full = append(full, txid)
+	}
+	for txid := range m.lightEntries {
+		light = append(light, txid)
+	}
+	sort.Strings(full)
+	sort.Strings(light)
+	return
+}
+
+func TestMempoolBitcoinType_limitTrackedTxs(t *testing.T) {
+	chain := &testMempoolChain{parser: &testMempoolParser{}, txs: newTestFeeRateTxs(), mempool: []string{"03", "01", "02"}}
+	m := newTestLimitedMempool(chain, 2)
+	tracked := func() ([]string, []string) {
+		return trackedTxs(m)
+	}
+	check := func(wantCount int, wantFull, wantLight []string) {
+		t.Helper()
+		count, err := m.Resync()
+		if err != nil {
+			t.Fatal(err)
+		}
+		full, light := tracked()
+		if count != wantCount || !reflect.DeepEqual(full, wantFull) || !reflect.DeepEqual(light, wantLight) {
+			t.Errorf("Resync() = %d, full %v, light %v, want %d, %v, %v", count, full, light, wantCount, wantFull, wantLight)
+		}
+	}
+
+	// 03 with the lowest fee rate over the limit is tracked only by txid
+	check(3, []string{"01", "02"}, []string{"03"})
+	if o, _ := m.GetAddrDescTransactions(AddressDescriptor("\xa3")); len(o) != 0 {
+		t.Errorf("lightweight transaction returned by address query %+v", o)
+	}
+	if len(m.GetAllEntries()) != 3 || m.GetTransactionTime("03") == 0 {
+		t.Error("lightweight transaction missing in mempool entries")
+	}
+	// 04 with low fee rate is not resolved at all
+	chain.mempool = append(chain.mempool, "04")
+	check(4, []string{"01", "02"}, []string{"03", "04"})
+	// after 01 is removed, the lightweight transaction with the highest fee rate is resolved
+	chain.mempool = []string{"02", "03", "04"}
+	time.Sleep(time.Second)
+	check(3, []string{"02", "03"}, []string{"04"})
+	if o, _ := m.GetAddrDescTransactions(AddressDescriptor("\xa3")); !reflect.DeepEqual(o, []Outpoint{{"03", 0}}) {
+		t.Errorf("resolved transaction not returned by address query %+v", o)
+	}
+	if stats := m.GetStats(); stats.Txs != 2 || stats.LightTxs != 1 || stats.MemoryBytes == 0 {
+		t.Errorf("GetStats() = %+v", stats)
+	}
+}
+
+func TestMempoolBitcoinType_processUpdateLimit(t *testing.T) {
+	chain := &testMempoolChain{parser: &testMempoolParser{}, txs: newTestFeeRateTxs()}
+	m := newTestLimitedMempool(chain, 2)
+	chanInput := make(chan chanInputPayload, 1)
+	chanResult := make(chan *addrIndex, 1)
+	go func() {
+		for payload := range chanInput {
+			chanResult <- m.getInputAddress(&payload)
+		}
+	}()
+	defer close(chanInput)
+	for _, txid := range []string{"03", "02", "01", "04"} {
+		m.processUpdate(&mempoolUpdate{txid: txid, label: MQSequenceMempoolAdd}, chanInput, chanResult)
+	}
+	// 03 is converted to the lightweight form when 01 is added, 04 is not resolved at all
+	full, light := trackedTxs(m)
+	if want := []string{"01", "02"}; !reflect.DeepEqual(full, want) {
+		t.Errorf("fully tracked %v, want %v", full, want)
+	}
+	if want := []string{"03", "04"}; !reflect.DeepEqual(light, want) {
+		t.Errorf("lightweight %v, want %v", light, want)
+	}
+}
+
+func TestMempoolBitcoinType_evictTrackedTxs(t *testing.T) {
+	// the raw transactions are not fetched from the backend, the fee rates are computed from the indexed inputs
+	chain := &testMempoolChain{parser: &testMempoolParser{}}
+	m := newTestLimitedMempool(chain, 20)
+	chanInput := make(chan chanInputPayload, 1)
+	chanResult := make(chan *addrIndex, 1)
+	go func() {
+		for payload := range chanInput {
+			chanResult <- m.getInputAddress(&payload)
+		}
+	}()
+	defer close(chanInput)
+	// transaction tNN has fee rate NN*1000 sat/kvB
+	add := func(n int) {
+		txid := fmt.Sprintf("t%02d", n)
+		tx := newTestMempoolTx(txid, Outpoint{"f" + txid, 0}, "a1")
+		tx.Vout[0].ValueSat.SetInt64(5000 - int64(n)*100)
+		tx.Hex = strings.Repeat("00", 100)
+		m.processUpdate(&mempoolUpdate{tx: tx, txid: txid}, chanInput, chanResult)
+		m.processUpdate(&mempoolUpdate{txid: txid, label: MQSequenceMempoolAdd}, chanInput, chanResult)
+	}
+	check := func(wantFull int, wantLight []string) {
+		t.Helper()
+		full, light := trackedTxs(m)
+		if len(full) != wantFull || !reflect.DeepEqual(light, wantLight) {
+			t.Errorf("fully tracked %d, light %v, want %d, %v", len(full), light, wantFull, wantLight)
+		}
+	}
+	for n := 10; n <= 30; n++ {
+		add(n)
+	}
+	// the limit is exceeded by t30, the transactions are evicted down to the limit minus the slack of 2
+	check(18, []string{"t10", "t11", "t12"})
+	// the slack is filled without eviction, transactions with fee rate under the threshold are tracked only by txid
+	add(31)
+	add(5)
+	add(32)
+	check(20, []string{"t05", "t10", "t11", "t12"})
+	add(33)
+	check(18, []string{"t05", "t10", "t11", "t12", "t13", "t14", "t15"})
+}
+
+// testMempoolEntriesChain returns the mempool entries in bulk and records the fetched transactions
+type testMempoolEntriesChain struct {
+	testMempoolChain
+	mux     sync.Mutex
+	fetched []string
+}
+
+func (c *testMempoolEntriesChain) GetTransactionForMempool(txid string) (*Tx, error) {
+	c.mux.Lock()
+	c.fetched = append(c.fetched, txid)
+	c.mux.Unlock()
+	return c.testMempoolChain.GetTransactionForMempool(txid)
+}
+
+func (c *testMempoolEntriesChain) SupportsGetMempoolEntries() bool {
+	return true
+}
+
+func (c *testMempoolEntriesChain) GetMempoolEntries() (map[string]*MempoolEntry, error) {
+	entries := make(map[string]*MempoolEntry, len(c.mempool))
+	for _, txid := range c.mempool {
+		tx, found := c.txs[txid]
+		if !found {
+			return nil, ErrTxNotFound
+		}
+		entries[txid] = newTestMempoolEntry(tx)
+	}
+	return entries, nil
+}
+
+func TestMempoolBitcoinType_ResyncMempoolEntries(t *testing.T) {
+	chain := &testMempoolEntriesChain{
+		testMempoolChain: testMempoolChain{parser: &testMempoolParser{}, txs: newTestFeeRateTxs(), mempool: []string{"04", "03", "02", "01"}},
+	}
+	m := newTestLimitedMempool(chain, 2)
+	count, err := m.Resync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, light := trackedTxs(m)
+	if count != 4 || !reflect.DeepEqual(full, []string{"01", "02"}) || !reflect.DeepEqual(light, []string{"03", "04"}) {
+		t.Errorf("Resync() = %d, full %v, light %v", count, full, light)
+	}
+	// the transactions over the limit are not fetched from the backend
+	sort.Strings(chain.fetched)
+	if want := []string{"01", "02"}; !reflect.DeepEqual(chain.fetched, want) {
+		t.Errorf("fetched transactions %v, want %v", chain.fetched, want)
+	}
+
+	// package of a lightweight transaction is resolved on demand, the transaction stays lightweight
+	p := m.GetTxPackage("03")
+	if p == nil {
+		t.Fatal("GetTxPackage() of lightweight transaction returned nil")
+	}
+	if p.Fee.Int64() != 2000 || p.VSize != 100 || p.AncestorCount != 1 {
+		t.Errorf("GetTxPackage() = %+v", p)
+	}
+	if o, _ := m.GetAddrDescTransactions(AddressDescriptor("\xa3")); len(o) != 0 {
+		t.Errorf("lightweight transaction returned by address query %+v", o)
+	}
+	if _, light = trackedTxs(m); !reflect.DeepEqual(light, []string{"03", "04"}) {
+		t.Errorf("lightweight %v after GetTxPackage()", light)
+	}
+}
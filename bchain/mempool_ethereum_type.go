@@ -114,11 +114,13 @@ func (m *MempoolEthereumType) Resync() (int, error) {
 	m.mux.Lock()
 	entries := len(m.txEntries)
 	now := time.Now()
+	var removals []MempoolTxRemoval
 	if m.nextTimeoutRun.Before(now) {
 		threshold := now.Add(-m.mempoolTimeoutTime)
 		for txid, entry := range m.txEntries {
 			if time.Unix(int64(entry.time), 0).Before(threshold) {
 				m.removeEntryFromMempool(txid, entry)
+				removals = append(removals, m.newTxRemoval(txid, entry, MempoolRemovalEvicted, ""))
 			}
 		}
 		removed := entries - len(m.txEntries)
@@ -127,6 +129,7 @@ func (m *MempoolEthereumType) Resync() (int, error) {
 		m.nextTimeoutRun = now.Add(mempoolTimeoutRunPeriod)
 	}
 	m.mux.Unlock()
+	m.notifyTxRemovals(removals)
 	glog.Info("Mempool: resync ", entries, " transactions in mempool")
 	return entries, nil
 }
@@ -153,15 +156,20 @@ func (m *MempoolEthereumType) AddTransactionToMempool(txid string) {
 	}
 }
 
-// RemoveTransactionFromMempool removes transaction from mempool
+// RemoveTransactionFromMempool removes transaction from mempool, the transaction is removed because it was confirmed
 func (m *MempoolEthereumType) RemoveTransactionFromMempool(txid string) {
 	m.mux.Lock()
 	entry, exists := m.txEntries[txid]
 	if glog.V(1) {
 		glog.Info("RemoveTransactionFromMempool ", txid, ", existed ", exists)
 	}
+	var removal MempoolTxRemoval
 	if exists {
 		m.removeEntryFromMempool(txid, entry)
+		removal = m.newTxRemoval(txid, entry, MempoolRemovalConfirmed, "")
 	}
 	m.mux.Unlock()
+	if exists {
+		m.notifyTxRemovals([]MempoolTxRemoval{removal})
+	}
 }
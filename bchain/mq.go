@@ -3,6 +3,8 @@ package bchain
 import (
 	"context"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/golang/glog"
@@ -11,11 +13,14 @@ import (
 
 // MQ is message queue listener handle
 type MQ struct {
-	context   *zmq.Context
-	socket    *zmq.Socket
-	isRunning bool
-	finished  chan error
-	binding   string
+	context    *zmq.Context
+	socket     *zmq.Socket
+	isRunning  bool
+	finished   chan error
+	binding    string
+	topics     []string
+	onRawTx    OnMQRawTxFunc
+	onSequence OnMQSequenceFunc
 }
 
 // NotificationType is type of notification
@@ -30,9 +35,34 @@ const (
 	NotificationNewTx NotificationType = iota
 )
 
+// labels of the messages of the sequence topic
+const (
+	// MQSequenceBlockConnected is sent when a block is connected
+	MQSequenceBlockConnected = 'C'
+	// MQSequenceBlockDisconnected is sent when a block is disconnected
+	MQSequenceBlockDisconnected = 'D'
+	// MQSequenceMempoolAdd is sent when a transaction is added to mempool
+	MQSequenceMempoolAdd = 'A'
+	// MQSequenceMempoolRemove is sent when a transaction is removed from mempool for other reason than block inclusion
+	MQSequenceMempoolRemove = 'R'
+)
+
+// OnMQRawTxFunc receives the serialized transaction from the rawtx topic
+type OnMQRawTxFunc func(rawTx []byte)
+
+// OnMQSequenceFunc receives the hash (txid or block hash) and the label from the sequence topic
+type OnMQSequenceFunc func(hash string, label byte)
+
 // NewMQ creates new Bitcoind ZeroMQ listener
 // callback function receives messages
 func NewMQ(binding string, callback func(NotificationType)) (*MQ, error) {
+	return NewMQWithRawTx(binding, callback, nil, nil)
+}
+
+// NewMQWithRawTx creates new Bitcoind ZeroMQ listener, which in addition to the hash notifications
+// subscribes to the rawtx and sequence topics, if onRawTx and onSequence handlers are specified
+// Lost messages of the raw topics are reported to callback as NotificationNewTx so that a full mempool resync can be done
+func NewMQWithRawTx(binding string, callback func(NotificationType), onRawTx OnMQRawTxFunc, onSequence OnMQSequenceFunc) (*MQ, error) {
 	context, err := zmq.NewContext()
 	if err != nil {
 		return nil, err
@@ -41,28 +71,48 @@ func NewMQ(binding string, callback func(NotificationType)) (*MQ, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = socket.SetSubscribe("hashblock")
-	if err != nil {
-		return nil, err
+	mq := &MQ{
+		context:  context,
+		socket:   socket,
+		finished: make(chan error),
+		binding:  binding,
+		topics:   []string{"hashblock", "hashtx"},
 	}
-	err = socket.SetSubscribe("hashtx")
-	if err != nil {
-		return nil, err
+	if onRawTx != nil && onSequence != nil {
+		// the mempool is updated incrementally from the raw topics, hashtx is not needed
+		mq.topics = []string{"hashblock", "rawtx", "sequence"}
+		mq.onRawTx = onRawTx
+		mq.onSequence = onSequence
+	}
+	for _, topic := range mq.topics {
+		err = socket.SetSubscribe(topic)
+		if err != nil {
+			return nil, err
+		}
 	}
-	// for now do not use raw subscriptions - we would have to handle skipped/lost notifications from zeromq
-	// on each notification we do sync or syncmempool respectively
-	// socket.SetSubscribe("rawblock")
-	// socket.SetSubscribe("rawtx")
 	err = socket.Connect(binding)
 	if err != nil {
 		return nil, err
 	}
-	glog.Info("MQ listening to ", binding)
-	mq := &MQ{context, socket, true, make(chan error), binding}
+	glog.Info("MQ listening to ", binding, ", topics ", mq.topics)
+	mq.isRunning = true
 	go mq.run(callback)
 	return mq, nil
 }
 
+// ParseMQSequence parses the body of the message of the sequence topic
+// the format is <32 byte hash in reversed byte order>|<1 byte label>|<optional 8 byte LE mempool sequence>
+func ParseMQSequence(body []byte) (string, byte, uint64, error) {
+	if len(body) != 33 && len(body) != 41 {
+		return "", 0, 0, errors.New("invalid sequence message length")
+	}
+	var mempoolSequence uint64
+	if len(body) == 41 {
+		mempoolSequence = binary.LittleEndian.Uint64(body[33:])
+	}
+	return hex.EncodeToString(body[:32]), body[32], mempoolSequence, nil
+}
+
 func (mq *MQ) run(callback func(NotificationType)) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -74,6 +124,7 @@ func (mq *MQ) run(callback func(NotificationType)) {
 	}()
 	mq.isRunning = true
 	repeatedError := false
+	lastSequences := make(map[string]uint32)
 	for {
 		msg, err := mq.socket.RecvMessageBytes(0)
 		if err != nil {
@@ -93,26 +144,42 @@ func (mq *MQ) run(callback func(NotificationType)) {
 			repeatedError = false
 		}
 		if msg != nil && len(msg) >= 3 {
-			var nt NotificationType
-			switch string(msg[0]) {
+			topic := string(msg[0])
+			sequence := uint32(0)
+			if len(msg[len(msg)-1]) == 4 {
+				sequence = binary.LittleEndian.Uint32(msg[len(msg)-1])
+			}
+			if mq.onRawTx != nil {
+				// each topic has its own message sequence, a gap means lost messages
+				// and the mempool must be resynchronized
+				if last, ok := lastSequences[topic]; ok && sequence != last+1 {
+					glog.Warningf("MQ: lost messages of topic %s, sequence %d, expected %d", topic, sequence, last+1)
+					callback(NotificationNewTx)
+				}
+				lastSequences[topic] = sequence
+			}
+			switch topic {
 			case "hashblock":
-				nt = NotificationNewBlock
-				break
+				glog.V(2).Infof("MQ: %v %s-%d", NotificationNewBlock, topic, sequence)
+				callback(NotificationNewBlock)
 			case "hashtx":
-				nt = NotificationNewTx
-				break
-			default:
-				nt = NotificationUnknown
-				glog.Infof("MQ: NotificationUnknown %v", string(msg[0]))
-			}
-			if glog.V(2) {
-				sequence := uint32(0)
-				if len(msg[len(msg)-1]) == 4 {
-					sequence = binary.LittleEndian.Uint32(msg[len(msg)-1])
+				glog.V(2).Infof("MQ: %v %s-%d", NotificationNewTx, topic, sequence)
+				callback(NotificationNewTx)
+			case "rawtx":
+				glog.V(2).Infof("MQ: %s-%d", topic, sequence)
+				mq.onRawTx(msg[1])
+			case "sequence":
+				hash, label, _, err := ParseMQSequence(msg[1])
+				if err != nil {
+					glog.Error("MQ: sequence ", err)
+					continue
 				}
-				glog.Infof("MQ: %v %s-%d", nt, string(msg[0]), sequence)
+				glog.V(2).Infof("MQ: %s-%d %c %s", topic, sequence, label, hash)
+				mq.onSequence(hash, label)
+			default:
+				glog.Infof("MQ: NotificationUnknown %v", topic)
+				callback(NotificationUnknown)
 			}
-			callback(nt)
 		}
 	}
 }
@@ -123,13 +190,11 @@ func (mq *MQ) Shutdown(ctx context.Context) error {
 	if mq.isRunning {
 		go func() {
 			// if errors in the closing sequence, let it close ungracefully
-			if err := mq.socket.SetUnsubscribe("hashtx"); err != nil {
-				mq.finished <- err
-				return
-			}
-			if err := mq.socket.SetUnsubscribe("hashblock"); err != nil {
-				mq.finished <- err
-				return
+			for _, topic := range mq.topics {
+				if err := mq.socket.SetUnsubscribe(topic); err != nil {
+					mq.finished <- err
+					return
+				}
 			}
 			if err := mq.socket.Unbind(mq.binding); err != nil {
 				mq.finished <- err
@@ -117,6 +117,8 @@ type MempoolTx struct {
 type Block struct {
 	BlockHeader
 	Txs []Tx `json:"tx"`
+	// RawHeader is the serialized header of the block, binary for Bitcoin-type and json for Ethereum-type coins, nil if the backend does not provide it
+	RawHeader []byte `json:"-"`
 }
 
 // BlockHeader contains limited data (as needed for indexing) from backend block header
@@ -159,20 +161,100 @@ type MempoolEntry struct {
 	Depends         []string          `json:"depends"`
 }
 
+// MempoolTxPackage contains fee data of a mempool transaction and of its in-mempool ancestors and descendants,
+// as needed for CPFP (child pays for parent); ancestor and descendant data include the transaction itself
+type MempoolTxPackage struct {
+	VSize           int64
+	Fee             big.Int
+	AncestorCount   int
+	AncestorVSize   int64
+	AncestorFees    big.Int
+	DescendantCount int
+	DescendantVSize int64
+	DescendantFees  big.Int
+	// effective package is the package with the highest fee rate, in which the transaction can be mined,
+	// i.e. its ancestors or ancestors of one of its descendants
+	EffectiveVSize int64
+	EffectiveFees  big.Int
+	Parents        []string
+	Children       []string
+}
+
+// MempoolRemovalReason is the inferred reason of the removal of a transaction from mempool
+type MempoolRemovalReason string
+
+const (
+	// MempoolRemovalConfirmed - the transaction was included in a block
+	MempoolRemovalConfirmed = MempoolRemovalReason("confirmed")
+	// MempoolRemovalConflicted - the transaction was replaced or conflicted by another transaction spending the same outputs
+	MempoolRemovalConflicted = MempoolRemovalReason("conflicted")
+	// MempoolRemovalEvicted - the transaction expired or was evicted by the backend, for example due to the mempool size limit
+	MempoolRemovalEvicted = MempoolRemovalReason("evicted")
+)
+
+// MempoolTxRemoval contains information about a transaction removed from mempool
+type MempoolTxRemoval struct {
+	Txid   string
+	Reason MempoolRemovalReason
+	// ConflictingTxid is the transaction spending the same outputs, if it is known
+	ConflictingTxid string
+	Time            uint32
+	AddrDescs       []AddressDescriptor
+}
+
+// MempoolStats contains the number of transactions tracked by mempool and the estimate of the memory used by them
+type MempoolStats struct {
+	// Txs is the number of fully tracked transactions, LightTxs of transactions tracked only by txid
+	Txs         int
+	LightTxs    int
+	AddrDescs   int
+	MemoryBytes int64
+}
+
+// ReorgTxStatus is the status of a transaction from a disconnected block after the reorganization
+type ReorgTxStatus string
+
+const (
+	// ReorgTxConfirmed - the transaction is included in the new chain
+	ReorgTxConfirmed = ReorgTxStatus("confirmed")
+	// ReorgTxMempool - the transaction returned to mempool
+	ReorgTxMempool = ReorgTxStatus("mempool")
+	// ReorgTxVanished - the transaction is neither in the new chain nor in mempool
+	ReorgTxVanished = ReorgTxStatus("vanished")
+)
+
+// ReorgTx contains a transaction of a disconnected block and the addresses it affects
+type ReorgTx struct {
+	Txid      string
+	Status    ReorgTxStatus
+	AddrDescs []AddressDescriptor
+}
+
+// Reorg contains information about a chain reorganization
+type Reorg struct {
+	// ForkHeight and ForkHash identify the last block common to the disconnected and the new chain
+	ForkHeight uint32
+	ForkHash   string
+	// DisconnectedHashes are the hashes of the disconnected blocks, starting from the former tip
+	DisconnectedHashes []string
+	Txs                []ReorgTx
+}
+
 // ChainInfo is used to get information about blockchain
 type ChainInfo struct {
-	Chain           string      `json:"chain"`
-	Blocks          int         `json:"blocks"`
-	Headers         int         `json:"headers"`
-	Bestblockhash   string      `json:"bestblockhash"`
-	Difficulty      string      `json:"difficulty"`
-	SizeOnDisk      int64       `json:"size_on_disk"`
-	Version         string      `json:"version"`
-	Subversion      string      `json:"subversion"`
-	ProtocolVersion string      `json:"protocolversion"`
-	Timeoffset      float64     `json:"timeoffset"`
-	Warnings        string      `json:"warnings"`
-	Consensus       interface{} `json:"consensus,omitempty"`
+	Chain           string                   `json:"chain"`
+	Blocks          int                      `json:"blocks"`
+	Headers         int                      `json:"headers"`
+	Bestblockhash   string                   `json:"bestblockhash"`
+	Difficulty      string                   `json:"difficulty"`
+	SizeOnDisk      int64                    `json:"size_on_disk"`
+	Version         string                   `json:"version"`
+	Subversion      string                   `json:"subversion"`
+	ProtocolVersion string                   `json:"protocolversion"`
+	Timeoffset      float64                  `json:"timeoffset"`
+	Warnings        string                   `json:"warnings"`
+	Consensus       interface{}              `json:"consensus,omitempty"`
+	Endpoints       []common.BackendEndpoint `json:"-"`
 }
 
 // RPCError defines rpc error returned by backend
@@ -234,6 +316,9 @@ const (
 	P2SHWPKH
 	P2WPKH
 	P2TR
+	P2SH
+	P2SHWSH
+	P2WSH
 )
 
 // XpubDescriptor contains parsed data from xpub descriptor
@@ -244,6 +329,35 @@ type XpubDescriptor struct {
 	Bip            string
 	ChangeIndexes  []uint32
 	ExtKey         interface{} // extended key parsed from xpub, usually of type *hdkeychain.ExtendedKey
+	Fingerprint    string      // fingerprint of the master key from the key origin, e.g. d34db33f from [d34db33f/84'/0'/0']
+	OriginPath     string      // derivation path of the xpub from the key origin, e.g. m/84'/0'/0'
+	// multisig descriptors (multi, sortedmulti), Xpub and ExtKey contain the first key
+	Xpubs        []string      // all xpubs of the multisig descriptor in the order of the descriptor
+	ExtKeys      []interface{} // extended keys parsed from Xpubs
+	Fingerprints []string      // key origin fingerprints of Xpubs, empty string if the key has no origin
+	OriginPaths  []string      // key origin paths of Xpubs, empty string if the key has no origin
+	Threshold    int           // number of signatures required by the multisig script
+	Sorted       bool          // sortedmulti, the public keys in the script are sorted lexicographically
+}
+
+// XpubPsbtInput is an input of a PSBT spending an output of an address derived from xpub
+type XpubPsbtInput struct {
+	Txid     string
+	Vout     uint32
+	ValueSat big.Int
+	AddrDesc AddressDescriptor
+	Change   uint32
+	Index    uint32
+	PrevTx   []byte // serialized previous transaction, required by non segwit inputs
+}
+
+// XpubPsbtOutput is an output of a PSBT, the change output is derived from xpub
+type XpubPsbtOutput struct {
+	AddrDesc AddressDescriptor
+	ValueSat big.Int
+	IsChange bool
+	Change   uint32
+	Index    uint32
 }
 
 // MempoolTxidEntries is array of MempoolTxidEntry
@@ -252,12 +366,18 @@ type MempoolTxidEntries []MempoolTxidEntry
 // OnNewBlockFunc is used to send notification about a new block
 type OnNewBlockFunc func(hash string, height uint32)
 
+// OnReorgFunc is used to send notification about a chain reorganization
+type OnReorgFunc func(reorg *Reorg)
+
 // OnNewTxAddrFunc is used to send notification about a new transaction/address
 type OnNewTxAddrFunc func(tx *Tx, desc AddressDescriptor)
 
 // OnNewTxFunc is used to send notification about a new transaction/address
 type OnNewTxFunc func(tx *MempoolTx)
 
+// OnTxRemovedFunc is used to send notification about a transaction removed from mempool
+type OnTxRemovedFunc func(removal *MempoolTxRemoval)
+
 // AddrDescForOutpointFunc returns address descriptor and value for given outpoint or nil if outpoint not found
 type AddrDescForOutpointFunc func(outpoint Outpoint) (AddressDescriptor, *big.Int)
 
@@ -269,7 +389,7 @@ type BlockChain interface {
 	// create mempool but do not initialize it
 	CreateMempool(BlockChain) (Mempool, error)
 	// initialize mempool, create ZeroMQ (or other) subscription
-	InitializeMempool(AddrDescForOutpointFunc, OnNewTxAddrFunc, OnNewTxFunc) error
+	InitializeMempool(AddrDescForOutpointFunc, OnNewTxAddrFunc, OnNewTxFunc, OnTxRemovedFunc) error
 	// shutdown mempool, ZeroMQ and block chain connections
 	Shutdown(ctx context.Context) error
 	// chain info
@@ -304,6 +424,91 @@ type BlockChain interface {
 	EthereumTypeGetErc20ContractBalance(addrDesc, contractDesc AddressDescriptor) (*big.Int, error)
 }
 
+// BlockSource is an alternative source of blocks used in the initial synchronization instead of the backend RPC
+type BlockSource interface {
+	// GetBlock returns block with given hash and height or ErrBlockNotFound if the block is not available in the source
+	GetBlock(hash string, height uint32) (*Block, error)
+}
+
+// BlockHeaderRawGetter is implemented by backends, which are able to return the serialized block header
+type BlockHeaderRawGetter interface {
+	// GetBlockHeaderRaw returns the header of the block with given hash in the format of Block.RawHeader
+	GetBlockHeaderRaw(hash string) ([]byte, error)
+}
+
+// TransactionBatcher is implemented by backends, which are able to get multiple transactions in one round-trip
+// The transactions are returned in the order of txids, errs contains the error of each transaction
+type TransactionBatcher interface {
+	// TransactionBatchSize returns the maximum number of transactions fetched in one round-trip, batching is disabled if it is less than 2
+	TransactionBatchSize() int
+	// GetTransactionsForMempool returns transactions as GetTransactionForMempool
+	GetTransactionsForMempool(txids []string) (txs []*Tx, errs []error)
+	// GetTransactions returns transactions as GetTransaction
+	GetTransactions(txids []string) (txs []*Tx, errs []error)
+}
+
+// TransactionBatchSize returns the transaction batch size of the chain, 0 if the chain does not support batching
+func TransactionBatchSize(chain BlockChain) int {
+	if tb, ok := chain.(TransactionBatcher); ok {
+		return tb.TransactionBatchSize()
+	}
+	return 0
+}
+
+// MempoolEntriesGetter is implemented by backends, which are able to return the data of all mempool entries in one call
+type MempoolEntriesGetter interface {
+	// SupportsGetMempoolEntries returns true if the backend returns the mempool entries in bulk
+	SupportsGetMempoolEntries() bool
+	// GetMempoolEntries returns the data of all mempool transactions indexed by txid
+	GetMempoolEntries() (map[string]*MempoolEntry, error)
+}
+
+// MempoolAcceptResult is the result of the test of the acceptance of a transaction to the mempool of the backend
+type MempoolAcceptResult struct {
+	Txid         string
+	Allowed      bool
+	RejectReason string
+	VSize        int64
+	Fee          big.Int
+}
+
+// MempoolAcceptTester is implemented by backends, which are able to test the acceptance of a transaction to the mempool without broadcasting it
+type MempoolAcceptTester interface {
+	// SupportsTestMempoolAccept returns true if the test is supported by the backend
+	SupportsTestMempoolAccept() bool
+	// TestMempoolAccept tests if the raw transaction would be accepted to the mempool
+	TestMempoolAccept(tx string) (*MempoolAcceptResult, error)
+}
+
+// SupportsTestMempoolAccept returns true if the chain is able to test the acceptance of a transaction to the mempool
+func SupportsTestMempoolAccept(chain BlockChain) bool {
+	if t, ok := chain.(MempoolAcceptTester); ok {
+		return t.SupportsTestMempoolAccept()
+	}
+	return false
+}
+
+// TxRelayPolicy contains the limits of the relay policy of the backend used in the local checks of the transactions before broadcast
+// the fee rates are in satoshis per 1000 vbytes, the checks with zero limits are disabled
+type TxRelayPolicy struct {
+	// DustRelayFeePerKb is the fee rate used to compute the dust threshold of the outputs
+	DustRelayFeePerKb int64
+	// MinRelayFeePerKb is the minimal fee rate of the relayed transactions
+	MinRelayFeePerKb int64
+	// MaxFeePerKb is the fee rate above which the fee is considered absurd
+	MaxFeePerKb int64
+}
+
+// TxRelayPolicyGetter is implemented by backends, which know the relay policy of the backend from the configuration
+type TxRelayPolicyGetter interface {
+	GetTxRelayPolicy() *TxRelayPolicy
+}
+
+// TxVSizeParser is implemented by parsers, which are able to compute virtual size (as defined by BIP141) of a transaction
+type TxVSizeParser interface {
+	GetTxVSize(tx *Tx) (int64, error)
+}
+
 // BlockChainParser defines common interface to parsing and conversions of block chain data
 type BlockChainParser interface {
 	// type of the blockchain
@@ -326,6 +531,7 @@ type BlockChainParser interface {
 	GetAddressesFromAddrDesc(addrDesc AddressDescriptor) ([]string, bool, error)
 	GetScriptFromAddrDesc(addrDesc AddressDescriptor) ([]byte, error)
 	IsAddrDescIndexable(addrDesc AddressDescriptor) bool
+	IsAddrDescStandard(addrDesc AddressDescriptor) bool
 	// transactions
 	PackedTxidLen() int
 	PackTxid(txid string) ([]byte, error)
@@ -344,6 +550,7 @@ type BlockChainParser interface {
 	DerivationBasePath(descriptor *XpubDescriptor) (string, error)
 	DeriveAddressDescriptors(descriptor *XpubDescriptor, change uint32, indexes []uint32) ([]AddressDescriptor, error)
 	DeriveAddressDescriptorsFromTo(descriptor *XpubDescriptor, change uint32, fromIndex uint32, toIndex uint32) ([]AddressDescriptor, error)
+	CreateXpubPsbt(descriptor *XpubDescriptor, inputs []XpubPsbtInput, outputs []XpubPsbtOutput) ([]byte, error)
 	// EthereumType specific
 	EthereumTypeGetErc20FromTx(tx *Tx) ([]Erc20Transfer, error)
 }
@@ -355,4 +562,7 @@ type Mempool interface {
 	GetAddrDescTransactions(addrDesc AddressDescriptor) ([]Outpoint, error)
 	GetAllEntries() MempoolTxidEntries
 	GetTransactionTime(txid string) uint32
+	GetTxPackage(txid string) *MempoolTxPackage
+	GetRemovedTransactions() []MempoolTxRemoval
+	GetStats() MempoolStats
 }
@@ -22,6 +22,7 @@ import (
 	"github.com/trezor/blockbook/api"
 	"github.com/trezor/blockbook/bchain"
 	"github.com/trezor/blockbook/bchain/coins"
+	"github.com/trezor/blockbook/bchain/coins/btc"
 	"github.com/trezor/blockbook/common"
 	"github.com/trezor/blockbook/db"
 	"github.com/trezor/blockbook/fiat"
@@ -52,19 +53,24 @@ var (
 	blockUntil     = flag.Int("blockuntil", -1, "height of the final block")
 	rollbackHeight = flag.Int("rollback", -1, "rollback to the given height and quit")
 
-	synchronize = flag.Bool("sync", false, "synchronizes until tip, if together with zeromq, keeps index synchronized")
-	repair      = flag.Bool("repair", false, "repair the database")
-	fixUtxo     = flag.Bool("fixutxo", false, "check and fix utxo db and exit")
-	prof        = flag.String("prof", "", "http server binding [address]:port of the interface to profiling data /debug/pprof/ (default no profiling)")
+	synchronize   = flag.Bool("sync", false, "synchronizes until tip, if together with zeromq, keeps index synchronized")
+	repair        = flag.Bool("repair", false, "repair the database")
+	fixUtxo       = flag.Bool("fixutxo", false, "check and fix utxo db and exit")
+	migrate       = flag.Bool("migrate", false, "apply pending migrations of the db data format and exit")
+	migrateDryRun = flag.Bool("migratedryrun", false, "only report the changes of the pending migrations of the db data format and exit")
+	prof          = flag.String("prof", "", "http server binding [address]:port of the interface to profiling data /debug/pprof/ (default no profiling)")
 
 	syncChunk   = flag.Int("chunk", 100, "block chunk size for processing in bulk mode")
-	syncWorkers = flag.Int("workers", 8, "number of workers to process blocks in bulk mode")
+	syncWorkers = flag.Int("workers", 8, "number of workers to process blocks in bulk mode and to prefetch blocks in regular sync")
 	dryRun      = flag.Bool("dryrun", false, "do not index blocks, only download")
+	blockFiles  = flag.String("blockfiles", "", "path to the backend blocks directory with blk*.dat files and the block index, used as the source of blocks in the initial sync (only bitcoin type coins)")
 
 	debugMode = flag.Bool("debug", false, "debug mode, return more verbose errors, reload templates on each request")
 
 	internalBinding = flag.String("internal", "", "internal http server binding [address]:port, (default no internal server)")
 
+	internalAuthFile = flag.String("internalauthfile", "", "path to file with token authorizing the sync control requests of the internal server (default sync control disabled)")
+
 	publicBinding = flag.String("public", "", "public http server binding [address]:port[/path] (default no public server)")
 
 	certFiles = flag.String("certfile", "", "to enable SSL specify path to certificate files without extension, expecting <certfile>.crt and <certfile>.key (default no SSL)")
@@ -84,6 +90,10 @@ var (
 
 	// resync mempool at least each resyncMempoolPeriodMs (could be more often if invoked by message from ZeroMQ)
 	resyncMempoolPeriodMs = flag.Int("resyncmempoolperiod", 60017, "resync mempool period in milliseconds")
+
+	// rebroadcast the transactions sent by blockbook, which disappeared from mempool, each rebroadcastPeriodMs until they expire
+	rebroadcastPeriodMs  = flag.Int("rebroadcastperiod", 600000, "rebroadcast period of the sent transactions in milliseconds")
+	broadcastExpiryHours = flag.Int("broadcastexpiry", 72, "number of hours for which the sent transactions are rebroadcasted, 0 disables rebroadcasting")
 )
 
 var (
@@ -93,6 +103,8 @@ var (
 	chanSyncIndexDone             = make(chan struct{})
 	chanSyncMempoolDone           = make(chan struct{})
 	chanStoreInternalStateDone    = make(chan struct{})
+	chanRebroadcast               = make(chan struct{})
+	chanRebroadcastDone           = make(chan struct{})
 	chain                         bchain.BlockChain
 	mempool                       bchain.Mempool
 	index                         *db.RocksDB
@@ -103,8 +115,12 @@ var (
 	callbacksOnNewBlock           []bchain.OnNewBlockFunc
 	callbacksOnNewTxAddr          []bchain.OnNewTxAddrFunc
 	callbacksOnNewTx              []bchain.OnNewTxFunc
+	callbacksOnTxRemoved          []bchain.OnTxRemovedFunc
+	callbacksOnReorg              []bchain.OnReorgFunc
 	callbacksOnNewFiatRatesTicker []fiat.OnNewFiatRatesTicker
 	chanOsSignal                  chan os.Signal
+	chanStopCompute               = make(chan os.Signal)
+	computeRunning                int32
 	inShutdown                    int32
 )
 
@@ -131,6 +147,7 @@ func mainWithExitCode() int {
 	defer glog.Flush()
 
 	rand.Seed(time.Now().UTC().UnixNano())
+	api.BroadcastExpiry = time.Duration(*broadcastExpiryHours) * time.Hour
 
 	chanOsSignal = make(chan os.Signal, 1)
 	signal.Notify(chanOsSignal, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
@@ -188,6 +205,18 @@ func mainWithExitCode() int {
 		return exitCodeFatal
 	}
 
+	// convert the data of the db created by an older version, the pending migrations are applied also at startup
+	index.SetInternalState(internalState)
+	if *migrate || *migrateDryRun || index.HasPendingMigrations() {
+		if err = index.Migrate(chain, *migrateDryRun, chanOsSignal); err != nil {
+			glog.Error("migrate: ", err)
+			return exitCodeFatal
+		}
+		if *migrate || *migrateDryRun {
+			return exitCodeOK
+		}
+	}
+
 	// fix possible inconsistencies in the UTXO index
 	if *fixUtxo || !internalState.UtxoChecked {
 		err = index.FixUtxos(chanOsSignal)
@@ -209,10 +238,18 @@ func mainWithExitCode() int {
 
 	if internalState.DbState != common.DbStateClosed {
 		if internalState.DbState == common.DbStateInconsistent {
-			glog.Error("internalState: database is in inconsistent state and cannot be used")
-			return exitCodeFatal
+			if internalState.BulkCheckpointHash == "" && !internalState.BulkCheckpointEmpty {
+				glog.Error("internalState: database is in inconsistent state and cannot be used")
+				return exitCodeFatal
+			}
+			glog.Warning("internalState: database is in inconsistent state, resuming from the bulk connect checkpoint at height ", internalState.BulkCheckpointHeight)
+			if err = index.ResumeBulkConnect(); err != nil {
+				glog.Error("internalState: ", err)
+				return exitCodeFatal
+			}
+		} else {
+			glog.Warning("internalState: database was left in open state, possibly previous ungraceful shutdown")
 		}
-		glog.Warning("internalState: database was left in open state, possibly previous ungraceful shutdown")
 	}
 
 	if *computeFeeStatsFlag {
@@ -241,6 +278,18 @@ func mainWithExitCode() int {
 		glog.Errorf("NewSyncWorker %v", err)
 		return exitCodeFatal
 	}
+	if *blockFiles != "" && *synchronize {
+		if chain.GetChainParser().GetChainType() != bchain.ChainBitcoinType {
+			glog.Error("blockfiles: supported only for bitcoin type coins")
+			return exitCodeFatal
+		}
+		bf, err := btc.NewBlockFiles(*blockFiles, chain.GetChainParser())
+		if err != nil {
+			glog.Error("blockfiles: ", err)
+			return exitCodeFatal
+		}
+		syncWorker.SetBlockSource(bf)
+	}
 
 	// set the DbState to open at this moment, after all important workers are initialized
 	internalState.DbState = common.DbStateOpen
@@ -289,7 +338,7 @@ func mainWithExitCode() int {
 	if *synchronize {
 		internalState.SyncMode = true
 		internalState.InitialSync = true
-		if err := syncWorker.ResyncIndex(nil, true); err != nil {
+		if err := syncWorker.ResyncIndex(nil, nil, true); err != nil {
 			if err != db.ErrOperationInterrupted {
 				glog.Error("resyncIndex ", err)
 				return exitCodeFatal
@@ -301,7 +350,7 @@ func mainWithExitCode() int {
 		if chain.GetChainParser().GetChainType() == bchain.ChainBitcoinType {
 			addrDescForOutpoint = index.AddrDescForOutpoint
 		}
-		err = chain.InitializeMempool(addrDescForOutpoint, onNewTxAddr, onNewTx)
+		err = chain.InitializeMempool(addrDescForOutpoint, onNewTxAddr, onNewTx, onTxRemoved)
 		if err != nil {
 			glog.Error("initializeMempool ", err)
 			return exitCodeFatal
@@ -314,6 +363,7 @@ func mainWithExitCode() int {
 		internalState.FinishedMempoolSync(mempoolCount)
 		go syncIndexLoop()
 		go syncMempoolLoop()
+		go rebroadcastLoop()
 		internalState.InitialSync = false
 	}
 	go storeInternalStateLoop()
@@ -323,6 +373,8 @@ func mainWithExitCode() int {
 		callbacksOnNewBlock = append(callbacksOnNewBlock, publicServer.OnNewBlock)
 		callbacksOnNewTxAddr = append(callbacksOnNewTxAddr, publicServer.OnNewTxAddr)
 		callbacksOnNewTx = append(callbacksOnNewTx, publicServer.OnNewTx)
+		callbacksOnTxRemoved = append(callbacksOnTxRemoved, publicServer.OnTxRemoved)
+		callbacksOnReorg = append(callbacksOnReorg, publicServer.OnReorg)
 		callbacksOnNewFiatRatesTicker = append(callbacksOnNewFiatRatesTicker, publicServer.OnNewFiatRatesTicker)
 		publicServer.ConnectFullPublicInterface()
 	}
@@ -355,9 +407,11 @@ func mainWithExitCode() int {
 		close(chanSyncIndex)
 		close(chanSyncMempool)
 		close(chanStoreInternalState)
+		close(chanRebroadcast)
 		<-chanSyncIndexDone
 		<-chanSyncMempoolDone
 		<-chanStoreInternalStateDone
+		<-chanRebroadcastDone
 	}
 	return exitCodeOK
 }
@@ -387,7 +441,19 @@ func getBlockChainWithRetry(coin string, configfile string, pushHandler func(bch
 }
 
 func startInternalServer() (*server.InternalServer, error) {
-	internalServer, err := server.NewInternalServer(*internalBinding, *certFiles, index, chain, mempool, txCache, metrics, internalState)
+	control := &server.SyncControl{
+		SyncWorker:         syncWorker,
+		ResyncMempool:      requestMempoolResync,
+		ComputeColumnStats: startComputeColumnStats,
+	}
+	if *internalAuthFile != "" {
+		token, err := ioutil.ReadFile(*internalAuthFile)
+		if err != nil {
+			return nil, err
+		}
+		control.AuthToken = strings.TrimSpace(string(token))
+	}
+	internalServer, err := server.NewInternalServer(*internalBinding, *certFiles, index, chain, mempool, txCache, metrics, internalState, control)
 	if err != nil {
 		return nil, err
 	}
@@ -426,29 +492,10 @@ func startPublicServer() (*server.PublicServer, error) {
 }
 
 func performRollback() error {
-	bestHeight, bestHash, err := index.GetBestBlock()
-	if err != nil {
+	if err := syncWorker.Rollback(uint32(*rollbackHeight)); err != nil {
 		glog.Error("rollbackHeight: ", err)
 		return err
 	}
-	if uint32(*rollbackHeight) > bestHeight {
-		glog.Infof("nothing to rollback, rollbackHeight %d, bestHeight: %d", *rollbackHeight, bestHeight)
-	} else {
-		hashes := []string{bestHash}
-		for height := bestHeight - 1; height >= uint32(*rollbackHeight); height-- {
-			hash, err := index.GetBlockHash(height)
-			if err != nil {
-				glog.Error("rollbackHeight: ", err)
-				return err
-			}
-			hashes = append(hashes, hash)
-		}
-		err = syncWorker.DisconnectBlocks(uint32(*rollbackHeight), bestHeight, hashes)
-		if err != nil {
-			glog.Error("rollbackHeight: ", err)
-			return err
-		}
-	}
 	return nil
 }
 
@@ -536,11 +583,11 @@ func syncIndexLoop() {
 	glog.Info("syncIndexLoop starting")
 	// resync index about every 15 minutes if there are no chanSyncIndex requests, with debounce 1 second
 	tickAndDebounce(time.Duration(*resyncIndexPeriodMs)*time.Millisecond, debounceResyncIndexMs*time.Millisecond, chanSyncIndex, func() {
-		if err := syncWorker.ResyncIndex(onNewBlockHash, false); err != nil {
+		if err := syncWorker.ResyncIndex(onNewBlockHash, onReorg, false); err != nil {
 			glog.Error("syncIndexLoop ", errors.ErrorStack(err), ", will retry...")
 			// retry once in case of random network error, after a slight delay
 			time.Sleep(time.Millisecond * 2500)
-			if err := syncWorker.ResyncIndex(onNewBlockHash, false); err != nil {
+			if err := syncWorker.ResyncIndex(onNewBlockHash, onReorg, false); err != nil {
 				glog.Error("syncIndexLoop ", errors.ErrorStack(err))
 			}
 		}
@@ -559,6 +606,17 @@ func onNewBlockHash(hash string, height uint32) {
 	}
 }
 
+func onReorg(reorg *bchain.Reorg) {
+	defer func() {
+		if r := recover(); r != nil {
+			glog.Error("onReorg recovered from panic: ", r)
+		}
+	}()
+	for _, c := range callbacksOnReorg {
+		c(reorg)
+	}
+}
+
 func onNewFiatRatesTicker(ticker *db.CurrencyRatesTicker) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -586,14 +644,61 @@ func syncMempoolLoop() {
 	glog.Info("syncMempoolLoop stopped")
 }
 
+func rebroadcastLoop() {
+	defer close(chanRebroadcastDone)
+	if api.BroadcastExpiry <= 0 || chain.GetChainParser().GetChainType() != bchain.ChainBitcoinType {
+		glog.Info("rebroadcastLoop disabled")
+		<-chanRebroadcast
+		return
+	}
+	w, err := api.NewWorker(index, chain, mempool, txCache, metrics, internalState)
+	if err != nil {
+		glog.Error("rebroadcastLoop ", err)
+		<-chanRebroadcast
+		return
+	}
+	glog.Info("rebroadcastLoop starting")
+	tickAndDebounce(time.Duration(*rebroadcastPeriodMs)*time.Millisecond, time.Duration(*rebroadcastPeriodMs)*time.Millisecond, chanRebroadcast, func() {
+		if err := w.RebroadcastTransactions(); err != nil {
+			glog.Error("rebroadcastLoop ", errors.ErrorStack(err))
+		}
+	})
+	glog.Info("rebroadcastLoop stopped")
+}
+
+// requestMempoolResync triggers the resync of mempool, it is possible only after the initial sync
+func requestMempoolResync() error {
+	if !internalState.SyncMode || internalState.InitialSync || atomic.LoadInt32(&inShutdown) != 0 {
+		return errors.New("Mempool is not being synchronized")
+	}
+	select {
+	case chanSyncMempool <- struct{}{}:
+		return nil
+	case <-time.After(time.Second):
+		return errors.New("Mempool resync is running")
+	}
+}
+
+// startComputeColumnStats starts the computation of the db column stats in the background
+func startComputeColumnStats() error {
+	if !atomic.CompareAndSwapInt32(&computeRunning, 0, 1) {
+		return errors.New("Computation of db column stats is running")
+	}
+	go func() {
+		defer atomic.StoreInt32(&computeRunning, 0)
+		if err := index.ComputeInternalStateColumnStats(chanStopCompute); err != nil {
+			glog.Error("computeInternalStateColumnStats error: ", err)
+		}
+	}()
+	return nil
+}
+
 func storeInternalStateLoop() {
-	stopCompute := make(chan os.Signal)
 	defer func() {
-		close(stopCompute)
+		close(chanStopCompute)
 		close(chanStoreInternalStateDone)
 	}()
-	signal.Notify(stopCompute, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
-	var computeRunning bool
+	signal.Notify(chanStopCompute, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
 	lastCompute := time.Now()
 	lastAppInfo := time.Now()
 	logAppInfoPeriod := 15 * time.Minute
@@ -605,16 +710,10 @@ func storeInternalStateLoop() {
 		glog.Info("storeInternalStateLoop starting with db stats compute disabled")
 	}
 	tickAndDebounce(storeInternalStatePeriodMs*time.Millisecond, (storeInternalStatePeriodMs-1)*time.Millisecond, chanStoreInternalState, func() {
-		if (*dbStatsPeriodHours) > 0 && !computeRunning && lastCompute.Add(computePeriod).Before(time.Now()) {
-			computeRunning = true
-			go func() {
-				err := index.ComputeInternalStateColumnStats(stopCompute)
-				if err != nil {
-					glog.Error("computeInternalStateColumnStats error: ", err)
-				}
+		if (*dbStatsPeriodHours) > 0 && lastCompute.Add(computePeriod).Before(time.Now()) {
+			if startComputeColumnStats() == nil {
 				lastCompute = time.Now()
-				computeRunning = false
-			}()
+			}
 		}
 		if err := index.StoreInternalState(internalState); err != nil {
 			glog.Error("storeInternalStateLoop ", errors.ErrorStack(err))
@@ -652,6 +751,17 @@ func onNewTx(tx *bchain.MempoolTx) {
 	}
 }
 
+func onTxRemoved(removal *bchain.MempoolTxRemoval) {
+	defer func() {
+		if r := recover(); r != nil {
+			glog.Error("onTxRemoved recovered from panic: ", r)
+		}
+	}()
+	for _, c := range callbacksOnTxRemoved {
+		c(removal)
+	}
+}
+
 func pushSynchronizationHandler(nt bchain.NotificationType) {
 	glog.V(1).Info("MQ: notification ", nt)
 	if atomic.LoadInt32(&inShutdown) != 0 {
@@ -26,21 +26,64 @@ type InternalStateColumn struct {
 	Updated    time.Time `json:"updated"`
 }
 
+// BackendEndpoint contains the health state of one of the backend endpoints
+type BackendEndpoint struct {
+	URL        string  `json:"url"`
+	Active     bool    `json:"active"`
+	Healthy    bool    `json:"healthy"`
+	BestHeight uint32  `json:"bestHeight"`
+	LatencyMs  float64 `json:"latencyMs"`
+	Error      string  `json:"error,omitempty"`
+}
+
 // BackendInfo is used to get information about blockchain
 type BackendInfo struct {
-	BackendError    string      `json:"error,omitempty"`
-	Chain           string      `json:"chain,omitempty"`
-	Blocks          int         `json:"blocks,omitempty"`
-	Headers         int         `json:"headers,omitempty"`
-	BestBlockHash   string      `json:"bestBlockHash,omitempty"`
-	Difficulty      string      `json:"difficulty,omitempty"`
-	SizeOnDisk      int64       `json:"sizeOnDisk,omitempty"`
-	Version         string      `json:"version,omitempty"`
-	Subversion      string      `json:"subversion,omitempty"`
-	ProtocolVersion string      `json:"protocolVersion,omitempty"`
-	Timeoffset      float64     `json:"timeOffset,omitempty"`
-	Warnings        string      `json:"warnings,omitempty"`
-	Consensus       interface{} `json:"consensus,omitempty"`
+	BackendError    string            `json:"error,omitempty"`
+	Chain           string            `json:"chain,omitempty"`
+	Blocks          int               `json:"blocks,omitempty"`
+	Headers         int               `json:"headers,omitempty"`
+	BestBlockHash   string            `json:"bestBlockHash,omitempty"`
+	Difficulty      string            `json:"difficulty,omitempty"`
+	SizeOnDisk      int64             `json:"sizeOnDisk,omitempty"`
+	Version         string            `json:"version,omitempty"`
+	Subversion      string            `json:"subversion,omitempty"`
+	ProtocolVersion string            `json:"protocolVersion,omitempty"`
+	Timeoffset      float64           `json:"timeOffset,omitempty"`
+	Warnings        string            `json:"warnings,omitempty"`
+	Consensus       interface{}       `json:"consensus,omitempty"`
+	Endpoints       []BackendEndpoint `json:"endpoints,omitempty"`
+}
+
+// stages of the synchronization of the index
+const (
+	SyncStageIdle     = "idle"
+	SyncStagePaused   = "paused"
+	SyncStageInitial  = "initial sync"
+	SyncStageParallel = "parallel sync"
+	SyncStageSync     = "sync"
+	SyncStageRollback = "rollback"
+)
+
+// SyncProgress contains the stage and progress of the synchronization of the index
+type SyncProgress struct {
+	Stage        string     `json:"stage"`
+	Paused       bool       `json:"paused"`
+	StartHeight  uint32     `json:"startHeight,omitempty"`
+	Height       uint32     `json:"height,omitempty"`
+	TargetHeight uint32     `json:"targetHeight,omitempty"`
+	StartTime    *time.Time `json:"startTime,omitempty"`
+	Progress     float64    `json:"progress"`
+	EtaSeconds   int64      `json:"etaSeconds,omitempty"`
+}
+
+// MigrationProgress contains the progress of the running migration of the db data,
+// the interrupted migration is resumed from the last migrated key
+type MigrationProgress struct {
+	Version     uint32   `json:"version"`
+	DoneColumns []string `json:"doneColumns,omitempty"`
+	Column      string   `json:"column"`
+	LastKey     []byte   `json:"lastKey,omitempty"`
+	Rows        int64    `json:"rows"`
 }
 
 // InternalState contains the data of the internal state
@@ -54,6 +97,16 @@ type InternalState struct {
 
 	DbState uint32 `json:"dbState"`
 
+	// version of the format of the data in db, older data are converted by migrations
+	DbVersion uint32             `json:"dbVersion"`
+	Migration *MigrationProgress `json:"migration,omitempty"`
+
+	// the last block durably stored by the bulk connect, the interrupted bulk connect can be resumed from it
+	BulkCheckpointHeight uint32 `json:"bulkCheckpointHeight,omitempty"`
+	BulkCheckpointHash   string `json:"bulkCheckpointHash,omitempty"`
+	// the checkpoint is the empty db, the bulk connect started without any block in db
+	BulkCheckpointEmpty bool `json:"bulkCheckpointEmpty,omitempty"`
+
 	LastStore time.Time `json:"lastStore"`
 
 	// true if application is with flag --sync
@@ -74,6 +127,14 @@ type InternalState struct {
 	UtxoChecked bool `json:"utxoChecked"`
 
 	BackendInfo BackendInfo `json:"-"`
+
+	// the progress of the running synchronization, it is not stored
+	syncStage        string
+	syncPaused       bool
+	syncStartHeight  uint32
+	syncHeight       uint32
+	syncTargetHeight uint32
+	syncStartTime    time.Time
 }
 
 // StartedSync signals start of synchronization
@@ -107,6 +168,64 @@ func (is *InternalState) FinishedSyncNoChange() {
 	is.IsSynchronized = true
 }
 
+// SetSyncStage sets the stage of the synchronization, which is going from startHeight to targetHeight
+func (is *InternalState) SetSyncStage(stage string, startHeight, targetHeight uint32) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	is.syncStage = stage
+	is.syncStartHeight = startHeight
+	is.syncHeight = startHeight
+	is.syncTargetHeight = targetHeight
+	is.syncStartTime = time.Now()
+}
+
+// SetSyncHeight updates the height reached by the running synchronization
+func (is *InternalState) SetSyncHeight(height uint32) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	is.syncHeight = height
+}
+
+// SetSyncPaused sets the flag that the synchronization is paused
+func (is *InternalState) SetSyncPaused(paused bool) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	is.syncPaused = paused
+}
+
+// GetSyncProgress returns the stage and progress of the synchronization with the estimated time to finish
+func (is *InternalState) GetSyncProgress() SyncProgress {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	p := SyncProgress{
+		Stage:  is.syncStage,
+		Paused: is.syncPaused,
+	}
+	if p.Stage == "" || p.Stage == SyncStageIdle {
+		p.Stage = SyncStageIdle
+		if is.syncPaused {
+			p.Stage = SyncStagePaused
+		}
+		return p
+	}
+	p.StartHeight = is.syncStartHeight
+	p.Height = is.syncHeight
+	p.TargetHeight = is.syncTargetHeight
+	startTime := is.syncStartTime
+	p.StartTime = &startTime
+	if p.TargetHeight <= p.StartHeight || p.Height >= p.TargetHeight {
+		p.Progress = 100
+		return p
+	}
+	if p.Height > p.StartHeight {
+		done := float64(p.Height - p.StartHeight)
+		total := float64(p.TargetHeight - p.StartHeight)
+		p.Progress = done / total * 100
+		p.EtaSeconds = int64(time.Since(startTime).Seconds() * (total - done) / done)
+	}
+	return p
+}
+
 // GetSyncState gets the state of synchronization
 func (is *InternalState) GetSyncState() (bool, uint32, time.Time) {
 	is.mux.Lock()
@@ -0,0 +1,37 @@
+//go:build unittest
+
+package common
+
+import (
+	"testing"
+)
+
+func TestInternalState_GetSyncProgress(t *testing.T) {
+	is := &InternalState{}
+	if p := is.GetSyncProgress(); p.Stage != SyncStageIdle || p.StartTime != nil {
+		t.Errorf("GetSyncProgress() = %+v, want idle", p)
+	}
+	is.SetSyncPaused(true)
+	if p := is.GetSyncProgress(); p.Stage != SyncStagePaused || !p.Paused {
+		t.Errorf("GetSyncProgress() = %+v, want paused", p)
+	}
+	is.SetSyncPaused(false)
+
+	is.SetSyncStage(SyncStageInitial, 100, 300)
+	if p := is.GetSyncProgress(); p.Stage != SyncStageInitial || p.Height != 100 || p.Progress != 0 || p.EtaSeconds != 0 {
+		t.Errorf("GetSyncProgress() = %+v, want initial sync at 100 without progress", p)
+	}
+	is.SetSyncHeight(150)
+	p := is.GetSyncProgress()
+	if p.StartHeight != 100 || p.Height != 150 || p.TargetHeight != 300 || p.Progress != 25 || p.StartTime == nil {
+		t.Errorf("GetSyncProgress() = %+v, want 25%% from 100 to 300", p)
+	}
+	is.SetSyncHeight(300)
+	if p := is.GetSyncProgress(); p.Progress != 100 || p.EtaSeconds != 0 {
+		t.Errorf("GetSyncProgress() = %+v, want finished", p)
+	}
+	is.SetSyncStage(SyncStageIdle, 0, 0)
+	if p := is.GetSyncProgress(); p.Stage != SyncStageIdle {
+		t.Errorf("GetSyncProgress() = %+v, want idle", p)
+	}
+}
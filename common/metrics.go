@@ -24,10 +24,16 @@ type Metrics struct {
 	IndexDBSize              prometheus.Gauge
 	ExplorerViews            *prometheus.CounterVec
 	MempoolSize              prometheus.Gauge
+	MempoolLightSize         prometheus.Gauge
+	MempoolAddresses         prometheus.Gauge
+	MempoolMemory            prometheus.Gauge
 	DbColumnRows             *prometheus.GaugeVec
 	DbColumnSize             *prometheus.GaugeVec
 	BlockbookAppInfo         *prometheus.GaugeVec
 	BackendBestHeight        prometheus.Gauge
+	BackendEndpointHealthy   *prometheus.GaugeVec
+	BackendEndpointHeight    *prometheus.GaugeVec
+	BackendEndpointLatency   *prometheus.GaugeVec
 	BlockbookBestHeight      prometheus.Gauge
 	ExplorerPendingRequests  *prometheus.GaugeVec
 	WebsocketPendingRequests *prometheus.GaugeVec
@@ -169,6 +175,27 @@ func GetMetrics(coin string) (*Metrics, error) {
 			ConstLabels: Labels{"coin": coin},
 		},
 	)
+	metrics.MempoolLightSize = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:        "blockbook_mempool_light_size",
+			Help:        "Number of mempool transactions tracked only by txid",
+			ConstLabels: Labels{"coin": coin},
+		},
+	)
+	metrics.MempoolAddresses = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:        "blockbook_mempool_addresses",
+			Help:        "Number of addresses in mempool index",
+			ConstLabels: Labels{"coin": coin},
+		},
+	)
+	metrics.MempoolMemory = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:        "blockbook_mempool_memory",
+			Help:        "Estimated memory used by mempool index in bytes",
+			ConstLabels: Labels{"coin": coin},
+		},
+	)
 	metrics.DbColumnRows = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name:        "blockbook_dbcolumn_rows",
@@ -207,6 +234,30 @@ func GetMetrics(coin string) (*Metrics, error) {
 			ConstLabels: Labels{"coin": coin},
 		},
 	)
+	metrics.BackendEndpointHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "blockbook_backend_endpoint_healthy",
+			Help:        "Health of the backend endpoint (1 healthy, 0 unhealthy)",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"endpoint"},
+	)
+	metrics.BackendEndpointHeight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "blockbook_backend_endpoint_best_height",
+			Help:        "Block height in the backend endpoint",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"endpoint"},
+	)
+	metrics.BackendEndpointLatency = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "blockbook_backend_endpoint_latency",
+			Help:        "Latency of the health check of the backend endpoint in milliseconds",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"endpoint"},
+	)
 	metrics.ExplorerPendingRequests = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name:        "blockbook_explorer_pending_reqests",
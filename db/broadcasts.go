@@ -0,0 +1,171 @@
+package db
+
+import (
+	vlq "github.com/bsm/go-vlq"
+	"github.com/juju/errors"
+)
+
+// BroadcastStatus is the status of a transaction broadcasted by blockbook
+type BroadcastStatus uint8
+
+const (
+	// BroadcastPending - the transaction is neither in mempool nor in a block, it is rebroadcasted
+	BroadcastPending = BroadcastStatus(iota)
+	// BroadcastMempool - the transaction is in mempool
+	BroadcastMempool
+	// BroadcastConfirmed - the transaction is in a block, it is no longer rebroadcasted
+	BroadcastConfirmed
+	// BroadcastConflicted - an input of the transaction is spent by another transaction, it is no longer rebroadcasted
+	BroadcastConflicted
+)
+
+var broadcastStatusNames = []string{"pending", "mempool", "confirmed", "conflicted"}
+
+func (s BroadcastStatus) String() string {
+	if int(s) < len(broadcastStatusNames) {
+		return broadcastStatusNames[s]
+	}
+	return "unknown"
+}
+
+// Broadcast is a transaction broadcasted by blockbook, it is stored in the broadcasts column until it expires
+// the times are unix timestamps
+type Broadcast struct {
+	Txid            string
+	Tx              string // the transaction as it was sent to the backend
+	Status          BroadcastStatus
+	Sent            int64
+	LastBroadcast   int64
+	Expiry          int64
+	Rebroadcasts    uint32
+	Height          uint32 // the height of the block of the confirmed transaction
+	ConflictingTxid string
+	LastError       string
+}
+
+func appendVarString(s string, buf []byte, varBuf []byte) []byte {
+	l := packVaruint(uint(len(s)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	return append(buf, s...)
+}
+
+func unpackVarString(buf []byte) (string, int, error) {
+	sl, l := unpackVaruint(buf)
+	if l+int(sl) > len(buf) {
+		return "", 0, errors.New("Invalid data")
+	}
+	return string(buf[l : l+int(sl)]), l + int(sl), nil
+}
+
+func packBroadcast(b *Broadcast) []byte {
+	varBuf := make([]byte, vlq.MaxLen64)
+	buf := make([]byte, 0, 64+len(b.Tx)+len(b.ConflictingTxid)+len(b.LastError))
+	buf = append(buf, byte(b.Status))
+	l := packVarint(int(b.Sent), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVarint(int(b.LastBroadcast), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVarint(int(b.Expiry), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(b.Rebroadcasts), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(b.Height), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	buf = appendVarString(b.ConflictingTxid, buf, varBuf)
+	buf = appendVarString(b.LastError, buf, varBuf)
+	return appendVarString(b.Tx, buf, varBuf)
+}
+
+func unpackBroadcast(txid string, buf []byte) (*Broadcast, error) {
+	if len(buf) < 1 {
+		return nil, errors.New("Invalid data")
+	}
+	b := &Broadcast{Txid: txid, Status: BroadcastStatus(buf[0])}
+	l := 1
+	v, ll := unpackVarint(buf[l:])
+	b.Sent = int64(v)
+	l += ll
+	v, ll = unpackVarint(buf[l:])
+	b.LastBroadcast = int64(v)
+	l += ll
+	v, ll = unpackVarint(buf[l:])
+	b.Expiry = int64(v)
+	l += ll
+	u, ll := unpackVaruint(buf[l:])
+	b.Rebroadcasts = uint32(u)
+	l += ll
+	u, ll = unpackVaruint(buf[l:])
+	b.Height = uint32(u)
+	l += ll
+	var err error
+	if b.ConflictingTxid, ll, err = unpackVarString(buf[l:]); err != nil {
+		return nil, err
+	}
+	l += ll
+	if b.LastError, ll, err = unpackVarString(buf[l:]); err != nil {
+		return nil, err
+	}
+	l += ll
+	if b.Tx, _, err = unpackVarString(buf[l:]); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// StoreBroadcast stores the broadcasted transaction
+func (d *RocksDB) StoreBroadcast(b *Broadcast) error {
+	key, err := d.chainParser.PackTxid(b.Txid)
+	if err != nil {
+		return err
+	}
+	return d.db.PutCF(d.wo, d.cfh[cfBroadcasts], key, packBroadcast(b))
+}
+
+// GetBroadcast returns the broadcasted transaction or nil if it is not stored
+func (d *RocksDB) GetBroadcast(txid string) (*Broadcast, error) {
+	key, err := d.chainParser.PackTxid(txid)
+	if err != nil {
+		return nil, err
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfBroadcasts], key)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	buf := val.Data()
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	return unpackBroadcast(txid, buf)
+}
+
+// GetBroadcasts returns all stored broadcasted transactions
+func (d *RocksDB) GetBroadcasts() ([]*Broadcast, error) {
+	var broadcasts []*Broadcast
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfBroadcasts])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		txid, err := d.chainParser.UnpackTxid(it.Key().Data())
+		if err != nil {
+			return nil, err
+		}
+		b, err := unpackBroadcast(txid, it.Value().Data())
+		if err != nil {
+			return nil, errors.Annotatef(err, "broadcast %v", txid)
+		}
+		broadcasts = append(broadcasts, b)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return broadcasts, nil
+}
+
+// DeleteBroadcast removes the broadcasted transaction
+func (d *RocksDB) DeleteBroadcast(txid string) error {
+	key, err := d.chainParser.PackTxid(txid)
+	if err != nil {
+		return err
+	}
+	return d.db.DeleteCF(d.wo, d.cfh[cfBroadcasts], key)
+}
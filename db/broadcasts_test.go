@@ -0,0 +1,66 @@
+//go:build unittest
+
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_packBroadcast(t *testing.T) {
+	tests := []struct {
+		name string
+		b    *Broadcast
+	}{
+		{
+			name: "pending",
+			b: &Broadcast{
+				Txid:          "056e3d82e5ffd0e915fb9b62797d76263508c34fe3e5dbed30dd3e943930f204",
+				Tx:            "0100000001ab",
+				Status:        BroadcastPending,
+				Sent:          1639000000,
+				LastBroadcast: 1639003600,
+				Expiry:        1639259200,
+				Rebroadcasts:  3,
+				LastError:     "-25: bad-txns-inputs-missingorspent",
+			},
+		},
+		{
+			name: "conflicted",
+			b: &Broadcast{
+				Txid:            "056e3d82e5ffd0e915fb9b62797d76263508c34fe3e5dbed30dd3e943930f204",
+				Tx:              "0100000001ab",
+				Status:          BroadcastConflicted,
+				Sent:            1639000000,
+				LastBroadcast:   1639000000,
+				Expiry:          1639259200,
+				ConflictingTxid: "7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25",
+			},
+		},
+		{
+			name: "confirmed",
+			b: &Broadcast{
+				Txid:          "056e3d82e5ffd0e915fb9b62797d76263508c34fe3e5dbed30dd3e943930f204",
+				Status:        BroadcastConfirmed,
+				Sent:          1639000000,
+				LastBroadcast: 1639000000,
+				Expiry:        1639259200,
+				Height:        712345,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unpackBroadcast(tt.b.Txid, packBroadcast(tt.b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.b) {
+				t.Errorf("unpackBroadcast() = %+v, want %+v", got, tt.b)
+			}
+		})
+	}
+	if _, err := unpackBroadcast("", []byte{0, 2, 2, 2, 0, 0, 10, 'a'}); err == nil {
+		t.Error("unpackBroadcast() expected error for truncated data")
+	}
+}
@@ -1,11 +1,16 @@
 package db
 
 import (
+	"bytes"
+	"sync"
 	"time"
 
+	vlq "github.com/bsm/go-vlq"
 	"github.com/flier/gorocksdb"
 	"github.com/golang/glog"
+	"github.com/juju/errors"
 	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
 )
 
 // bulk connect
@@ -13,6 +18,11 @@ import (
 // it speeds up the import in two ways:
 // 1) balances and txAddresses are modified several times during the import, there is a chance that the modifications are done before write to DB
 // 2) rocksdb seems to handle better fewer larger batches than continuous stream of smaller batches
+// the cached balances and addressContracts modified since the last checkpoint are stored only in checkpoints,
+// together with all cached txAddresses and the height of the last connected block, in one atomic write
+// if the bulk connect is interrupted, the db can be rolled back to the last checkpoint and the import resumed from it
+// txAddresses can be stored also between the checkpoints, the blocks connected again after the resume overwrite them,
+// the addresses stored between the checkpoints are listed in the default column, so that they can be rolled back
 
 type bulkAddresses struct {
 	bi        BlockInfo
@@ -28,7 +38,14 @@ type BulkConnect struct {
 	txAddressesMap     map[string]*TxAddresses
 	balances           map[string]*AddrBalance
 	addressContracts   map[string]*AddrContracts
-	height             uint32
+	// keys of the balances (or addressContracts) modified since the last checkpoint
+	// the other cached balances are the same as in db and can be dropped from the cache at any time
+	dirty map[string]struct{}
+	// heights of the blocks with addresses stored after the last checkpoint
+	aheadHeights   []uint32
+	height         uint32
+	hash           string
+	lastCheckpoint time.Time
 }
 
 const (
@@ -39,9 +56,16 @@ const (
 	partialStoreBalances      = maxBulkBalances / 10
 	maxBulkAddrContracts      = 1200000
 	partialStoreAddrContracts = maxBulkAddrContracts / 10
+	bulkCheckpointPeriod      = 10 * time.Minute
+	// the cached data are packed to the checkpoint in parallel in this number of parts
+	bulkStoreParts = 8
 )
 
+// prefix of the keys in the default column with the addresses of the blocks stored after the last checkpoint
+const bulkAddressesKeyPrefix = "bulkAddresses"
+
 // InitBulkConnect initializes bulk connect and switches DB to inconsistent state
+// the current best block of the db (or the empty db) is recorded as the initial checkpoint
 func (d *RocksDB) InitBulkConnect() (*BulkConnect, error) {
 	b := &BulkConnect{
 		d:                d,
@@ -49,7 +73,16 @@ func (d *RocksDB) InitBulkConnect() (*BulkConnect, error) {
 		txAddressesMap:   make(map[string]*TxAddresses),
 		balances:         make(map[string]*AddrBalance),
 		addressContracts: make(map[string]*AddrContracts),
+		dirty:            make(map[string]struct{}),
+		lastCheckpoint:   time.Now(),
+	}
+	height, hash, err := d.GetBestBlock()
+	if err != nil {
+		return nil, err
 	}
+	d.is.BulkCheckpointHeight = height
+	d.is.BulkCheckpointHash = hash
+	d.is.BulkCheckpointEmpty = hash == ""
 	if err := d.SetInconsistentState(true); err != nil {
 		return nil, err
 	}
@@ -57,6 +90,82 @@ func (d *RocksDB) InitBulkConnect() (*BulkConnect, error) {
 	return b, nil
 }
 
+// batchWriter is the part of gorocksdb.WriteBatch used to store the data
+type batchWriter interface {
+	PutCF(cf *gorocksdb.ColumnFamilyHandle, key, value []byte)
+	DeleteCF(cf *gorocksdb.ColumnFamilyHandle, key []byte)
+}
+
+type bufferedBatchOp struct {
+	cf         *gorocksdb.ColumnFamilyHandle
+	key, value []byte
+	delete     bool
+}
+
+// bufferedBatch collects the packed data in memory, so that they can be created in parallel and written in one WriteBatch
+type bufferedBatch struct {
+	ops []bufferedBatchOp
+}
+
+func (bb *bufferedBatch) PutCF(cf *gorocksdb.ColumnFamilyHandle, key, value []byte) {
+	// the callers reuse the buffers, the data must be copied
+	bb.ops = append(bb.ops, bufferedBatchOp{
+		cf:    cf,
+		key:   append([]byte(nil), key...),
+		value: append([]byte(nil), value...),
+	})
+}
+
+func (bb *bufferedBatch) DeleteCF(cf *gorocksdb.ColumnFamilyHandle, key []byte) {
+	bb.ops = append(bb.ops, bufferedBatchOp{
+		cf:     cf,
+		key:    append([]byte(nil), key...),
+		delete: true,
+	})
+}
+
+func (bb *bufferedBatch) writeTo(wb *gorocksdb.WriteBatch) {
+	for i := range bb.ops {
+		op := &bb.ops[i]
+		if op.delete {
+			wb.DeleteCF(op.cf, op.key)
+		} else {
+			wb.PutCF(op.cf, op.key, op.value)
+		}
+	}
+	bb.ops = nil
+}
+
+// bulkStorePart returns true if the key belongs to given part of the cached data, the parts are packed in parallel
+func bulkStorePart(key string, part int) bool {
+	return len(key) > 0 && int(key[len(key)-1])%bulkStoreParts == part
+}
+
+// parallelStore packs the data using the store function, which is called in parallel for each of the bulkStoreParts parts,
+// and writes the packed data to wb
+func parallelStore(wb *gorocksdb.WriteBatch, store func(w batchWriter, part int) error) error {
+	var wg sync.WaitGroup
+	batches := make([]bufferedBatch, bulkStoreParts)
+	errs := make([]error, bulkStoreParts)
+	for i := 0; i < bulkStoreParts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = store(&batches[i], i)
+		}(i)
+	}
+	wg.Wait()
+	for i := range batches {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		batches[i].writeTo(wb)
+	}
+	return nil
+}
+
+// storeTxAddresses stores all cached txAddresses or, if all is false, the completely spent ones
+// and some others up to partialStoreAddresses
 func (b *BulkConnect) storeTxAddresses(wb *gorocksdb.WriteBatch, all bool) (int, int, error) {
 	var txm map[string]*TxAddresses
 	var sp int
@@ -91,18 +200,29 @@ func (b *BulkConnect) storeTxAddresses(wb *gorocksdb.WriteBatch, all bool) (int,
 			}
 		}
 	}
-	if err := b.d.storeTxAddresses(wb, txm); err != nil {
+	if err := parallelStore(wb, func(w batchWriter, part int) error {
+		m := make(map[string]*TxAddresses, len(txm)/bulkStoreParts+1)
+		for k, v := range txm {
+			if bulkStorePart(k, part) {
+				m[k] = v
+			}
+		}
+		return b.d.storeTxAddresses(w, m)
+	}); err != nil {
 		return 0, 0, err
 	}
 	return len(txm), sp, nil
 }
 
-func (b *BulkConnect) parallelStoreTxAddresses(c chan error, all bool) {
+// parallelStoreTxAddresses stores part of the cached txAddresses between the checkpoints
+// it does not break the resume from the checkpoint, the blocks connected again overwrite the txAddresses
+// of their transactions and mark the same outputs as spent
+func (b *BulkConnect) parallelStoreTxAddresses(c chan error) {
 	defer close(c)
 	start := time.Now()
 	wb := gorocksdb.NewWriteBatch()
 	defer wb.Destroy()
-	count, sp, err := b.storeTxAddresses(wb, all)
+	count, sp, err := b.storeTxAddresses(wb, false)
 	if err != nil {
 		c <- err
 		return
@@ -115,47 +235,112 @@ func (b *BulkConnect) parallelStoreTxAddresses(c chan error, all bool) {
 	c <- nil
 }
 
-func (b *BulkConnect) storeBalances(wb *gorocksdb.WriteBatch, all bool) (int, error) {
-	var bal map[string]*AddrBalance
-	if all {
-		bal = b.balances
-		b.balances = make(map[string]*AddrBalance)
-	} else {
-		bal = make(map[string]*AddrBalance)
-		// store some random balances
-		for k, a := range b.balances {
-			bal[k] = a
-			delete(b.balances, k)
-			if len(bal) >= partialStoreBalances {
-				break
-			}
+// storeBalances stores the balances modified since the last checkpoint
+func (b *BulkConnect) storeBalances(wb *gorocksdb.WriteBatch) (int, error) {
+	bal := make(map[string]*AddrBalance, len(b.dirty))
+	for k := range b.dirty {
+		if v, found := b.balances[k]; found {
+			bal[k] = v
 		}
 	}
-	if err := b.d.storeBalances(wb, bal); err != nil {
+	if err := parallelStore(wb, func(w batchWriter, part int) error {
+		m := make(map[string]*AddrBalance, len(bal)/bulkStoreParts+1)
+		for k, v := range bal {
+			if bulkStorePart(k, part) {
+				m[k] = v
+			}
+		}
+		return b.d.storeBalances(w, m)
+	}); err != nil {
 		return 0, err
 	}
 	return len(bal), nil
 }
 
-func (b *BulkConnect) parallelStoreBalances(c chan error, all bool) {
-	defer close(c)
-	start := time.Now()
-	wb := gorocksdb.NewWriteBatch()
-	defer wb.Destroy()
-	count, err := b.storeBalances(wb, all)
-	if err != nil {
-		c <- err
-		return
+// dropCleanBalances drops from the cache up to partialStoreBalances balances not modified since the last checkpoint
+// returns false if there is not enough of them, the balances must be stored by a checkpoint then
+func (b *BulkConnect) dropCleanBalances() bool {
+	dropped := 0
+	for k := range b.balances {
+		if dropped >= partialStoreBalances {
+			break
+		}
+		if _, d := b.dirty[k]; !d {
+			delete(b.balances, k)
+			dropped++
+		}
 	}
-	if err := b.d.db.Write(b.d.wo, wb); err != nil {
-		c <- err
-		return
+	return dropped >= partialStoreBalances
+}
+
+// storeAddressContracts stores the addressContracts modified since the last checkpoint
+func (b *BulkConnect) storeAddressContracts(wb *gorocksdb.WriteBatch) (int, error) {
+	ac := make(map[string]*AddrContracts, len(b.dirty))
+	for k := range b.dirty {
+		if v, found := b.addressContracts[k]; found {
+			ac[k] = v
+		}
 	}
-	glog.Info("rocksdb: height ", b.height, ", stored ", count, " balances, ", len(b.balances), " remaining, done in ", time.Since(start))
-	c <- nil
+	if err := parallelStore(wb, func(w batchWriter, part int) error {
+		m := make(map[string]*AddrContracts, len(ac)/bulkStoreParts+1)
+		for k, v := range ac {
+			if bulkStorePart(k, part) {
+				m[k] = v
+			}
+		}
+		return b.d.storeAddressContracts(w, m)
+	}); err != nil {
+		return 0, err
+	}
+	return len(ac), nil
+}
+
+// dropCleanAddressContracts drops from the cache up to partialStoreAddrContracts addressContracts not modified since the last checkpoint
+// returns false if there is not enough of them, the addressContracts must be stored by a checkpoint then
+func (b *BulkConnect) dropCleanAddressContracts() bool {
+	dropped := 0
+	for k := range b.addressContracts {
+		if dropped >= partialStoreAddrContracts {
+			break
+		}
+		if _, d := b.dirty[k]; !d {
+			delete(b.addressContracts, k)
+			dropped++
+		}
+	}
+	return dropped >= partialStoreAddrContracts
 }
 
-func (b *BulkConnect) storeBulkAddresses(wb *gorocksdb.WriteBatch) error {
+func bulkAddressesKey(height uint32) []byte {
+	return append([]byte(bulkAddressesKeyPrefix), packUint(height)...)
+}
+
+func packBulkAddresses(addresses addressesMap) []byte {
+	buf := make([]byte, 0, len(addresses)*32)
+	varBuf := make([]byte, vlq.MaxLen64)
+	for addrDesc := range addresses {
+		buf = appendVarString(addrDesc, buf, varBuf)
+	}
+	return buf
+}
+
+func unpackBulkAddresses(buf []byte) ([]bchain.AddressDescriptor, error) {
+	var addrDescs []bchain.AddressDescriptor
+	for len(buf) > 0 {
+		s, l, err := unpackVarString(buf)
+		if err != nil {
+			return nil, err
+		}
+		addrDescs = append(addrDescs, bchain.AddressDescriptor(s))
+		buf = buf[l:]
+	}
+	return addrDescs, nil
+}
+
+// storeBulkAddresses stores the cached addresses and block infos
+// if they are stored ahead of the checkpoint, the list of the addresses of each block is stored too,
+// so that the rows can be removed when the bulk connect is resumed from the checkpoint
+func (b *BulkConnect) storeBulkAddresses(wb *gorocksdb.WriteBatch, aheadOfCheckpoint bool) error {
 	for _, ba := range b.bulkAddresses {
 		if err := b.d.storeAddresses(wb, ba.bi.Height, ba.addresses); err != nil {
 			return err
@@ -163,54 +348,101 @@ func (b *BulkConnect) storeBulkAddresses(wb *gorocksdb.WriteBatch) error {
 		if err := b.d.writeHeight(wb, ba.bi.Height, &ba.bi, opInsert); err != nil {
 			return err
 		}
+		if aheadOfCheckpoint {
+			wb.PutCF(b.d.cfh[cfDefault], bulkAddressesKey(ba.bi.Height), packBulkAddresses(ba.addresses))
+			b.aheadHeights = append(b.aheadHeights, ba.bi.Height)
+		}
 	}
 	b.bulkAddressesCount = 0
 	b.bulkAddresses = b.bulkAddresses[:0]
 	return nil
 }
 
-func (b *BulkConnect) connectBlockBitcoinType(block *bchain.Block, storeBlockTxs bool) error {
-	addresses := make(addressesMap)
-	if err := b.d.processAddressesBitcoinType(block, addresses, b.txAddressesMap, b.balances); err != nil {
+// checkpoint stores all cached data and the last connected block as the checkpoint to the internal state in one write
+func (b *BulkConnect) checkpoint() error {
+	start := time.Now()
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	bac := b.bulkAddressesCount
+	if err := b.storeBulkAddresses(wb, false); err != nil {
 		return err
 	}
-	var storeAddressesChan, storeBalancesChan chan error
-	var sa bool
-	if len(b.txAddressesMap) > maxBulkTxAddresses || len(b.balances) > maxBulkBalances {
-		sa = true
-		if len(b.txAddressesMap)+partialStoreAddresses > maxBulkTxAddresses {
-			storeAddressesChan = make(chan error)
-			go b.parallelStoreTxAddresses(storeAddressesChan, false)
-		}
-		if len(b.balances)+partialStoreBalances > maxBulkBalances {
-			storeBalancesChan = make(chan error)
-			go b.parallelStoreBalances(storeBalancesChan, false)
-		}
+	// the addresses stored after the previous checkpoint are now covered by this one
+	for _, h := range b.aheadHeights {
+		wb.DeleteCF(b.d.cfh[cfDefault], bulkAddressesKey(h))
+	}
+	txc, _, err := b.storeTxAddresses(wb, true)
+	if err != nil {
+		return err
+	}
+	bc, err := b.storeBalances(wb)
+	if err != nil {
+		return err
+	}
+	acc, err := b.storeAddressContracts(wb)
+	if err != nil {
+		return err
+	}
+	if b.hash != "" {
+		b.d.is.BulkCheckpointHeight = b.height
+		b.d.is.BulkCheckpointHash = b.hash
+		b.d.is.BulkCheckpointEmpty = false
+	}
+	if err := b.d.storeStateToBatch(wb, b.d.is); err != nil {
+		return err
+	}
+	if err := b.d.db.Write(b.d.wo, wb); err != nil {
+		return err
+	}
+	b.aheadHeights = b.aheadHeights[:0]
+	b.dirty = make(map[string]struct{})
+	// the stored data stay in the cache, only the overflow over the limits is dropped
+	if len(b.balances) > maxBulkBalances {
+		b.dropCleanBalances()
+	}
+	if len(b.addressContracts) > maxBulkAddrContracts {
+		b.dropCleanAddressContracts()
 	}
+	b.lastCheckpoint = time.Now()
+	glog.Info("rocksdb: height ", b.height, ", checkpoint stored ", bac, " addresses, ", txc, " txAddresses, ", bc, " balances, ", acc, " addressContracts, done in ", time.Since(start))
+	return nil
+}
+
+// storeBlock stores the bulk addresses and block txs if necessary, or makes the checkpoint if cp is set
+// partialStore, if not nil, signals the end of the storing of the cached data running in parallel
+func (b *BulkConnect) storeBlock(block *bchain.Block, addresses addressesMap, cp bool, storeBlockTxs func(wb *gorocksdb.WriteBatch) error, partialStore chan error) error {
 	b.bulkAddresses = append(b.bulkAddresses, bulkAddresses{
 		bi: BlockInfo{
-			Hash:   block.Hash,
-			Time:   block.Time,
-			Txs:    uint32(len(block.Txs)),
-			Size:   uint32(block.Size),
-			Height: block.Height,
+			Hash:      block.Hash,
+			Time:      block.Time,
+			Txs:       uint32(len(block.Txs)),
+			Size:      uint32(block.Size),
+			Height:    block.Height,
+			RawHeader: block.RawHeader,
 		},
 		addresses: addresses,
 	})
 	b.bulkAddressesCount += len(addresses)
+	// balances and addressContracts are modified only for the addresses of the block
+	for addrDesc := range addresses {
+		b.dirty[addrDesc] = struct{}{}
+	}
+	cp = cp || time.Since(b.lastCheckpoint) > bulkCheckpointPeriod
+	// the addresses are stored by the checkpoint if it is going to be made
+	sa := !cp && b.bulkAddressesCount > maxBulkAddresses
 	// open WriteBatch only if going to write
-	if sa || b.bulkAddressesCount > maxBulkAddresses || storeBlockTxs {
+	if sa || storeBlockTxs != nil {
 		start := time.Now()
 		wb := gorocksdb.NewWriteBatch()
 		defer wb.Destroy()
 		bac := b.bulkAddressesCount
-		if sa || b.bulkAddressesCount > maxBulkAddresses {
-			if err := b.storeBulkAddresses(wb); err != nil {
+		if sa {
+			if err := b.storeBulkAddresses(wb, true); err != nil {
 				return err
 			}
 		}
-		if storeBlockTxs {
-			if err := b.d.storeAndCleanupBlockTxs(wb, block); err != nil {
+		if storeBlockTxs != nil {
+			if err := storeBlockTxs(wb); err != nil {
 				return err
 			}
 		}
@@ -221,57 +453,36 @@ func (b *BulkConnect) connectBlockBitcoinType(block *bchain.Block, storeBlockTxs
 			glog.Info("rocksdb: height ", b.height, ", stored ", bac, " addresses, done in ", time.Since(start))
 		}
 	}
-	if storeAddressesChan != nil {
-		if err := <-storeAddressesChan; err != nil {
+	if partialStore != nil {
+		if err := <-partialStore; err != nil {
 			return err
 		}
 	}
-	if storeBalancesChan != nil {
-		if err := <-storeBalancesChan; err != nil {
-			return err
-		}
+	if cp {
+		return b.checkpoint()
 	}
 	return nil
 }
 
-func (b *BulkConnect) storeAddressContracts(wb *gorocksdb.WriteBatch, all bool) (int, error) {
-	var ac map[string]*AddrContracts
-	if all {
-		ac = b.addressContracts
-		b.addressContracts = make(map[string]*AddrContracts)
-	} else {
-		ac = make(map[string]*AddrContracts)
-		// store some random address contracts
-		for k, a := range b.addressContracts {
-			ac[k] = a
-			delete(b.addressContracts, k)
-			if len(ac) >= partialStoreAddrContracts {
-				break
-			}
-		}
-	}
-	if err := b.d.storeAddressContracts(wb, ac); err != nil {
-		return 0, err
+func (b *BulkConnect) connectBlockBitcoinType(block *bchain.Block, storeBlockTxs bool) error {
+	addresses := make(addressesMap)
+	if err := b.d.processAddressesBitcoinType(block, addresses, b.txAddressesMap, b.balances); err != nil {
+		return err
 	}
-	return len(ac), nil
-}
-
-func (b *BulkConnect) parallelStoreAddressContracts(c chan error, all bool) {
-	defer close(c)
-	start := time.Now()
-	wb := gorocksdb.NewWriteBatch()
-	defer wb.Destroy()
-	count, err := b.storeAddressContracts(wb, all)
-	if err != nil {
-		c <- err
-		return
+	var storeTxAddressesChan chan error
+	if len(b.txAddressesMap) > maxBulkTxAddresses {
+		storeTxAddressesChan = make(chan error)
+		go b.parallelStoreTxAddresses(storeTxAddressesChan)
 	}
-	if err := b.d.db.Write(b.d.wo, wb); err != nil {
-		c <- err
-		return
+	var sbt func(wb *gorocksdb.WriteBatch) error
+	if storeBlockTxs {
+		sbt = func(wb *gorocksdb.WriteBatch) error {
+			return b.d.storeAndCleanupBlockTxs(wb, block)
+		}
 	}
-	glog.Info("rocksdb: height ", b.height, ", stored ", count, " addressContracts, ", len(b.addressContracts), " remaining, done in ", time.Since(start))
-	c <- nil
+	// the modified balances can be stored only by the checkpoint, make it if the clean ones cannot be dropped from the cache
+	cp := len(b.balances) > maxBulkBalances && !b.dropCleanBalances()
+	return b.storeBlock(block, addresses, cp, sbt, storeTxAddressesChan)
 }
 
 func (b *BulkConnect) connectBlockEthereumType(block *bchain.Block, storeBlockTxs bool) error {
@@ -280,58 +491,20 @@ func (b *BulkConnect) connectBlockEthereumType(block *bchain.Block, storeBlockTx
 	if err != nil {
 		return err
 	}
-	var storeAddrContracts chan error
-	var sa bool
-	if len(b.addressContracts) > maxBulkAddrContracts {
-		sa = true
-		storeAddrContracts = make(chan error)
-		go b.parallelStoreAddressContracts(storeAddrContracts, false)
-	}
-	b.bulkAddresses = append(b.bulkAddresses, bulkAddresses{
-		bi: BlockInfo{
-			Hash:   block.Hash,
-			Time:   block.Time,
-			Txs:    uint32(len(block.Txs)),
-			Size:   uint32(block.Size),
-			Height: block.Height,
-		},
-		addresses: addresses,
-	})
-	b.bulkAddressesCount += len(addresses)
-	// open WriteBatch only if going to write
-	if sa || b.bulkAddressesCount > maxBulkAddresses || storeBlockTxs {
-		start := time.Now()
-		wb := gorocksdb.NewWriteBatch()
-		defer wb.Destroy()
-		bac := b.bulkAddressesCount
-		if sa || b.bulkAddressesCount > maxBulkAddresses {
-			if err := b.storeBulkAddresses(wb); err != nil {
-				return err
-			}
-		}
-		if storeBlockTxs {
-			if err := b.d.storeAndCleanupBlockTxsEthereumType(wb, block, blockTxs); err != nil {
-				return err
-			}
-		}
-		if err := b.d.db.Write(b.d.wo, wb); err != nil {
-			return err
-		}
-		if bac > b.bulkAddressesCount {
-			glog.Info("rocksdb: height ", b.height, ", stored ", bac, " addresses, done in ", time.Since(start))
+	var sbt func(wb *gorocksdb.WriteBatch) error
+	if storeBlockTxs {
+		sbt = func(wb *gorocksdb.WriteBatch) error {
+			return b.d.storeAndCleanupBlockTxsEthereumType(wb, block, blockTxs)
 		}
 	}
-	if storeAddrContracts != nil {
-		if err := <-storeAddrContracts; err != nil {
-			return err
-		}
-	}
-	return nil
+	cp := len(b.addressContracts) > maxBulkAddrContracts && !b.dropCleanAddressContracts()
+	return b.storeBlock(block, addresses, cp, sbt, nil)
 }
 
 // ConnectBlock connects block in bulk mode
 func (b *BulkConnect) ConnectBlock(block *bchain.Block, storeBlockTxs bool) error {
 	b.height = block.Height
+	b.hash = block.Hash
 	if b.chainType == bchain.ChainBitcoinType {
 		return b.connectBlockBitcoinType(block, storeBlockTxs)
 	} else if b.chainType == bchain.ChainEthereumType {
@@ -345,52 +518,103 @@ func (b *BulkConnect) ConnectBlock(block *bchain.Block, storeBlockTxs bool) erro
 // after Close, the BulkConnect cannot be used
 func (b *BulkConnect) Close() error {
 	glog.Info("rocksdb: bulk connect closing")
-	start := time.Now()
-	var storeTxAddressesChan, storeBalancesChan, storeAddressContractsChan chan error
-	if b.chainType == bchain.ChainBitcoinType {
-		storeTxAddressesChan = make(chan error)
-		go b.parallelStoreTxAddresses(storeTxAddressesChan, true)
-		storeBalancesChan = make(chan error)
-		go b.parallelStoreBalances(storeBalancesChan, true)
-	} else if b.chainType == bchain.ChainEthereumType {
-		storeAddressContractsChan = make(chan error)
-		go b.parallelStoreAddressContracts(storeAddressContractsChan, true)
+	if err := b.checkpoint(); err != nil {
+		return err
 	}
-	wb := gorocksdb.NewWriteBatch()
-	defer wb.Destroy()
-	bac := b.bulkAddressesCount
-	if err := b.storeBulkAddresses(wb); err != nil {
+	var err error
+	b.d.is.BlockTimes, err = b.d.loadBlockTimes()
+	if err != nil {
 		return err
 	}
-	if err := b.d.db.Write(b.d.wo, wb); err != nil {
+	b.d.is.BulkCheckpointHeight = 0
+	b.d.is.BulkCheckpointHash = ""
+	b.d.is.BulkCheckpointEmpty = false
+	if err := b.d.SetInconsistentState(false); err != nil {
 		return err
 	}
-	glog.Info("rocksdb: height ", b.height, ", stored ", bac, " addresses, done in ", time.Since(start))
-	if storeTxAddressesChan != nil {
-		if err := <-storeTxAddressesChan; err != nil {
-			return err
+	glog.Info("rocksdb: bulk connect closed, db set to open state")
+	b.d = nil
+	return nil
+}
+
+// ResumeBulkConnect rolls back the data stored after the last checkpoint of an interrupted bulk connect
+// and switches DB from inconsistent to open state, the sync then continues from the checkpoint
+func (d *RocksDB) ResumeBulkConnect() error {
+	if d.is == nil {
+		return errors.New("Internal state not created")
+	}
+	if d.is.DbState != common.DbStateInconsistent {
+		return nil
+	}
+	height := d.is.BulkCheckpointHeight
+	hash := d.is.BulkCheckpointHash
+	// the first block above the checkpoint
+	from := height + 1
+	if d.is.BulkCheckpointEmpty {
+		from = 0
+	} else {
+		if hash == "" {
+			return errors.New("No bulk connect checkpoint, database must be recreated")
 		}
-	}
-	if storeBalancesChan != nil {
-		if err := <-storeBalancesChan; err != nil {
+		h, err := d.GetBlockHash(height)
+		if err != nil {
 			return err
 		}
+		if h != hash {
+			return errors.Errorf("Bulk connect checkpoint %d %s does not match stored block %s", height, hash, h)
+		}
 	}
-	if storeAddressContractsChan != nil {
-		if err := <-storeAddressContractsChan; err != nil {
-			return err
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	// remove the addresses of the blocks above the checkpoint, they would stay in the index if the blocks changed
+	addresses := 0
+	prefix := []byte(bulkAddressesKeyPrefix)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfDefault])
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		if h := unpackUint(key[len(prefix):]); h >= from {
+			addrDescs, err := unpackBulkAddresses(it.Value().Data())
+			if err != nil {
+				it.Close()
+				return err
+			}
+			for _, addrDesc := range addrDescs {
+				wb.DeleteCF(d.cfh[cfAddresses], packAddressKey(addrDesc, h))
+			}
+			addresses += len(addrDescs)
 		}
+		wb.DeleteCF(d.cfh[cfDefault], append([]byte(nil), key...))
+	}
+	it.Close()
+	heights := 0
+	for _, cf := range []int{cfHeight, cfBlockTxs, cfHeaders} {
+		it := d.db.NewIteratorCF(d.ro, d.cfh[cf])
+		for it.Seek(packUint(from)); it.Valid(); it.Next() {
+			wb.DeleteCF(d.cfh[cf], append([]byte(nil), it.Key().Data()...))
+			if cf == cfHeight {
+				heights++
+			}
+		}
+		it.Close()
+	}
+	if err := d.db.Write(d.wo, wb); err != nil {
+		return err
 	}
 	var err error
-	b.d.is.BlockTimes, err = b.d.loadBlockTimes()
+	d.is.BlockTimes, err = d.loadBlockTimes()
 	if err != nil {
 		return err
 	}
-
-	if err := b.d.SetInconsistentState(false); err != nil {
+	d.is.UpdateBestHeight(height)
+	d.is.BulkCheckpointHeight = 0
+	d.is.BulkCheckpointHash = ""
+	d.is.BulkCheckpointEmpty = false
+	if err := d.SetInconsistentState(false); err != nil {
 		return err
 	}
-	glog.Info("rocksdb: bulk connect closed, db set to open state")
-	b.d = nil
+	glog.Info("rocksdb: bulk connect resumed from checkpoint ", height, " ", hash, ", rolled back ", heights, " blocks and ", addresses, " addresses, db set to open state")
 	return nil
 }
@@ -0,0 +1,255 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"time"
+
+	"github.com/flier/gorocksdb"
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
+)
+
+// migrations of the data format
+// a change of the data format bumps dbVersion and adds a migration step converting the data from the previous version,
+// so that the existing db can be upgraded in place instead of a full resync
+// the steps are applied in the order of the versions at startup or by the -migrate flag
+// each step must be idempotent, it can be interrupted and run again; the conversion of a column by migrateColumn
+// stores its progress to the internal state together with the converted data and is resumed from the last converted key
+
+// dbMigration converts the data of the db from the version-1 to the version
+type dbMigration struct {
+	version     uint32
+	description string
+	migrate     func(m *migrationRun) error
+}
+
+// dbMigrations are the migration steps to the current dbVersion, ordered by version
+var dbMigrations = []dbMigration{
+	{version: 6, description: "store block headers", migrate: migrateBlockHeaders},
+}
+
+// number of rows converted and stored in one write batch
+const migrationBatchRows = 100000
+
+// migrationRun is the context of one running migration step
+type migrationRun struct {
+	d            *RocksDB
+	chain        bchain.BlockChain
+	version      uint32
+	dryRun       bool
+	chanOsSignal chan os.Signal
+}
+
+// pendingMigrations returns the migration steps converting the data from the version from to the version to
+func pendingMigrations(migrations []dbMigration, from, to uint32) ([]dbMigration, error) {
+	if from > to {
+		return nil, errors.Errorf("DB version %v is newer than %v", from, to)
+	}
+	var pending []dbMigration
+	for v := from + 1; v <= to; v++ {
+		found := false
+		for i := range migrations {
+			if migrations[i].version == v {
+				pending = append(pending, migrations[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("Missing migration to version %v", v)
+		}
+	}
+	return pending, nil
+}
+
+// HasPendingMigrations returns true if the data in db are in an older format and must be migrated
+func (d *RocksDB) HasPendingMigrations() bool {
+	return d.is != nil && d.is.DbVersion < dbVersion
+}
+
+// Migrate applies the pending migrations of the data format, in dry run mode only reports the changes
+// the chain is used by the steps, which need data not stored in the db
+func (d *RocksDB) Migrate(chain bchain.BlockChain, dryRun bool, chanOsSignal chan os.Signal) error {
+	if d.is == nil {
+		return errors.New("Internal state not created")
+	}
+	pending, err := pendingMigrations(dbMigrations, d.is.DbVersion, dbVersion)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		glog.Info("db: data version ", d.is.DbVersion, " is up to date, no migrations to apply")
+		return nil
+	}
+	if d.is.DbState == common.DbStateInconsistent {
+		return errors.New("DB is in inconsistent state, it cannot be migrated")
+	}
+	for i := range pending {
+		mg := &pending[i]
+		start := time.Now()
+		glog.Infof("db: migration to version %v (%v) start, dry run %v", mg.version, mg.description, dryRun)
+		m := &migrationRun{d: d, chain: chain, version: mg.version, dryRun: dryRun, chanOsSignal: chanOsSignal}
+		if err := mg.migrate(m); err != nil {
+			return errors.Annotatef(err, "migration to version %v", mg.version)
+		}
+		if dryRun {
+			glog.Infof("db: migration to version %v dry run finished in %v", mg.version, time.Since(start))
+			// the following steps depend on the result of this one
+			return nil
+		}
+		d.is.DbVersion = mg.version
+		d.is.Migration = nil
+		for c := range d.is.DbColumns {
+			d.is.DbColumns[c].Version = mg.version
+		}
+		if err := d.storeState(d.is); err != nil {
+			return err
+		}
+		glog.Infof("db: migration to version %v finished in %v", mg.version, time.Since(start))
+	}
+	return nil
+}
+
+// migrateColumn converts all rows of the column by the convert function, which returns the new value of the row
+// and true if it changed; nil new value deletes the row
+// the conversion is stored in batches together with the progress and resumed after an interruption
+func (m *migrationRun) migrateColumn(col int, convert func(key, value []byte) ([]byte, bool, error)) error {
+	return m.migrateColumnTo(col, col, convert)
+}
+
+// migrateColumnTo converts all rows of the column col as migrateColumn, the converted values are stored
+// under the same keys to the column dst
+func (m *migrationRun) migrateColumnTo(col, dst int, convert func(key, value []byte) ([]byte, bool, error)) error {
+	d := m.d
+	name := cfNames[col]
+	var lastKey []byte
+	var rows, changed int64
+	var doneColumns []string
+	if p := d.is.Migration; p != nil && p.Version == m.version && !m.dryRun {
+		for _, c := range p.DoneColumns {
+			if c == name {
+				glog.Info("db: migration of column ", name, " already done")
+				return nil
+			}
+		}
+		doneColumns = p.DoneColumns
+		if p.Column == name {
+			lastKey = append([]byte(nil), p.LastKey...)
+			rows = p.Rows
+			glog.Info("db: migration of column ", name, " resumed after ", rows, " rows")
+		}
+	}
+	// do not use cache
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	ro.SetFillCache(false)
+	for {
+		select {
+		case <-m.chanOsSignal:
+			return ErrOperationInterrupted
+		default:
+		}
+		wb := gorocksdb.NewWriteBatch()
+		it := d.db.NewIteratorCF(ro, d.cfh[col])
+		if lastKey == nil {
+			it.SeekToFirst()
+		} else {
+			it.Seek(lastKey)
+			if it.Valid() && bytes.Equal(it.Key().Data(), lastKey) {
+				it.Next()
+			}
+		}
+		count := 0
+		var err error
+		for ; it.Valid() && count < migrationBatchRows; it.Next() {
+			key := it.Key().Data()
+			value, ch, cerr := convert(key, it.Value().Data())
+			if cerr != nil {
+				err = errors.Annotatef(cerr, "column %v, key %x", name, key)
+				break
+			}
+			if ch {
+				changed++
+				if value == nil {
+					wb.DeleteCF(d.cfh[dst], key)
+				} else {
+					wb.PutCF(d.cfh[dst], key, value)
+				}
+			}
+			lastKey = append(lastKey[:0], key...)
+			count++
+			rows++
+		}
+		valid := it.Valid()
+		it.Close()
+		if err == nil && !m.dryRun {
+			d.is.Migration = &common.MigrationProgress{
+				Version:     m.version,
+				DoneColumns: doneColumns,
+				Column:      name,
+				LastKey:     append([]byte(nil), lastKey...),
+				Rows:        rows,
+			}
+			if err = d.storeStateToBatch(wb, d.is); err == nil {
+				err = d.db.Write(d.wo, wb)
+			}
+		}
+		wb.Destroy()
+		if err != nil {
+			return err
+		}
+		if !valid {
+			break
+		}
+		glog.Info("db: migration of column ", name, ": rows ", rows, ", changed ", changed, ", in progress...")
+	}
+	if m.dryRun {
+		glog.Info("db: migration of column ", name, ": rows ", rows, ", would change ", changed)
+		return nil
+	}
+	glog.Info("db: migration of column ", name, ": rows ", rows, ", changed ", changed)
+	d.is.Migration = &common.MigrationProgress{
+		Version:     m.version,
+		DoneColumns: append(doneColumns, name),
+	}
+	return d.storeState(d.is)
+}
+
+// migrateBlockHeaders stores the headers of the blocks indexed before the headers were stored in the headers column,
+// the headers are fetched from the backend by the block hashes
+func migrateBlockHeaders(m *migrationRun) error {
+	g, ok := m.chain.(bchain.BlockHeaderRawGetter)
+	if !ok {
+		return errors.New("The backend does not support getting of block headers")
+	}
+	d := m.d
+	return m.migrateColumnTo(cfHeight, cfHeaders, func(key, value []byte) ([]byte, bool, error) {
+		header, err := d.db.GetCF(d.ro, d.cfh[cfHeaders], key)
+		if err != nil {
+			return nil, false, err
+		}
+		stored := header.Size() > 0
+		header.Free()
+		if stored {
+			return nil, false, nil
+		}
+		if m.dryRun {
+			return []byte{}, true, nil
+		}
+		bi, err := d.unpackBlockInfo(value)
+		if err != nil {
+			return nil, false, err
+		}
+		if bi == nil {
+			return nil, false, errors.New("Invalid block info")
+		}
+		raw, err := g.GetBlockHeaderRaw(bi.Hash)
+		if err != nil {
+			return nil, false, errors.Annotatef(err, "GetBlockHeaderRaw %v", bi.Hash)
+		}
+		return raw, true, nil
+	})
+}
@@ -0,0 +1,174 @@
+//go:build unittest
+
+package db
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/trezor/blockbook/common"
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+func Test_pendingMigrations(t *testing.T) {
+	migrations := []dbMigration{{version: 4}, {version: 6}, {version: 5}}
+	tests := []struct {
+		name     string
+		from, to uint32
+		want     []uint32
+		wantErr  bool
+	}{
+		{name: "up to date", from: 6, to: 6},
+		{name: "one step", from: 5, to: 6, want: []uint32{6}},
+		{name: "ordered steps", from: 3, to: 6, want: []uint32{4, 5, 6}},
+		{name: "missing step", from: 2, to: 6, wantErr: true},
+		{name: "newer db", from: 7, to: 6, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pendingMigrations(migrations, tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pendingMigrations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("pendingMigrations() = %+v, want versions %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].version != tt.want[i] {
+					t.Errorf("pendingMigrations()[%d] = %v, want %v", i, got[i].version, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRocksDB_Migrate(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	for i := byte(0); i < 10; i++ {
+		if err := d.db.PutCF(d.wo, d.cfh[cfDefault], []byte{'m', i}, []byte{i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the test migration doubles the values of the test rows and removes the row with value 9
+	saved := dbMigrations
+	defer func() { dbMigrations = saved }()
+	dbMigrations = []dbMigration{{
+		version:     dbVersion,
+		description: "test",
+		migrate: func(m *migrationRun) error {
+			return m.migrateColumn(cfDefault, func(key, value []byte) ([]byte, bool, error) {
+				if len(key) != 2 || key[0] != 'm' {
+					return nil, false, nil
+				}
+				if value[0] == 9 {
+					return nil, true, nil
+				}
+				return []byte{value[0] * 2}, true, nil
+			})
+		},
+	}}
+	d.is.DbVersion = dbVersion - 1
+	if !d.HasPendingMigrations() {
+		t.Fatal("HasPendingMigrations() = false, want true")
+	}
+	check := func(multiplier byte) {
+		t.Helper()
+		for i := byte(0); i < 9; i++ {
+			val, err := d.db.GetCF(d.ro, d.cfh[cfDefault], []byte{'m', i})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(val.Data(), []byte{i * multiplier}) {
+				t.Errorf("row %d = %v, want %v", i, val.Data(), i*multiplier)
+			}
+			val.Free()
+		}
+	}
+
+	// dry run does not change anything
+	if err := d.Migrate(nil, true, make(chan os.Signal)); err != nil {
+		t.Fatal(err)
+	}
+	check(1)
+	if d.is.DbVersion != dbVersion-1 || d.is.Migration != nil {
+		t.Fatalf("after dry run DbVersion = %v, Migration %+v", d.is.DbVersion, d.is.Migration)
+	}
+
+	if err := d.Migrate(nil, false, make(chan os.Signal)); err != nil {
+		t.Fatal(err)
+	}
+	check(2)
+	val, err := d.db.GetCF(d.ro, d.cfh[cfDefault], []byte{'m', 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.Data() != nil {
+		t.Errorf("row 9 = %v, want deleted", val.Data())
+	}
+	val.Free()
+	if d.is.DbVersion != dbVersion || d.is.Migration != nil || d.HasPendingMigrations() {
+		t.Fatalf("after migration DbVersion = %v, Migration %+v", d.is.DbVersion, d.is.Migration)
+	}
+
+	// the column already converted by the interrupted migration is skipped
+	d.is.DbVersion = dbVersion - 1
+	d.is.Migration = &common.MigrationProgress{Version: dbVersion, DoneColumns: []string{cfNames[cfDefault]}}
+	if err := d.Migrate(nil, false, make(chan os.Signal)); err != nil {
+		t.Fatal(err)
+	}
+	check(2)
+}
+
+func TestRocksDB_migrateBlockHeaders(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	// the first block was indexed before the headers were stored
+	block1 := dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)
+	header1 := block1.RawHeader
+	block1.RawHeader = nil
+	if err := d.ConnectBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	block2 := dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	chain, err := dbtestdata.NewFakeBlockChain(d.chainParser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHeaders := func(want [][]byte) {
+		t.Helper()
+		headers, err := d.GetBlockHeaders(block1.Height, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(headers, want) {
+			t.Errorf("GetBlockHeaders() = %x, want %x", headers, want)
+		}
+	}
+	checkHeaders(nil)
+
+	d.is.DbVersion = 5
+	if err := d.Migrate(chain, true, make(chan os.Signal)); err != nil {
+		t.Fatal(err)
+	}
+	checkHeaders(nil)
+
+	if err := d.Migrate(chain, false, make(chan os.Signal)); err != nil {
+		t.Fatal(err)
+	}
+	checkHeaders([][]byte{header1, block2.RawHeader})
+	if d.is.DbVersion != dbVersion || d.HasPendingMigrations() {
+		t.Fatalf("after migration DbVersion = %v", d.is.DbVersion)
+	}
+}
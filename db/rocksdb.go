@@ -22,7 +22,7 @@ import (
 	"github.com/trezor/blockbook/common"
 )
 
-const dbVersion = 5
+const dbVersion = 6
 
 const packedHeightBytes = 4
 const maxAddrDescLen = 1024
@@ -107,6 +107,8 @@ const (
 	cfBlockTxs
 	cfTransactions
 	cfFiatRates
+	cfBroadcasts
+	cfHeaders
 	// BitcoinType
 	cfAddressBalance
 	cfTxAddresses
@@ -116,7 +118,7 @@ const (
 
 // common columns
 var cfNames []string
-var cfBaseNames = []string{"default", "height", "addresses", "blockTxs", "transactions", "fiatRates"}
+var cfBaseNames = []string{"default", "height", "addresses", "blockTxs", "transactions", "fiatRates", "broadcasts", "headers"}
 
 // type specific columns
 var cfNamesBitcoinType = []string{"addressBalance", "txAddresses"}
@@ -128,8 +130,8 @@ func openDB(path string, c *gorocksdb.Cache, openFiles int) (*gorocksdb.DB, []*g
 	// opts for addresses without bloom filter
 	// from documentation: if most of your queries are executed using iterators, you shouldn't set bloom filter
 	optsAddresses := createAndSetDBOptions(0, c, openFiles)
-	// default, height, addresses, blockTxids, transactions
-	cfOptions := []*gorocksdb.Options{opts, opts, optsAddresses, opts, opts, opts}
+	// default, height, addresses, blockTxids, transactions, fiatRates, broadcasts, headers
+	cfOptions := []*gorocksdb.Options{opts, opts, optsAddresses, opts, opts, opts, opts, opts}
 	// append type specific options
 	count := len(cfNames) - len(cfOptions)
 	for i := 0; i < count; i++ {
@@ -856,7 +858,7 @@ func (d *RocksDB) storeAddresses(wb *gorocksdb.WriteBatch, height uint32, addres
 	return nil
 }
 
-func (d *RocksDB) storeTxAddresses(wb *gorocksdb.WriteBatch, am map[string]*TxAddresses) error {
+func (d *RocksDB) storeTxAddresses(wb batchWriter, am map[string]*TxAddresses) error {
 	varBuf := make([]byte, maxPackedBigintBytes)
 	buf := make([]byte, 1024)
 	for txID, ta := range am {
@@ -866,7 +868,7 @@ func (d *RocksDB) storeTxAddresses(wb *gorocksdb.WriteBatch, am map[string]*TxAd
 	return nil
 }
 
-func (d *RocksDB) storeBalances(wb *gorocksdb.WriteBatch, abm map[string]*AddrBalance) error {
+func (d *RocksDB) storeBalances(wb batchWriter, abm map[string]*AddrBalance) error {
 	// allocate buffer initial buffer
 	buf := make([]byte, 1024)
 	varBuf := make([]byte, maxPackedBigintBytes)
@@ -910,20 +912,9 @@ func (d *RocksDB) storeAndCleanupBlockTxs(wb *gorocksdb.WriteBatch, block *bchai
 	zeroTx := make([]byte, pl)
 	for i := range block.Txs {
 		tx := &block.Txs[i]
-		o := make([]outpoint, len(tx.Vin))
-		for v := range tx.Vin {
-			vin := &tx.Vin[v]
-			btxID, err := d.chainParser.PackTxid(vin.Txid)
-			if err != nil {
-				// do not process inputs without input txid
-				if err == bchain.ErrTxidMissing {
-					btxID = zeroTx
-				} else {
-					return err
-				}
-			}
-			o[v].btxID = btxID
-			o[v].index = int32(vin.Vout)
+		o, err := d.txInputOutpoints(tx, zeroTx)
+		if err != nil {
+			return err
 		}
 		btxID, err := d.chainParser.PackTxid(tx.Txid)
 		if err != nil {
@@ -939,6 +930,47 @@ func (d *RocksDB) storeAndCleanupBlockTxs(wb *gorocksdb.WriteBatch, block *bchai
 	return d.cleanupBlockTxs(wb, block)
 }
 
+// txInputOutpoints returns the outpoints spent by the inputs of the transaction, zeroTx is used for inputs without input txid
+func (d *RocksDB) txInputOutpoints(tx *bchain.Tx, zeroTx []byte) ([]outpoint, error) {
+	o := make([]outpoint, len(tx.Vin))
+	for v := range tx.Vin {
+		vin := &tx.Vin[v]
+		btxID, err := d.chainParser.PackTxid(vin.Txid)
+		if err != nil {
+			// do not process inputs without input txid
+			if err == bchain.ErrTxidMissing {
+				btxID = zeroTx
+			} else {
+				return nil, err
+			}
+		}
+		o[v].btxID = btxID
+		o[v].index = int32(vin.Vout)
+	}
+	return o, nil
+}
+
+// blockTxsFromTxs creates the blockTxs data, as they are stored in the blockTxs column, from the transactions of a block
+func (d *RocksDB) blockTxsFromTxs(txs []bchain.Tx) ([]blockTxs, error) {
+	zeroTx := make([]byte, d.chainParser.PackedTxidLen())
+	bt := make([]blockTxs, len(txs))
+	for i := range txs {
+		o, err := d.txInputOutpoints(&txs[i], zeroTx)
+		if err != nil {
+			return nil, err
+		}
+		btxID, err := d.chainParser.PackTxid(txs[i].Txid)
+		if err != nil {
+			return nil, err
+		}
+		bt[i] = blockTxs{
+			btxID:  btxID,
+			inputs: o,
+		}
+	}
+	return bt, nil
+}
+
 func (d *RocksDB) getBlockTxs(height uint32) ([]blockTxs, error) {
 	pl := d.chainParser.PackedTxidLen()
 	val, err := d.db.GetCF(d.ro, d.cfh[cfBlockTxs], packUint(height))
@@ -1235,6 +1267,8 @@ type BlockInfo struct {
 	Txs    uint32
 	Size   uint32
 	Height uint32 // Height is not packed!
+	// RawHeader is not packed, it is stored in the headers column
+	RawHeader []byte
 }
 
 func (d *RocksDB) packBlockInfo(block *BlockInfo) ([]byte, error) {
@@ -1331,13 +1365,32 @@ func (d *RocksDB) GetBlockInfo(height uint32) (*BlockInfo, error) {
 	return bi, err
 }
 
+// GetBlockHeaders returns the stored raw headers of up to count consecutive blocks starting at height from
+// the headers are returned up to the first block without a stored header
+func (d *RocksDB) GetBlockHeaders(from uint32, count int) ([][]byte, error) {
+	var headers [][]byte
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfHeaders])
+	defer it.Close()
+	for it.Seek(packUint(from)); it.Valid() && len(headers) < count; it.Next() {
+		if unpackUint(it.Key().Data()) != from+uint32(len(headers)) {
+			break
+		}
+		headers = append(headers, append([]byte(nil), it.Value().Data()...))
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
 func (d *RocksDB) writeHeightFromBlock(wb *gorocksdb.WriteBatch, block *bchain.Block, op int) error {
 	return d.writeHeight(wb, block.Height, &BlockInfo{
-		Hash:   block.Hash,
-		Time:   block.Time,
-		Txs:    uint32(len(block.Txs)),
-		Size:   uint32(block.Size),
-		Height: block.Height,
+		Hash:      block.Hash,
+		Time:      block.Time,
+		Txs:       uint32(len(block.Txs)),
+		Size:      uint32(block.Size),
+		Height:    block.Height,
+		RawHeader: block.RawHeader,
 	}, op)
 }
 
@@ -1350,9 +1403,13 @@ func (d *RocksDB) writeHeight(wb *gorocksdb.WriteBatch, height uint32, bi *Block
 			return err
 		}
 		wb.PutCF(d.cfh[cfHeight], key, val)
+		if len(bi.RawHeader) > 0 {
+			wb.PutCF(d.cfh[cfHeaders], key, bi.RawHeader)
+		}
 		d.is.UpdateBestHeight(height)
 	case opDelete:
 		wb.DeleteCF(d.cfh[cfHeight], key)
+		wb.DeleteCF(d.cfh[cfHeaders], key)
 		d.is.UpdateBestHeight(height - 1)
 	}
 	return nil
@@ -1525,6 +1582,7 @@ func (d *RocksDB) disconnectBlock(height uint32, blockTxs []blockTxs) error {
 	key := packUint(height)
 	wb.DeleteCF(d.cfh[cfBlockTxs], key)
 	wb.DeleteCF(d.cfh[cfHeight], key)
+	wb.DeleteCF(d.cfh[cfHeaders], key)
 	d.storeTxAddresses(wb, txAddressesToUpdate)
 	d.storeBalancesDisconnect(wb, balances)
 	for s := range txsToDelete {
@@ -1538,17 +1596,90 @@ func (d *RocksDB) disconnectBlock(height uint32, blockTxs []blockTxs) error {
 // DisconnectBlockRangeBitcoinType removes all data belonging to blocks in range lower-higher
 // it is able to disconnect only blocks for which there are data in the blockTxs column
 func (d *RocksDB) DisconnectBlockRangeBitcoinType(lower uint32, higher uint32) error {
+	blocks, err := d.getBlockRangeTxs(lower, higher, nil)
+	if err != nil {
+		return err
+	}
+	return d.disconnectBlockRangeBitcoinType(lower, higher, blocks)
+}
+
+// getBlockRangeTxs returns the blockTxs data of the blocks in range lower-higher
+// the data of the blocks, which are no longer in the blockTxs column, are obtained by the reconstruct function, if it is set
+func (d *RocksDB) getBlockRangeTxs(lower uint32, higher uint32, reconstruct func(height uint32) ([]blockTxs, error)) ([][]blockTxs, error) {
 	blocks := make([][]blockTxs, higher-lower+1)
 	for height := lower; height <= higher; height++ {
 		blockTxs, err := d.getBlockTxs(height)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if len(blockTxs) == 0 && reconstruct != nil {
+			blockTxs, err = reconstruct(height)
+			if err != nil {
+				return nil, errors.Annotatef(err, "Cannot reconstruct data of block %v", height)
+			}
 		}
 		if len(blockTxs) == 0 {
-			return errors.Errorf("Cannot disconnect blocks with height %v and lower. It is necessary to rebuild index.", height)
+			return nil, errors.Errorf("Cannot disconnect blocks with height %v and lower. It is necessary to rebuild index.", height)
 		}
 		blocks[height-lower] = blockTxs
 	}
+	return blocks, nil
+}
+
+// getTxidsOfBlocks returns the txids of the indexed transactions of the blocks in range lower-higher
+// the index does not contain the list of the transactions of a block, the whole txAddresses column is scanned
+// for the transactions with the height in the range, which can be very slow operation
+func (d *RocksDB) getTxidsOfBlocks(lower uint32, higher uint32, stop chan os.Signal) (map[uint32][]string, error) {
+	glog.Info("rocksdb: scanning txAddresses for transactions of blocks ", lower, "-", higher)
+	txids := make(map[uint32][]string)
+	var rows int64
+	var seekKey []byte
+	// do not use cache
+	ro := gorocksdb.NewDefaultReadOptions()
+	ro.SetFillCache(false)
+	for {
+		var key []byte
+		it := d.db.NewIteratorCF(ro, d.cfh[cfTxAddresses])
+		if rows == 0 {
+			it.SeekToFirst()
+		} else {
+			glog.Info("rocksdb: scanning txAddresses, rows ", rows, ", in progress...")
+			it.Seek(seekKey)
+			it.Next()
+		}
+		for count := 0; it.Valid() && count < refreshIterator; it.Next() {
+			select {
+			case <-stop:
+				it.Close()
+				return nil, errors.New("Interrupted")
+			default:
+			}
+			key = it.Key().Data()
+			count++
+			rows++
+			height, l := unpackVaruint(it.Value().Data())
+			if l == 0 || uint32(height) < lower || uint32(height) > higher {
+				continue
+			}
+			txid, err := d.chainParser.UnpackTxid(key)
+			if err != nil {
+				it.Close()
+				return nil, err
+			}
+			txids[uint32(height)] = append(txids[uint32(height)], txid)
+		}
+		seekKey = append([]byte{}, key...)
+		valid := it.Valid()
+		it.Close()
+		if !valid {
+			break
+		}
+	}
+	return txids, nil
+}
+
+// disconnectBlockRangeBitcoinType disconnects blocks in range lower-higher using the already loaded blockTxs data
+func (d *RocksDB) disconnectBlockRangeBitcoinType(lower uint32, higher uint32, blocks [][]blockTxs) error {
 	for height := higher; height >= lower; height-- {
 		err := d.disconnectBlock(height, blocks[height-lower])
 		if err != nil {
@@ -1707,7 +1838,7 @@ func (d *RocksDB) LoadInternalState(rpcCoin string) (*common.InternalState, erro
 	data := val.Data()
 	var is *common.InternalState
 	if len(data) == 0 {
-		is = &common.InternalState{Coin: rpcCoin, UtxoChecked: true}
+		is = &common.InternalState{Coin: rpcCoin, UtxoChecked: true, DbVersion: dbVersion}
 	} else {
 		is, err = common.UnpackInternalState(data)
 		if err != nil {
@@ -1723,15 +1854,29 @@ func (d *RocksDB) LoadInternalState(rpcCoin string) (*common.InternalState, erro
 	}
 	// make sure that column stats match the columns
 	sc := is.DbColumns
+	if is.DbVersion == 0 {
+		// the db was created before the version was stored in the internal state, the columns contain it
+		is.DbVersion = dbVersion
+		if len(sc) > 0 {
+			is.DbVersion = sc[0].Version
+		}
+	}
+	if is.DbVersion != dbVersion {
+		// older db can be used only if it can be migrated to the required version
+		if _, err := pendingMigrations(dbMigrations, is.DbVersion, dbVersion); err != nil {
+			return nil, errors.Errorf("DB version %v does not match the required version %v. DB is not compatible: %v", is.DbVersion, dbVersion, err)
+		}
+		glog.Warningf("rocksdb: DB version %v is older than the required version %v, the data must be migrated", is.DbVersion, dbVersion)
+	}
 	nc := make([]common.InternalStateColumn, len(cfNames))
 	for i := 0; i < len(nc); i++ {
 		nc[i].Name = cfNames[i]
-		nc[i].Version = dbVersion
+		nc[i].Version = is.DbVersion
 		for j := 0; j < len(sc); j++ {
 			if sc[j].Name == nc[i].Name {
 				// check the version of the column, if it does not match, the db is not compatible
-				if sc[j].Version != dbVersion {
-					return nil, errors.Errorf("DB version %v of column '%v' does not match the required version %v. DB is not compatible.", sc[j].Version, sc[j].Name, dbVersion)
+				if sc[j].Version != is.DbVersion {
+					return nil, errors.Errorf("DB version %v of column '%v' does not match the DB version %v. DB is not compatible.", sc[j].Version, sc[j].Name, is.DbVersion)
 				}
 				nc[i].Rows = sc[j].Rows
 				nc[i].KeyBytes = sc[j].KeyBytes
@@ -1794,6 +1939,15 @@ func (d *RocksDB) storeState(is *common.InternalState) error {
 	return d.db.PutCF(d.wo, d.cfh[cfDefault], []byte(internalStateKey), buf)
 }
 
+func (d *RocksDB) storeStateToBatch(wb *gorocksdb.WriteBatch, is *common.InternalState) error {
+	buf, err := is.Pack()
+	if err != nil {
+		return err
+	}
+	wb.PutCF(d.cfh[cfDefault], []byte(internalStateKey), buf)
+	return nil
+}
+
 func (d *RocksDB) computeColumnSize(col int, stopCompute chan os.Signal) (int64, int64, int64, error) {
 	var rows, keysSum, valuesSum int64
 	var seekKey []byte
@@ -25,7 +25,7 @@ type AddrContracts struct {
 	Contracts      []AddrContract
 }
 
-func (d *RocksDB) storeAddressContracts(wb *gorocksdb.WriteBatch, acm map[string]*AddrContracts) error {
+func (d *RocksDB) storeAddressContracts(wb batchWriter, acm map[string]*AddrContracts) error {
 	buf := make([]byte, 64)
 	varBuf := make([]byte, vlq.MaxLen64)
 	for addrDesc, acs := range acm {
@@ -451,6 +451,7 @@ func (d *RocksDB) DisconnectBlockRangeEthereumType(lower uint32, higher uint32)
 		key := packUint(height)
 		wb.DeleteCF(d.cfh[cfBlockTxs], key)
 		wb.DeleteCF(d.cfh[cfHeight], key)
+		wb.DeleteCF(d.cfh[cfHeaders], key)
 	}
 	d.storeAddressContracts(wb, contracts)
 	err := d.db.Write(d.wo, wb)
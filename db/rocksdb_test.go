@@ -3,6 +3,7 @@
 package db
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"io/ioutil"
@@ -15,6 +16,7 @@ import (
 	"time"
 
 	vlq "github.com/bsm/go-vlq"
+	"github.com/flier/gorocksdb"
 	"github.com/juju/errors"
 	"github.com/martinboehm/btcutil/chaincfg"
 	"github.com/trezor/blockbook/bchain"
@@ -189,6 +191,13 @@ func verifyAfterBitcoinTypeBlock1(t *testing.T, d *RocksDB, afterDisconnect bool
 			t.Fatal(err)
 		}
 	}
+	if err := checkColumn(d, cfHeaders, []keyPair{
+		{"000370d5", "00000020c2d1b5638f2e9a0a6e5b4a8cbdd07f0c2a2a6a2abd146f8f0e00000000000000790677d9812841c00755c399c5ddf0894e52cc40707b8a4a366dbd532d8d9b4b127ab05affff001d812c9f7d", nil},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
 	// the vout is encoded as signed varint, i.e. value * 2 for non negative values
 	if err := checkColumn(d, cfAddresses, []keyPair{
 		{addressKeyHex(dbtestdata.Addr1, 225493, d), txIndexesHex(dbtestdata.TxidB1T1, []int32{0}), nil},
@@ -302,6 +311,14 @@ func verifyAfterBitcoinTypeBlock2(t *testing.T, d *RocksDB) {
 			t.Fatal(err)
 		}
 	}
+	if err := checkColumn(d, cfHeaders, []keyPair{
+		{"000370d5", "00000020c2d1b5638f2e9a0a6e5b4a8cbdd07f0c2a2a6a2abd146f8f0e00000000000000790677d9812841c00755c399c5ddf0894e52cc40707b8a4a366dbd532d8d9b4b127ab05affff001d812c9f7d", nil},
+		{"000370d6", "0000002097294ee985ad46f74c449d9c4e98aa5ba36a85180e5bd70fd9befb760000000083343d58b1ba9eb96d94a2abeeb73882fc25c12ab6d5002d76c2bb5d7356b58c1eb5b15affff001de1447139", nil},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
 	if err := checkColumn(d, cfAddresses, []keyPair{
 		{addressKeyHex(dbtestdata.Addr1, 225493, d), txIndexesHex(dbtestdata.TxidB1T1, []int32{0}), nil},
 		{addressKeyHex(dbtestdata.Addr2, 225493, d), txIndexesHex(dbtestdata.TxidB1T1, []int32{1, 2}), nil},
@@ -632,6 +649,15 @@ func TestRocksDB_Index_BitcoinType(t *testing.T) {
 		t.Errorf("GetBlockInfo() = %+v, want %+v", info, iw)
 	}
 
+	// GetBlockHeaders, the range is cut at the first block without header
+	headers, err := d.GetBlockHeaders(225493, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hw := [][]byte{block1.RawHeader, block2.RawHeader}; !reflect.DeepEqual(headers, hw) {
+		t.Errorf("GetBlockHeaders() = %x, want %x", headers, hw)
+	}
+
 	// Test tx caching functionality, leave one tx in db to test cleanup in DisconnectBlock
 	testTxCache(t, d, block1, &block1.Txs[0])
 	testTxCache(t, d, block2, &block2.Txs[0])
@@ -756,6 +782,47 @@ func TestRocksDB_Index_BitcoinType(t *testing.T) {
 
 }
 
+func TestRocksDB_getTxidsOfBlocks(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	block1 := dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)
+	if err := d.ConnectBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	block2 := dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	blockTxids := func(b *bchain.Block) []string {
+		txids := make([]string, len(b.Txs))
+		for i := range b.Txs {
+			txids[i] = b.Txs[i].Txid
+		}
+		sort.Strings(txids)
+		return txids
+	}
+
+	got, err := d.getTxidsOfBlocks(block2.Height, block2.Height, make(chan os.Signal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got[block2.Height])
+	if len(got) != 1 || !reflect.DeepEqual(got[block2.Height], blockTxids(block2)) {
+		t.Errorf("getTxidsOfBlocks() = %v, want %v", got, blockTxids(block2))
+	}
+
+	got, err = d.getTxidsOfBlocks(block1.Height, block2.Height, make(chan os.Signal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got[block1.Height])
+	if len(got) != 2 || !reflect.DeepEqual(got[block1.Height], blockTxids(block1)) || len(got[block2.Height]) != len(block2.Txs) {
+		t.Errorf("getTxidsOfBlocks() = %v", got)
+	}
+}
+
 func Test_BulkConnect_BitcoinType(t *testing.T) {
 	d := setupRocksDB(t, &testBitcoinParser{
 		BitcoinParser: bitcoinTestnetParser(),
@@ -803,6 +870,141 @@ func Test_BulkConnect_BitcoinType(t *testing.T) {
 	}
 }
 
+func Test_BulkConnect_Resume_BitcoinType(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	bc, err := d.InitBulkConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if d.is.BulkCheckpointHeight != 225493 {
+		t.Fatal("Expecting is.BulkCheckpointHeight 225493, got ", d.is.BulkCheckpointHeight)
+	}
+
+	// connect the 2nd block and store its addresses and block txs without checkpoint, then simulate crash
+	if err := bc.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser), true); err != nil {
+		t.Fatal(err)
+	}
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	if err := bc.storeBulkAddresses(wb, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.db.Write(d.wo, wb); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.ResumeBulkConnect(); err != nil {
+		t.Fatal(err)
+	}
+	if d.is.DbState != common.DbStateOpen {
+		t.Fatal("DB not in DbStateOpen")
+	}
+	if d.is.BulkCheckpointHash != "" {
+		t.Fatal("Expecting empty is.BulkCheckpointHash, got ", d.is.BulkCheckpointHash)
+	}
+	height, _, err := d.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 225493 {
+		t.Fatalf("GetBestBlock: got height %v, expected %v", height, 225493)
+	}
+	// the addresses of the 2nd block stored ahead of the checkpoint are removed
+	verifyAfterBitcoinTypeBlock1(t, d, true)
+	checkNoBulkAddresses(t, d)
+
+	// connect the 2nd block again, the result must be the same as without the interruption
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	verifyAfterBitcoinTypeBlock2(t, d)
+}
+
+func checkNoBulkAddresses(t *testing.T, d *RocksDB) {
+	t.Helper()
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfDefault])
+	defer it.Close()
+	for it.Seek([]byte(bulkAddressesKeyPrefix)); it.Valid(); it.Next() {
+		if bytes.HasPrefix(it.Key().Data(), []byte(bulkAddressesKeyPrefix)) {
+			t.Fatalf("unexpected key %q in default column", it.Key().Data())
+		}
+	}
+}
+
+func Test_BulkConnect_ResumeEmpty_BitcoinType(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	bc, err := d.InitBulkConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.is.BulkCheckpointEmpty {
+		t.Fatal("Expecting is.BulkCheckpointEmpty for empty db")
+	}
+	// store the addresses of the 1st block without any checkpoint, then simulate crash
+	if err := bc.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser), false); err != nil {
+		t.Fatal(err)
+	}
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	if err := bc.storeBulkAddresses(wb, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.db.Write(d.wo, wb); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.ResumeBulkConnect(); err != nil {
+		t.Fatal(err)
+	}
+	if d.is.DbState != common.DbStateOpen || d.is.BulkCheckpointEmpty {
+		t.Fatalf("Unexpected state after resume %+v", d.is)
+	}
+	for _, cf := range []int{cfHeight, cfHeaders, cfAddresses} {
+		if err := checkColumn(d, cf, []keyPair{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkNoBulkAddresses(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	verifyAfterBitcoinTypeBlock2(t, d)
+}
+
+func Test_packBulkAddresses(t *testing.T) {
+	addresses := addressesMap{"\x00\x14abc": nil, "xyz": nil}
+	got, err := unpackBulkAddresses(packBulkAddresses(addresses))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(addresses) {
+		t.Fatalf("unpackBulkAddresses() = %v", got)
+	}
+	for _, a := range got {
+		if _, found := addresses[string(a)]; !found {
+			t.Errorf("unexpected address %v", a)
+		}
+	}
+}
+
 func Test_packBigint_unpackBigint(t *testing.T) {
 	bigbig1, _ := big.NewInt(0).SetString("123456789123456789012345", 10)
 	bigbig2, _ := big.NewInt(0).SetString("12345678912345678901234512389012345123456789123456789012345123456789123456789012345", 10)
@@ -23,6 +23,9 @@ type SyncWorker struct {
 	chanOsSignal           chan os.Signal
 	metrics                *common.Metrics
 	is                     *common.InternalState
+	blockSource            bchain.BlockSource
+	running                chan struct{}
+	paused                 int32
 }
 
 // NewSyncWorker creates new SyncWorker and returns its handle
@@ -40,15 +43,106 @@ func NewSyncWorker(db *RocksDB, chain bchain.BlockChain, syncWorkers, syncChunk
 		chanOsSignal: chanOsSignal,
 		metrics:      metrics,
 		is:           is,
+		running:      make(chan struct{}, 1),
 	}, nil
 }
 
+// SetBlockSource sets the source of blocks used in the parallel sync before falling back to the backend
+func (w *SyncWorker) SetBlockSource(blockSource bchain.BlockSource) {
+	w.blockSource = blockSource
+}
+
+// blockSourceTipDistance is the distance from the tip of the backend below which the blocks are read from the block source,
+// the blocks closer to the tip can still be reorganized or not yet flushed to the block files by the backend
+const blockSourceTipDistance = 100
+
 var errSynced = errors.New("synced")
 var errFork = errors.New("fork")
+var errPaused = errors.New("paused")
 
 // ErrOperationInterrupted is returned when operation is interrupted by OS signal
 var ErrOperationInterrupted = errors.New("ErrOperationInterrupted")
 
+// ErrSyncRunning is returned when operation cannot be performed because the synchronization is running
+var ErrSyncRunning = errors.New("Synchronization is running")
+
+// Pause pauses the synchronization, the running synchronization stops after the currently connected block
+// the initial synchronization waits until it is resumed
+func (w *SyncWorker) Pause() {
+	if atomic.CompareAndSwapInt32(&w.paused, 0, 1) {
+		glog.Info("sync: paused")
+	}
+	w.is.SetSyncPaused(true)
+}
+
+// Resume resumes the paused synchronization
+func (w *SyncWorker) Resume() {
+	if atomic.CompareAndSwapInt32(&w.paused, 1, 0) {
+		glog.Info("sync: resumed")
+	}
+	w.is.SetSyncPaused(false)
+}
+
+// IsPaused returns true if the synchronization is paused
+func (w *SyncWorker) IsPaused() bool {
+	return atomic.LoadInt32(&w.paused) != 0
+}
+
+// waitWhilePaused blocks while the synchronization is paused, returns ErrOperationInterrupted on OS signal
+func (w *SyncWorker) waitWhilePaused() error {
+	for w.IsPaused() {
+		select {
+		case <-w.chanOsSignal:
+			return ErrOperationInterrupted
+		case <-time.After(time.Second):
+		}
+	}
+	return nil
+}
+
+// Rollback disconnects the blocks from height up to the best block
+// returns ErrSyncRunning if the synchronization is running at the moment
+func (w *SyncWorker) Rollback(height uint32) error {
+	select {
+	case w.running <- struct{}{}:
+		defer func() { <-w.running }()
+	default:
+		return ErrSyncRunning
+	}
+	bestHeight, _, err := w.db.GetBestBlock()
+	if err != nil {
+		return err
+	}
+	if height > bestHeight {
+		glog.Infof("nothing to rollback, rollbackHeight %d, bestHeight: %d", height, bestHeight)
+		return nil
+	}
+	hashes := make([]string, 0, bestHeight-height+1)
+	for h := bestHeight; h >= height; h-- {
+		hash, err := w.db.GetBlockHash(h)
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, hash)
+		if h == 0 {
+			break
+		}
+	}
+	w.is.SetSyncStage(common.SyncStageRollback, bestHeight, height)
+	defer w.is.SetSyncStage(common.SyncStageIdle, 0, 0)
+	w.is.StartedSync()
+	if err = w.DisconnectBlocks(height, bestHeight, hashes); err != nil {
+		return err
+	}
+	bestHeight, _, err = w.db.GetBestBlock()
+	if err != nil {
+		return err
+	}
+	w.is.UpdateBestHeight(bestHeight)
+	w.metrics.BlockbookBestHeight.Set(float64(bestHeight))
+	return nil
+}
+
 func (w *SyncWorker) updateBackendInfo() {
 	ci, err := w.chain.GetChainInfo()
 	var backendError string
@@ -71,16 +165,31 @@ func (w *SyncWorker) updateBackendInfo() {
 		Version:         ci.Version,
 		Warnings:        ci.Warnings,
 		Consensus:       ci.Consensus,
+		Endpoints:       ci.Endpoints,
 	})
 }
 
 // ResyncIndex synchronizes index to the top of the blockchain
 // onNewBlock is called when new block is connected, but not in initial parallel sync
-func (w *SyncWorker) ResyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
+// onReorg is called after blocks were disconnected due to a fork and the index is synchronized to the new chain
+// if the synchronization is paused, the regular resync is skipped and the initial sync waits until it is resumed
+func (w *SyncWorker) ResyncIndex(onNewBlock bchain.OnNewBlockFunc, onReorg bchain.OnReorgFunc, initialSync bool) error {
+	if initialSync {
+		if err := w.waitWhilePaused(); err != nil {
+			return err
+		}
+	} else if w.IsPaused() {
+		// the index is not kept in sync with the backend while paused, for example after a rollback
+		w.is.StartedSync()
+		return nil
+	}
+	w.running <- struct{}{}
+	defer func() { <-w.running }()
 	start := time.Now()
 	w.is.StartedSync()
 
-	err := w.resyncIndex(onNewBlock, initialSync)
+	err := w.resyncIndex(onNewBlock, onReorg, initialSync)
+	w.is.SetSyncStage(common.SyncStageIdle, 0, 0)
 
 	// update backend info after each resync
 	w.updateBackendInfo()
@@ -107,6 +216,13 @@ func (w *SyncWorker) ResyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 			glog.Info("resync: finished in ", d)
 		}
 		return nil
+	case errPaused:
+		glog.Info("resync: paused")
+		if bh, _, err := w.db.GetBestBlock(); err == nil {
+			w.is.UpdateBestHeight(bh)
+			w.metrics.BlockbookBestHeight.Set(float64(bh))
+		}
+		return nil
 	}
 
 	w.metrics.IndexResyncErrors.With(common.Labels{"error": "failure"}).Inc()
@@ -114,7 +230,7 @@ func (w *SyncWorker) ResyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 	return err
 }
 
-func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
+func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, onReorg bchain.OnReorgFunc, initialSync bool) error {
 	remoteBestHash, err := w.chain.GetBestBlockHash()
 	if err != nil {
 		return err
@@ -137,7 +253,7 @@ func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 		if remoteHash != localBestHash {
 			// forked - the remote hash differs from the local hash at the same height
 			glog.Info("resync: local is forked at height ", localBestHeight, ", local hash ", localBestHash, ", remote hash ", remoteHash)
-			return w.handleFork(localBestHeight, localBestHash, onNewBlock, initialSync)
+			return w.handleFork(localBestHeight, localBestHash, onNewBlock, onReorg, initialSync)
 		}
 		glog.Info("resync: local at ", localBestHeight, " is behind")
 		w.startHeight = localBestHeight + 1
@@ -163,25 +279,37 @@ func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 		}
 		if remoteBestHeight-w.startHeight > uint32(w.syncChunk) {
 			glog.Infof("resync: parallel sync of blocks %d-%d, using %d workers", w.startHeight, remoteBestHeight, w.syncWorkers)
+			w.is.SetSyncStage(common.SyncStageParallel, w.startHeight, remoteBestHeight)
 			err = w.ConnectBlocksParallel(w.startHeight, remoteBestHeight)
 			if err != nil {
 				return err
 			}
 			// after parallel load finish the sync using standard way,
 			// new blocks may have been created in the meantime
-			return w.resyncIndex(onNewBlock, initialSync)
+			return w.resyncIndex(onNewBlock, onReorg, initialSync)
 		}
 	}
+	stage := common.SyncStageSync
+	if initialSync {
+		stage = common.SyncStageInitial
+	}
+	// the target height is used only to show the progress of the sync
+	remoteBestHeight, err := w.chain.GetBestBlockHeight()
+	if err != nil {
+		glog.Warning("resync: GetBestBlockHeight error ", err)
+	}
+	w.is.SetSyncStage(stage, w.startHeight, remoteBestHeight)
 	err = w.connectBlocks(onNewBlock, initialSync)
 	if err == errFork {
-		return w.resyncIndex(onNewBlock, initialSync)
+		return w.resyncIndex(onNewBlock, onReorg, initialSync)
 	}
 	return err
 }
 
-func (w *SyncWorker) handleFork(localBestHeight uint32, localBestHash string, onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
+func (w *SyncWorker) handleFork(localBestHeight uint32, localBestHash string, onNewBlock bchain.OnNewBlockFunc, onReorg bchain.OnReorgFunc, initialSync bool) error {
 	// find forked blocks, disconnect them and then synchronize again
 	var height uint32
+	var forkHash string
 	hashes := []string{localBestHash}
 	for height = localBestHeight - 1; height >= 0; height-- {
 		local, err := w.db.GetBlockHash(height)
@@ -197,14 +325,130 @@ func (w *SyncWorker) handleFork(localBestHeight uint32, localBestHash string, on
 			return err
 		}
 		if local == remote {
+			forkHash = local
 			break
 		}
 		hashes = append(hashes, local)
 	}
-	if err := w.DisconnectBlocks(height+1, localBestHeight, hashes); err != nil {
+	parser := w.chain.GetChainParser()
+	var blocks [][]blockTxs
+	if parser.GetChainType() == bchain.ChainBitcoinType {
+		if keep := parser.KeepBlockAddresses(); localBestHeight-height > uint32(keep) {
+			glog.Warning("resync: fork of ", localBestHeight-height, " blocks is deeper than ", keep, " kept blocks, the data of the older blocks will be reconstructed")
+		}
+		// load the data of all forked blocks before the disconnect starts, not to leave the index in inconsistent state
+		var err error
+		if blocks, err = w.getDisconnectBlockTxs(height+1, localBestHeight); err != nil {
+			return err
+		}
+	}
+	var reorg *bchain.Reorg
+	if onReorg != nil {
+		reorg = &bchain.Reorg{
+			ForkHeight:         height,
+			ForkHash:           forkHash,
+			DisconnectedHashes: hashes,
+		}
+		txs, err := w.getReorgTxs(height+1, localBestHeight, blocks)
+		if err != nil {
+			glog.Error("getReorgTxs error ", err)
+		}
+		reorg.Txs = txs
+	}
+	if err := w.disconnectBlocks(height+1, localBestHeight, blocks); err != nil {
 		return err
 	}
-	return w.resyncIndex(onNewBlock, initialSync)
+	err := w.resyncIndex(onNewBlock, onReorg, initialSync)
+	if reorg != nil {
+		// the blocks were disconnected, notify about the reorg even if the sync of the new chain failed
+		w.resolveReorgTxs(reorg.Txs)
+		onReorg(reorg)
+	}
+	return err
+}
+
+// getReorgTxs returns transactions of the blocks in range lower-higher, which are about to be disconnected,
+// together with the addresses they affect; for bitcoin type coins blocks contain the blockTxs data of the blocks
+func (w *SyncWorker) getReorgTxs(lower uint32, higher uint32, blocks [][]blockTxs) ([]bchain.ReorgTx, error) {
+	var txs []bchain.ReorgTx
+	parser := w.chain.GetChainParser()
+	add := func(btxID []byte, addrDescs ...bchain.AddressDescriptor) error {
+		txid, err := parser.UnpackTxid(btxID)
+		if err != nil {
+			return err
+		}
+		tx := bchain.ReorgTx{Txid: txid}
+		seen := make(map[string]struct{}, len(addrDescs))
+		for _, ad := range addrDescs {
+			if _, found := seen[string(ad)]; len(ad) > 0 && !found {
+				seen[string(ad)] = struct{}{}
+				tx.AddrDescs = append(tx.AddrDescs, ad)
+			}
+		}
+		txs = append(txs, tx)
+		return nil
+	}
+	for height := lower; height <= higher; height++ {
+		switch parser.GetChainType() {
+		case bchain.ChainBitcoinType:
+			blockTxs := blocks[height-lower]
+			for i := range blockTxs {
+				ta, err := w.db.getTxAddresses(blockTxs[i].btxID)
+				if err != nil {
+					return txs, err
+				}
+				var addrDescs []bchain.AddressDescriptor
+				if ta != nil {
+					for j := range ta.Inputs {
+						addrDescs = append(addrDescs, ta.Inputs[j].AddrDesc)
+					}
+					for j := range ta.Outputs {
+						addrDescs = append(addrDescs, ta.Outputs[j].AddrDesc)
+					}
+				}
+				if err = add(blockTxs[i].btxID, addrDescs...); err != nil {
+					return txs, err
+				}
+			}
+		case bchain.ChainEthereumType:
+			blockTxs, err := w.db.getBlockTxsEthereumType(height)
+			if err != nil {
+				return txs, err
+			}
+			for i := range blockTxs {
+				addrDescs := []bchain.AddressDescriptor{blockTxs[i].from, blockTxs[i].to}
+				for _, c := range blockTxs[i].contracts {
+					addrDescs = append(addrDescs, c.addr, c.contract)
+				}
+				if err = add(blockTxs[i].btxID, addrDescs...); err != nil {
+					return txs, err
+				}
+			}
+		}
+	}
+	return txs, nil
+}
+
+// resolveReorgTxs sets the status of the transactions of the disconnected blocks after the sync of the new chain
+func (w *SyncWorker) resolveReorgTxs(txs []bchain.ReorgTx) {
+	bitcoinType := w.chain.GetChainParser().GetChainType() == bchain.ChainBitcoinType
+	for i := range txs {
+		tx := &txs[i]
+		if bitcoinType {
+			if ta, err := w.db.GetTxAddresses(tx.Txid); err == nil && ta != nil {
+				tx.Status = bchain.ReorgTxConfirmed
+				continue
+			}
+		}
+		t, err := w.chain.GetTransactionForMempool(tx.Txid)
+		if err != nil {
+			tx.Status = bchain.ReorgTxVanished
+		} else if t.Confirmations > 0 {
+			tx.Status = bchain.ReorgTxConfirmed
+		} else {
+			tx.Status = bchain.ReorgTxMempool
+		}
+	}
 }
 
 func (w *SyncWorker) connectBlocks(onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
@@ -228,6 +472,7 @@ func (w *SyncWorker) connectBlocks(onNewBlock bchain.OnNewBlockFunc, initialSync
 		if onNewBlock != nil {
 			onNewBlock(res.block.Hash, res.block.Height)
 		}
+		w.is.SetSyncHeight(res.block.Height)
 		w.metrics.BlockbookBestHeight.Set(float64(res.block.Height))
 		if res.block.Height > 0 && res.block.Height%1000 == 0 {
 			glog.Info("connected block ", res.block.Height, " ", res.block.Hash)
@@ -251,6 +496,10 @@ func (w *SyncWorker) connectBlocks(onNewBlock bchain.OnNewBlockFunc, initialSync
 				if err != nil {
 					return err
 				}
+				if err = w.waitWhilePaused(); err != nil {
+					glog.Info("connectBlocks interrupted at height ", lastRes.block.Height)
+					return err
+				}
 			}
 		}
 	} else {
@@ -260,6 +509,10 @@ func (w *SyncWorker) connectBlocks(onNewBlock bchain.OnNewBlockFunc, initialSync
 			if err != nil {
 				return err
 			}
+			if w.IsPaused() {
+				glog.Info("connectBlocks paused at height ", res.block.Height)
+				return errPaused
+			}
 		}
 	}
 
@@ -311,6 +564,7 @@ func (w *SyncWorker) ConnectBlocksParallel(lower, higher uint32) error {
 					glog.Fatal("writeBlockWorker ", b.Height, " ", b.Hash, " error ", err)
 				}
 				lastBlock = b.Height
+				w.is.SetSyncHeight(b.Height)
 			case <-terminating:
 				break WriteBlockLoop
 			}
@@ -328,7 +582,7 @@ func (w *SyncWorker) ConnectBlocksParallel(lower, higher uint32) error {
 	GetBlockLoop:
 		for hh := range hch {
 			for {
-				block, err = w.chain.GetBlock(hh.hash, hh.height)
+				block, err = w.getBlockParallel(hh.hash, hh.height, higher)
 				if err != nil {
 					// signal came while looping in the error loop
 					if hchClosed.Load() == true {
@@ -371,6 +625,10 @@ ConnectLoop:
 			close(terminating)
 			break ConnectLoop
 		default:
+			if w.IsPaused() {
+				time.Sleep(time.Second)
+				continue
+			}
 			hash, err = w.chain.GetBlockHash(h)
 			if err != nil {
 				glog.Error("GetBlockHash error ", err)
@@ -404,6 +662,23 @@ ConnectLoop:
 	return err
 }
 
+// getBlockParallel gets the block from the block source, if it is set and the block is at least blockSourceTipDistance
+// below the tip, otherwise or if the block is not in the source from the backend
+func (w *SyncWorker) getBlockParallel(hash string, height, tip uint32) (*bchain.Block, error) {
+	if w.blockSource != nil && height+blockSourceTipDistance <= tip {
+		block, err := w.blockSource.GetBlock(hash, height)
+		if err == nil {
+			return block, nil
+		}
+		if err != bchain.ErrBlockNotFound {
+			glog.Warning("sync: block source error ", err, ", getting block ", height, " from backend")
+		} else if glog.V(1) {
+			glog.Info("sync: block ", height, " ", hash, " not in block source, getting it from backend")
+		}
+	}
+	return w.chain.GetBlock(hash, height)
+}
+
 type blockResult struct {
 	block *bchain.Block
 	err   error
@@ -416,6 +691,25 @@ func (w *SyncWorker) getBlockChain(out chan blockResult, done chan struct{}) {
 	height := w.startHeight
 	prevHash := ""
 
+	// the blocks known to the backend at the start are prefetched in parallel,
+	// the blocks created in the meantime are then fetched one by one by following the chain
+	if w.syncWorkers > 1 {
+		bestHeight, err := w.chain.GetBestBlockHeight()
+		if err != nil {
+			glog.Warning("sync: GetBestBlockHeight error ", err, ", blocks are not prefetched")
+		} else if bestHeight > height {
+			last, next, ok := w.prefetchBlocks(hash, height, bestHeight, out, done)
+			if !ok {
+				return
+			}
+			if last != nil {
+				hash = last.Next
+				height = next
+				prevHash = last.Hash
+			}
+		}
+	}
+
 	// loop until error ErrBlockNotFound
 	for {
 		select {
@@ -443,14 +737,187 @@ func (w *SyncWorker) getBlockChain(out chan blockResult, done chan struct{}) {
 	}
 }
 
+// prefetchBlocks downloads and parses the blocks in range lower-higher using syncWorkers goroutines
+// and sends them to out in the order of the chain, while the previous blocks are being connected
+// the number of blocks fetched ahead is bounded, the fork is detected by checking the link to the previous block
+// returns the last sent block, the height of the next block and false if the processing should not continue
+func (w *SyncWorker) prefetchBlocks(lowerHash string, lower, higher uint32, out chan blockResult, done chan struct{}) (*bchain.Block, uint32, bool) {
+	type prefetched struct {
+		height uint32
+		block  *bchain.Block
+		err    error
+	}
+	workers := w.syncWorkers
+	// window limits the number of blocks fetched ahead of the block being sent
+	window := make(chan struct{}, 2*workers)
+	heights := make(chan uint32)
+	results := make(chan prefetched, 2*workers)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(heights)
+		for h := lower; h <= higher; h++ {
+			select {
+			case window <- struct{}{}:
+			case <-stop:
+				return
+			}
+			select {
+			case heights <- h:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		go func() {
+			for h := range heights {
+				var block *bchain.Block
+				hash, err := lowerHash, error(nil)
+				if h != lower {
+					hash, err = w.chain.GetBlockHash(h)
+				}
+				if err == nil {
+					block, err = w.chain.GetBlock(hash, h)
+				}
+				select {
+				case results <- prefetched{height: h, block: block, err: err}:
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+	glog.Infof("sync: prefetching blocks %d-%d using %d workers", lower, higher, workers)
+	pending := make(map[uint32]prefetched, 2*workers)
+	var last *bchain.Block
+	for height := lower; height <= higher; {
+		r, found := pending[height]
+		if !found {
+			select {
+			case r = <-results:
+				pending[r.height] = r
+			case <-done:
+				return last, height, false
+			}
+			continue
+		}
+		delete(pending, height)
+		if r.err != nil {
+			if r.err == bchain.ErrBlockNotFound {
+				// the chain is shorter than expected, continue following it one block at a time
+				return last, height, true
+			}
+			out <- blockResult{err: r.err}
+			return last, height, false
+		}
+		block := r.block
+		if last != nil && block.Prev != "" && last.Hash != block.Prev {
+			glog.Infof("sync: fork detected at height %d %s, local prevHash %s, remote prevHash %s", height, block.Hash, last.Hash, block.Prev)
+			out <- blockResult{err: errFork}
+			return last, height, false
+		}
+		select {
+		case out <- blockResult{block: block}:
+		case <-done:
+			return last, height, false
+		}
+		<-window
+		last = block
+		height++
+	}
+	return last, higher + 1, true
+}
+
 // DisconnectBlocks removes all data belonging to blocks in range lower-higher,
 func (w *SyncWorker) DisconnectBlocks(lower uint32, higher uint32, hashes []string) error {
+	return w.disconnectBlocks(lower, higher, nil)
+}
+
+// disconnectBlocks removes all data belonging to blocks in range lower-higher,
+// for bitcoin type coins the already loaded blockTxs data of the blocks can be passed in blocks
+func (w *SyncWorker) disconnectBlocks(lower uint32, higher uint32, blocks [][]blockTxs) error {
 	glog.Infof("sync: disconnecting blocks %d-%d", lower, higher)
 	ct := w.chain.GetChainParser().GetChainType()
 	if ct == bchain.ChainBitcoinType {
-		return w.db.DisconnectBlockRangeBitcoinType(lower, higher)
+		if blocks == nil {
+			var err error
+			if blocks, err = w.getDisconnectBlockTxs(lower, higher); err != nil {
+				return err
+			}
+		}
+		return w.db.disconnectBlockRangeBitcoinType(lower, higher, blocks)
 	} else if ct == bchain.ChainEthereumType {
 		return w.db.DisconnectBlockRangeEthereumType(lower, higher)
 	}
 	return errors.New("Unknown chain type")
 }
+
+// getDisconnectBlockTxs returns the data needed to disconnect the blocks in range lower-higher of a bitcoin type coin
+// the blockTxs column contains only the last KeepBlockAddresses blocks, the data of older blocks are reconstructed
+// from the blocks fetched from the backend or, if the backend does not have them anymore, from the index
+func (w *SyncWorker) getDisconnectBlockTxs(lower uint32, higher uint32) ([][]blockTxs, error) {
+	var indexTxids map[uint32][]string
+	return w.db.getBlockRangeTxs(lower, higher, func(height uint32) ([]blockTxs, error) {
+		bi, err := w.db.GetBlockInfo(height)
+		if err != nil {
+			return nil, err
+		}
+		if bi == nil {
+			return nil, errors.Errorf("Block %v not found in index", height)
+		}
+		bt, err := w.reconstructBlockTxs(bi, height)
+		if err == nil {
+			return bt, nil
+		}
+		glog.Warning("sync: ", err, ", reconstructing the block from the index")
+		// the blocks are reconstructed in ascending order, the txids of all remaining blocks are found by one scan of the index
+		if indexTxids == nil {
+			if indexTxids, err = w.db.getTxidsOfBlocks(height, higher, w.chanOsSignal); err != nil {
+				return nil, err
+			}
+		}
+		return w.reconstructBlockTxsFromIndex(bi, height, indexTxids[height])
+	})
+}
+
+// reconstructBlockTxs reconstructs the blockTxs data of the indexed block from the block fetched from the backend by its hash,
+// the orphaned blocks are usually still stored there
+func (w *SyncWorker) reconstructBlockTxs(bi *BlockInfo, height uint32) ([]blockTxs, error) {
+	block, err := w.chain.GetBlock(bi.Hash, height)
+	if err != nil {
+		return nil, errors.Annotatef(err, "Block %v %v not returned by backend", height, bi.Hash)
+	}
+	if block.Hash != "" && block.Hash != bi.Hash {
+		return nil, errors.Errorf("Backend returned block %v instead of %v", block.Hash, bi.Hash)
+	}
+	txs := block.Txs
+	if len(txs) == 0 {
+		return nil, errors.Errorf("Block %v %v has no transactions", height, bi.Hash)
+	}
+	glog.Info("sync: reconstructed data of block ", height, " ", bi.Hash, " containing ", len(txs), " transactions")
+	return w.db.blockTxsFromTxs(txs)
+}
+
+// reconstructBlockTxsFromIndex reconstructs the blockTxs data of the indexed block from the txids of its transactions found in the index,
+// the transactions are loaded from the transactions column (tx cache) or from the backend one by one
+func (w *SyncWorker) reconstructBlockTxsFromIndex(bi *BlockInfo, height uint32, txids []string) ([]blockTxs, error) {
+	if len(txids) == 0 || len(txids) != int(bi.Txs) {
+		return nil, errors.Errorf("Found %v of %v transactions of block %v %v in index, it is necessary to rebuild index", len(txids), bi.Txs, height, bi.Hash)
+	}
+	txs := make([]bchain.Tx, len(txids))
+	for i, txid := range txids {
+		tx, _, err := w.db.GetTx(txid)
+		if err != nil {
+			return nil, err
+		}
+		if tx == nil {
+			if tx, err = w.chain.GetTransaction(txid); err != nil {
+				return nil, errors.Annotatef(err, "Transaction %v of block %v %v is not available, it is necessary to rebuild index", txid, height, bi.Hash)
+			}
+		}
+		txs[i] = *tx
+	}
+	glog.Info("sync: reconstructed data of block ", height, " ", bi.Hash, " containing ", len(txs), " transactions from the index")
+	return w.db.blockTxsFromTxs(txs)
+}
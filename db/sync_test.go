@@ -0,0 +1,175 @@
+//go:build unittest
+
+package db
+
+import (
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
+)
+
+// testPrefetchChain serves a chain of empty blocks with random latency
+type testPrefetchChain struct {
+	bchain.BlockChain
+	mux    sync.Mutex
+	hashes []string
+	// forkAt replaces the chain from given height after the block at height forkAfter was fetched
+	forkAt, forkAfter uint32
+}
+
+func (c *testPrefetchChain) GetBestBlockHeight() (uint32, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return uint32(len(c.hashes) - 1), nil
+}
+
+func (c *testPrefetchChain) GetBlockHash(height uint32) (string, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if int(height) >= len(c.hashes) {
+		return "", bchain.ErrBlockNotFound
+	}
+	return c.hashes[height], nil
+}
+
+func (c *testPrefetchChain) GetBlock(hash string, height uint32) (*bchain.Block, error) {
+	time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if hash == "" {
+		if int(height) >= len(c.hashes) {
+			return nil, bchain.ErrBlockNotFound
+		}
+		hash = c.hashes[height]
+	}
+	b := &bchain.Block{BlockHeader: bchain.BlockHeader{Hash: hash, Height: height}}
+	if height > 0 {
+		b.Prev = c.hashes[height-1]
+	}
+	if int(height)+1 < len(c.hashes) {
+		b.Next = c.hashes[height+1]
+	}
+	if c.forkAfter > 0 && height == c.forkAfter {
+		for h := c.forkAt; h < uint32(len(c.hashes)); h++ {
+			c.hashes[h] = "fork" + strconv.Itoa(int(h))
+		}
+		c.forkAfter = 0
+	}
+	return b, nil
+}
+
+func newTestPrefetchChain(n int) *testPrefetchChain {
+	c := &testPrefetchChain{hashes: make([]string, n)}
+	for i := range c.hashes {
+		c.hashes[i] = "hash" + strconv.Itoa(i)
+	}
+	return c
+}
+
+func collectBlockChain(w *SyncWorker) ([]string, error) {
+	bch := make(chan blockResult, 8)
+	done := make(chan struct{})
+	defer close(done)
+	go w.getBlockChain(bch, done)
+	var hashes []string
+	for res := range bch {
+		if res.err != nil {
+			return hashes, res.err
+		}
+		hashes = append(hashes, res.block.Hash)
+	}
+	return hashes, nil
+}
+
+func TestSyncWorker_getBlockChain(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		chain := newTestPrefetchChain(100)
+		w := &SyncWorker{chain: chain, syncWorkers: workers, startHeight: 10, startHash: "hash10"}
+		hashes, err := collectBlockChain(w)
+		if err != nil {
+			t.Fatalf("workers %d: getBlockChain error %v", workers, err)
+		}
+		if len(hashes) != 90 {
+			t.Fatalf("workers %d: got %d blocks, want 90", workers, len(hashes))
+		}
+		for i, h := range hashes {
+			if h != chain.hashes[i+10] {
+				t.Fatalf("workers %d: block %d = %v, want %v", workers, i+10, h, chain.hashes[i+10])
+			}
+		}
+	}
+}
+
+func TestSyncWorker_getBlockChainFork(t *testing.T) {
+	chain := newTestPrefetchChain(100)
+	// the blocks from height 40 are replaced when the block 45 is fetched, the block 45 itself is returned from the old chain
+	// the blocks fetched later are from the new chain, the prefetch must detect the broken link
+	chain.forkAt, chain.forkAfter = 40, 45
+	w := &SyncWorker{chain: chain, syncWorkers: 4, startHeight: 10, startHash: "hash10"}
+	hashes, err := collectBlockChain(w)
+	if err != errFork {
+		t.Fatalf("getBlockChain error %v, want %v", err, errFork)
+	}
+	if len(hashes) < 30 {
+		t.Fatalf("got %d blocks, want at least 30", len(hashes))
+	}
+	for i := 0; i < 30; i++ {
+		if hashes[i] != "hash"+strconv.Itoa(i+10) {
+			t.Fatalf("block %d = %v, want %v", i+10, hashes[i], "hash"+strconv.Itoa(i+10))
+		}
+	}
+}
+
+func TestSyncWorker_pause(t *testing.T) {
+	is := &common.InternalState{}
+	is.FinishedSync(100)
+	chanOsSignal := make(chan os.Signal, 1)
+	w, err := NewSyncWorker(nil, nil, 1, 0, 0, false, chanOsSignal, nil, is)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Pause()
+	if !w.IsPaused() || !is.GetSyncProgress().Paused {
+		t.Fatal("Pause: synchronization not paused")
+	}
+	// the regular resync is skipped while paused and the index is no longer reported as synchronized
+	if err = w.ResyncIndex(nil, nil, false); err != nil {
+		t.Fatalf("ResyncIndex while paused error %v", err)
+	}
+	if synced, _, _ := is.GetSyncState(); synced {
+		t.Fatal("ResyncIndex while paused: IsSynchronized not cleared")
+	}
+	// the initial sync waits until resumed or interrupted by OS signal
+	chanOsSignal <- os.Interrupt
+	if err = w.ResyncIndex(nil, nil, true); err != ErrOperationInterrupted {
+		t.Fatalf("initial ResyncIndex while paused error %v, want %v", err, ErrOperationInterrupted)
+	}
+	done := make(chan error)
+	go func() { done <- w.waitWhilePaused() }()
+	w.Resume()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatalf("waitWhilePaused error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waitWhilePaused did not return after Resume")
+	}
+	if w.IsPaused() || is.GetSyncProgress().Paused {
+		t.Fatal("Resume: synchronization still paused")
+	}
+
+	// rollback is refused while the synchronization is running
+	w.running <- struct{}{}
+	if err = w.Rollback(0); err != ErrSyncRunning {
+		t.Fatalf("Rollback while running error %v, want %v", err, ErrSyncRunning)
+	}
+	<-w.running
+}
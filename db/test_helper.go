@@ -14,6 +14,12 @@ func ConnectBlocks(w *SyncWorker, onNewBlock bchain.OnNewBlockFunc, initialSync
 	return w.connectBlocks(onNewBlock, initialSync)
 }
 
-func HandleFork(w *SyncWorker, localBestHeight uint32, localBestHash string, onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
-	return w.handleFork(localBestHeight, localBestHash, onNewBlock, initialSync)
+func HandleFork(w *SyncWorker, localBestHeight uint32, localBestHash string, onNewBlock bchain.OnNewBlockFunc, onReorg bchain.OnReorgFunc, initialSync bool) error {
+	return w.handleFork(localBestHeight, localBestHash, onNewBlock, onReorg, initialSync)
+}
+
+// RemoveBlockTxs removes the data of the block at given height from the blockTxs column,
+// as if the block were older than the number of blocks kept in the column
+func RemoveBlockTxs(d *RocksDB, height uint32) error {
+	return d.db.DeleteCF(d.wo, d.cfh[cfBlockTxs], packUint(height))
 }
@@ -36,31 +36,85 @@ func NewTxCache(db *RocksDB, chain bchain.BlockChain, metrics *common.Metrics, i
 // GetTransaction returns transaction either from RocksDB or if not present from blockchain
 // it the transaction is confirmed, it is stored in the RocksDB
 func (c *TxCache) GetTransaction(txid string) (*bchain.Tx, int, error) {
-	var tx *bchain.Tx
-	var h uint32
-	var err error
-	if c.enabled {
-		tx, h, err = c.db.GetTx(txid)
-		if err != nil {
-			return nil, 0, err
+	tx, h, err := c.getCachedTransaction(txid)
+	if err != nil || tx != nil {
+		return tx, h, err
+	}
+	tx, err = c.chain.GetTransaction(txid)
+	if err != nil {
+		return nil, 0, err
+	}
+	return c.storeTransaction(tx)
+}
+
+// GetTransactions returns transactions as GetTransaction, the transactions missing in RocksDB are fetched
+// from the blockchain in batches, if the backend supports it
+// The transactions are returned in the order of txids, heights and errs contain the height and error of each transaction
+func (c *TxCache) GetTransactions(txids []string) ([]*bchain.Tx, []int, []error) {
+	txs := make([]*bchain.Tx, len(txids))
+	heights := make([]int, len(txids))
+	errs := make([]error, len(txids))
+	var missing []string
+	var indexes []int
+	for i, txid := range txids {
+		txs[i], heights[i], errs[i] = c.getCachedTransaction(txid)
+		if errs[i] == nil && txs[i] == nil {
+			missing = append(missing, txid)
+			indexes = append(indexes, i)
 		}
-		if tx != nil {
-			// number of confirmations is not stored in cache, they change all the time
-			_, bestheight, _ := c.is.GetSyncState()
-			tx.Confirmations = bestheight - h + 1
-			c.metrics.TxCacheEfficiency.With(common.Labels{"status": "hit"}).Inc()
-			return tx, int(h), nil
+	}
+	if len(missing) == 0 {
+		return txs, heights, errs
+	}
+	var mtxs []*bchain.Tx
+	var merrs []error
+	if tb, ok := c.chain.(bchain.TransactionBatcher); ok && tb.TransactionBatchSize() > 1 {
+		mtxs, merrs = tb.GetTransactions(missing)
+	} else {
+		mtxs = make([]*bchain.Tx, len(missing))
+		merrs = make([]error, len(missing))
+		for j, txid := range missing {
+			mtxs[j], merrs[j] = c.chain.GetTransaction(txid)
 		}
 	}
-	tx, err = c.chain.GetTransaction(txid)
+	for j, i := range indexes {
+		if merrs[j] != nil {
+			errs[i] = merrs[j]
+			continue
+		}
+		txs[i], heights[i], errs[i] = c.storeTransaction(mtxs[j])
+	}
+	return txs, heights, errs
+}
+
+// getCachedTransaction returns transaction from RocksDB or nil if it is not cached
+func (c *TxCache) getCachedTransaction(txid string) (*bchain.Tx, int, error) {
+	if !c.enabled {
+		return nil, 0, nil
+	}
+	tx, h, err := c.db.GetTx(txid)
 	if err != nil {
 		return nil, 0, err
 	}
+	if tx != nil {
+		// number of confirmations is not stored in cache, they change all the time
+		_, bestheight, _ := c.is.GetSyncState()
+		tx.Confirmations = bestheight - h + 1
+		c.metrics.TxCacheEfficiency.With(common.Labels{"status": "hit"}).Inc()
+		return tx, int(h), nil
+	}
+	return nil, 0, nil
+}
+
+// storeTransaction stores transaction fetched from the blockchain to RocksDB, if it is confirmed
+func (c *TxCache) storeTransaction(tx *bchain.Tx) (*bchain.Tx, int, error) {
+	var h uint32
+	var err error
 	c.metrics.TxCacheEfficiency.With(common.Labels{"status": "miss"}).Inc()
 	// cache only confirmed transactions
 	if tx.Confirmations > 0 {
 		if c.chainType == bchain.ChainBitcoinType {
-			ta, err := c.db.GetTxAddresses(txid)
+			ta, err := c.db.GetTxAddresses(tx.Txid)
 			if err != nil {
 				return nil, 0, err
 			}
@@ -2,11 +2,15 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/golang/glog"
+	"github.com/juju/errors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/trezor/blockbook/api"
 	"github.com/trezor/blockbook/bchain"
@@ -25,10 +29,28 @@ type InternalServer struct {
 	mempool     bchain.Mempool
 	is          *common.InternalState
 	api         *api.Worker
+	control     *SyncControl
+}
+
+// SyncControl contains the handles by which the internal server controls the synchronization of the running blockbook
+// The control endpoints are enabled only if AuthToken is set, the requests must contain header "Authorization: Bearer <AuthToken>"
+type SyncControl struct {
+	AuthToken  string
+	SyncWorker *db.SyncWorker
+	// ResyncMempool triggers the resynchronization of mempool
+	ResyncMempool func() error
+	// ComputeColumnStats starts the computation of the statistics of the database columns in the background
+	ComputeColumnStats func() error
+}
+
+type syncControlResult struct {
+	Result string              `json:"result,omitempty"`
+	Error  string              `json:"error,omitempty"`
+	Sync   common.SyncProgress `json:"sync"`
 }
 
 // NewInternalServer creates new internal http interface to blockbook and returns its handle
-func NewInternalServer(binding, certFiles string, db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, metrics *common.Metrics, is *common.InternalState) (*InternalServer, error) {
+func NewInternalServer(binding, certFiles string, db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, metrics *common.Metrics, is *common.InternalState, control *SyncControl) (*InternalServer, error) {
 	api, err := api.NewWorker(db, chain, mempool, txCache, metrics, is)
 	if err != nil {
 		return nil, err
@@ -50,10 +72,17 @@ func NewInternalServer(binding, certFiles string, db *db.RocksDB, chain bchain.B
 		mempool:     mempool,
 		is:          is,
 		api:         api,
+		control:     control,
 	}
 
 	serveMux.Handle(path+"favicon.ico", http.FileServer(http.Dir("./static/")))
 	serveMux.HandleFunc(path+"metrics", promhttp.Handler().ServeHTTP)
+	serveMux.HandleFunc(path+"sync", s.syncStatus)
+	serveMux.HandleFunc(path+"sync/pause", s.syncControlHandler(s.pauseSync))
+	serveMux.HandleFunc(path+"sync/resume", s.syncControlHandler(s.resumeSync))
+	serveMux.HandleFunc(path+"sync/rollback", s.syncControlHandler(s.rollback))
+	serveMux.HandleFunc(path+"mempool/resync", s.syncControlHandler(s.resyncMempool))
+	serveMux.HandleFunc(path+"dbstats/compute", s.syncControlHandler(s.computeColumnStats))
 	serveMux.HandleFunc(path, s.index)
 
 	return s, nil
@@ -97,3 +126,91 @@ func (s *InternalServer) index(w http.ResponseWriter, r *http.Request) {
 
 	w.Write(buf)
 }
+
+func (s *InternalServer) writeSyncControlResult(w http.ResponseWriter, status int, result string, err error) {
+	r := syncControlResult{
+		Result: result,
+		Sync:   s.is.GetSyncProgress(),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(&r); err != nil {
+		glog.Error(err)
+	}
+}
+
+func (s *InternalServer) syncStatus(w http.ResponseWriter, r *http.Request) {
+	s.writeSyncControlResult(w, http.StatusOK, "", nil)
+}
+
+// syncControlHandler checks the method and the authorization of the sync control request and calls the handler
+func (s *InternalServer) syncControlHandler(handler func(r *http.Request) (string, int, error)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.control == nil || s.control.AuthToken == "" {
+			s.writeSyncControlResult(w, http.StatusForbidden, "", errors.New("Sync control is disabled"))
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			s.writeSyncControlResult(w, http.StatusMethodNotAllowed, "", errors.New("Method not allowed"))
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.control.AuthToken)) != 1 {
+			glog.Warning("internal server: unauthorized sync control request ", r.URL.Path, " from ", r.RemoteAddr)
+			s.writeSyncControlResult(w, http.StatusUnauthorized, "", errors.New("Unauthorized"))
+			return
+		}
+		result, status, err := handler(r)
+		if err != nil {
+			glog.Error("internal server: ", r.URL.Path, " error ", err)
+		} else {
+			glog.Info("internal server: ", r.URL.Path, " ", result)
+		}
+		s.writeSyncControlResult(w, status, result, err)
+	}
+}
+
+func (s *InternalServer) pauseSync(r *http.Request) (string, int, error) {
+	s.control.SyncWorker.Pause()
+	return "Synchronization paused", http.StatusOK, nil
+}
+
+func (s *InternalServer) resumeSync(r *http.Request) (string, int, error) {
+	s.control.SyncWorker.Resume()
+	return "Synchronization resumed", http.StatusOK, nil
+}
+
+func (s *InternalServer) rollback(r *http.Request) (string, int, error) {
+	height, err := strconv.ParseUint(r.URL.Query().Get("height"), 10, 32)
+	if err != nil {
+		return "", http.StatusBadRequest, errors.New("Missing or invalid parameter height")
+	}
+	if !s.control.SyncWorker.IsPaused() {
+		return "", http.StatusConflict, errors.New("Synchronization must be paused before rollback")
+	}
+	if err = s.control.SyncWorker.Rollback(uint32(height)); err != nil {
+		if err == db.ErrSyncRunning {
+			return "", http.StatusConflict, err
+		}
+		return "", http.StatusInternalServerError, err
+	}
+	return fmt.Sprintf("Disconnected blocks from height %d", height), http.StatusOK, nil
+}
+
+func (s *InternalServer) resyncMempool(r *http.Request) (string, int, error) {
+	if err := s.control.ResyncMempool(); err != nil {
+		return "", http.StatusConflict, err
+	}
+	return "Mempool resync triggered", http.StatusOK, nil
+}
+
+func (s *InternalServer) computeColumnStats(r *http.Request) (string, int, error) {
+	if err := s.control.ComputeColumnStats(); err != nil {
+		return "", http.StatusConflict, err
+	}
+	return "Computation of database column statistics started", http.StatusOK, nil
+}
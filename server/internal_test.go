@@ -0,0 +1,324 @@
+//go:build unittest
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain/coins/btc"
+	"github.com/trezor/blockbook/common"
+	"github.com/trezor/blockbook/db"
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+const testSyncControlToken = "secret-token"
+
+type testSyncControl struct {
+	mempoolResyncs   int
+	columnStats      int
+	mempoolResyncErr error
+}
+
+func setupInternalHTTPServer(t *testing.T, authToken string, tc *testSyncControl) (*InternalServer, string) {
+	parser := btc.NewBitcoinParser(
+		btc.GetChainParams("test"),
+		&btc.Configuration{
+			BlockAddressesToKeep: 1,
+		})
+
+	d, is, path := setupRocksDB(t, parser)
+	is.Coin = "Fakecoin"
+	is.CoinLabel = "Fake Coin"
+	is.CoinShortcut = "FAKE"
+
+	// the metrics of the public server tests are registered with coin Fakecoin, registering them again would fail
+	metrics, err := common.GetMetrics("Fakecoin internal")
+	if err != nil {
+		glog.Fatal("metrics: ", err)
+	}
+
+	chain, err := dbtestdata.NewFakeBlockChain(parser)
+	if err != nil {
+		glog.Fatal("fakechain: ", err)
+	}
+
+	mempool, err := chain.CreateMempool(chain)
+	if err != nil {
+		glog.Fatal("mempool: ", err)
+	}
+
+	txCache, err := db.NewTxCache(d, chain, metrics, is, false)
+	if err != nil {
+		glog.Fatal("txCache: ", err)
+	}
+
+	syncWorker, err := db.NewSyncWorker(d, chain, 1, 0, 0, false, make(chan os.Signal, 1), metrics, is)
+	if err != nil {
+		glog.Fatal("syncWorker: ", err)
+	}
+
+	control := &SyncControl{
+		AuthToken:  authToken,
+		SyncWorker: syncWorker,
+		ResyncMempool: func() error {
+			if tc.mempoolResyncErr != nil {
+				return tc.mempoolResyncErr
+			}
+			tc.mempoolResyncs++
+			return nil
+		},
+		ComputeColumnStats: func() error {
+			tc.columnStats++
+			return nil
+		},
+	}
+
+	// s.Run is never called, binding can be to any port
+	s, err := NewInternalServer("localhost:12346", "", d, chain, mempool, txCache, metrics, is, control)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, path
+}
+
+func closeAndDestroyInternalServer(t *testing.T, s *InternalServer, dbpath string) {
+	if err := s.db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(dbpath)
+}
+
+func syncControlRequest(t *testing.T, ts *httptest.Server, method, path, token string) (int, *syncControlResult) {
+	r, err := http.NewRequest(method, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var res syncControlResult
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("%s %s: invalid response %v", method, path, err)
+	}
+	return resp.StatusCode, &res
+}
+
+func Test_InternalServer_syncControlDisabled(t *testing.T) {
+	s, dbpath := setupInternalHTTPServer(t, "", &testSyncControl{})
+	defer closeAndDestroyInternalServer(t, s, dbpath)
+	ts := httptest.NewServer(s.https.Handler)
+	defer ts.Close()
+
+	for _, path := range []string{"/sync/pause", "/sync/resume", "/sync/rollback?height=1", "/mempool/resync", "/dbstats/compute"} {
+		status, res := syncControlRequest(t, ts, http.MethodPost, path, testSyncControlToken)
+		if status != http.StatusForbidden || res.Error != "Sync control is disabled" {
+			t.Errorf("%s: got %d %+v, want %d", path, status, res, http.StatusForbidden)
+		}
+	}
+	if s.control.SyncWorker.IsPaused() {
+		t.Error("synchronization paused by disabled sync control")
+	}
+}
+
+func Test_InternalServer_syncControl(t *testing.T) {
+	tc := &testSyncControl{}
+	s, dbpath := setupInternalHTTPServer(t, testSyncControlToken, tc)
+	defer closeAndDestroyInternalServer(t, s, dbpath)
+	ts := httptest.NewServer(s.https.Handler)
+	defer ts.Close()
+	sw := s.control.SyncWorker
+	block1 := dbtestdata.GetTestBitcoinTypeBlock1(s.chainParser)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+		wantError  string
+		check      func(t *testing.T, res *syncControlResult)
+	}{
+		{
+			name:       "status without token",
+			method:     http.MethodGet,
+			path:       "/sync",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "pause GET",
+			method:     http.MethodGet,
+			path:       "/sync/pause",
+			token:      testSyncControlToken,
+			wantStatus: http.StatusMethodNotAllowed,
+			wantError:  "Method not allowed",
+		},
+		{
+			name:       "pause missing token",
+			method:     http.MethodPost,
+			path:       "/sync/pause",
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "Unauthorized",
+		},
+		{
+			name:       "pause wrong token",
+			method:     http.MethodPost,
+			path:       "/sync/pause",
+			token:      "wrong-token",
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "Unauthorized",
+			check: func(t *testing.T, res *syncControlResult) {
+				if sw.IsPaused() || res.Sync.Paused {
+					t.Error("synchronization paused by unauthorized request")
+				}
+			},
+		},
+		{
+			name:       "rollback not paused",
+			method:     http.MethodPost,
+			path:       "/sync/rollback?height=225494",
+			token:      testSyncControlToken,
+			wantStatus: http.StatusConflict,
+			wantError:  "Synchronization must be paused before rollback",
+		},
+		{
+			name:       "pause",
+			method:     http.MethodPost,
+			path:       "/sync/pause",
+			token:      testSyncControlToken,
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, res *syncControlResult) {
+				if !sw.IsPaused() || !res.Sync.Paused || res.Sync.Stage != common.SyncStagePaused {
+					t.Errorf("synchronization not paused, %+v", res.Sync)
+				}
+			},
+		},
+		{
+			name:       "rollback missing height",
+			method:     http.MethodPost,
+			path:       "/sync/rollback",
+			token:      testSyncControlToken,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "Missing or invalid parameter height",
+		},
+		{
+			name:       "rollback",
+			method:     http.MethodPost,
+			path:       "/sync/rollback?height=225494",
+			token:      testSyncControlToken,
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, res *syncControlResult) {
+				height, hash, err := s.db.GetBestBlock()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if height != block1.Height || hash != block1.Hash {
+					t.Errorf("best block %d %s, want %d %s", height, hash, block1.Height, block1.Hash)
+				}
+				synced, bestHeight, _ := s.is.GetSyncState()
+				if synced || bestHeight != block1.Height {
+					t.Errorf("internal state synchronized %v, best height %d, want false, %d", synced, bestHeight, block1.Height)
+				}
+				// the regular resync is skipped while paused
+				if err := sw.ResyncIndex(nil, nil, false); err != nil {
+					t.Fatal(err)
+				}
+				if height, _, _ := s.db.GetBestBlock(); height != block1.Height {
+					t.Errorf("best height %d after ResyncIndex while paused, want %d", height, block1.Height)
+				}
+			},
+		},
+		{
+			name:       "rollback above best height",
+			method:     http.MethodPost,
+			path:       "/sync/rollback?height=225500",
+			token:      testSyncControlToken,
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, res *syncControlResult) {
+				if height, _, _ := s.db.GetBestBlock(); height != block1.Height {
+					t.Errorf("best height %d, want %d", height, block1.Height)
+				}
+			},
+		},
+		{
+			name:       "resume",
+			method:     http.MethodPost,
+			path:       "/sync/resume",
+			token:      testSyncControlToken,
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, res *syncControlResult) {
+				if sw.IsPaused() || res.Sync.Paused {
+					t.Errorf("synchronization still paused, %+v", res.Sync)
+				}
+			},
+		},
+		{
+			name:       "mempool resync",
+			method:     http.MethodPost,
+			path:       "/mempool/resync",
+			token:      testSyncControlToken,
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, res *syncControlResult) {
+				if tc.mempoolResyncs != 1 {
+					t.Errorf("mempool resyncs %d, want 1", tc.mempoolResyncs)
+				}
+				tc.mempoolResyncErr = errors.New("Mempool resync is running")
+			},
+		},
+		{
+			name:       "mempool resync running",
+			method:     http.MethodPost,
+			path:       "/mempool/resync",
+			token:      testSyncControlToken,
+			wantStatus: http.StatusConflict,
+			wantError:  "Mempool resync is running",
+		},
+		{
+			name:       "dbstats compute wrong token",
+			method:     http.MethodPost,
+			path:       "/dbstats/compute",
+			token:      testSyncControlToken + "x",
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "Unauthorized",
+		},
+		{
+			name:       "dbstats compute",
+			method:     http.MethodPost,
+			path:       "/dbstats/compute",
+			token:      testSyncControlToken,
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, res *syncControlResult) {
+				if tc.columnStats != 1 {
+					t.Errorf("column stats computations %d, want 1", tc.columnStats)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, res := syncControlRequest(t, ts, tt.method, tt.path, tt.token)
+			if status != tt.wantStatus {
+				t.Errorf("status %d, want %d, response %+v", status, tt.wantStatus, res)
+			}
+			if res.Error != tt.wantError {
+				t.Errorf("error %q, want %q", res.Error, tt.wantError)
+			}
+			if tt.wantError == "" && res.Result == "" && tt.path != "/sync" {
+				t.Error("missing result")
+			}
+			if tt.check != nil {
+				tt.check(t, res)
+			}
+		})
+	}
+}
@@ -29,6 +29,7 @@ const txsOnPage = 25
 const blocksOnPage = 50
 const mempoolTxsOnPage = 50
 const txsInAPI = 1000
+const defaultXpubAddresses = 20
 
 const (
 	_ = iota
@@ -188,8 +189,14 @@ func (s *PublicServer) ConnectFullPublicInterface() {
 	serveMux.HandleFunc(path+"api/v2/block/", s.jsonHandler(s.apiBlock, apiV2))
 	serveMux.HandleFunc(path+"api/v2/rawblock/", s.jsonHandler(s.apiBlockRaw, apiDefault))
 	serveMux.HandleFunc(path+"api/v2/sendtx/", s.jsonHandler(s.apiSendTx, apiV2))
+	serveMux.HandleFunc(path+"api/v2/decodetx/", s.jsonHandler(s.apiDecodeTx, apiV2))
+	serveMux.HandleFunc(path+"api/v2/broadcasts/", s.jsonHandler(s.apiBroadcast, apiV2))
+	serveMux.HandleFunc(path+"api/v2/verify-merkle-proof/", s.jsonHandler(s.apiVerifyMerkleProof, apiV2))
+	serveMux.HandleFunc(path+"api/v2/headers", s.jsonHandler(s.apiBlockHeaders, apiV2))
 	serveMux.HandleFunc(path+"api/v2/estimatefee/", s.jsonHandler(s.apiEstimateFee, apiV2))
 	serveMux.HandleFunc(path+"api/v2/feestats/", s.jsonHandler(s.apiFeeStats, apiV2))
+	serveMux.HandleFunc(path+"api/v2/cpfp/", s.jsonHandler(s.apiCpfp, apiV2))
+	serveMux.HandleFunc(path+"api/v2/mempool/removed", s.jsonHandler(s.apiMempoolRemoved, apiV2))
 	serveMux.HandleFunc(path+"api/v2/balancehistory/", s.jsonHandler(s.apiBalanceHistory, apiDefault))
 	serveMux.HandleFunc(path+"api/v2/tickers/", s.jsonHandler(s.apiTickers, apiV2))
 	serveMux.HandleFunc(path+"api/v2/multi-tickers/", s.jsonHandler(s.apiMultiTickers, apiV2))
@@ -223,6 +230,12 @@ func (s *PublicServer) OnNewFiatRatesTicker(ticker *db.CurrencyRatesTicker) {
 	s.websocket.OnNewFiatRatesTicker(ticker)
 }
 
+// OnReorg notifies users subscribed to notification about chain reorganizations
+func (s *PublicServer) OnReorg(reorg *bchain.Reorg) {
+	s.socketio.OnReorg(reorg)
+	s.websocket.OnReorg(reorg)
+}
+
 // OnNewTxAddr notifies users subscribed to notification about new tx
 func (s *PublicServer) OnNewTxAddr(tx *bchain.Tx, desc bchain.AddressDescriptor) {
 	s.socketio.OnNewTxAddr(tx.Txid, desc)
@@ -233,6 +246,11 @@ func (s *PublicServer) OnNewTx(tx *bchain.MempoolTx) {
 	s.websocket.OnNewTx(tx)
 }
 
+// OnTxRemoved notifies users subscribed to notification about new tx that a tx was removed from mempool
+func (s *PublicServer) OnTxRemoved(removal *bchain.MempoolTxRemoval) {
+	s.websocket.OnTxRemoved(removal)
+}
+
 func (s *PublicServer) txRedirect(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, joinURL(s.explorerURL, r.URL.Path), 302)
 	s.metrics.ExplorerViews.With(common.Labels{"action": "tx-redirect"}).Inc()
@@ -271,9 +289,13 @@ func getFunctionName(i interface{}) string {
 	return name
 }
 
+// binaryData returned by the handler of jsonHandler is sent as application/octet-stream instead of json
+type binaryData []byte
+
 func (s *PublicServer) jsonHandler(handler func(r *http.Request, apiVersion int) (interface{}, error), apiVersion int) func(w http.ResponseWriter, r *http.Request) {
 	type jsonError struct {
 		Text       string `json:"error"`
+		Code       string `json:"code,omitempty"`
 		HTTPStatus int    `json:"-"`
 	}
 	handlerName := getFunctionName(handler)
@@ -285,18 +307,25 @@ func (s *PublicServer) jsonHandler(handler func(r *http.Request, apiVersion int)
 				glog.Error(handlerName, " recovered from panic: ", e)
 				debug.PrintStack()
 				if s.debug {
-					data = jsonError{fmt.Sprint("Internal server error: recovered from panic ", e), http.StatusInternalServerError}
+					data = jsonError{fmt.Sprint("Internal server error: recovered from panic ", e), "", http.StatusInternalServerError}
 				} else {
-					data = jsonError{"Internal server error", http.StatusInternalServerError}
+					data = jsonError{"Internal server error", "", http.StatusInternalServerError}
 				}
 			}
-			w.Header().Set("Content-Type", "application/json; charset=utf-8")
-			if e, isError := data.(jsonError); isError {
-				w.WriteHeader(e.HTTPStatus)
-			}
-			err = json.NewEncoder(w).Encode(data)
-			if err != nil {
-				glog.Warning("json encode ", err)
+			if b, isBinary := data.(binaryData); isBinary {
+				w.Header().Set("Content-Type", "application/octet-stream")
+				if _, err = w.Write(b); err != nil {
+					glog.Warning("write ", err)
+				}
+			} else {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				if e, isError := data.(jsonError); isError {
+					w.WriteHeader(e.HTTPStatus)
+				}
+				err = json.NewEncoder(w).Encode(data)
+				if err != nil {
+					glog.Warning("json encode ", err)
+				}
 			}
 			s.metrics.ExplorerPendingRequests.With((common.Labels{"method": handlerName})).Dec()
 		}()
@@ -305,9 +334,9 @@ func (s *PublicServer) jsonHandler(handler func(r *http.Request, apiVersion int)
 		if err != nil || data == nil {
 			if apiErr, ok := err.(*api.APIError); ok {
 				if apiErr.Public {
-					data = jsonError{apiErr.Error(), http.StatusBadRequest}
+					data = jsonError{apiErr.Error(), apiErr.Code, http.StatusBadRequest}
 				} else {
-					data = jsonError{apiErr.Error(), http.StatusInternalServerError}
+					data = jsonError{apiErr.Error(), apiErr.Code, http.StatusInternalServerError}
 				}
 			} else {
 				if err != nil {
@@ -315,12 +344,12 @@ func (s *PublicServer) jsonHandler(handler func(r *http.Request, apiVersion int)
 				}
 				if s.debug {
 					if data != nil {
-						data = jsonError{fmt.Sprintf("Internal server error: %v, data %+v", err, data), http.StatusInternalServerError}
+						data = jsonError{fmt.Sprintf("Internal server error: %v, data %+v", err, data), "", http.StatusInternalServerError}
 					} else {
-						data = jsonError{fmt.Sprintf("Internal server error: %v", err), http.StatusInternalServerError}
+						data = jsonError{fmt.Sprintf("Internal server error: %v", err), "", http.StatusInternalServerError}
 					}
 				} else {
-					data = jsonError{"Internal server error", http.StatusInternalServerError}
+					data = jsonError{"Internal server error", "", http.StatusInternalServerError}
 				}
 			}
 		}
@@ -821,7 +850,7 @@ func (s *PublicServer) explorerSendTx(w http.ResponseWriter, r *http.Request) (t
 		}
 		hex := r.FormValue("hex")
 		if len(hex) > 0 {
-			res, err := s.chain.SendRawTransaction(hex)
+			res, err := s.api.SendTransaction(hex)
 			if err != nil {
 				data.SendTxHex = hex
 				data.Error = &api.APIError{Text: err.Error(), Public: true}
@@ -947,6 +976,9 @@ func (s *PublicServer) apiTx(r *http.Request, apiVersion int) (interface{}, erro
 	if i > 0 {
 		txid = r.URL.Path[i+1:]
 	}
+	if txid == "merkle-proof" {
+		return s.apiTxMerkleProof(r, apiVersion)
+	}
 	if len(txid) == 0 {
 		return nil, api.NewAPIError("Missing txid", true)
 	}
@@ -968,6 +1000,41 @@ func (s *PublicServer) apiTx(r *http.Request, apiVersion int) (interface{}, erro
 	return tx, err
 }
 
+// apiTxMerkleProof returns the merkle proof of inclusion of the transaction in its block
+func (s *PublicServer) apiTxMerkleProof(r *http.Request, apiVersion int) (interface{}, error) {
+	var txid string
+	path := strings.TrimSuffix(r.URL.Path, "/merkle-proof")
+	if i := strings.LastIndexByte(path, '/'); i > 0 {
+		txid = path[i+1:]
+	}
+	if len(txid) == 0 || txid == "tx" {
+		return nil, api.NewAPIError("Missing txid", true)
+	}
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-tx-merkle-proof"}).Inc()
+	return s.api.GetMerkleProof(txid)
+}
+
+// apiVerifyMerkleProof verifies the proof in the format of bitcoind gettxoutproof, passed as POST body or in url
+func (s *PublicServer) apiVerifyMerkleProof(r *http.Request, apiVersion int) (interface{}, error) {
+	var hex string
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-verify-merkle-proof"}).Inc()
+	if r.Method == http.MethodPost {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, api.NewAPIError("Missing proof", true)
+		}
+		hex = string(data)
+	} else {
+		if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+			hex = r.URL.Path[i+1:]
+		}
+	}
+	if len(hex) == 0 {
+		return nil, api.NewAPIError("Missing proof", true)
+	}
+	return s.api.VerifyMerkleProof(hex)
+}
+
 func (s *PublicServer) apiTxSpecific(r *http.Request, apiVersion int) (interface{}, error) {
 	var txid string
 	i := strings.LastIndexByte(r.URL.Path, '/')
@@ -1013,6 +1080,15 @@ func (s *PublicServer) apiXpub(r *http.Request, apiVersion int) (interface{}, er
 	if i > 0 {
 		xpub = r.URL.Path[i+5:]
 	}
+	if strings.HasSuffix(xpub, "/psbt") {
+		return s.apiXpubPsbt(r, strings.TrimSuffix(xpub, "/psbt"))
+	}
+	if strings.HasSuffix(xpub, "/addresses") {
+		return s.apiXpubAddresses(r, strings.TrimSuffix(xpub, "/addresses"))
+	}
+	if strings.HasSuffix(xpub, "/next-unused") {
+		return s.apiXpubNextUnused(r, strings.TrimSuffix(xpub, "/next-unused"))
+	}
 	if len(xpub) == 0 {
 		return nil, api.NewAPIError("Missing xpub", true)
 	}
@@ -1030,6 +1106,99 @@ func (s *PublicServer) apiXpub(r *http.Request, apiVersion int) (interface{}, er
 	return address, err
 }
 
+// getXpubChangeParam returns the change query parameter, -1 if not specified
+func getXpubChangeParam(r *http.Request) (int, error) {
+	c := r.URL.Query().Get("change")
+	if len(c) == 0 {
+		return -1, nil
+	}
+	change, err := strconv.Atoi(c)
+	if err != nil || change < 0 {
+		return 0, api.NewAPIError("Parameter 'change' is not a valid change index", true)
+	}
+	return change, nil
+}
+
+func (s *PublicServer) apiXpubAddresses(r *http.Request, xpub string) (interface{}, error) {
+	if len(xpub) == 0 {
+		return nil, api.NewAPIError("Missing xpub", true)
+	}
+	change, err := getXpubChangeParam(r)
+	if err != nil {
+		return nil, err
+	}
+	var from, to uint64
+	if f := r.URL.Query().Get("from"); len(f) > 0 {
+		if from, err = strconv.ParseUint(f, 10, 31); err != nil {
+			return nil, api.NewAPIError("Parameter 'from' cannot be converted to number", true)
+		}
+	}
+	if t := r.URL.Query().Get("to"); len(t) > 0 {
+		if to, err = strconv.ParseUint(t, 10, 31); err != nil {
+			return nil, api.NewAPIError("Parameter 'to' cannot be converted to number", true)
+		}
+	} else {
+		to = from + defaultXpubAddresses
+	}
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-xpub-addresses"}).Inc()
+	addresses, err := s.api.GetXpubAddresses(xpub, change, uint32(from), uint32(to))
+	if err == api.ErrUnsupportedXpub {
+		err = api.NewAPIError("XPUB functionality is not supported", true)
+	}
+	return addresses, err
+}
+
+func (s *PublicServer) apiXpubNextUnused(r *http.Request, xpub string) (interface{}, error) {
+	if len(xpub) == 0 {
+		return nil, api.NewAPIError("Missing xpub", true)
+	}
+	change, err := getXpubChangeParam(r)
+	if err != nil {
+		return nil, err
+	}
+	gap, ec := strconv.Atoi(r.URL.Query().Get("gap"))
+	if ec != nil {
+		gap = 0
+	}
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-xpub-next-unused"}).Inc()
+	address, err := s.api.GetXpubNextUnusedAddress(xpub, change, gap)
+	if err == api.ErrUnsupportedXpub {
+		err = api.NewAPIError("XPUB functionality is not supported", true)
+	}
+	return address, err
+}
+
+func (s *PublicServer) apiXpubPsbt(r *http.Request, xpub string) (interface{}, error) {
+	if r.Method != http.MethodPost {
+		return nil, api.NewAPIError("PSBT must be requested using POST method", true)
+	}
+	if len(xpub) == 0 {
+		return nil, api.NewAPIError("Missing xpub", true)
+	}
+	var request api.XpubPsbtRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, api.NewAPIError("Invalid PSBT request: "+err.Error(), true)
+	}
+	onlyConfirmed := false
+	if c := r.URL.Query().Get("confirmed"); len(c) > 0 {
+		var err error
+		onlyConfirmed, err = strconv.ParseBool(c)
+		if err != nil {
+			return nil, api.NewAPIError("Parameter 'confirmed' cannot be converted to boolean", true)
+		}
+	}
+	gap, ec := strconv.Atoi(r.URL.Query().Get("gap"))
+	if ec != nil {
+		gap = 0
+	}
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-xpub-psbt"}).Inc()
+	psbt, err := s.api.CreateXpubPsbt(xpub, &request, onlyConfirmed, gap)
+	if err == api.ErrUnsupportedXpub {
+		err = api.NewAPIError("XPUB functionality is not supported", true)
+	}
+	return psbt, err
+}
+
 func (s *PublicServer) apiUtxo(r *http.Request, apiVersion int) (interface{}, error) {
 	var utxo []api.Utxo
 	var err error
@@ -1142,6 +1311,40 @@ func (s *PublicServer) apiFeeStats(r *http.Request, apiVersion int) (interface{}
 	return feeStats, err
 }
 
+func (s *PublicServer) apiCpfp(r *http.Request, apiVersion int) (interface{}, error) {
+	var cpfp *api.CpfpFee
+	var err error
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-cpfp"}).Inc()
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		feePerKb, ec := strconv.ParseInt(r.URL.Query().Get("feePerKb"), 10, 64)
+		if ec != nil {
+			return nil, api.NewAPIError("Missing or invalid parameter feePerKb", true)
+		}
+		var childVSize int64
+		if v := r.URL.Query().Get("childVSize"); v != "" {
+			childVSize, ec = strconv.ParseInt(v, 10, 64)
+			if ec != nil {
+				return nil, api.NewAPIError("Invalid parameter childVSize", true)
+			}
+		}
+		cpfp, err = s.api.GetCpfpFee(r.URL.Path[i+1:], feePerKb, childVSize)
+	}
+	return cpfp, err
+}
+
+func (s *PublicServer) apiMempoolRemoved(r *http.Request, apiVersion int) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-mempool-removed"}).Inc()
+	page, ec := strconv.Atoi(r.URL.Query().Get("page"))
+	if ec != nil {
+		page = 0
+	}
+	pageSize, ec := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if ec != nil || pageSize <= 0 || pageSize > mempoolTxsOnPage {
+		pageSize = mempoolTxsOnPage
+	}
+	return s.api.GetMempoolRemovals(page, pageSize)
+}
+
 type resultSendTransaction struct {
 	Result string `json:"result"`
 }
@@ -1163,15 +1366,76 @@ func (s *PublicServer) apiSendTx(r *http.Request, apiVersion int) (interface{},
 		}
 	}
 	if len(hex) > 0 {
-		res.Result, err = s.chain.SendRawTransaction(hex)
+		if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun")); dryRun {
+			return s.api.ValidateTransaction(hex)
+		}
+		res.Result, err = s.api.SendTransaction(hex)
 		if err != nil {
-			return nil, api.NewAPIError(err.Error(), true)
+			return nil, err
 		}
 		return res, nil
 	}
 	return nil, api.NewAPIError("Missing tx blob", true)
 }
 
+// apiDecodeTx decodes raw transaction, passed as POST body or in url, and checks it for problems before it is broadcasted
+func (s *PublicServer) apiDecodeTx(r *http.Request, apiVersion int) (interface{}, error) {
+	var hex string
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-decodetx"}).Inc()
+	if r.Method == http.MethodPost {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, api.NewAPIError("Missing tx blob", true)
+		}
+		hex = string(data)
+	} else {
+		if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+			hex = r.URL.Path[i+1:]
+		}
+	}
+	if len(hex) == 0 {
+		return nil, api.NewAPIError("Missing tx blob", true)
+	}
+	return s.api.DecodeTransaction(hex)
+}
+
+// apiBroadcast returns the status of the transaction broadcasted by blockbook
+func (s *PublicServer) apiBroadcast(r *http.Request, apiVersion int) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-broadcast"}).Inc()
+	var txid string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		txid = r.URL.Path[i+1:]
+	}
+	if len(txid) == 0 {
+		return nil, api.NewAPIError("Missing txid", true)
+	}
+	return s.api.GetBroadcast(txid)
+}
+
+// apiBlockHeaders returns the headers of a range of blocks stored in the index, as json or in binary format
+func (s *PublicServer) apiBlockHeaders(r *http.Request, apiVersion int) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-headers"}).Inc()
+	from, err := strconv.ParseUint(r.URL.Query().Get("from"), 10, 32)
+	if err != nil {
+		return nil, api.NewAPIError("Parameter 'from' is not a valid block height", true)
+	}
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil {
+		return nil, api.NewAPIError("Parameter 'count' is not a valid number", true)
+	}
+	switch r.URL.Query().Get("format") {
+	case "", "hex":
+		return s.api.GetBlockHeaders(uint32(from), count)
+	case "binary":
+		b, err := s.api.GetBlockHeadersBinary(uint32(from), count)
+		if err != nil {
+			return nil, err
+		}
+		return binaryData(b), nil
+	}
+	return nil, api.NewAPIError("Parameter 'format' must be hex or binary", true)
+}
+
 // apiTickersList returns a list of available FiatRates currencies
 func (s *PublicServer) apiTickersList(r *http.Request, apiVersion int) (interface{}, error) {
 	s.metrics.ExplorerViews.With(common.Labels{"action": "api-tickers-list"}).Inc()
@@ -739,6 +739,97 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 				`{"page":1,"totalPages":1,"itemsOnPage":1000,"address":"tr([5c9e228d/86'/1'/0']tpubDC88gkaZi5HvJGxGDNLADkvtdpni3mLmx6vr2KnXmWMG8zfkBRggsxHVBkUpgcwPe2KKpkyvTJCdXHb1UHEWE64vczyyPQfHr1skBcsRedN/{0,1}/*)#4rqwxvej","balance":"0","totalReceived":"0","totalSent":"0","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":0,"tokens":[{"type":"XPUBAddress","name":"tb1pswrqtykue8r89t9u4rprjs0gt4qzkdfuursfnvqaa3f2yql07zmq8s8a5u","path":"m/86'/1'/0'/0/0","transfers":0,"decimals":8},{"type":"XPUBAddress","name":"tb1p8tvmvsvhsee73rhym86wt435qrqm92psfsyhy6a3n5gw455znnpqm8wald","path":"m/86'/1'/0'/0/1","transfers":0,"decimals":8},{"type":"XPUBAddress","name":"tb1p537ddhyuydg5c2v75xxmn6ac64yz4xns2x0gpdcwj5vzzzgrywlqlqwk43","path":"m/86'/1'/0'/0/2","transfers":0,"decimals":8},{"type":"XPUBAddress","name":"tb1pn2d0yjeedavnkd8z8lhm566p0f2utm3lgvxrsdehnl94y34txmts5s7t4c","path":"m/86'/1'/0'/1/0","transfers":0,"decimals":8},{"type":"XPUBAddress","name":"tb1p0pnd6ue5vryymvd28aeq3kdz6rmsdjqrq6eespgtg8wdgnxjzjksujhq4u","path":"m/86'/1'/0'/1/1","transfers":0,"decimals":8},{"type":"XPUBAddress","name":"tb1p29gpmd96hhgf7wj2vs03ca7x2xx39g8t6e0p55h2d5ssqs4fsj8qtx00wc","path":"m/86'/1'/0'/1/2","transfers":0,"decimals":8}]}`,
 			},
 		},
+		{
+			name:        "apiXpub v2 addresses",
+			r:           newGetRequest(ts.URL + "/api/v2/xpub/" + dbtestdata.Xpub + "/addresses?to=2"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"address":"2MzmAKayJmja784jyHvRUW1bXPget1csRRG","path":"m/49'/1'/33'/0/0","used":true},{"address":"2MsYfbi6ZdVXLDNrYAQ11ja9Sd3otMk4Pmj","path":"m/49'/1'/33'/0/1","used":false}]`,
+			},
+		},
+		{
+			name:        "apiXpub v2 taproot descriptor addresses change=1",
+			r:           newGetRequest(ts.URL + "/api/v2/xpub/" + url.QueryEscape(dbtestdata.TaprootDescriptor) + "/addresses?change=1&from=1&to=3"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"address":"tb1p0pnd6ue5vryymvd28aeq3kdz6rmsdjqrq6eespgtg8wdgnxjzjksujhq4u","path":"m/86'/1'/0'/1/1","used":false},{"address":"tb1p29gpmd96hhgf7wj2vs03ca7x2xx39g8t6e0p55h2d5ssqs4fsj8qtx00wc","path":"m/86'/1'/0'/1/2","used":false}]`,
+			},
+		},
+		{
+			name:        "apiXpub v2 addresses change not in descriptor",
+			r:           newGetRequest(ts.URL + "/api/v2/xpub/" + url.QueryEscape(dbtestdata.TaprootDescriptor) + "/addresses?change=2"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Change 2 is not part of the xpub descriptor"}`,
+			},
+		},
+		{
+			name:        "apiXpub v2 next-unused",
+			r:           newGetRequest(ts.URL + "/api/v2/xpub/" + dbtestdata.Xpub + "/next-unused"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"address":"2MsYfbi6ZdVXLDNrYAQ11ja9Sd3otMk4Pmj","path":"m/49'/1'/33'/0/1","used":false}`,
+			},
+		},
+		{
+			name:        "apiXpub v2 taproot descriptor next-unused change=1",
+			r:           newGetRequest(ts.URL + "/api/v2/xpub/" + url.QueryEscape(dbtestdata.TaprootDescriptor) + "/next-unused?change=1"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"address":"tb1pn2d0yjeedavnkd8z8lhm566p0f2utm3lgvxrsdehnl94y34txmts5s7t4c","path":"m/86'/1'/0'/1/0","used":false}`,
+			},
+		},
+		{
+			name:        "apiXpub v2 psbt",
+			r:           newPostRequest(ts.URL+"/api/v2/xpub/"+dbtestdata.Xpub+"/psbt", `{"outputs":[{"address":"`+dbtestdata.Addr1+`","value":"100000000"}],"feeRate":2}`),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"inputs":[{"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","vout":0,"value":"118641975500","height":225494,"confirmations":1,"address":"2N6utyMZfPNUb1Bk8oz7p2JqJrXkq83gegu","path":"m/49'/1'/33'/1/3"}]`,
+				`"changeValue":"118541975165","fee":"335","vsize":168,"coinSelection":"largest-first"}`,
+			},
+		},
+		{
+			name:        "apiXpub v2 psbt insufficient funds",
+			r:           newPostRequest(ts.URL+"/api/v2/xpub/"+dbtestdata.Xpub+"/psbt", `{"outputs":[{"address":"`+dbtestdata.Addr1+`","value":"118641975500"}],"feeRate":2}`),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Insufficient funds"}`,
+			},
+		},
+		{
+			name:        "apiXpub v2 psbt missing outputs",
+			r:           newPostRequest(ts.URL+"/api/v2/xpub/"+dbtestdata.Xpub+"/psbt", `{"feeRate":2}`),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Missing outputs"}`,
+			},
+		},
+		{
+			name:        "apiXpub v2 psbt GET",
+			r:           newGetRequest(ts.URL + "/api/v2/xpub/" + dbtestdata.Xpub + "/psbt"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"PSBT must be requested using POST method"}`,
+			},
+		},
+		{
+			name:        "apiXpub v2 psbt taproot descriptor",
+			r:           newPostRequest(ts.URL+"/api/v2/xpub/"+url.QueryEscape(dbtestdata.TaprootDescriptor)+"/psbt", `{"outputs":[{"address":"`+dbtestdata.Addr1+`","value":"1000"}],"feeRate":2}`),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"PSBT is not supported for this type of xpub descriptor"}`,
+			},
+		},
 		{
 			name:        "apiXpub v2 details=basic",
 			r:           newGetRequest(ts.URL + "/api/v2/xpub/" + dbtestdata.Xpub + "?details=basic"),
@@ -919,6 +1010,143 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 				`{"error":"Missing tx blob"}`,
 			},
 		},
+		{
+			name:        "apiSendTx POST rejected",
+			r:           newPostRequest(ts.URL+"/api/v2/sendtx/", "01000000017f9a22c9cbf54bd902400df746f138f37bcf5b4d93eb755820e974ba43ed5f42040000006a4730440220037f4ed5427cde81d55b9b6a2fd08c8a25090c2c2fff3a75c1a57625ca8a7118022076c702fe55969fa08137f71afd4851c48e31082dd3c40c919c92cdbc826758d30121029f6da5623c9f9b68a9baf9c1bc7511df88fa34c6c2f71f7c62f2f03ff48dca80feffffff019c9700000000000017a9146144d57c8aff48492c9dfb914e120b20bad72d6f8773d00700"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Input spends unknown output 425fed43ba74e9205875eb934d5bcf7bf338f146f70d4002d94bf5cbc9229a7f:4","code":"missingInputs"}`,
+			},
+		},
+		{
+			name:        "apiSendTx POST dryRun",
+			r:           newPostRequest(ts.URL+"/api/v2/sendtx/?dryRun=true", "01000000017f9a22c9cbf54bd902400df746f138f37bcf5b4d93eb755820e974ba43ed5f42040000006a4730440220037f4ed5427cde81d55b9b6a2fd08c8a25090c2c2fff3a75c1a57625ca8a7118022076c702fe55969fa08137f71afd4851c48e31082dd3c40c919c92cdbc826758d30121029f6da5623c9f9b68a9baf9c1bc7511df88fa34c6c2f71f7c62f2f03ff48dca80feffffff019c9700000000000017a9146144d57c8aff48492c9dfb914e120b20bad72d6f8773d00700"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"txid":"056e3d82e5ffd0e915fb9b62797d76263508c34fe3e5dbed30dd3e943930f204","allowed":false,"testedByBackend":false,"vsize":189,"errors":[{"code":"missingInputs","message":"Input spends unknown output 425fed43ba74e9205875eb934d5bcf7bf338f146f70d4002d94bf5cbc9229a7f:4"}]}`,
+			},
+		},
+		{
+			name:        "apiBroadcast",
+			r:           newGetRequest(ts.URL + "/api/v2/broadcasts/9876"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"txid":"9876","status":"pending","sentTime":`,
+				`"rebroadcasts":0}`,
+			},
+		},
+		{
+			name:        "apiBroadcast not found",
+			r:           newGetRequest(ts.URL + "/api/v2/broadcasts/056e3d82e5ffd0e915fb9b62797d76263508c34fe3e5dbed30dd3e943930f204"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Broadcast of transaction 056e3d82e5ffd0e915fb9b62797d76263508c34fe3e5dbed30dd3e943930f204 not found"}`,
+			},
+		},
+		{
+			name:        "apiBroadcast invalid txid",
+			r:           newGetRequest(ts.URL + "/api/v2/broadcasts/xyz"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Invalid txid"}`,
+			},
+		},
+		{
+			name:        "apiTxMerkleProof",
+			r:           newGetRequest(ts.URL + "/api/v2/tx/effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75/merkle-proof"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","blockHash":"0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997","blockHeight":225493,"pos":1,"merkle":["00b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa3840"],"merkleRoot":"4b9b8d2d53bd6d364a8a7b7040cc524e89f0ddc599c35507c0412881d9770679","hex":"00000020c2d1b5638f2e9a0a6e5b4a8cbdd07f0c2a2a6a2abd146f8f0e00000000000000790677d9812841c00755c399c5ddf0894e52cc40707b8a4a366dbd532d8d9b4b127ab05affff001d812c9f7d02000000024038aa0cd9e504179b284ffaa791431010e3fd8141bd829c0ee9e55560c0b20075acb49486d6bb2240fdbef2a421f5fb8e4c43bff58a1c6b533d3809f59efdef0105"}`,
+			},
+		},
+		{
+			name:        "apiTxMerkleProof not found",
+			r:           newGetRequest(ts.URL + "/api/v2/tx/1234567890123456789012345678901234567890123456789012345678901234/merkle-proof"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Transaction 1234567890123456789012345678901234567890123456789012345678901234 not found"}`,
+			},
+		},
+		{
+			name:        "apiVerifyMerkleProof POST unknown block",
+			r:           newPostRequest(ts.URL+"/api/v2/verify-merkle-proof/", "0100000055bd840a78798ad0da853f68974f3d183e2bd1db6a842c1feecf222a00000000ff104ccb05421ab93e63f8c3ce5c2c2e9dbb37de2764b3a3175c8166562cac7d51b96a49ffff001d283e9e70020000000282501c1178fa0b222c1f3d474ec726b832013f0a532b44bb620cce8624a5feb1169e1e83e930853391bc6f35f605c6754cfead57cf8387639d3b4096c54f18f40105"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"valid":false,"blockHash":"00000000d1145790a8694403d4063f323d499e655c83426834d4ce2f8dd4a2ee","txids":["f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"],"positions":[1],"error":"Block 00000000d1145790a8694403d4063f323d499e655c83426834d4ce2f8dd4a2ee not found"}`,
+			},
+		},
+		{
+			name:        "apiVerifyMerkleProof invalid",
+			r:           newGetRequest(ts.URL + "/api/v2/verify-merkle-proof/0100"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Cannot parse proof, Unexpected end of data"}`,
+			},
+		},
+		{
+			name:        "apiBlockHeaders",
+			r:           newGetRequest(ts.URL + "/api/v2/headers?from=225493&count=3"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"from":225493,"count":2,"headers":["00000020c2d1b5638f2e9a0a6e5b4a8cbdd07f0c2a2a6a2abd146f8f0e00000000000000790677d9812841c00755c399c5ddf0894e52cc40707b8a4a366dbd532d8d9b4b127ab05affff001d812c9f7d","0000002097294ee985ad46f74c449d9c4e98aa5ba36a85180e5bd70fd9befb760000000083343d58b1ba9eb96d94a2abeeb73882fc25c12ab6d5002d76c2bb5d7356b58c1eb5b15affff001de1447139"]}`,
+			},
+		},
+		{
+			name:        "apiBlockHeaders binary",
+			r:           newGetRequest(ts.URL + "/api/v2/headers?from=225494&count=1&format=binary"),
+			status:      http.StatusOK,
+			contentType: "application/octet-stream",
+			body: []string{
+				"\x00\x00\x00\x20\x97\x29\x4e\xe9\x85\xad\x46\xf7",
+			},
+		},
+		{
+			name:        "apiBlockHeaders above best block",
+			r:           newGetRequest(ts.URL + "/api/v2/headers?from=225495&count=1"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Block 225495 is above the best block 225494"}`,
+			},
+		},
+		{
+			name:        "apiBlockHeaders missing count",
+			r:           newGetRequest(ts.URL + "/api/v2/headers?from=225493"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Parameter 'count' is not a valid number"}`,
+			},
+		},
+		{
+			name:        "apiDecodeTx POST",
+			r:           newPostRequest(ts.URL+"/api/v2/decodetx/", "01000000017f9a22c9cbf54bd902400df746f138f37bcf5b4d93eb755820e974ba43ed5f42040000006a4730440220037f4ed5427cde81d55b9b6a2fd08c8a25090c2c2fff3a75c1a57625ca8a7118022076c702fe55969fa08137f71afd4851c48e31082dd3c40c919c92cdbc826758d30121029f6da5623c9f9b68a9baf9c1bc7511df88fa34c6c2f71f7c62f2f03ff48dca80feffffff019c9700000000000017a9146144d57c8aff48492c9dfb914e120b20bad72d6f8773d00700"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"txid":"056e3d82e5ffd0e915fb9b62797d76263508c34fe3e5dbed30dd3e943930f204","version":1,"lockTime":512115,`,
+				`"vsize":189,"feePerKb":0,"problems":[{"type":"missingInput","message":"Input spends unknown output 425fed43ba74e9205875eb934d5bcf7bf338f146f70d4002d94bf5cbc9229a7f:4","vin":0}]}`,
+			},
+		},
+		{
+			name:        "apiDecodeTx invalid hex",
+			r:           newGetRequest(ts.URL + "/api/v2/decodetx/12345"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Invalid transaction hex"}`,
+			},
+		},
 		{
 			name:        "apiEstimateFee",
 			r:           newGetRequest(ts.URL + "/api/estimatefee/123?conservative=false"),
@@ -1508,6 +1736,38 @@ func websocketTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 			},
 			want: `{"id":"39","data":{"subscribed":false,"message":"unsubscribeNewTransaction not enabled, use -enablesubnewtx flag to enable."}}`,
 		},
+		{
+			name: "websocket getAccountAddresses",
+			req: websocketReq{
+				Method: "getAccountAddresses",
+				Params: map[string]interface{}{
+					"descriptor": dbtestdata.Xpub,
+					"to":         2,
+				},
+			},
+			want: `{"id":"40","data":[{"address":"2MzmAKayJmja784jyHvRUW1bXPget1csRRG","path":"m/49'/1'/33'/0/0","used":true},{"address":"2MsYfbi6ZdVXLDNrYAQ11ja9Sd3otMk4Pmj","path":"m/49'/1'/33'/0/1","used":false}]}`,
+		},
+		{
+			name: "websocket getAccountNextUnusedAddress",
+			req: websocketReq{
+				Method: "getAccountNextUnusedAddress",
+				Params: map[string]interface{}{
+					"descriptor": dbtestdata.Xpub,
+				},
+			},
+			want: `{"id":"41","data":{"address":"2MsYfbi6ZdVXLDNrYAQ11ja9Sd3otMk4Pmj","path":"m/49'/1'/33'/0/1","used":false}}`,
+		},
+		{
+			name: "websocket sendTransaction dryRun",
+			req: websocketReq{
+				Method: "sendTransaction",
+				Params: map[string]interface{}{
+					"hex":    "123456",
+					"dryRun": true,
+				},
+			},
+			want: `{"id":"42","data":{"allowed":false,"testedByBackend":false,"errors":[{"code":"invalid","message":"Cannot parse transaction, unexpected EOF"}]}}`,
+		},
 	}
 
 	// send all requests at once
@@ -155,6 +155,7 @@ var onMessageHandlers = map[string]func(*SocketIoServer, json.RawMessage) (inter
 type resultError struct {
 	Error struct {
 		Message string `json:"message"`
+		Code    string `json:"code,omitempty"`
 	} `json:"error"`
 }
 
@@ -661,6 +662,7 @@ func (s *SocketIoServer) getMempoolEntry(txid string) (res resultGetMempoolEntry
 
 // onSubscribe expects two event subscriptions based on the req parameter (including the doublequotes):
 // "bitcoind/hashblock"
+// "bitcoind/reorg"
 // "bitcoind/addresstxid",["2MzTmvPJLZaLzD9XdN3jMtQA5NexC3rAPww","2NAZRJKr63tSdcTxTN3WaE9ZNDyXy6PgGuv"]
 func (s *SocketIoServer) onSubscribe(c *gosocketio.Channel, req []byte) interface{} {
 	defer func() {
@@ -706,8 +708,8 @@ func (s *SocketIoServer) onSubscribe(c *gosocketio.Channel, req []byte) interfac
 		}
 	} else {
 		sc = r[1 : len(r)-1]
-		if sc != "bitcoind/hashblock" {
-			onError(c.Id(), sc, "invalid data", "expecting bitcoind/hashblock, req: "+r)
+		if sc != "bitcoind/hashblock" && sc != "bitcoind/reorg" {
+			onError(c.Id(), sc, "invalid data", "expecting bitcoind/hashblock or bitcoind/reorg, req: "+r)
 			return nil
 		}
 		c.Join(sc)
@@ -726,6 +728,16 @@ func (s *SocketIoServer) OnNewBlockHash(hash string) {
 	go s.onNewBlockHashAsync(hash)
 }
 
+func (s *SocketIoServer) onReorgAsync(reorg *bchain.Reorg) {
+	c := s.server.BroadcastTo("bitcoind/reorg", "bitcoind/reorg", s.api.GetReorg(reorg))
+	glog.Info("broadcasting reorg at height ", reorg.ForkHeight, " to ", c, " channels")
+}
+
+// OnReorg notifies users subscribed to bitcoind/reorg about chain reorganization
+func (s *SocketIoServer) OnReorg(reorg *bchain.Reorg) {
+	go s.onReorgAsync(reorg)
+}
+
 // OnNewTxAddr notifies users subscribed to bitcoind/addresstxid about new block
 func (s *SocketIoServer) OnNewTxAddr(txid string, desc bchain.AddressDescriptor) {
 	addr, searchable, err := s.chainParser.GetAddressesFromAddrDesc(desc)
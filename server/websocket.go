@@ -71,6 +71,8 @@ type WebsocketServer struct {
 	block0hash                      string
 	newBlockSubscriptions           map[*websocketChannel]string
 	newBlockSubscriptionsLock       sync.Mutex
+	reorgSubscriptions              map[*websocketChannel]string
+	reorgSubscriptionsLock          sync.Mutex
 	newTransactionEnabled           bool
 	newTransactionSubscriptions     map[*websocketChannel]string
 	newTransactionSubscriptionsLock sync.Mutex
@@ -106,6 +108,7 @@ func NewWebsocketServer(db *db.RocksDB, chain bchain.BlockChain, mempool bchain.
 		api:                         api,
 		block0hash:                  b0,
 		newBlockSubscriptions:       make(map[*websocketChannel]string),
+		reorgSubscriptions:          make(map[*websocketChannel]string),
 		newTransactionEnabled:       enableSubNewTx,
 		newTransactionSubscriptions: make(map[*websocketChannel]string),
 		addressSubscriptions:        make(map[string]map[*websocketChannel]string),
@@ -257,6 +260,7 @@ func (s *WebsocketServer) onConnect(c *websocketChannel) {
 
 func (s *WebsocketServer) onDisconnect(c *websocketChannel) {
 	s.unsubscribeNewBlock(c)
+	s.unsubscribeReorgs(c)
 	s.unsubscribeNewTransaction(c)
 	s.unsubscribeAddresses(c)
 	s.unsubscribeFiatRates(c)
@@ -295,6 +299,34 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *webs
 		}
 		return
 	},
+	"getAccountAddresses": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		r := struct {
+			Descriptor string `json:"descriptor"`
+			Change     int    `json:"change"`
+			From       uint32 `json:"from"`
+			To         uint32 `json:"to"`
+		}{Change: -1}
+		err = json.Unmarshal(req.Params, &r)
+		if err == nil {
+			if r.To == 0 {
+				r.To = r.From + defaultXpubAddresses
+			}
+			rv, err = s.api.GetXpubAddresses(r.Descriptor, r.Change, r.From, r.To)
+		}
+		return
+	},
+	"getAccountNextUnusedAddress": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		r := struct {
+			Descriptor string `json:"descriptor"`
+			Change     int    `json:"change"`
+			Gap        int    `json:"gap"`
+		}{Change: -1}
+		err = json.Unmarshal(req.Params, &r)
+		if err == nil {
+			rv, err = s.api.GetXpubNextUnusedAddress(r.Descriptor, r.Change, r.Gap)
+		}
+		return
+	},
 	"getBalanceHistory": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		r := struct {
 			Descriptor string   `json:"descriptor"`
@@ -347,11 +379,16 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *webs
 	},
 	"sendTransaction": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		r := struct {
-			Hex string `json:"hex"`
+			Hex    string `json:"hex"`
+			DryRun bool   `json:"dryRun"`
 		}{}
 		err = json.Unmarshal(req.Params, &r)
 		if err == nil {
-			rv, err = s.sendTransaction(r.Hex)
+			if r.DryRun {
+				rv, err = s.api.ValidateTransaction(r.Hex)
+			} else {
+				rv, err = s.sendTransaction(r.Hex)
+			}
 		}
 		return
 	},
@@ -361,6 +398,12 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *webs
 	"unsubscribeNewBlock": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		return s.unsubscribeNewBlock(c)
 	},
+	"subscribeReorgs": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		return s.subscribeReorgs(c, req)
+	},
+	"unsubscribeReorgs": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
+		return s.unsubscribeReorgs(c)
+	},
 	"subscribeNewTransaction": func(s *WebsocketServer, c *websocketChannel, req *websocketReq) (rv interface{}, err error) {
 		return s.subscribeNewTransaction(c, req)
 	},
@@ -463,6 +506,9 @@ func (s *WebsocketServer) onRequest(c *websocketChannel, req *websocketReq) {
 			s.metrics.WebsocketRequests.With(common.Labels{"method": req.Method, "status": "failure"}).Inc()
 			e := resultError{}
 			e.Error.Message = err.Error()
+			if apiErr, ok := err.(*api.APIError); ok {
+				e.Error.Code = apiErr.Code
+			}
 			data = e
 		}
 	} else {
@@ -669,7 +715,7 @@ func (s *WebsocketServer) estimateFee(c *websocketChannel, params []byte) (inter
 }
 
 func (s *WebsocketServer) sendTransaction(tx string) (res resultSendTransaction, err error) {
-	txid, err := s.chain.SendRawTransaction(tx)
+	txid, err := s.api.SendTransaction(tx)
 	if err != nil {
 		return res, err
 	}
@@ -701,6 +747,22 @@ func (s *WebsocketServer) unsubscribeNewBlock(c *websocketChannel) (res interfac
 	return &subscriptionResponse{false}, nil
 }
 
+func (s *WebsocketServer) subscribeReorgs(c *websocketChannel, req *websocketReq) (res interface{}, err error) {
+	s.reorgSubscriptionsLock.Lock()
+	defer s.reorgSubscriptionsLock.Unlock()
+	s.reorgSubscriptions[c] = req.ID
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeReorgs"})).Set(float64(len(s.reorgSubscriptions)))
+	return &subscriptionResponse{true}, nil
+}
+
+func (s *WebsocketServer) unsubscribeReorgs(c *websocketChannel) (res interface{}, err error) {
+	s.reorgSubscriptionsLock.Lock()
+	defer s.reorgSubscriptionsLock.Unlock()
+	delete(s.reorgSubscriptions, c)
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeReorgs"})).Set(float64(len(s.reorgSubscriptions)))
+	return &subscriptionResponse{false}, nil
+}
+
 func (s *WebsocketServer) subscribeNewTransaction(c *websocketChannel, req *websocketReq) (res interface{}, err error) {
 	s.newTransactionSubscriptionsLock.Lock()
 	defer s.newTransactionSubscriptionsLock.Unlock()
@@ -853,6 +915,58 @@ func (s *WebsocketServer) OnNewBlock(hash string, height uint32) {
 	go s.onNewBlockAsync(hash, height)
 }
 
+func (s *WebsocketServer) onReorgAsync(reorg *bchain.Reorg) {
+	r := s.api.GetReorg(reorg)
+	s.reorgSubscriptionsLock.Lock()
+	for c, id := range s.reorgSubscriptions {
+		c.DataOut(&websocketRes{
+			ID:   id,
+			Data: r,
+		})
+	}
+	glog.Info("broadcasting reorg at height ", reorg.ForkHeight, " to ", len(s.reorgSubscriptions), " channels")
+	s.reorgSubscriptionsLock.Unlock()
+	// notify address subscribers about the transactions, which became unconfirmed
+	s.addressSubscriptionsLock.Lock()
+	defer s.addressSubscriptionsLock.Unlock()
+	for i := range reorg.Txs {
+		tx := &reorg.Txs[i]
+		if tx.Status == bchain.ReorgTxConfirmed {
+			continue
+		}
+		for _, addrDesc := range tx.AddrDescs {
+			as, ok := s.addressSubscriptions[string(addrDesc)]
+			if !ok || len(as) == 0 {
+				continue
+			}
+			addr, _, err := s.chainParser.GetAddressesFromAddrDesc(addrDesc)
+			if err != nil || len(addr) != 1 {
+				continue
+			}
+			data := struct {
+				Address string       `json:"address"`
+				ReorgTx *api.ReorgTx `json:"reorgTx"`
+			}{
+				Address: addr[0],
+				ReorgTx: &r.Txs[i],
+			}
+			for c, id := range as {
+				c.DataOut(&websocketRes{
+					ID:   id,
+					Data: &data,
+				})
+			}
+			glog.Info("broadcasting reorg tx ", tx.Txid, ", status ", tx.Status, ", addr ", addr[0], " to ", len(as), " channels")
+		}
+	}
+}
+
+// OnReorg is a callback that broadcasts info about chain reorganization to subscribed clients
+// and about the transactions, which became unconfirmed, to the subscribers of the affected addresses
+func (s *WebsocketServer) OnReorg(reorg *bchain.Reorg) {
+	go s.onReorgAsync(reorg)
+}
+
 func (s *WebsocketServer) sendOnNewTx(tx *api.Tx) {
 	s.newTransactionSubscriptionsLock.Lock()
 	defer s.newTransactionSubscriptionsLock.Unlock()
@@ -960,6 +1074,63 @@ func (s *WebsocketServer) OnNewTx(tx *bchain.MempoolTx) {
 	}
 }
 
+func (s *WebsocketServer) onTxRemovedAsync(removal *bchain.MempoolTxRemoval, subscribed []string) {
+	r := s.api.GetMempoolTxRemoval(removal)
+	s.newTransactionSubscriptionsLock.Lock()
+	data := struct {
+		RemovedTx *api.MempoolTxRemoval `json:"removedTx"`
+	}{
+		RemovedTx: r,
+	}
+	for c, id := range s.newTransactionSubscriptions {
+		c.DataOut(&websocketRes{
+			ID:   id,
+			Data: &data,
+		})
+	}
+	s.newTransactionSubscriptionsLock.Unlock()
+	for _, stringAddressDescriptor := range subscribed {
+		addr, _, err := s.chainParser.GetAddressesFromAddrDesc(bchain.AddressDescriptor(stringAddressDescriptor))
+		if err != nil || len(addr) != 1 {
+			continue
+		}
+		data := struct {
+			Address   string                `json:"address"`
+			RemovedTx *api.MempoolTxRemoval `json:"removedTx"`
+		}{
+			Address:   addr[0],
+			RemovedTx: r,
+		}
+		s.addressSubscriptionsLock.Lock()
+		for c, id := range s.addressSubscriptions[stringAddressDescriptor] {
+			c.DataOut(&websocketRes{
+				ID:   id,
+				Data: &data,
+			})
+		}
+		s.addressSubscriptionsLock.Unlock()
+	}
+	glog.Info("broadcasting removed tx ", removal.Txid, ", reason ", removal.Reason)
+}
+
+// OnTxRemoved is a callback that broadcasts info about a tx removed from mempool to new tx and affected address subscribers
+func (s *WebsocketServer) OnTxRemoved(removal *bchain.MempoolTxRemoval) {
+	var subscribed []string
+	s.addressSubscriptionsLock.Lock()
+	for _, addrDesc := range removal.AddrDescs {
+		if as, ok := s.addressSubscriptions[string(addrDesc)]; ok && len(as) > 0 {
+			subscribed = append(subscribed, string(addrDesc))
+		}
+	}
+	s.addressSubscriptionsLock.Unlock()
+	s.newTransactionSubscriptionsLock.Lock()
+	newTxSubscribed := len(s.newTransactionSubscriptions) > 0
+	s.newTransactionSubscriptionsLock.Unlock()
+	if newTxSubscribed || len(subscribed) > 0 {
+		go s.onTxRemovedAsync(removal, subscribed)
+	}
+}
+
 func (s *WebsocketServer) broadcastTicker(currency string, rates map[string]float64) {
 	as, ok := s.fiatRatesSubscriptions[currency]
 	if ok && len(as) > 0 {
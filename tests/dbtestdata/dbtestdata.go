@@ -63,6 +63,14 @@ func AddressToPubKeyHex(addr string, parser bchain.BlockChainParser) string {
 	return hex.EncodeToString(b)
 }
 
+func hexToBytes(h string) []byte {
+	b, err := hex.DecodeString(h)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	return b
+}
+
 // GetTestBitcoinTypeBlock1 returns block #1
 func GetTestBitcoinTypeBlock1(parser bchain.BlockChainParser) *bchain.Block {
 	return &bchain.Block{
@@ -73,6 +81,7 @@ func GetTestBitcoinTypeBlock1(parser bchain.BlockChainParser) *bchain.Block {
 			Time:          1521515026,
 			Confirmations: 2,
 		},
+		RawHeader: hexToBytes("00000020c2d1b5638f2e9a0a6e5b4a8cbdd07f0c2a2a6a2abd146f8f0e00000000000000790677d9812841c00755c399c5ddf0894e52cc40707b8a4a366dbd532d8d9b4b127ab05affff001d812c9f7d"),
 		Txs: []bchain.Tx{
 			{
 				Txid: TxidB1T1,
@@ -147,6 +156,7 @@ func GetTestBitcoinTypeBlock2(parser bchain.BlockChainParser) *bchain.Block {
 			Time:          1521595678,
 			Confirmations: 1,
 		},
+		RawHeader: hexToBytes("0000002097294ee985ad46f74c449d9c4e98aa5ba36a85180e5bd70fd9befb760000000083343d58b1ba9eb96d94a2abeeb73882fc25c12ab6d5002d76c2bb5d7356b58c1eb5b15affff001de1447139"),
 		Txs: []bchain.Tx{
 			{
 				Txid: TxidB2T1,
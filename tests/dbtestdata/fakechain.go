@@ -19,14 +19,14 @@ func NewFakeBlockChain(parser bchain.BlockChainParser) (bchain.BlockChain, error
 }
 
 func (c *fakeBlockChain) CreateMempool(chain bchain.BlockChain) (bchain.Mempool, error) {
-	return bchain.NewMempoolBitcoinType(chain, 1, 1), nil
+	return bchain.NewMempoolBitcoinType(chain, 1, 1, 0), nil
 }
 
 func (c *fakeBlockChain) Initialize() error {
 	return nil
 }
 
-func (c *fakeBlockChain) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOutpointFunc, onNewTxAddr bchain.OnNewTxAddrFunc, onNewTx bchain.OnNewTxFunc) error {
+func (c *fakeBlockChain) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOutpointFunc, onNewTxAddr bchain.OnNewTxAddrFunc, onNewTx bchain.OnNewTxFunc, onTxRemoved bchain.OnTxRemovedFunc) error {
 	return nil
 }
 
@@ -93,6 +93,18 @@ func (c *fakeBlockChain) GetBlockHeader(hash string) (v *bchain.BlockHeader, err
 	return nil, bchain.ErrBlockNotFound
 }
 
+func (c *fakeBlockChain) GetBlockHeaderRaw(hash string) (v []byte, err error) {
+	b1 := GetTestBitcoinTypeBlock1(c.Parser)
+	if hash == b1.BlockHeader.Hash {
+		return b1.RawHeader, nil
+	}
+	b2 := GetTestBitcoinTypeBlock2(c.Parser)
+	if hash == b2.BlockHeader.Hash {
+		return b2.RawHeader, nil
+	}
+	return nil, bchain.ErrBlockNotFound
+}
+
 func (c *fakeBlockChain) GetBlock(hash string, height uint32) (v *bchain.Block, err error) {
 	b1 := GetTestBitcoinTypeBlock1(c.Parser)
 	if hash == b1.BlockHeader.Hash || height == b1.BlockHeader.Height {
@@ -9,6 +9,10 @@ type fakeBlockChain struct {
 	returnFakes bool
 	fakeBlocks  map[uint32]BlockID
 	bestHeight  uint32
+	// blocks which are not returned by GetBlock, as if they were no longer available in the backend
+	unavailable map[string]struct{}
+	// transactions are not returned by GetTransaction
+	unavailableTxs bool
 }
 
 func (c *fakeBlockChain) GetBestBlockHash() (v string, err error) {
@@ -44,6 +48,9 @@ func (c *fakeBlockChain) GetBlock(hash string, height uint32) (*bchain.Block, er
 			}
 		}
 	}
+	if _, found := c.unavailable[hash]; found && hash != "" {
+		return nil, bchain.ErrBlockNotFound
+	}
 	b, err := c.BlockChain.GetBlock(hash, height)
 	if err != nil {
 		return nil, err
@@ -51,3 +58,10 @@ func (c *fakeBlockChain) GetBlock(hash string, height uint32) (*bchain.Block, er
 	b.Height = height
 	return b, nil
 }
+
+func (c *fakeBlockChain) GetTransaction(txid string) (*bchain.Tx, error) {
+	if c.unavailableTxs {
+		return nil, bchain.ErrTxNotFound
+	}
+	return c.BlockChain.GetTransaction(txid)
+}
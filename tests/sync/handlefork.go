@@ -15,6 +15,17 @@ import (
 )
 
 func testHandleFork(t *testing.T, h *TestHandler) {
+	testHandleForkOfDepth(t, h, false)
+}
+
+// testHandleDeepFork emulates a fork deeper than the number of blocks kept in the blockTxs column,
+// the data of the forked blocks must be reconstructed from the orphaned blocks fetched from the backend
+// or, if they are not available, from the transactions found in the index
+func testHandleDeepFork(t *testing.T, h *TestHandler) {
+	testHandleForkOfDepth(t, h, true)
+}
+
+func testHandleForkOfDepth(t *testing.T, h *TestHandler, deep bool) {
 	for _, rng := range h.TestData.HandleFork.SyncRanges {
 		withRocksDBAndSyncWorker(t, h, rng.Lower, func(d *db.RocksDB, sw *db.SyncWorker, ch chan os.Signal) {
 			fakeBlocks := getFakeBlocks(h, rng)
@@ -47,12 +58,43 @@ func testHandleFork(t *testing.T, h *TestHandler) {
 			chain.returnFakes = false
 
 			upperHash := fakeBlocks[len(fakeBlocks)-1].Hash
+			if deep {
+				for i := rng.Lower; i <= rng.Upper; i++ {
+					if err := db.RemoveBlockTxs(d, i); err != nil {
+						t.Fatal(err)
+					}
+				}
+				// the orphaned blocks not available in the backend are reconstructed from the transactions found in the index
+				chain.unavailable = make(map[string]struct{})
+				for i, b := range fakeBlocks {
+					if i%2 == 0 {
+						chain.unavailable[b.Hash] = struct{}{}
+					}
+				}
+				// the fork cannot be handled if also the transactions are not available, the index is not changed
+				chain.unavailableTxs = true
+				err := db.HandleFork(sw, rng.Upper, upperHash, func(hash string, height uint32) {}, nil, true)
+				if err == nil || !strings.Contains(err.Error(), "rebuild index") {
+					t.Fatalf("HandleFork() with unavailable transactions error = %v, want rebuild index error", err)
+				}
+				if height, hash, err := d.GetBestBlock(); err != nil || height != rng.Upper || hash != upperHash {
+					t.Fatalf("GetBestBlock() after failed HandleFork = %v, %v, %v", height, hash, err)
+				}
+				verifyTransactions2(t, d, rng, fakeAddr2txs, true)
+				chain.unavailableTxs = false
+			}
+
+			var reorg *bchain.Reorg
 			db.HandleFork(sw, rng.Upper, upperHash, func(hash string, height uint32) {
 				if hash == upperHash {
 					close(ch)
 				}
+			}, func(r *bchain.Reorg) {
+				reorg = r
 			}, true)
 
+			verifyReorg(t, reorg, upperHash, fakeTxs)
+
 			realBlocks := getRealBlocks(h, rng)
 			realTxs, err := getTxs(h, d, rng, realBlocks)
 			if err != nil {
@@ -67,6 +109,29 @@ func testHandleFork(t *testing.T, h *TestHandler) {
 	}
 }
 
+func verifyReorg(t *testing.T, reorg *bchain.Reorg, upperHash string, fakeTxs []bchain.Tx) {
+	if reorg == nil {
+		t.Fatal("Reorg notification not received")
+	}
+	if len(reorg.DisconnectedHashes) == 0 || reorg.DisconnectedHashes[0] != upperHash {
+		t.Errorf("Reorg disconnected hashes %v, expected to start with %s", reorg.DisconnectedHashes, upperHash)
+	}
+	reorgTxs := make(map[string]bchain.ReorgTx, len(reorg.Txs))
+	for _, tx := range reorg.Txs {
+		reorgTxs[tx.Txid] = tx
+	}
+	for _, tx := range fakeTxs {
+		rtx, found := reorgTxs[tx.Txid]
+		if !found {
+			t.Errorf("Tx %s: not found in reorg notification", tx.Txid)
+			continue
+		}
+		if rtx.Status == "" {
+			t.Errorf("Tx %s: status of reorg tx not resolved", tx.Txid)
+		}
+	}
+}
+
 func verifyAddresses2(t *testing.T, d *db.RocksDB, chain bchain.BlockChain, blks []BlockID) {
 	parser := chain.GetChainParser()
 
@@ -19,6 +19,7 @@ var testMap = map[string]func(t *testing.T, th *TestHandler){
 	"ConnectBlocks":         testConnectBlocks,
 	"ConnectBlocksParallel": testConnectBlocksParallel,
 	"HandleFork":            testHandleFork,
+	"HandleDeepFork":        testHandleDeepFork,
 }
 
 type TestHandler struct {